@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+// ec2AMIOptionsFor 在内置镜像和“自定义”之间插入用户在当前区域保存的 AMI 预设。
+func ec2AMIOptionsFor(presets []store.AMIPreset) []Option {
+	out := make([]Option, 0, len(ec2AMIOptions)+len(presets))
+	for _, o := range ec2AMIOptions {
+		if o.ID == "custom" {
+			for _, p := range presets {
+				out = append(out, Option{ID: p.AMIID, Name: "★ " + p.Name + " (" + p.AMIID + ")"})
+			}
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+func registerAMIPresetRoutes(r *gin.Engine) {
+	r.POST("/aws/ami-presets", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		region := normalizeRegion(firstNonEmpty(c.PostForm("region"), s.GetString("region", "us-east-1")))
+		back := "/?tab=create&service=ec2&region=" + url.QueryEscape(region)
+		keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+		activeKey, _ := resolveActiveKey(s, keys)
+		if activeKey == nil || strings.TrimSpace(activeKey.AccessKey) == "" || strings.TrimSpace(activeKey.SecretKey) == "" {
+			c.Redirect(http.StatusFound, back+"&msg=needuse")
+			return
+		}
+		cli, err := aws.NewEC2Client(c.Request.Context(), region, strings.TrimSpace(activeKey.AccessKey), strings.TrimSpace(activeKey.SecretKey), strings.TrimSpace(activeKey.Proxy))
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, back+"&msg=err_client")
+			return
+		}
+		info, err := aws.DescribeAMI(c.Request.Context(), cli, c.PostForm("ami_id"))
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, back+"&msg=preset_invalid&err="+url.QueryEscape(formatFlashError(err)))
+			return
+		}
+		p := &store.AMIPreset{
+			UserID:       userID,
+			Region:       region,
+			Name:         firstNonEmpty(c.PostForm("name"), info.Name),
+			AMIID:        info.ID,
+			Architecture: info.Architecture,
+		}
+		if err := appStore.CreateAMIPreset(c.Request.Context(), p); err != nil {
+			if errors.Is(err, store.ErrPresetExists) {
+				c.Redirect(http.StatusFound, back+"&msg=preset_exists")
+				return
+			}
+			auditError(c, err)
+			c.Redirect(http.StatusFound, back+"&msg=preset_failed")
+			return
+		}
+		s.SetString("create_ec2_ami", p.AMIID)
+		c.Redirect(http.StatusFound, back+"&msg=preset_saved")
+	})
+
+	r.POST("/aws/ami-presets/delete", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		back := "/?tab=create&service=ec2&region=" + url.QueryEscape(normalizeRegion(firstNonEmpty(c.PostForm("region"), s.GetString("region", "us-east-1"))))
+		id, err := strconv.ParseInt(strings.TrimSpace(c.PostForm("preset_id")), 10, 64)
+		if err != nil {
+			c.Redirect(http.StatusFound, back)
+			return
+		}
+		if err := appStore.DeleteAMIPreset(c.Request.Context(), userID, id); err != nil && !errors.Is(err, store.ErrPresetNotFound) {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, back+"&msg=preset_failed")
+			return
+		}
+		c.Redirect(http.StatusFound, back+"&msg=preset_deleted")
+	})
+}
+
+type apiAMIPreset struct {
+	ID           int64     `json:"id"`
+	Region       string    `json:"region"`
+	Name         string    `json:"name"`
+	AMIID        string    `json:"ami_id"`
+	Architecture string    `json:"architecture"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type apiAMIPresetInput struct {
+	Region string `json:"region"`
+	Name   string `json:"name"`
+	AMIID  string `json:"ami_id" binding:"required"`
+}
+
+func toAPIAMIPreset(p *store.AMIPreset) apiAMIPreset {
+	return apiAMIPreset{ID: p.ID, Region: p.Region, Name: p.Name, AMIID: p.AMIID, Architecture: p.Architecture, CreatedAt: p.CreatedAt}
+}
+
+func apiListAMIPresets(c *gin.Context) {
+	region := ""
+	if strings.TrimSpace(c.Query("region")) != "" {
+		region = normalizeRegion(c.Query("region"))
+	}
+	list, err := appStore.ListAMIPresets(c.Request.Context(), apiUserID(c), region)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取 AMI 预设失败")
+		return
+	}
+	out := make([]apiAMIPreset, 0, len(list))
+	for i := range list {
+		out = append(out, toAPIAMIPreset(&list[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateAMIPreset(c *gin.Context) {
+	var in apiAMIPresetInput
+	if !apiBind(c, &in) {
+		return
+	}
+	region := apiRegion(c, in.Region)
+	cli, _, ok := apiEC2Client(c, region)
+	if !ok {
+		return
+	}
+	info, err := aws.DescribeAMI(c.Request.Context(), cli, in.AMIID)
+	if err != nil {
+		if errors.Is(err, aws.ErrInvalidAMI) {
+			apiFail(c, http.StatusBadRequest, "invalid_ami", err.Error())
+			return
+		}
+		apiAWSFail(c, err)
+		return
+	}
+	p := &store.AMIPreset{
+		UserID:       apiUserID(c),
+		Region:       region,
+		Name:         firstNonEmpty(in.Name, info.Name),
+		AMIID:        info.ID,
+		Architecture: info.Architecture,
+	}
+	if err := appStore.CreateAMIPreset(c.Request.Context(), p); err != nil {
+		if errors.Is(err, store.ErrPresetExists) {
+			apiFail(c, http.StatusConflict, "preset_exists", "该区域已保存过这个 AMI")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "保存 AMI 预设失败")
+		return
+	}
+	c.JSON(http.StatusCreated, toAPIAMIPreset(p))
+}
+
+func apiDeleteAMIPreset(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "预设 ID 无效")
+		return
+	}
+	if err := appStore.DeleteAMIPreset(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, store.ErrPresetNotFound) {
+			apiFail(c, http.StatusNotFound, "preset_not_found", "AMI 预设不存在")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "删除 AMI 预设失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
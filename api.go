@@ -0,0 +1,1021 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+const apiPrefix = "/api/v1"
+
+// apiError 是 /api/v1 统一的错误结构；AWS 返回的错误会带上 aws_code。
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	AWSCode string `json:"aws_code,omitempty"`
+}
+
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type apiMe struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	IsAdmin   bool   `json:"is_admin"`
+	CSRFToken string `json:"csrf_token"`
+}
+
+type apiKeyView struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	AccessKey   string    `json:"access_key"`
+	Proxy       string    `json:"proxy"`
+	Active      bool      `json:"active"`
+	QuotaRegion string    `json:"quota_region,omitempty"`
+	QuotaOn     string    `json:"quota_on_demand,omitempty"`
+	QuotaSpot   string    `json:"quota_spot,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type apiKeyInput struct {
+	Name      string  `json:"name"`
+	AccessKey string  `json:"access_key"`
+	SecretKey string  `json:"secret_key"`
+	Proxy     *string `json:"proxy"` // 更新时省略表示不修改，"" 表示清除代理
+}
+
+type apiCatalog struct {
+	IPTypes []Option `json:"ip_types"`
+	EC2AMIs []Option `json:"ec2_amis"`
+}
+
+type apiCreateLightsailRequest struct {
+	Region       string `json:"region"`
+	AZ           string `json:"az"`
+	BlueprintID  string `json:"blueprint_id" binding:"required"`
+	BundleID     string `json:"bundle_id" binding:"required"`
+	IPType       string `json:"ip_type,omitempty"`
+	OpenAllPorts bool   `json:"open_all_ports,omitempty"`
+	// FirewallProfileID 指定时创建后应用该防火墙模板，优先于 open_all_ports
+	FirewallProfileID int64 `json:"firewall_profile_id,omitempty"`
+	// SSHKeyID 为已保存的 SSH 公钥，会导入为区域内的密钥对；不指定时使用区域默认密钥对
+	SSHKeyID int64 `json:"ssh_key_id,omitempty"`
+	// RootPassword 非空时开启 root 密码登录，默认只允许密钥登录
+	RootPassword string `json:"root_password,omitempty"`
+	// DiskSizeGB 非 0 时附加一块块存储磁盘，实例就绪后由后台任务创建并挂载到 disk_mount_point（默认 /data）
+	DiskSizeGB     int32  `json:"disk_size_gb,omitempty"`
+	DiskMountPoint string `json:"disk_mount_point,omitempty"`
+}
+
+type apiCreateEC2Request struct {
+	Region       string `json:"region"`
+	AMI          string `json:"ami" binding:"required"` // 内置镜像名（如 ubuntu-24.04）或 ami- 开头的 ID
+	InstanceType string `json:"instance_type" binding:"required"`
+	AZ           string `json:"az,omitempty"` // 可用区，例如 us-east-1a 或 a；默认由 AWS 选择
+	Count        int32  `json:"count,omitempty"`
+	IPv6         bool   `json:"ipv6,omitempty"`
+	SSHKeyID     int64  `json:"ssh_key_id,omitempty"`    // 已保存的 SSH 公钥，会导入为区域内的密钥对；与 root_password 至少提供一个
+	RootPassword string `json:"root_password,omitempty"` // 非空时开启 root 密码登录
+}
+
+type apiCreated struct {
+	Service string `json:"service"`
+	Region  string `json:"region"`
+	Name    string `json:"name"`
+	// JobID 为附加磁盘的后台任务
+	JobID int64 `json:"job_id,omitempty"`
+}
+
+type apiActionResult struct {
+	Action string `json:"action"`
+	Region string `json:"region"`
+	Target string `json:"target"`
+}
+
+type apiQuotaResult struct {
+	Region       string `json:"region"`
+	OnDemand     string `json:"on_demand"`
+	Spot         string `json:"spot"`
+	OnDemandName string `json:"on_demand_name"`
+	SpotName     string `json:"spot_name"`
+}
+
+type apiProxyCheck struct {
+	IP  string `json:"ip"`
+	ASN string `json:"asn"`
+}
+
+type apiDeleted struct {
+	Deleted bool `json:"deleted"`
+}
+
+var (
+	apiRegionParam = apiParam{Name: "region", Description: "AWS 区域，默认使用会话中的区域"}
+	apiKeyParam    = apiParam{Name: "key_id", Description: "使用的密钥 ID，默认使用会话中启用的密钥"}
+)
+
+// apiRoutes 同时用于注册路由和生成 OpenAPI 文档。
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{Method: http.MethodGet, Path: "/me", ID: "getMe", Tag: "session", Summary: "当前用户与 CSRF token（token 认证时为空）", Result: apiMe{}, Handler: apiGetMe},
+
+		{Method: http.MethodGet, Path: "/keys", ID: "listKeys", Tag: "keys", Summary: "列出密钥", Result: []apiKeyView{}, Handler: apiListKeys},
+		{Method: http.MethodPost, Path: "/keys", ID: "createKey", Tag: "keys", Summary: "新增密钥", Body: apiKeyInput{}, Status: http.StatusCreated, Result: apiKeyView{}, Handler: apiCreateKey},
+		{Method: http.MethodPut, Path: "/keys/:id", ID: "updateKey", Tag: "keys", Summary: "更新密钥（留空的字段不修改，proxy 传空字符串表示清除代理）", Body: apiKeyInput{}, Result: apiKeyView{}, Handler: apiUpdateKey},
+		{Method: http.MethodDelete, Path: "/keys/:id", ID: "deleteKey", Tag: "keys", Summary: "删除密钥", Result: apiDeleted{}, Handler: apiDeleteKey},
+		{Method: http.MethodPost, Path: "/keys/:id/activate", ID: "activateKey", Tag: "keys", Summary: "在当前会话中启用密钥", Result: apiKeyView{}, Handler: apiActivateKey},
+
+		{Method: http.MethodGet, Path: "/tokens", ID: "listTokens", Tag: "tokens", Summary: "列出 API token", Result: []apiTokenView{}, Handler: apiListTokens},
+		{Method: http.MethodPost, Path: "/tokens", ID: "createToken", Tag: "tokens", Summary: "创建 API token（明文只返回这一次）", Body: apiTokenInput{}, Status: http.StatusCreated, Result: apiTokenCreated{}, Handler: apiCreateToken},
+		{Method: http.MethodDelete, Path: "/tokens/:id", ID: "revokeToken", Tag: "tokens", Summary: "吊销 API token", Result: apiDeleted{}, Handler: apiRevokeToken},
+
+		{Method: http.MethodGet, Path: "/sessions", ID: "listSessions", Tag: "session", Summary: "列出当前用户的登录会话", Result: []apiSessionView{}, Handler: apiListSessions},
+		{Method: http.MethodDelete, Path: "/sessions/:id", ID: "revokeSession", Tag: "session", Summary: "注销指定登录会话", Result: apiDeleted{}, Handler: apiRevokeSession},
+		{Method: http.MethodPost, Path: "/admin/users/:id/logout", ID: "logoutUser", Tag: "admin", Summary: "强制用户下线（管理员）", Result: apiLogoutResult{}, Handler: apiLogoutUser},
+
+		{Method: http.MethodGet, Path: "/regions", ID: "listRegions", Tag: "catalog", Summary: "可用区域（有密钥时按账号查询，含启用状态）", Query: []apiParam{{Name: "service", Description: "lightsail 或 ec2"}, apiKeyParam}, Result: []RegionOption{}, Handler: apiListRegions},
+		{Method: http.MethodGet, Path: "/zones", ID: "listZones", Tag: "catalog", Summary: "区域内当前账号可用的可用区", Query: []apiParam{{Name: "service", Description: "lightsail 或 ec2"}, apiRegionParam, apiKeyParam}, Result: []ZoneOption{}, Handler: apiListZones},
+		{Method: http.MethodGet, Path: "/catalog", ID: "getCatalog", Tag: "catalog", Summary: "创建实例可选的 IP 类型与 EC2 内置镜像", Result: apiCatalog{}, Handler: apiGetCatalog},
+
+		{Method: http.MethodGet, Path: "/lightsail/catalog", ID: "getLightsailCatalog", Tag: "lightsail", Summary: "区域内可用的 Lightsail 镜像与套餐（含对应的仅 IPv6 套餐）", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: aws.LightsailCatalog{}, Handler: apiGetLightsailCatalog},
+		{Method: http.MethodGet, Path: "/lightsail/instances", ID: "listLightsailInstances", Tag: "lightsail", Summary: "列出 Lightsail 实例", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: []aws.InstanceView{}, Handler: apiListLightsailInstances},
+		{Method: http.MethodPost, Path: "/lightsail/instances", ID: "createLightsailInstance", Tag: "lightsail", Summary: "创建 Lightsail 实例", Query: []apiParam{apiKeyParam}, Body: apiCreateLightsailRequest{}, Status: http.StatusCreated, Result: apiCreated{}, Handler: apiCreateLightsailInstance},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/reboot", ID: "rebootLightsailInstance", Tag: "lightsail", Summary: "重启 Lightsail 实例", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiActionResult{}, Handler: apiLightsailAction("reboot", func(ctx context.Context, cli aws.LightsailAPI, name string) error {
+			return aws.RebootInstance(ctx, cli, name)
+		})},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/start", ID: "startLightsailInstance", Tag: "lightsail", Summary: "启动 Lightsail 实例并等待进入 running（后台任务）", Query: []apiParam{apiRegionParam, apiKeyParam}, Status: http.StatusAccepted, Result: JobStatus{}, Handler: apiEnqueueLightsailJob(jobKindStart)},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/stop", ID: "stopLightsailInstance", Tag: "lightsail", Summary: "停止 Lightsail 实例并等待进入 stopped（后台任务）", Query: []apiParam{apiRegionParam, apiKeyParam, {Name: "force", Description: "true 时强制停止"}}, Status: http.StatusAccepted, Result: JobStatus{}, Handler: apiStopLightsailInstance},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/openall", ID: "openAllLightsailPorts", Tag: "lightsail", Summary: "开放 Lightsail 实例全部端口", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiActionResult{}, Handler: apiLightsailAction("openall", func(ctx context.Context, cli aws.LightsailAPI, name string) error {
+			return aws.OpenAllPorts(ctx, cli, name)
+		})},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/swapip", ID: "swapLightsailStaticIP", Tag: "lightsail", Summary: "更换静态 IP（后台任务）；指定 ports 或 check_url 时换到新地址可达为止", Query: []apiParam{apiRegionParam, apiKeyParam, {Name: "ports", Description: "逗号分隔的 TCP 端口，换 IP 后逐个探测"}, {Name: "check_url", Description: "外部检测地址，{ip}、{port} 替换为新地址和第一个端口，返回 2xx 视为可达"}, {Name: "max_attempts", Description: "最多更换次数，默认 3，最大 10；任务剩余时间不够再换一次时提前结束"}, {Name: "keep_old_minutes", Description: "大于 0 时旧静态 IP 只解绑不释放，保留期内可回滚，到期自动释放；最大 4320"}}, Status: http.StatusAccepted, Result: JobStatus{}, Handler: apiSwapLightsailStaticIP},
+		{Method: http.MethodGet, Path: "/lightsail/instances/:name/swap-attempts", ID: "listLightsailSwapAttempts", Tag: "lightsail", Summary: "最近换到过的静态 IP 及探测结果，新的在前", Query: []apiParam{apiRegionParam, {Name: "limit", Description: "返回条数，默认 50"}}, Result: []apiSwapAttempt{}, Handler: apiListSwapAttempts},
+		{Method: http.MethodDelete, Path: "/lightsail/instances/:name", ID: "deleteLightsailInstance", Tag: "lightsail", Summary: "删除 Lightsail 实例并释放静态 IP（后台任务）", Query: []apiParam{apiRegionParam, apiKeyParam}, Status: http.StatusAccepted, Result: JobStatus{}, Handler: apiEnqueueLightsailJob(jobKindDelete)},
+		{Method: http.MethodGet, Path: "/lightsail/disks", ID: "listLightsailDisks", Tag: "lightsail", Summary: "列出块存储磁盘（含挂载的实例与挂载点）", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: []aws.DiskView{}, Handler: apiListLightsailDisks},
+		{Method: http.MethodPost, Path: "/lightsail/disks", ID: "createLightsailDisk", Tag: "lightsail", Summary: "创建块存储磁盘", Query: []apiParam{apiRegionParam, apiKeyParam}, Body: apiCreateDiskRequest{}, Status: http.StatusCreated, Result: apiCreated{}, Handler: apiCreateLightsailDisk},
+		{Method: http.MethodPost, Path: "/lightsail/disks/:name/attach", ID: "attachLightsailDisk", Tag: "lightsail", Summary: "挂载磁盘到同一可用区的实例，返回在实例内执行的挂载命令", Query: []apiParam{apiRegionParam, apiKeyParam}, Body: apiAttachDiskRequest{}, Result: apiDiskAttached{}, Handler: apiAttachLightsailDisk},
+		{Method: http.MethodPost, Path: "/lightsail/disks/:name/detach", ID: "detachLightsailDisk", Tag: "lightsail", Summary: "从实例卸载磁盘（实例需已停止）", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiActionResult{}, Handler: apiDetachLightsailDisk},
+		{Method: http.MethodDelete, Path: "/lightsail/disks/:name", ID: "deleteLightsailDisk", Tag: "lightsail", Summary: "删除未挂载的磁盘", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiDeleted{}, Handler: apiDeleteLightsailDisk},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/dns", ID: "pointDNSAtLightsailInstance", Tag: "dns", Summary: "让域名记录指向实例（A 为静态或公网 IPv4，AAAA 为 IPv6），返回记录变更", Query: []apiParam{apiRegionParam, apiKeyParam}, Body: apiPointDNSInput{}, Result: []aws.DNSChange{}, Handler: apiPointDNSAtInstance},
+		{Method: http.MethodGet, Path: "/lightsail/transfer", ID: "listLightsailTransfer", Tag: "lightsail", Summary: "区域内各实例本月流量用量、套餐配额与月底预估", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: []apiTransferUsage{}, Handler: apiListLightsailTransfer},
+		{Method: http.MethodGet, Path: "/lightsail/instances/:name/metrics", ID: "getLightsailMetrics", Tag: "lightsail", Summary: "实例监控指标（CPU、网络、突发容量、状态检查）", Query: []apiParam{apiRegionParam, apiKeyParam, {Name: "period", Description: "1h（默认）、24h 或 7d"}}, Result: []aws.MetricSeries{}, Handler: apiGetLightsailMetrics},
+		{Method: http.MethodGet, Path: "/lightsail/instances/:name/firewall", ID: "getLightsailFirewall", Tag: "firewall", Summary: "实例当前开放的防火墙规则", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: []aws.FirewallRule{}, Handler: apiGetFirewall},
+		{Method: http.MethodPut, Path: "/lightsail/instances/:name/firewall", ID: "putLightsailFirewall", Tag: "firewall", Summary: "用一组规则或防火墙模板整体替换实例规则", Query: []apiParam{apiRegionParam, apiKeyParam}, Body: apiFirewallPut{}, Result: []aws.FirewallRule{}, Handler: apiPutFirewall},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/firewall/open", ID: "openLightsailFirewallRule", Tag: "firewall", Summary: "新增一条防火墙规则", Query: []apiParam{apiRegionParam, apiKeyParam}, Body: aws.FirewallRule{}, Result: apiActionResult{}, Handler: apiFirewallRuleAction("open", aws.OpenFirewallRule)},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/firewall/close", ID: "closeLightsailFirewallRule", Tag: "firewall", Summary: "删除一条防火墙规则", Query: []apiParam{apiRegionParam, apiKeyParam}, Body: aws.FirewallRule{}, Result: apiActionResult{}, Handler: apiFirewallRuleAction("close", aws.CloseFirewallRule)},
+		{Method: http.MethodGet, Path: "/ssh-keys", ID: "listSSHKeys", Tag: "ssh-keys", Summary: "列出 SSH 公钥", Result: []apiSSHKey{}, Handler: apiListSSHKeys},
+		{Method: http.MethodPost, Path: "/ssh-keys", ID: "createSSHKey", Tag: "ssh-keys", Summary: "保存 SSH 公钥（ssh-rsa / ssh-ed25519）", Body: apiSSHKeyInput{}, Status: http.StatusCreated, Result: apiSSHKey{}, Handler: apiCreateSSHKey},
+		{Method: http.MethodDelete, Path: "/ssh-keys/:id", ID: "deleteSSHKey", Tag: "ssh-keys", Summary: "删除 SSH 公钥（不删除已导入 AWS 的密钥对）", Result: apiDeleted{}, Handler: apiDeleteSSHKey},
+		{Method: http.MethodGet, Path: "/transfer-guards", ID: "listTransferGuards", Tag: "transfer-guards", Summary: "列出流量保护策略", Result: []apiTransferGuard{}, Handler: apiListTransferGuards},
+		{Method: http.MethodPost, Path: "/transfer-guards", ID: "createTransferGuard", Tag: "transfer-guards", Summary: "创建流量保护策略，绑定到 key_id 指定或当前启用的密钥", Query: []apiParam{apiKeyParam}, Body: apiTransferGuardInput{}, Status: http.StatusCreated, Result: apiTransferGuard{}, Handler: apiCreateTransferGuard},
+		{Method: http.MethodDelete, Path: "/transfer-guards/:id", ID: "deleteTransferGuard", Tag: "transfer-guards", Summary: "删除流量保护策略", Result: apiDeleted{}, Handler: apiDeleteTransferGuard},
+		{Method: http.MethodGet, Path: "/transfer-guards/events", ID: "listTransferGuardEvents", Tag: "transfer-guards", Summary: "最近的策略触发记录", Result: []apiTransferGuardEvent{}, Handler: apiListTransferGuardEvents},
+		{Method: http.MethodGet, Path: "/leftovers", ID: "listLeftovers", Tag: "leftovers", Summary: "区域内的遗留资源（未绑定的静态 IP / 弹性 IP、未挂载的 EBS 卷、孤立快照）及估算月费", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiLeftovers{}, Handler: apiListLeftovers},
+		{Method: http.MethodPost, Path: "/leftovers/sweep", ID: "sweepLeftovers", Tag: "leftovers", Summary: "批量释放或删除遗留资源，dry_run 时只预览", Query: []apiParam{apiRegionParam, apiKeyParam}, Body: apiLeftoverSweepRequest{}, Result: apiLeftoverSweepResponse{}, Handler: apiSweepLeftovers},
+		{Method: http.MethodGet, Path: "/dns/domains", ID: "listDomains", Tag: "dns", Summary: "列出 Lightsail DNS 区域", Query: []apiParam{apiKeyParam}, Result: []aws.DomainView{}, Handler: apiListDomains},
+		{Method: http.MethodPost, Path: "/dns/domains", ID: "createDomain", Tag: "dns", Summary: "创建 DNS 区域", Query: []apiParam{apiKeyParam}, Body: apiDomainInput{}, Status: http.StatusCreated, Result: apiCreated{}, Handler: apiCreateDomain},
+		{Method: http.MethodGet, Path: "/dns/domains/:domain/records", ID: "listDNSRecords", Tag: "dns", Summary: "列出区域内的 A/AAAA/CNAME/TXT 记录", Query: []apiParam{apiKeyParam}, Result: []aws.DNSRecord{}, Handler: apiListDNSRecords},
+		{Method: http.MethodPost, Path: "/dns/domains/:domain/records", ID: "createDNSRecord", Tag: "dns", Summary: "添加解析记录", Query: []apiParam{apiKeyParam}, Body: apiDNSRecordInput{}, Status: http.StatusCreated, Result: apiCreated{}, Handler: apiCreateDNSRecord},
+		{Method: http.MethodDelete, Path: "/dns/domains/:domain/records/:id", ID: "deleteDNSRecord", Tag: "dns", Summary: "删除解析记录", Query: []apiParam{apiKeyParam}, Result: apiDeleted{}, Handler: apiDeleteDNSRecord},
+		{Method: http.MethodGet, Path: "/dns-providers", ID: "listDNSProviders", Tag: "dns", Summary: "列出外部 DNS 服务商（不返回密钥）", Result: []apiDNSProvider{}, Handler: apiListDNSProviders},
+		{Method: http.MethodPost, Path: "/dns-providers", ID: "createDNSProvider", Tag: "dns", Summary: "保存外部 DNS 服务商（Cloudflare / Route 53 / RFC 2136），凭据加密存储", Body: apiDNSProviderInput{}, Status: http.StatusCreated, Result: apiDNSProvider{}, Handler: apiCreateDNSProvider},
+		{Method: http.MethodDelete, Path: "/dns-providers/:id", ID: "deleteDNSProvider", Tag: "dns", Summary: "删除外部 DNS 服务商及其绑定", Result: apiDeleted{}, Handler: apiDeleteDNSProvider},
+		{Method: http.MethodGet, Path: "/dns-bindings", ID: "listDNSBindings", Tag: "dns", Summary: "列出绑定到实例的外部 DNS 记录及最近同步结果", Result: []apiDNSBinding{}, Handler: apiListDNSBindings},
+		{Method: http.MethodPost, Path: "/dns-bindings", ID: "createDNSBinding", Tag: "dns", Summary: "把外部 DNS 记录绑定到实例，更换静态 IP 后自动改写；关联 key_id 指定或当前启用的密钥", Query: []apiParam{apiKeyParam}, Body: apiDNSBindingInput{}, Status: http.StatusCreated, Result: apiDNSBinding{}, Handler: apiCreateDNSBinding},
+		{Method: http.MethodDelete, Path: "/dns-bindings/:id", ID: "deleteDNSBinding", Tag: "dns", Summary: "删除绑定（不删除外部 DNS 上的记录）", Result: apiDeleted{}, Handler: apiDeleteDNSBinding},
+		{Method: http.MethodPost, Path: "/dns-bindings/sync", ID: "syncDNSBindings", Tag: "dns", Summary: "立即把实例的绑定记录改写为当前地址，返回逐条结果", Query: []apiParam{apiKeyParam}, Body: apiDNSSyncInput{}, Result: []dnsSyncResult{}, Handler: apiSyncDNSBindings},
+		{Method: http.MethodGet, Path: "/ip-history", ID: "listIPHistory", Tag: "ip-history", Summary: "密钥在区域内各实例用过的 IP、使用时长与释放原因，新的在前", Query: []apiParam{apiRegionParam, apiKeyParam, {Name: "instance", Description: "只看该实例"}, {Name: "limit", Description: "返回条数，默认 200"}}, Result: []apiIPHistory{}, Handler: apiListIPHistory},
+		{Method: http.MethodGet, Path: "/ip-blocklist", ID: "listBlockedIPs", Tag: "ip-history", Summary: "列出密钥的 IP 黑名单", Query: []apiParam{apiKeyParam}, Result: []apiBlockedIP{}, Handler: apiListBlockedIPs},
+		{Method: http.MethodPost, Path: "/ip-blocklist", ID: "createBlockedIP", Tag: "ip-history", Summary: "把地址加入密钥的黑名单，换 IP 申请到时立即释放重申", Query: []apiParam{apiKeyParam}, Body: apiBlockedIPInput{}, Status: http.StatusCreated, Result: apiBlockedIP{}, Handler: apiCreateBlockedIP},
+		{Method: http.MethodDelete, Path: "/ip-blocklist/:id", ID: "deleteBlockedIP", Tag: "ip-history", Summary: "移出黑名单", Result: apiDeleted{}, Handler: apiDeleteBlockedIP},
+		{Method: http.MethodGet, Path: "/ip-holds", ID: "listHeldStaticIPs", Tag: "ip-history", Summary: "换 IP 时保留的旧静态 IP 及其状态，新的在前", Result: []apiHeldStaticIP{}, Handler: apiListHeldStaticIPs},
+		{Method: http.MethodPost, Path: "/ip-holds/:id/rollback", ID: "rollbackHeldStaticIP", Tag: "ip-history", Summary: "在保留期内把实例换回旧静态 IP 并释放当前静态 IP（后台任务）", Status: http.StatusAccepted, Result: JobStatus{}, Handler: apiRollbackHeldStaticIP},
+		{Method: http.MethodGet, Path: "/firewall-profiles", ID: "listFirewallProfiles", Tag: "firewall", Summary: "列出防火墙模板", Result: []apiFirewallProfile{}, Handler: apiListFirewallProfiles},
+		{Method: http.MethodPost, Path: "/firewall-profiles", ID: "createFirewallProfile", Tag: "firewall", Summary: "保存防火墙模板", Body: apiFirewallProfileInput{}, Status: http.StatusCreated, Result: apiFirewallProfile{}, Handler: apiCreateFirewallProfile},
+		{Method: http.MethodDelete, Path: "/firewall-profiles/:id", ID: "deleteFirewallProfile", Tag: "firewall", Summary: "删除防火墙模板", Result: apiDeleted{}, Handler: apiDeleteFirewallProfile},
+		{Method: http.MethodPost, Path: "/lightsail/instances/:name/snapshots", ID: "createLightsailSnapshot", Tag: "lightsail", Summary: "为实例创建快照（快照在后台生成）", Query: []apiParam{apiRegionParam, apiKeyParam, {Name: "snapshot_name", Description: "快照名，默认 snap-<实例名>-<时间戳>"}}, Status: http.StatusCreated, Result: apiCreated{}, Handler: apiCreateLightsailSnapshot},
+		{Method: http.MethodGet, Path: "/lightsail/snapshots", ID: "listLightsailSnapshots", Tag: "lightsail", Summary: "列出实例快照（含大小与创建时长）", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: []aws.SnapshotView{}, Handler: apiListLightsailSnapshots},
+		{Method: http.MethodPost, Path: "/lightsail/snapshots/:name/restore", ID: "restoreLightsailSnapshot", Tag: "lightsail", Summary: "从快照创建新实例（可更换套餐与可用区）", Query: []apiParam{apiRegionParam, apiKeyParam}, Body: apiRestoreSnapshotRequest{}, Status: http.StatusCreated, Result: apiCreated{}, Handler: apiRestoreLightsailSnapshot},
+		{Method: http.MethodDelete, Path: "/lightsail/snapshots/:name", ID: "deleteLightsailSnapshot", Tag: "lightsail", Summary: "删除快照", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiDeleted{}, Handler: apiDeleteLightsailSnapshot},
+
+		{Method: http.MethodGet, Path: "/ec2/instances", ID: "listEC2Instances", Tag: "ec2", Summary: "列出 EC2 实例", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: []aws.EC2InstanceView{}, Handler: apiListEC2Instances},
+		{Method: http.MethodPost, Path: "/ec2/instances", ID: "createEC2Instances", Tag: "ec2", Summary: "创建 EC2 实例", Query: []apiParam{apiKeyParam}, Body: apiCreateEC2Request{}, Status: http.StatusCreated, Result: apiCreated{}, Handler: apiCreateEC2Instances},
+		{Method: http.MethodGet, Path: "/ec2/instance-types", ID: "listEC2InstanceTypes", Tag: "ec2", Summary: "区域内可启动的实例类型", Query: []apiParam{apiRegionParam, apiKeyParam, {Name: "q", Description: "搜索关键字，空格分隔；支持类型名、arm、x86、burst、free、2c（vCPU）、4g（内存）"}}, Result: []aws.InstanceTypeView{}, Handler: apiListEC2InstanceTypes},
+		{Method: http.MethodGet, Path: "/ec2/ami-presets", ID: "listAMIPresets", Tag: "ec2", Summary: "列出保存的 AMI 预设", Query: []apiParam{{Name: "region", Description: "只列出该区域的预设，默认全部"}}, Result: []apiAMIPreset{}, Handler: apiListAMIPresets},
+		{Method: http.MethodPost, Path: "/ec2/ami-presets", ID: "createAMIPreset", Tag: "ec2", Summary: "校验并保存 AMI 预设", Query: []apiParam{apiKeyParam}, Body: apiAMIPresetInput{}, Status: http.StatusCreated, Result: apiAMIPreset{}, Handler: apiCreateAMIPreset},
+		{Method: http.MethodDelete, Path: "/ec2/ami-presets/:id", ID: "deleteAMIPreset", Tag: "ec2", Summary: "删除 AMI 预设", Result: apiDeleted{}, Handler: apiDeleteAMIPreset},
+		{Method: http.MethodPost, Path: "/ec2/instances/:id/start", ID: "startEC2Instance", Tag: "ec2", Summary: "启动 EC2 实例", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiActionResult{}, Handler: apiEC2Action("start", aws.StartEC2Instance)},
+		{Method: http.MethodPost, Path: "/ec2/instances/:id/stop", ID: "stopEC2Instance", Tag: "ec2", Summary: "停止 EC2 实例", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiActionResult{}, Handler: apiEC2Action("stop", aws.StopEC2Instance)},
+		{Method: http.MethodPost, Path: "/ec2/instances/:id/reboot", ID: "rebootEC2Instance", Tag: "ec2", Summary: "重启 EC2 实例", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiActionResult{}, Handler: apiEC2Action("reboot", aws.RebootEC2Instance)},
+		{Method: http.MethodPost, Path: "/ec2/instances/:id/openall", ID: "openAllEC2Ports", Tag: "ec2", Summary: "开放 EC2 实例安全组全部端口", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiActionResult{}, Handler: apiEC2Action("openall", aws.OpenAllEC2Ports)},
+		{Method: http.MethodPost, Path: "/ec2/instances/:id/terminate", ID: "terminateEC2Instance", Tag: "ec2", Summary: "终止 EC2 实例", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiActionResult{}, Handler: apiEC2Action("terminate", aws.TerminateEC2Instance)},
+
+		{Method: http.MethodPost, Path: "/quota", ID: "testQuota", Tag: "quota", Summary: "查询 EC2 vCPU 配额并保存到密钥", Query: []apiParam{apiRegionParam, apiKeyParam}, Result: apiQuotaResult{}, Handler: apiTestQuota},
+		{Method: http.MethodGet, Path: "/proxy/check", ID: "checkProxy", Tag: "proxy", Summary: "检测代理出口 IP", Query: []apiParam{{Name: "proxy", Description: "代理地址，默认使用会话中启用密钥的代理"}}, Result: apiProxyCheck{}, Handler: apiCheckProxy},
+
+		{Method: http.MethodGet, Path: "/jobs", ID: "listJobs", Tag: "jobs", Summary: "最近的后台任务", Result: []JobStatus{}, Handler: apiListJobs},
+		{Method: http.MethodGet, Path: "/jobs/:id", ID: "getJob", Tag: "jobs", Summary: "后台任务状态与步骤", Result: JobStatus{}, Handler: apiGetJob},
+	}
+}
+
+func registerAPIRoutes(r *gin.Engine) {
+	routes := apiRoutes()
+	spec := openAPISpec(routes)
+	g := r.Group(apiPrefix)
+	g.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	})
+	for _, rt := range routes {
+		g.Handle(rt.Method, rt.Path, rt.Handler)
+	}
+	r.NoRoute(func(c *gin.Context) {
+		if isAPIRequest(c) {
+			apiFail(c, http.StatusNotFound, "not_found", "接口不存在")
+			return
+		}
+		c.String(http.StatusNotFound, "404 page not found")
+	})
+}
+
+func isAPIRequest(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/api/")
+}
+
+func apiFail(c *gin.Context, status int, code, msg string) {
+	c.Set("audit_error", code+": "+msg)
+	c.AbortWithStatusJSON(status, apiErrorResponse{Error: apiError{Code: code, Message: msg}})
+}
+
+// apiAWSFail 把 AWS 调用错误转换成 JSON；AWS 的 4xx 原样返回（401 改为 403，避免与本服务的认证混淆），其余为 502。
+func apiAWSFail(c *gin.Context, err error) {
+	auditError(c, err)
+	status := http.StatusBadGateway
+	if code := aws.HTTPStatus(err); code >= 400 && code < 500 {
+		status = code
+		if code == http.StatusUnauthorized {
+			status = http.StatusForbidden
+		}
+	}
+	c.AbortWithStatusJSON(status, apiErrorResponse{Error: apiError{
+		Code:    "aws_error",
+		Message: err.Error(),
+		AWSCode: aws.ErrorCode(err),
+	}})
+}
+
+func apiBind(c *gin.Context, v any) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "请求体不是有效的 JSON："+err.Error())
+		return false
+	}
+	c.Set("audit_params", apiAuditParams(v))
+	return true
+}
+
+// apiAuditParams 序列化请求体用于审计，去掉密码与 secret key，并遮盖 access key。
+func apiAuditParams(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	params := map[string]any{}
+	if err := json.Unmarshal(b, &params); err != nil {
+		return ""
+	}
+	delete(params, "secret_key")
+	delete(params, "root_password")
+	delete(params, "api_token")
+	delete(params, "tsig_secret")
+	if ak, ok := params["access_key"].(string); ok {
+		params["access_key"] = maskAccessKey(ak)
+	}
+	b, _ = json.Marshal(params)
+	return string(b)
+}
+
+func maskAccessKey(ak string) string {
+	ak = strings.TrimSpace(ak)
+	if len(ak) <= 4 {
+		return ak
+	}
+	return "****" + ak[len(ak)-4:]
+}
+
+func apiUserID(c *gin.Context) int64 {
+	userID, _ := userIDFromSession(session.Must(c))
+	return userID
+}
+
+func apiRegion(c *gin.Context, fallback string) string {
+	region := normalizeRegion(firstNonEmpty(c.Query("region"), fallback))
+	if region == "" {
+		region = normalizeRegion(session.Must(c).GetString("region", "us-east-1"))
+	}
+	c.Set("audit_region", region)
+	return region
+}
+
+// apiKey 按 ?key_id= 选择密钥，未指定时使用当前会话启用的密钥。
+func apiKey(c *gin.Context) (*store.Key, bool) {
+	s := session.Must(c)
+	userID, _ := userIDFromSession(s)
+	keys, err := appStore.ListKeys(c.Request.Context(), userID)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取密钥失败")
+		return nil, false
+	}
+	var key *store.Key
+	if raw := strings.TrimSpace(c.Query("key_id")); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			apiFail(c, http.StatusBadRequest, "invalid_request", "key_id 无效")
+			return nil, false
+		}
+		if key = findKeyByID(keys, id); key == nil {
+			apiFail(c, http.StatusNotFound, "key_not_found", "密钥不存在")
+			return nil, false
+		}
+	} else if key, _ = resolveActiveKey(s, keys); key == nil {
+		apiFail(c, http.StatusBadRequest, "key_required", "未指定 key_id，且当前会话没有启用的密钥")
+		return nil, false
+	}
+	if strings.TrimSpace(key.AccessKey) == "" || strings.TrimSpace(key.SecretKey) == "" {
+		apiFail(c, http.StatusBadRequest, "key_incomplete", "Access Key / Secret Key 不能为空")
+		return nil, false
+	}
+	c.Set("audit_key_id", key.ID)
+	return key, true
+}
+
+func apiKeyFromPath(c *gin.Context) (*store.Key, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "密钥 ID 无效")
+		return nil, false
+	}
+	keys, err := appStore.ListKeys(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取密钥失败")
+		return nil, false
+	}
+	key := findKeyByID(keys, id)
+	if key == nil {
+		apiFail(c, http.StatusNotFound, "key_not_found", "密钥不存在")
+		return nil, false
+	}
+	c.Set("audit_key_id", key.ID)
+	return key, true
+}
+
+func toAPIKeyView(s *session.Session, k *store.Key) apiKeyView {
+	return apiKeyView{
+		ID:          k.ID,
+		Name:        k.Name,
+		AccessKey:   maskAccessKey(k.AccessKey),
+		Proxy:       k.Proxy,
+		Active:      strconv.FormatInt(k.ID, 10) == strings.TrimSpace(s.GetString("key_id", "")),
+		QuotaRegion: k.QuotaRegion,
+		QuotaOn:     k.QuotaOn,
+		QuotaSpot:   k.QuotaSpot,
+		CreatedAt:   k.CreatedAt,
+	}
+}
+
+func apiGetMe(c *gin.Context) {
+	s := session.Must(c)
+	c.JSON(http.StatusOK, apiMe{
+		UserID:    apiUserID(c),
+		Username:  s.GetString("username", ""),
+		IsAdmin:   isAdminSession(s),
+		CSRFToken: s.GetString("csrf_token", ""),
+	})
+}
+
+func apiListKeys(c *gin.Context) {
+	s := session.Must(c)
+	keys, err := appStore.ListKeys(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取密钥失败")
+		return
+	}
+	out := make([]apiKeyView, 0, len(keys))
+	for i := range keys {
+		out = append(out, toAPIKeyView(s, &keys[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateKey(c *gin.Context) {
+	var in apiKeyInput
+	if !apiBind(c, &in) {
+		return
+	}
+	in.AccessKey, in.SecretKey = strings.TrimSpace(in.AccessKey), strings.TrimSpace(in.SecretKey)
+	if in.AccessKey == "" || in.SecretKey == "" {
+		apiFail(c, http.StatusBadRequest, "key_incomplete", "Access Key / Secret Key 不能为空")
+		return
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		name = time.Now().Format("2006-01-02 15:04")
+	}
+	proxy := ""
+	if in.Proxy != nil {
+		proxy = strings.TrimSpace(*in.Proxy)
+	}
+	userID := apiUserID(c)
+	id, err := appStore.CreateKey(c.Request.Context(), userID, name, in.AccessKey, in.SecretKey, proxy)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "保存密钥失败")
+		return
+	}
+	c.Set("audit_key_id", id)
+	keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+	if k := findKeyByID(keys, id); k != nil {
+		c.JSON(http.StatusCreated, toAPIKeyView(session.Must(c), k))
+		return
+	}
+	c.JSON(http.StatusCreated, apiKeyView{ID: id, Name: name})
+}
+
+func apiUpdateKey(c *gin.Context) {
+	existing, ok := apiKeyFromPath(c)
+	if !ok {
+		return
+	}
+	var in apiKeyInput
+	if !apiBind(c, &in) {
+		return
+	}
+	name := firstNonEmpty(in.Name, existing.Name)
+	ak := firstNonEmpty(in.AccessKey, existing.AccessKey)
+	sk := firstNonEmpty(in.SecretKey, existing.SecretKey)
+	proxy := existing.Proxy
+	if in.Proxy != nil {
+		proxy = strings.TrimSpace(*in.Proxy)
+	}
+	userID := apiUserID(c)
+	if err := appStore.UpdateKey(c.Request.Context(), userID, existing.ID, name, ak, sk, proxy); err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "更新密钥失败")
+		return
+	}
+	keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+	if k := findKeyByID(keys, existing.ID); k != nil {
+		c.JSON(http.StatusOK, toAPIKeyView(session.Must(c), k))
+		return
+	}
+	apiFail(c, http.StatusNotFound, "key_not_found", "密钥不存在")
+}
+
+func apiDeleteKey(c *gin.Context) {
+	key, ok := apiKeyFromPath(c)
+	if !ok {
+		return
+	}
+	if err := appStore.DeleteKey(c.Request.Context(), apiUserID(c), key.ID); err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "删除密钥失败")
+		return
+	}
+	s := session.Must(c)
+	id := strconv.FormatInt(key.ID, 10)
+	if s.GetString("key_id", "") == id {
+		s.SetString("key_id", "")
+	}
+	if s.GetString("pending_key_id", "") == id {
+		s.SetString("pending_key_id", "")
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
+
+func apiActivateKey(c *gin.Context) {
+	key, ok := apiKeyFromPath(c)
+	if !ok {
+		return
+	}
+	s := session.Must(c)
+	id := strconv.FormatInt(key.ID, 10)
+	s.SetString("key_id", id)
+	s.SetString("pending_key_id", id)
+	c.JSON(http.StatusOK, toAPIKeyView(s, key))
+}
+
+// apiDiscoveryKey 用于区域查询：指定 key_id 时必须有效，否则使用会话中启用的密钥（可以没有）。
+func apiDiscoveryKey(c *gin.Context) (*store.Key, bool) {
+	if strings.TrimSpace(c.Query("key_id")) != "" {
+		return apiKey(c)
+	}
+	s := session.Must(c)
+	userID, _ := userIDFromSession(s)
+	keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+	key, _ := resolveActiveKey(s, keys)
+	return key, true
+}
+
+func apiListRegions(c *gin.Context) {
+	key, ok := apiDiscoveryKey(c)
+	if !ok {
+		return
+	}
+	list, err := discoverRegions(c.Request.Context(), strings.TrimSpace(c.Query("service")), key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func apiListZones(c *gin.Context) {
+	region := apiRegion(c, "")
+	key, ok := apiDiscoveryKey(c)
+	if !ok {
+		return
+	}
+	list, err := discoverZones(c.Request.Context(), strings.TrimSpace(c.Query("service")), region, key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func apiGetCatalog(c *gin.Context) {
+	c.JSON(http.StatusOK, apiCatalog{
+		IPTypes: ipTypeOptions,
+		EC2AMIs: ec2AMIOptions,
+	})
+}
+
+func apiGetLightsailCatalog(c *gin.Context) {
+	region := apiRegion(c, "")
+	cli, _, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	cat, err := lightsailCatalog(c.Request.Context(), region, func() (aws.LightsailAPI, error) { return cli, nil })
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cat)
+}
+
+func apiListEC2InstanceTypes(c *gin.Context) {
+	region := apiRegion(c, "")
+	cli, _, ok := apiEC2Client(c, region)
+	if !ok {
+		return
+	}
+	list, err := ec2InstanceTypes(c.Request.Context(), region, func() (aws.EC2InstanceTypeAPI, error) { return cli, nil })
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	list = aws.SearchInstanceTypes(list, c.Query("q"))
+	if list == nil {
+		list = []aws.InstanceTypeView{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func apiLightsailClient(c *gin.Context, region string) (aws.LightsailAPI, *store.Key, bool) {
+	key, ok := apiKey(c)
+	if !ok {
+		return nil, nil, false
+	}
+	cli, err := aws.NewLightsailClient(c.Request.Context(), region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		apiAWSFail(c, err)
+		return nil, nil, false
+	}
+	return cli, key, true
+}
+
+func apiEC2Client(c *gin.Context, region string) (*ec2.Client, *store.Key, bool) {
+	key, ok := apiKey(c)
+	if !ok {
+		return nil, nil, false
+	}
+	cli, err := aws.NewEC2Client(c.Request.Context(), region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		apiAWSFail(c, err)
+		return nil, nil, false
+	}
+	return cli, key, true
+}
+
+func instCacheKey(prefix, region string, key *store.Key) string {
+	return strings.Join([]string{prefix, region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.Proxy)}, "|")
+}
+
+func apiListLightsailInstances(c *gin.Context) {
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	cacheKey := instCacheKey("inst", region, key)
+	if v, ok := instCache.Get(cacheKey); ok {
+		c.JSON(http.StatusOK, v.([]aws.InstanceView))
+		return
+	}
+	list, err := aws.ListInstances(c.Request.Context(), cli)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	if list == nil {
+		list = []aws.InstanceView{}
+	}
+	instCache.Set(cacheKey, list, cache.DefaultExpiration)
+	observeInstanceIPs(c.Request.Context(), apiUserID(c), key, region, list)
+	c.JSON(http.StatusOK, list)
+}
+
+func apiCreateLightsailInstance(c *gin.Context) {
+	var in apiCreateLightsailRequest
+	if !apiBind(c, &in) {
+		return
+	}
+	region := apiRegion(c, in.Region)
+	in.BlueprintID, in.BundleID = strings.TrimSpace(in.BlueprintID), strings.TrimSpace(in.BundleID)
+	if in.BlueprintID == "" || in.BundleID == "" {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "blueprint_id / bundle_id 不能为空")
+		return
+	}
+	ipType := firstNonEmpty(in.IPType, "dualstack")
+	diskSize, diskMount, err := parseExtraDisk(strconv.Itoa(int(in.DiskSizeGB)), in.DiskMountPoint)
+	if err != nil {
+		apiDiskFail(c, err)
+		return
+	}
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	zone := zoneName(region, in.AZ)
+	if msg := checkPlacement(c.Request.Context(), "lightsail", region, zone, key); msg != "" {
+		apiFail(c, http.StatusBadRequest, msg, placementErrorText[msg])
+		return
+	}
+	cat, err := lightsailCatalog(c.Request.Context(), region, func() (aws.LightsailAPI, error) { return cli, nil })
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	bundle, msg := lightsailBundleFor(cat, in.BlueprintID, in.BundleID, ipType)
+	if msg != "" {
+		apiFail(c, http.StatusBadRequest, msg, catalogErrorText[msg])
+		return
+	}
+	var fwRules []aws.FirewallRule
+	if in.FirewallProfileID != 0 {
+		if fwRules, err = firewallProfileRules(c.Request.Context(), apiUserID(c), in.FirewallProfileID); err != nil {
+			apiFail(c, http.StatusBadRequest, "profile_not_found", "防火墙模板不存在")
+			return
+		}
+	}
+	keyPair, ok := apiSSHKeyPair(c, in.SSHKeyID, func(name, pub string) error {
+		return aws.EnsureLightsailKeyPair(c.Request.Context(), cli, name, pub)
+	})
+	if !ok {
+		return
+	}
+	userData := ""
+	if pwd := strings.TrimSpace(in.RootPassword); pwd != "" {
+		userData = aws.BuildRootPasswordUserData(pwd, keyPair != "")
+	}
+	if diskSize > 0 {
+		userData = aws.AppendUserData(userData, aws.DiskMountScript(firstDiskPath, diskMount))
+	}
+	name := "vps-" + strconv.FormatInt(time.Now().Unix(), 10)
+	c.Set("audit_instance", name)
+	err = aws.CreateInstance(c.Request.Context(), cli, aws.CreateInstanceInput{
+		InstanceName:     name,
+		AvailabilityZone: zone,
+		BlueprintID:      in.BlueprintID,
+		BundleID:         bundle,
+		UserData:         userData,
+		IPAddressType:    ipType,
+		EnableFWAll:      in.OpenAllPorts,
+		FirewallRules:    fwRules,
+		KeyPairName:      keyPair,
+	})
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	instCache.Delete(instCacheKey("inst", region, key))
+	out := apiCreated{Service: "lightsail", Region: region, Name: name}
+	if diskSize > 0 {
+		out.JobID, err = enqueueDiskJob(c.Request.Context(), apiUserID(c), key, region, name, diskJobParams{
+			Disk:       aws.DiskName(name),
+			SizeGB:     diskSize,
+			Zone:       zone,
+			Path:       firstDiskPath,
+			MountPoint: diskMount,
+		})
+		if err != nil {
+			auditError(c, err)
+			apiFail(c, http.StatusInternalServerError, "internal", "实例已创建，但提交附加磁盘任务失败")
+			return
+		}
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+// apiSSHKeyPair 导入请求指定的 SSH 公钥并返回密钥对名称，未指定时返回空；失败时已写入错误响应。
+func apiSSHKeyPair(c *gin.Context, id int64, ensure func(keyPairName, publicKey string) error) (string, bool) {
+	if id == 0 {
+		return "", true
+	}
+	name, err := sshKeyPairFor(c.Request.Context(), apiUserID(c), strconv.FormatInt(id, 10), ensure)
+	switch {
+	case errors.Is(err, store.ErrSSHKeyNotFound):
+		apiFail(c, http.StatusBadRequest, "sshkey_not_found", "SSH 公钥不存在")
+		return "", false
+	case errors.Is(err, aws.ErrInvalidSSHKey):
+		apiFail(c, http.StatusBadRequest, "invalid_ssh_key", err.Error())
+		return "", false
+	case err != nil:
+		apiAWSFail(c, err)
+		return "", false
+	}
+	return name, true
+}
+
+func apiLightsailAction(action string, fn func(ctx context.Context, cli aws.LightsailAPI, name string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.TrimSpace(c.Param("name"))
+		c.Set("audit_instance", name)
+		region := apiRegion(c, "")
+		cli, key, ok := apiLightsailClient(c, region)
+		if !ok {
+			return
+		}
+		if err := fn(c.Request.Context(), cli, name); err != nil {
+			apiAWSFail(c, err)
+			return
+		}
+		instCache.Delete(instCacheKey("inst", region, key))
+		c.JSON(http.StatusOK, apiActionResult{Action: action, Region: region, Target: name})
+	}
+}
+
+func apiStopLightsailInstance(c *gin.Context) {
+	kind := jobKindStop
+	if force, _ := strconv.ParseBool(c.Query("force")); force {
+		kind = jobKindForceStop
+	}
+	apiEnqueueLightsailJob(kind)(c)
+}
+
+func apiEnqueueLightsailJob(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiEnqueueLightsailJobWithParams(c, kind, "")
+	}
+}
+
+func apiEnqueueLightsailJobWithParams(c *gin.Context, kind, params string) {
+	name := strings.TrimSpace(c.Param("name"))
+	c.Set("audit_instance", name)
+	region := apiRegion(c, "")
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	id, err := jobRunner.Enqueue(c.Request.Context(), store.Job{
+		UserID: apiUserID(c),
+		KeyID:  key.ID,
+		Kind:   kind,
+		Region: region,
+		Target: name,
+		Params: params,
+	})
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "提交后台任务失败")
+		return
+	}
+	job, err := appStore.GetJob(c.Request.Context(), id)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取后台任务失败")
+		return
+	}
+	c.Header("Location", apiPrefix+"/jobs/"+strconv.FormatInt(id, 10))
+	c.JSON(http.StatusAccepted, jobStatusJSON(job, nil))
+}
+
+func apiListEC2Instances(c *gin.Context) {
+	region := apiRegion(c, "")
+	cli, key, ok := apiEC2Client(c, region)
+	if !ok {
+		return
+	}
+	cacheKey := instCacheKey("ec2inst", region, key)
+	if v, ok := instCache.Get(cacheKey); ok {
+		c.JSON(http.StatusOK, v.([]aws.EC2InstanceView))
+		return
+	}
+	list, err := aws.ListEC2Instances(c.Request.Context(), cli)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	if list == nil {
+		list = []aws.EC2InstanceView{}
+	}
+	instCache.Set(cacheKey, list, cache.DefaultExpiration)
+	c.JSON(http.StatusOK, list)
+}
+
+func apiCreateEC2Instances(c *gin.Context) {
+	var in apiCreateEC2Request
+	if !apiBind(c, &in) {
+		return
+	}
+	region := apiRegion(c, in.Region)
+	in.AMI, in.InstanceType = strings.TrimSpace(in.AMI), strings.TrimSpace(in.InstanceType)
+	if in.AMI == "" || in.InstanceType == "" {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "ami / instance_type 不能为空")
+		return
+	}
+	// EC2 没有默认密钥对，两者都没有时实例创建后无法登录
+	if in.SSHKeyID == 0 && strings.TrimSpace(in.RootPassword) == "" {
+		apiFail(c, http.StatusBadRequest, "need_login", "ssh_key_id 与 root_password 至少提供一个，否则实例创建后无法登录")
+		return
+	}
+	if in.Count < 1 {
+		in.Count = 1
+	}
+	cli, key, ok := apiEC2Client(c, region)
+	if !ok {
+		return
+	}
+	types, err := ec2InstanceTypes(c.Request.Context(), region, func() (aws.EC2InstanceTypeAPI, error) { return cli, nil })
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	if _, err := aws.FindInstanceType(types, in.InstanceType); err != nil {
+		apiFail(c, http.StatusBadRequest, "instance_type_unavailable", err.Error())
+		return
+	}
+	zone := ""
+	if strings.TrimSpace(in.AZ) != "" {
+		zone = zoneName(region, in.AZ)
+		if msg := checkPlacement(c.Request.Context(), "ec2", region, zone, key); msg != "" {
+			apiFail(c, http.StatusBadRequest, msg, placementErrorText[msg])
+			return
+		}
+		if err := aws.CheckInstanceTypeInZone(c.Request.Context(), cli, in.InstanceType, zone); err != nil {
+			if errors.Is(err, aws.ErrInstanceTypeUnavailable) {
+				apiFail(c, http.StatusBadRequest, "instance_type_unavailable", err.Error())
+				return
+			}
+			apiAWSFail(c, err)
+			return
+		}
+	}
+	amiID, err := aws.ResolveEC2AMI(c.Request.Context(), cli, in.AMI, in.InstanceType)
+	if err != nil {
+		if errors.Is(err, aws.ErrInvalidAMI) {
+			apiFail(c, http.StatusBadRequest, "invalid_ami", err.Error())
+			return
+		}
+		apiAWSFail(c, err)
+		return
+	}
+	keyPair, ok := apiSSHKeyPair(c, in.SSHKeyID, func(name, pub string) error {
+		return aws.EnsureEC2KeyPair(c.Request.Context(), cli, name, pub)
+	})
+	if !ok {
+		return
+	}
+	userData := ""
+	if pwd := strings.TrimSpace(in.RootPassword); pwd != "" {
+		userData = aws.BuildRootPasswordUserData(pwd, keyPair != "")
+	}
+	name := "ec2-" + strconv.FormatInt(time.Now().Unix(), 10)
+	c.Set("audit_instance", name)
+	err = aws.CreateEC2Instance(c.Request.Context(), cli, aws.CreateEC2InstanceInput{
+		Name:             name,
+		AMI:              amiID,
+		InstanceType:     in.InstanceType,
+		Count:            in.Count,
+		UserData:         userData,
+		KeyName:          keyPair,
+		EnableIPv6:       in.IPv6,
+		AvailabilityZone: zone,
+	})
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	instCache.Delete(instCacheKey("ec2inst", region, key))
+	c.JSON(http.StatusCreated, apiCreated{Service: "ec2", Region: region, Name: name})
+}
+
+func apiEC2Action(action string, fn func(ctx context.Context, cli *ec2.Client, id string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.TrimSpace(c.Param("id"))
+		c.Set("audit_instance", id)
+		region := apiRegion(c, "")
+		cli, key, ok := apiEC2Client(c, region)
+		if !ok {
+			return
+		}
+		if err := fn(c.Request.Context(), cli, id); err != nil {
+			apiAWSFail(c, err)
+			return
+		}
+		instCache.Delete(instCacheKey("ec2inst", region, key))
+		if action == "start" {
+			enqueueDNSSync(c.Request.Context(), apiUserID(c), key, jobKindEC2SyncDNS, region, id)
+		}
+		c.JSON(http.StatusOK, apiActionResult{Action: action, Region: region, Target: id})
+	}
+}
+
+func apiTestQuota(c *gin.Context) {
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	region := apiRegion(c, firstNonEmpty(key.QuotaRegion, "us-east-1"))
+	sq, err := aws.NewServiceQuotasClient(c.Request.Context(), region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	onVal, spotVal, onName, spotName, err := aws.TestVCPUQuotas(c.Request.Context(), sq)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	if err := appStore.UpdateKeyQuota(c.Request.Context(), apiUserID(c), key.ID, region, onVal, spotVal, onName, spotName); err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "保存配额结果失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiQuotaResult{Region: region, OnDemand: onVal, Spot: spotVal, OnDemandName: onName, SpotName: spotName})
+}
+
+func apiCheckProxy(c *gin.Context) {
+	proxy := strings.TrimSpace(c.Query("proxy"))
+	if proxy == "" {
+		s := session.Must(c)
+		keys, _ := appStore.ListKeys(c.Request.Context(), apiUserID(c))
+		activeKey, _ := resolveActiveKey(s, keys)
+		proxy = keyProxy(activeKey)
+	}
+	ip, asn, err := aws.CheckProxyExitIP(c.Request.Context(), proxy)
+	if err != nil {
+		apiFail(c, http.StatusBadGateway, "proxy_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, apiProxyCheck{IP: ip, ASN: asn})
+}
+
+func apiListJobs(c *gin.Context) {
+	list, err := appStore.ListJobs(c.Request.Context(), apiUserID(c), 100)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取任务失败")
+		return
+	}
+	out := make([]JobStatus, 0, len(list))
+	for i := range list {
+		out = append(out, jobStatusJSON(&list[i], nil))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiGetJob(c *gin.Context) {
+	job, ok := loadVisibleJob(c)
+	if !ok {
+		apiFail(c, http.StatusNotFound, "job_not_found", "任务不存在")
+		return
+	}
+	steps, _ := appStore.ListJobSteps(c.Request.Context(), job.ID)
+	c.JSON(http.StatusOK, jobStatusJSON(job, steps))
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/dnsprovider"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	cases := []struct {
+		name       string
+		in         string
+		wantPath   string
+		wantParams string
+	}{
+		{name: "static", in: "/keys", wantPath: "/keys", wantParams: ""},
+		{name: "one-param", in: "/keys/:id", wantPath: "/keys/{id}", wantParams: "id"},
+		{name: "nested", in: "/lightsail/instances/:name/reboot", wantPath: "/lightsail/instances/{name}/reboot", wantParams: "name"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, params := openAPIPath(tc.in)
+			if path != tc.wantPath || strings.Join(params, ",") != tc.wantParams {
+				t.Fatalf("openAPIPath(%q) = %q, %v; want %q, %q", tc.in, path, params, tc.wantPath, tc.wantParams)
+			}
+		})
+	}
+}
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	routes := apiRoutes()
+	b, err := json.Marshal(openAPISpec(routes))
+	if err != nil {
+		t.Fatalf("marshal spec: %v", err)
+	}
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatalf("unmarshal spec: %v", err)
+	}
+
+	ids := map[string]bool{}
+	for _, rt := range routes {
+		if ids[rt.ID] {
+			t.Fatalf("duplicate operationId %q", rt.ID)
+		}
+		ids[rt.ID] = true
+		path, _ := openAPIPath(rt.Path)
+		if _, ok := spec.Paths[path][strings.ToLower(rt.Method)]; !ok {
+			t.Fatalf("spec missing %s %s", rt.Method, path)
+		}
+		if rt.Handler == nil {
+			t.Fatalf("route %s has no handler", rt.ID)
+		}
+	}
+
+	create := spec.Components.Schemas["CreateLightsailRequest"]
+	if _, ok := create.Properties["blueprint_id"]; !ok {
+		t.Fatalf("CreateLightsailRequest schema missing blueprint_id: %+v", create)
+	}
+	// 密码登录是可选的，默认只用 SSH 密钥
+	if required := strings.Join(create.Required, ","); !strings.Contains(required, "bundle_id") || strings.Contains(required, "root_password") {
+		t.Fatalf("CreateLightsailRequest required = %v, want bundle_id without root_password", create.Required)
+	}
+	if _, ok := spec.Components.Schemas["ErrorResponse"].Properties["error"]; !ok {
+		t.Fatalf("spec missing ErrorResponse schema")
+	}
+	if len(spec.Paths) == 0 || spec.Paths["/jobs/{id}"][strings.ToLower(http.MethodGet)] == nil {
+		t.Fatalf("spec missing /jobs/{id}")
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	cases := []struct {
+		name   string
+		scope  string
+		method string
+		path   string
+		want   bool
+	}{
+		{name: "read-get", scope: "read", method: http.MethodGet, path: "/api/v1/lightsail/instances", want: true},
+		{name: "read-post", scope: "read", method: http.MethodPost, path: "/api/v1/lightsail/instances/a/reboot", want: false},
+		{name: "operate-post", scope: "operate", method: http.MethodPost, path: "/api/v1/lightsail/instances/a/reboot", want: true},
+		{name: "operate-tokens", scope: "operate", method: http.MethodGet, path: "/api/v1/tokens", want: false},
+		{name: "operate-admin", scope: "operate", method: http.MethodGet, path: "/admin/audit", want: false},
+		{name: "admin-tokens", scope: "admin", method: http.MethodPost, path: "/api/v1/tokens", want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tokenAllows(tc.scope, tc.method, tc.path); got != tc.want {
+				t.Fatalf("tokenAllows(%q, %q, %q) = %v, want %v", tc.scope, tc.method, tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAPIAuditParamsDropsSecrets(t *testing.T) {
+	got := apiAuditParams(apiDNSProviderInput{Name: "cf", Kind: "route53", Config: dnsprovider.Config{
+		APIToken: "cf-token", AccessKey: "AKIAEXAMPLE1234", SecretKey: "aws-secret", TSIGSecret: "tsig-secret",
+	}})
+	for _, secret := range []string{"cf-token", "aws-secret", "tsig-secret", "AKIAEXAMPLE1234"} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("audit params leak %q: %s", secret, got)
+		}
+	}
+	if !strings.Contains(got, `"name":"cf"`) {
+		t.Fatalf("audit params = %s", got)
+	}
+}
+
+func TestAPIUpdateKeyProxy(t *testing.T) {
+	st, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	raw, _ := store.GenerateMasterKey()
+	mk, _ := store.ParseMasterKey(raw)
+	keyring, err := store.NewKeyring(mk)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	st.SetKeyring(keyring)
+	prev := appStore
+	appStore = st
+	defer func() { appStore = prev }()
+
+	ctx := context.Background()
+	keyID, err := st.CreateKey(ctx, 1, "main", "AKIAEXAMPLE1234", "secret", "socks5://127.0.0.1:1080")
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		s := session.New()
+		s.SetString("user_id", "1")
+		c.Set("sess", s)
+	})
+	registerAPIRoutes(r)
+	put := func(body string) apiKeyView {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, apiPrefix+"/keys/"+strconv.FormatInt(keyID, 10), strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("PUT %s = %d %s", body, w.Code, w.Body.String())
+		}
+		var v apiKeyView
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return v
+	}
+
+	if v := put(`{"name":"renamed"}`); v.Name != "renamed" || v.Proxy != "socks5://127.0.0.1:1080" {
+		t.Fatalf("update without proxy = %+v", v)
+	}
+	if v := put(`{"proxy":"http://10.0.0.1:3128"}`); v.Name != "renamed" || v.Proxy != "http://10.0.0.1:3128" {
+		t.Fatalf("update proxy = %+v", v)
+	}
+	if v := put(`{"proxy":""}`); v.Name != "renamed" || v.Proxy != "" {
+		t.Fatalf("clear proxy = %+v", v)
+	}
+	keys, _ := st.ListKeys(ctx, 1)
+	if k := findKeyByID(keys, keyID); k == nil || k.AccessKey != "AKIAEXAMPLE1234" || k.SecretKey != "secret" {
+		t.Fatalf("credentials changed: %+v", k)
+	}
+}
+
+func TestAPICreateEC2RequiresLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		s := session.New()
+		s.SetString("user_id", "1")
+		c.Set("sess", s)
+	})
+	registerAPIRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, apiPrefix+"/ec2/instances", strings.NewReader(`{"region":"us-east-1","ami":"ubuntu-24.04","instance_type":"t3.micro"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp apiErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if w.Code != http.StatusBadRequest || resp.Error.Code != "need_login" {
+		t.Fatalf("POST without ssh key or password = %d %s", w.Code, w.Body.String())
+	}
+}
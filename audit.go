@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+const (
+	auditPageSize  = 50
+	auditExportMax = 10000
+)
+
+// 这些表单字段不写入审计参数
+var auditSecretFields = map[string]bool{
+	"csrf_token": true,
+	"sk":         true,
+	"root_pwd":   true,
+	"password":   true,
+	// 外部 DNS 服务商的凭据
+	"api_token":   true,
+	"access_key":  true,
+	"secret_key":  true,
+	"tsig_secret": true,
+}
+
+// 跳转 msg 为这些值时视为操作失败
+var auditFailedMsgs = map[string]bool{
+	"csrf":       true,
+	"needuse":    true,
+	"needkey":    true,
+	"needids":    true,
+	"err_client": true,
+	"quota_err":  true,
+	// 登录 / 注册
+	"bad":       true,
+	"captcha":   true,
+	"exists":    true,
+	"invalid":   true,
+	"failed":    true,
+	"regclosed": true,
+}
+
+// auditError 记录处理过程中的真实错误，由 auditMiddleware 写入审计日志。
+func auditError(c *gin.Context, err error) {
+	if err == nil {
+		return
+	}
+	log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	c.Set("audit_error", err.Error())
+}
+
+// auditMiddleware 为所有变更请求（非 GET/HEAD，含登录、注册、退出）写一条审计记录。
+// 用户取请求结束后的会话，退出登录时会话已清空，退回请求开始时的用户。
+// API 请求的 region / instance / 参数由处理函数通过 audit_region、audit_instance、audit_params 提供。
+func auditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		username := s.GetString("username", "")
+		c.Next()
+
+		if id, ok := userIDFromSession(s); ok {
+			userID, username = id, s.GetString("username", "")
+		}
+		ev := store.AuditEvent{
+			UserID:   userID,
+			Username: username,
+			Service:  auditService(c),
+			Region:   normalizeRegion(firstNonEmpty(c.PostForm("region"), c.PostForm("quota_region"))),
+			Instance: strings.TrimSpace(c.PostForm("instance")),
+			Action:   path,
+			Params:   auditParams(c),
+			Result:   "ok",
+			ClientIP: c.ClientIP(),
+		}
+		if isAPIRequest(c) {
+			ev.Action = c.Request.Method + " " + firstNonEmpty(c.FullPath(), path)
+		}
+		if v := c.GetString("audit_region"); v != "" {
+			ev.Region = v
+		}
+		if v := c.GetString("audit_instance"); v != "" {
+			ev.Instance = v
+		}
+		if v := c.GetString("audit_params"); v != "" {
+			ev.Params = v
+		}
+		if id, ok := c.Get("audit_key_id"); ok {
+			ev.KeyID, _ = id.(int64)
+		} else if id, err := strconv.ParseInt(firstNonEmpty(c.PostForm("key_id"), s.GetString("key_id", "")), 10, 64); err == nil {
+			ev.KeyID = id
+		}
+		if v, ok := c.Get("audit_error"); ok {
+			ev.Result = "failed"
+			ev.Error, _ = v.(string)
+		} else if msg := redirectMsg(c); msg != "" && (strings.HasSuffix(msg, "_failed") || auditFailedMsgs[msg]) {
+			ev.Result = "failed"
+			ev.Error = msg
+		} else if c.Writer.Status() >= http.StatusBadRequest {
+			ev.Result = "failed"
+			ev.Error = http.StatusText(c.Writer.Status())
+		}
+		if err := appStore.RecordAudit(c.Request.Context(), ev); err != nil {
+			log.Printf("record audit event failed: %v", err)
+		}
+	}
+}
+
+func auditService(c *gin.Context) string {
+	path := c.Request.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/aws/ec2/"), strings.HasPrefix(path, apiPrefix+"/ec2/"):
+		return "ec2"
+	case strings.HasPrefix(path, apiPrefix+"/lightsail/"):
+		return "lightsail"
+	case strings.HasPrefix(path, apiPrefix+"/quota"):
+		return "servicequotas"
+	case strings.HasPrefix(path, apiPrefix+"/keys"):
+		return "auth"
+	case strings.HasPrefix(path, "/api/"):
+		return "api"
+	case strings.HasPrefix(path, "/aws/quota"):
+		return "servicequotas"
+	case strings.HasPrefix(path, "/aws/"):
+		if svc := strings.TrimSpace(c.PostForm("service")); svc != "" {
+			return svc
+		}
+		return "lightsail"
+	case strings.HasPrefix(path, "/auth/"), path == "/login", path == "/logout", path == "/register":
+		return "auth"
+	default:
+		return "admin"
+	}
+}
+
+func auditParams(c *gin.Context) string {
+	_ = c.Request.ParseForm()
+	params := map[string]string{}
+	for k, vals := range c.Request.PostForm {
+		if auditSecretFields[k] || len(vals) == 0 {
+			continue
+		}
+		v := strings.TrimSpace(vals[0])
+		if k == "ak" {
+			v = maskAccessKey(v)
+		}
+		params[k] = v
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(params)
+	return string(b)
+}
+
+func redirectMsg(c *gin.Context) string {
+	loc := c.Writer.Header().Get("Location")
+	if loc == "" {
+		return ""
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("msg")
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+type AuditPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	IsAdmin   bool
+
+	Events  []store.AuditEvent
+	Total   int
+	Page    int
+	Pages   int
+	Query   url.Values
+	PrevURL string
+	NextURL string
+
+	ExportCSVURL  string
+	ExportJSONURL string
+}
+
+func auditFilterFromQuery(c *gin.Context) store.AuditFilter {
+	f := store.AuditFilter{
+		Username: c.Query("username"),
+		Action:   c.Query("action"),
+		Service:  c.Query("service"),
+		Region:   c.Query("region"),
+		Instance: c.Query("instance"),
+		Result:   c.Query("result"),
+	}
+	if t, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(c.Query("since")), time.Local); err == nil {
+		f.Since = t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(c.Query("until")), time.Local); err == nil {
+		f.Until = t.AddDate(0, 0, 1)
+	}
+	return f
+}
+
+func registerAuditRoutes(r *gin.Engine) {
+	r.GET("/admin/audit", func(c *gin.Context) {
+		s := session.Must(c)
+		if !isAdminSession(s) {
+			c.Redirect(http.StatusFound, "/")
+			return
+		}
+		page, _ := strconv.Atoi(c.Query("page"))
+		if page < 1 {
+			page = 1
+		}
+		f := auditFilterFromQuery(c)
+		f.Limit = auditPageSize
+		f.Offset = (page - 1) * auditPageSize
+		events, total, err := appStore.ListAuditEvents(c.Request.Context(), f)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "load audit events failed: %v", err)
+			return
+		}
+		pages := (total + auditPageSize - 1) / auditPageSize
+		if pages < 1 {
+			pages = 1
+		}
+		query := c.Request.URL.Query()
+		data := AuditPageData{
+			Title:     "AutoSail 审计日志",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			IsAdmin:   true,
+			Events:    events,
+			Total:     total,
+			Page:      page,
+			Pages:     pages,
+			Query:     query,
+		}
+		data.ExportCSVURL = auditExportURL(query, "csv")
+		data.ExportJSONURL = auditExportURL(query, "json")
+		if page > 1 {
+			data.PrevURL = auditPageURL(query, page-1)
+		}
+		if page < pages {
+			data.NextURL = auditPageURL(query, page+1)
+		}
+		c.HTML(http.StatusOK, "audit", data)
+	})
+
+	r.GET("/admin/audit/export", func(c *gin.Context) {
+		s := session.Must(c)
+		if !isAdminSession(s) {
+			c.Redirect(http.StatusFound, "/")
+			return
+		}
+		f := auditFilterFromQuery(c)
+		f.Limit = auditExportMax
+		events, _, err := appStore.ListAuditEvents(c.Request.Context(), f)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "load audit events failed: %v", err)
+			return
+		}
+		filename := "audit-" + time.Now().Format("20060102-150405")
+		if c.Query("format") == "json" {
+			c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+			c.JSON(http.StatusOK, events)
+			return
+		}
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		w := csv.NewWriter(c.Writer)
+		_ = w.Write([]string{"id", "time", "user_id", "username", "key_id", "service", "region", "instance", "action", "params", "result", "error", "client_ip"})
+		for _, e := range events {
+			_ = w.Write([]string{
+				strconv.FormatInt(e.ID, 10),
+				e.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+				strconv.FormatInt(e.UserID, 10),
+				e.Username,
+				strconv.FormatInt(e.KeyID, 10),
+				e.Service,
+				e.Region,
+				e.Instance,
+				e.Action,
+				e.Params,
+				e.Result,
+				e.Error,
+				e.ClientIP,
+			})
+		}
+		w.Flush()
+	})
+}
+
+func auditPageURL(query url.Values, page int) string {
+	q := cloneValues(query)
+	q.Set("page", strconv.Itoa(page))
+	return "/admin/audit?" + q.Encode()
+}
+
+func auditExportURL(query url.Values, format string) string {
+	q := cloneValues(query)
+	q.Del("page")
+	q.Set("format", format)
+	return "/admin/audit/export?" + q.Encode()
+}
+
+func cloneValues(v url.Values) url.Values {
+	out := url.Values{}
+	for k, vals := range v {
+		out[k] = append([]string(nil), vals...)
+	}
+	return out
+}
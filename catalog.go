@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"aws-lightsail-go/internal/aws"
+)
+
+// 镜像与套餐变化很少，按区域缓存；同一区域不同账号看到的目录相同。
+var catalogCache = cache.New(time.Hour, 10*time.Minute)
+
+// lightsailCatalog 返回区域内可用的镜像与套餐，缓存未命中时才创建客户端拉取。
+func lightsailCatalog(ctx context.Context, region string, newClient func() (aws.LightsailAPI, error)) (*aws.LightsailCatalog, error) {
+	if v, ok := catalogCache.Get("lightsail|" + region); ok {
+		return v.(*aws.LightsailCatalog), nil
+	}
+	cli, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	cat, err := aws.GetLightsailCatalog(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	catalogCache.Set("lightsail|"+region, cat, cache.DefaultExpiration)
+	return cat, nil
+}
+
+// ec2InstanceTypes 返回区域内可启动的 EC2 实例类型，按区域缓存。
+func ec2InstanceTypes(ctx context.Context, region string, newClient func() (aws.EC2InstanceTypeAPI, error)) ([]aws.InstanceTypeView, error) {
+	if v, ok := catalogCache.Get("ec2types|" + region); ok {
+		return v.([]aws.InstanceTypeView), nil
+	}
+	cli, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	list, err := aws.ListEC2InstanceTypes(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	catalogCache.Set("ec2types|"+region, list, cache.DefaultExpiration)
+	return list, nil
+}
+
+func instanceTypeOptionsFor(list []aws.InstanceTypeView) []Option {
+	out := make([]Option, 0, len(list))
+	for _, v := range list {
+		out = append(out, Option{ID: v.Type, Name: v.Label()})
+	}
+	return out
+}
+
+func blueprintOptionsFor(cat *aws.LightsailCatalog) []Option {
+	out := make([]Option, 0, len(cat.Blueprints))
+	for _, b := range cat.Blueprints {
+		out = append(out, Option{ID: b.ID, Name: b.Name})
+	}
+	return out
+}
+
+func bundleOptionsFor(cat *aws.LightsailCatalog) []Option {
+	out := make([]Option, 0, len(cat.Bundles))
+	for _, b := range cat.Bundles {
+		out = append(out, Option{ID: b.ID, Name: b.Label()})
+	}
+	return out
+}
+
+var catalogErrorText = map[string]string{
+	"blueprint_unsupported": "该区域不提供所选系统镜像",
+	"bundle_unsupported":    "该区域不提供所选套餐",
+	"ipv6_unsupported":      "所选套餐在该区域没有仅 IPv6 版本",
+}
+
+// lightsailBundleFor 校验镜像与套餐在区域内可用，并在仅 IPv6 时换成对应的 IPv6 套餐 ID。
+func lightsailBundleFor(cat *aws.LightsailCatalog, blueprint, bundle, ipType string) (string, string) {
+	if !cat.HasBlueprint(blueprint) {
+		return "", "blueprint_unsupported"
+	}
+	if !cat.HasBundle(bundle) {
+		return "", "bundle_unsupported"
+	}
+	if ipType != "ipv6" {
+		return bundle, ""
+	}
+	v6, ok := cat.IPv6BundleID(bundle)
+	if !ok {
+		return "", "ipv6_unsupported"
+	}
+	return v6, ""
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+// 新实例的第一块磁盘固定挂到该设备，创建时写入的挂载脚本按此等待设备出现
+const firstDiskPath = "/dev/xvdf"
+
+const (
+	defaultDiskMountPoint = "/data"
+	diskStateTimeout      = 5 * time.Minute
+)
+
+// diskJobParams 是创建并挂载磁盘任务的参数，保存在 Job.Params。
+type diskJobParams struct {
+	Disk       string `json:"disk"`
+	SizeGB     int32  `json:"size_gb"`
+	Zone       string `json:"zone"`
+	Path       string `json:"path"`
+	MountPoint string `json:"mount_point"`
+}
+
+// cachedDisks 与实例列表共用 instCache，磁盘操作后失效。
+func cachedDisks(ctx context.Context, cli aws.LightsailAPI, region string, key *store.Key) ([]aws.DiskView, error) {
+	cacheKey := instCacheKey("disk", region, key)
+	if v, ok := instCache.Get(cacheKey); ok {
+		return v.([]aws.DiskView), nil
+	}
+	list, err := aws.ListDisks(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []aws.DiskView{}
+	}
+	instCache.Set(cacheKey, list, cache.DefaultExpiration)
+	return list, nil
+}
+
+// parseExtraDisk 解析创建实例时附加的磁盘；容量为空或 0 表示不附加，挂载点默认 /data。
+func parseExtraDisk(size, mount string) (int32, string, error) {
+	size = strings.TrimSpace(size)
+	if size == "" || size == "0" {
+		return 0, "", nil
+	}
+	n, err := strconv.Atoi(size)
+	if err != nil || n < aws.MinDiskSizeGB || n > aws.MaxDiskSizeGB {
+		return 0, "", fmt.Errorf("%w：容量需在 %d-%d GB 之间", aws.ErrInvalidDiskSize, aws.MinDiskSizeGB, aws.MaxDiskSizeGB)
+	}
+	mount = firstNonEmpty(strings.TrimSpace(mount), defaultDiskMountPoint)
+	if err := aws.ValidateMountPoint(mount); err != nil {
+		return 0, "", err
+	}
+	return int32(n), mount, nil
+}
+
+// createAndAttachDisk 创建磁盘并挂载到实例。实例刚创建时还不能挂载，先等磁盘与实例都就绪；
+// 任务中断后重新执行时跳过已完成的步骤。
+func createAndAttachDisk(ctx context.Context, cli aws.LightsailAPI, instance string, p diskJobParams) error {
+	list, err := aws.ListDisks(ctx, cli)
+	if err != nil {
+		return err
+	}
+	d, ok := aws.FindDisk(list, p.Disk)
+	if ok && d.AttachedTo == instance {
+		return nil
+	}
+	if !ok {
+		err := aws.CreateDisk(ctx, cli, aws.CreateDiskInput{
+			DiskName:         p.Disk,
+			AvailabilityZone: p.Zone,
+			SizeGB:           p.SizeGB,
+			MountPoint:       p.MountPoint,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := aws.WaitDiskState(ctx, cli, p.Disk, "available", diskStateTimeout); err != nil {
+		return err
+	}
+	if err := aws.WaitInstanceState(ctx, cli, instance, "running", instanceStateTimeout); err != nil {
+		return err
+	}
+	return aws.AttachDisk(ctx, cli, p.Disk, instance, p.Path)
+}
+
+// enqueueDiskJob 提交为新实例创建并挂载磁盘的后台任务。
+func enqueueDiskJob(ctx context.Context, userID int64, key *store.Key, region, instance string, p diskJobParams) (int64, error) {
+	params, err := json.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+	return jobRunner.Enqueue(ctx, store.Job{
+		UserID: userID,
+		KeyID:  key.ID,
+		Kind:   jobKindCreateDisk,
+		Region: region,
+		Target: instance,
+		Params: string(params),
+	})
+}
+
+// attachDisk 把磁盘挂到实例上第一个空闲的设备路径，返回挂载后的磁盘信息。
+func attachDisk(ctx context.Context, cli aws.LightsailAPI, disk, instance string) (aws.DiskView, error) {
+	list, err := aws.ListDisks(ctx, cli)
+	if err != nil {
+		return aws.DiskView{}, err
+	}
+	d, ok := aws.FindDisk(list, disk)
+	if !ok {
+		return aws.DiskView{}, fmt.Errorf("磁盘 %s 不存在", disk)
+	}
+	path, err := aws.NextDiskPath(list, instance)
+	if err != nil {
+		return aws.DiskView{}, err
+	}
+	if err := aws.AttachDisk(ctx, cli, disk, instance, path); err != nil {
+		return aws.DiskView{}, err
+	}
+	d.AttachedTo, d.Path = instance, path
+	return d, nil
+}
+
+func registerDiskRoutes(r *gin.Engine) {
+	r.POST("/aws/disks", func(c *gin.Context) {
+		doManageActionOn(c, "diskcreate", "az", func(ctx *gin.Context, cli aws.LightsailAPI, _ *store.Key, az string) error {
+			region := normalizeRegion(firstNonEmpty(ctx.PostForm("region"), session.Must(ctx).GetString("region", "us-east-1")))
+			size, mount, err := parseExtraDisk(ctx.PostForm("size_gb"), ctx.PostForm("mount_point"))
+			if err == nil && size == 0 {
+				err = errors.New("请填写磁盘容量")
+			}
+			if err != nil {
+				return err
+			}
+			return aws.CreateDisk(ctx.Request.Context(), cli, aws.CreateDiskInput{
+				DiskName:         firstNonEmpty(strings.TrimSpace(ctx.PostForm("disk_name")), aws.DiskName("")),
+				AvailabilityZone: zoneName(region, az),
+				SizeGB:           size,
+				MountPoint:       mount,
+			})
+		})
+	})
+
+	r.POST("/aws/disks/attach", func(c *gin.Context) {
+		doManageActionOn(c, "diskattach", "disk", func(ctx *gin.Context, cli aws.LightsailAPI, _ *store.Key, disk string) error {
+			instance := strings.TrimSpace(ctx.PostForm("instance"))
+			if instance == "" {
+				return errors.New("请选择要挂载的实例")
+			}
+			_, err := attachDisk(ctx.Request.Context(), cli, disk, instance)
+			return err
+		})
+	})
+
+	r.POST("/aws/disks/detach", func(c *gin.Context) {
+		doManageActionOn(c, "diskdetach", "disk", func(ctx *gin.Context, cli aws.LightsailAPI, _ *store.Key, disk string) error {
+			return aws.DetachDisk(ctx.Request.Context(), cli, disk)
+		})
+	})
+
+	r.POST("/aws/disks/delete", func(c *gin.Context) {
+		doManageActionOn(c, "diskdelete", "disk", func(ctx *gin.Context, cli aws.LightsailAPI, _ *store.Key, disk string) error {
+			return aws.DeleteDisk(ctx.Request.Context(), cli, disk)
+		})
+	})
+}
+
+// loadDisksPage 为管理页加载磁盘列表；创建磁盘需要可用区，快照区没有加载时在这里补上。
+func loadDisksPage(c *gin.Context, data *PageData, region string, key *store.Key) {
+	ctx := c.Request.Context()
+	cli, err := aws.NewLightsailClient(ctx, region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		return
+	}
+	list, err := cachedDisks(ctx, cli, region, key)
+	if err != nil {
+		data.Flash.Warn = "拉取磁盘失败：" + formatFlashError(err)
+		return
+	}
+	data.Disks = list
+	if len(data.Zones) == 0 {
+		if zones, err := discoverZones(ctx, "lightsail", region, key); err == nil {
+			data.Zones = zones
+		}
+	}
+}
+
+type apiCreateDiskRequest struct {
+	Name       string `json:"name,omitempty"` // 默认 disk-<时间戳>
+	SizeGB     int32  `json:"size_gb" binding:"required"`
+	AZ         string `json:"az,omitempty"`          // 可用区，例如 us-east-1a 或 a，默认 a
+	MountPoint string `json:"mount_point,omitempty"` // 默认 /data，挂载到实例后按此格式化并挂载
+}
+
+type apiAttachDiskRequest struct {
+	Instance string `json:"instance" binding:"required"`
+}
+
+type apiDiskAttached struct {
+	Disk     string `json:"disk"`
+	Instance string `json:"instance"`
+	Path     string `json:"path"`
+	// MountScript 需要在实例内以 root 执行，格式化（仅新磁盘）并挂载
+	MountScript string `json:"mount_script,omitempty"`
+}
+
+// apiDiskFail 参数错误返回 400，设备路径用尽返回 409，其余按 AWS 错误处理。
+func apiDiskFail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, aws.ErrInvalidDiskSize):
+		apiFail(c, http.StatusBadRequest, "invalid_disk_size", err.Error())
+	case errors.Is(err, aws.ErrInvalidMountPoint):
+		apiFail(c, http.StatusBadRequest, "invalid_mount_point", err.Error())
+	case errors.Is(err, aws.ErrNoFreeDiskPath):
+		apiFail(c, http.StatusConflict, "no_free_disk_path", err.Error())
+	default:
+		apiAWSFail(c, err)
+	}
+}
+
+func apiListLightsailDisks(c *gin.Context) {
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	list, err := cachedDisks(c.Request.Context(), cli, region, key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func apiCreateLightsailDisk(c *gin.Context) {
+	var in apiCreateDiskRequest
+	if !apiBind(c, &in) {
+		return
+	}
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	name := firstNonEmpty(strings.TrimSpace(in.Name), aws.DiskName(""))
+	err := aws.CreateDisk(c.Request.Context(), cli, aws.CreateDiskInput{
+		DiskName:         name,
+		AvailabilityZone: zoneName(region, in.AZ),
+		SizeGB:           in.SizeGB,
+		MountPoint:       firstNonEmpty(strings.TrimSpace(in.MountPoint), defaultDiskMountPoint),
+	})
+	if err != nil {
+		apiDiskFail(c, err)
+		return
+	}
+	instCache.Delete(instCacheKey("disk", region, key))
+	c.JSON(http.StatusCreated, apiCreated{Service: "lightsail", Region: region, Name: name})
+}
+
+func apiAttachLightsailDisk(c *gin.Context) {
+	var in apiAttachDiskRequest
+	if !apiBind(c, &in) {
+		return
+	}
+	disk := strings.TrimSpace(c.Param("name"))
+	instance := strings.TrimSpace(in.Instance)
+	c.Set("audit_instance", instance)
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	d, err := attachDisk(c.Request.Context(), cli, disk, instance)
+	if err != nil {
+		apiDiskFail(c, err)
+		return
+	}
+	instCache.Delete(instCacheKey("disk", region, key))
+	c.JSON(http.StatusOK, apiDiskAttached{Disk: disk, Instance: instance, Path: d.Path, MountScript: d.MountScript()})
+}
+
+func apiDetachLightsailDisk(c *gin.Context) {
+	disk := strings.TrimSpace(c.Param("name"))
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	if err := aws.DetachDisk(c.Request.Context(), cli, disk); err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	instCache.Delete(instCacheKey("disk", region, key))
+	c.JSON(http.StatusOK, apiActionResult{Action: "detach", Region: region, Target: disk})
+}
+
+func apiDeleteLightsailDisk(c *gin.Context) {
+	disk := strings.TrimSpace(c.Param("name"))
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	if err := aws.DeleteDisk(c.Request.Context(), cli, disk); err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	instCache.Delete(instCacheKey("disk", region, key))
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+// dnsClient 返回管理 DNS 区域用的客户端，DNS 接口只在 us-east-1 提供。
+func dnsClient(ctx context.Context, key *store.Key) (aws.LightsailDNSAPI, error) {
+	return aws.NewLightsailClient(ctx, aws.DNSRegion, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+}
+
+// cachedDomains 与实例列表共用 instCache，创建 DNS 区域或修改记录后失效。
+func cachedDomains(ctx context.Context, cli aws.LightsailDNSAPI, key *store.Key) ([]aws.DomainView, error) {
+	cacheKey := instCacheKey("dns", aws.DNSRegion, key)
+	if v, ok := instCache.Get(cacheKey); ok {
+		return v.([]aws.DomainView), nil
+	}
+	list, err := aws.ListDomains(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []aws.DomainView{}
+	}
+	instCache.Set(cacheKey, list, cache.DefaultExpiration)
+	return list, nil
+}
+
+func invalidateDomainCache(key *store.Key) {
+	instCache.Delete(instCacheKey("dns", aws.DNSRegion, key))
+}
+
+// pointDomainAtInstance 按区域重新查出实例，让 domain 下的 name 记录指向实例的 IPv4（优先静态 IP）与 IPv6。
+func pointDomainAtInstance(ctx context.Context, key *store.Key, region, instance, domain, name string) ([]aws.DNSChange, error) {
+	cli, err := aws.NewLightsailClient(ctx, region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		return nil, err
+	}
+	instances, err := cachedInstances(ctx, cli, region, key)
+	if err != nil {
+		return nil, err
+	}
+	var inst *aws.InstanceView
+	for i := range instances {
+		if instances[i].Name == instance {
+			inst = &instances[i]
+		}
+	}
+	if inst == nil {
+		return nil, fmt.Errorf("实例 %s 不存在", instance)
+	}
+	dns, err := dnsClient(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := aws.PointRecordAtInstance(ctx, dns, domain, name, *inst)
+	invalidateDomainCache(key)
+	return changes, err
+}
+
+type DNSPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	Flash     Flash
+
+	KeyName     string
+	Domains     []aws.DomainView
+	Domain      string
+	Records     []aws.DNSRecord
+	RecordTypes []string
+}
+
+func dnsRedirect(c *gin.Context, domain, msg string, err error) {
+	q := url.Values{"msg": {msg}}
+	if domain != "" {
+		q.Set("domain", domain)
+	}
+	if err != nil {
+		auditError(c, err)
+		q.Set("err", formatFlashError(err))
+	}
+	c.Redirect(http.StatusFound, "/dns?"+q.Encode())
+}
+
+// dnsFormKey 返回当前启用的密钥，不可用时跳转回首页。
+func dnsFormKey(c *gin.Context) (*store.Key, bool) {
+	s := session.Must(c)
+	userID, _ := userIDFromSession(s)
+	keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+	key, _ := resolveActiveKey(s, keys)
+	if !keyUsable(key) {
+		c.Redirect(http.StatusFound, "/?tab=manage&msg=needuse")
+		return nil, false
+	}
+	return key, true
+}
+
+func registerDNSRoutes(r *gin.Engine) {
+	r.GET("/dns", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		ctx := c.Request.Context()
+		data := DNSPageData{
+			Title:       "AutoSail DNS",
+			CSRFToken:   s.GetString("csrf_token", ""),
+			Username:    s.GetString("username", ""),
+			RecordTypes: aws.DNSRecordTypes,
+		}
+		errText := strings.TrimSpace(c.Query("err"))
+		switch c.Query("msg") {
+		case "domain_ok":
+			data.Flash.Success = "已创建 DNS 区域，请到域名注册商把 NS 改为区域内的 Lightsail 名称服务器"
+		case "domain_failed":
+			data.Flash.Error = "创建 DNS 区域失败：" + errText
+		case "record_ok":
+			data.Flash.Success = "已添加解析记录"
+		case "record_failed":
+			data.Flash.Error = "添加解析记录失败：" + errText
+		case "recorddelete_ok":
+			data.Flash.Success = "已删除解析记录"
+		case "recorddelete_failed":
+			data.Flash.Error = "删除解析记录失败：" + errText
+		case "point_ok":
+			data.Flash.Success = "已将 " + c.Query("name") + " 指向实例 " + c.Query("instance")
+		case "point_failed":
+			data.Flash.Error = "解析到实例失败：" + errText
+		}
+		keys, _ := appStore.ListKeys(ctx, userID)
+		key, _ := resolveActiveKey(s, keys)
+		if !keyUsable(key) {
+			data.Flash.Warn = "请先在首页启用一个可用的密钥"
+			c.HTML(http.StatusOK, "dns", data)
+			return
+		}
+		data.KeyName = key.Name
+		cli, err := dnsClient(ctx, key)
+		if err == nil {
+			data.Domains, err = cachedDomains(ctx, cli, key)
+		}
+		if err != nil {
+			data.Flash.Error = "拉取域名失败：" + formatFlashError(err)
+			c.HTML(http.StatusOK, "dns", data)
+			return
+		}
+		data.Domain = strings.TrimSpace(c.Query("domain"))
+		if data.Domain == "" && len(data.Domains) > 0 {
+			data.Domain = data.Domains[0].Name
+		}
+		if data.Domain != "" {
+			if data.Records, err = aws.ListDNSRecords(ctx, cli, data.Domain); err != nil {
+				data.Flash.Error = "拉取解析记录失败：" + formatFlashError(err)
+			}
+		}
+		c.HTML(http.StatusOK, "dns", data)
+	})
+
+	r.POST("/aws/dns/domains", func(c *gin.Context) {
+		key, ok := dnsFormKey(c)
+		if !ok {
+			return
+		}
+		domain, err := aws.NormalizeDomain(c.PostForm("domain"))
+		if err == nil {
+			var cli aws.LightsailDNSAPI
+			if cli, err = dnsClient(c.Request.Context(), key); err == nil {
+				err = aws.CreateDomain(c.Request.Context(), cli, domain)
+			}
+		}
+		if err != nil {
+			dnsRedirect(c, "", "domain_failed", err)
+			return
+		}
+		invalidateDomainCache(key)
+		dnsRedirect(c, domain, "domain_ok", nil)
+	})
+
+	r.POST("/aws/dns/records", func(c *gin.Context) {
+		key, ok := dnsFormKey(c)
+		if !ok {
+			return
+		}
+		domain := strings.TrimSpace(c.PostForm("domain"))
+		cli, err := dnsClient(c.Request.Context(), key)
+		if err == nil {
+			err = aws.CreateDNSRecord(c.Request.Context(), cli, domain, aws.DNSRecord{
+				Name:   c.PostForm("name"),
+				Type:   c.PostForm("type"),
+				Target: c.PostForm("target"),
+			})
+		}
+		if err != nil {
+			dnsRedirect(c, domain, "record_failed", err)
+			return
+		}
+		invalidateDomainCache(key)
+		dnsRedirect(c, domain, "record_ok", nil)
+	})
+
+	r.POST("/aws/dns/records/delete", func(c *gin.Context) {
+		key, ok := dnsFormKey(c)
+		if !ok {
+			return
+		}
+		domain := strings.TrimSpace(c.PostForm("domain"))
+		cli, err := dnsClient(c.Request.Context(), key)
+		if err == nil {
+			err = aws.DeleteDNSRecord(c.Request.Context(), cli, domain, strings.TrimSpace(c.PostForm("id")))
+		}
+		if err != nil {
+			dnsRedirect(c, domain, "recorddelete_failed", err)
+			return
+		}
+		invalidateDomainCache(key)
+		dnsRedirect(c, domain, "recorddelete_ok", nil)
+	})
+
+	// 管理页的「解析到此实例」
+	r.POST("/aws/dns/point", func(c *gin.Context) {
+		key, ok := dnsFormKey(c)
+		if !ok {
+			return
+		}
+		s := session.Must(c)
+		region := normalizeRegion(firstNonEmpty(c.PostForm("region"), s.GetString("region", "us-east-1")))
+		instance := strings.TrimSpace(c.PostForm("instance"))
+		domain := strings.TrimSpace(c.PostForm("domain"))
+		name := strings.TrimSpace(c.PostForm("name"))
+		if _, err := pointDomainAtInstance(c.Request.Context(), key, region, instance, domain, name); err != nil {
+			dnsRedirect(c, domain, "point_failed", err)
+			return
+		}
+		fqdn, _ := aws.RecordFQDN(domain, name)
+		c.Redirect(http.StatusFound, "/dns?"+url.Values{"msg": {"point_ok"}, "domain": {domain}, "name": {fqdn}, "instance": {instance}}.Encode())
+	})
+}
+
+// loadDomainsPage 为管理页的「解析到此实例」加载域名列表；没有 DNS 权限时不显示该表单。
+func loadDomainsPage(c *gin.Context, data *PageData, key *store.Key) {
+	ctx := c.Request.Context()
+	cli, err := dnsClient(ctx, key)
+	if err != nil {
+		return
+	}
+	if list, err := cachedDomains(ctx, cli, key); err == nil {
+		data.Domains = list
+	}
+}
+
+type apiDomainInput struct {
+	Domain string `json:"domain" binding:"required"`
+}
+
+type apiDNSRecordInput struct {
+	Name   string `json:"name"` // 相对名（www）或完整域名，空或 @ 为根域名
+	Type   string `json:"type" binding:"required"`
+	Target string `json:"target" binding:"required"` // TXT 的值不带引号时自动补上
+}
+
+type apiPointDNSInput struct {
+	Domain string `json:"domain" binding:"required"`
+	Name   string `json:"name"` // 默认根域名
+}
+
+// apiDNSFail 参数错误返回 400，记录不存在返回 404，其余按 AWS 错误处理。
+func apiDNSFail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, aws.ErrInvalidDomain):
+		apiFail(c, http.StatusBadRequest, "invalid_domain", err.Error())
+	case errors.Is(err, aws.ErrInvalidDNSRecord):
+		apiFail(c, http.StatusBadRequest, "invalid_record", err.Error())
+	case errors.Is(err, aws.ErrDNSRecordNotFound):
+		apiFail(c, http.StatusNotFound, "record_not_found", err.Error())
+	default:
+		apiAWSFail(c, err)
+	}
+}
+
+func apiDNSClient(c *gin.Context) (aws.LightsailDNSAPI, *store.Key, bool) {
+	key, ok := apiKey(c)
+	if !ok {
+		return nil, nil, false
+	}
+	cli, err := dnsClient(c.Request.Context(), key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return nil, nil, false
+	}
+	c.Set("audit_region", aws.DNSRegion)
+	return cli, key, true
+}
+
+func apiListDomains(c *gin.Context) {
+	cli, key, ok := apiDNSClient(c)
+	if !ok {
+		return
+	}
+	list, err := cachedDomains(c.Request.Context(), cli, key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func apiCreateDomain(c *gin.Context) {
+	var in apiDomainInput
+	if !apiBind(c, &in) {
+		return
+	}
+	domain, err := aws.NormalizeDomain(in.Domain)
+	if err != nil {
+		apiDNSFail(c, err)
+		return
+	}
+	cli, key, ok := apiDNSClient(c)
+	if !ok {
+		return
+	}
+	if err := aws.CreateDomain(c.Request.Context(), cli, domain); err != nil {
+		apiDNSFail(c, err)
+		return
+	}
+	invalidateDomainCache(key)
+	c.JSON(http.StatusCreated, apiCreated{Service: "lightsail", Region: aws.DNSRegion, Name: domain})
+}
+
+func apiListDNSRecords(c *gin.Context) {
+	cli, _, ok := apiDNSClient(c)
+	if !ok {
+		return
+	}
+	list, err := aws.ListDNSRecords(c.Request.Context(), cli, strings.TrimSpace(c.Param("domain")))
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	if list == nil {
+		list = []aws.DNSRecord{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func apiCreateDNSRecord(c *gin.Context) {
+	var in apiDNSRecordInput
+	if !apiBind(c, &in) {
+		return
+	}
+	domain := strings.TrimSpace(c.Param("domain"))
+	fqdn, err := aws.RecordFQDN(domain, in.Name)
+	if err != nil {
+		apiDNSFail(c, err)
+		return
+	}
+	cli, key, ok := apiDNSClient(c)
+	if !ok {
+		return
+	}
+	if err := aws.CreateDNSRecord(c.Request.Context(), cli, domain, aws.DNSRecord{Name: fqdn, Type: in.Type, Target: in.Target}); err != nil {
+		apiDNSFail(c, err)
+		return
+	}
+	invalidateDomainCache(key)
+	c.JSON(http.StatusCreated, apiCreated{Service: "lightsail", Region: aws.DNSRegion, Name: fqdn})
+}
+
+func apiDeleteDNSRecord(c *gin.Context) {
+	cli, key, ok := apiDNSClient(c)
+	if !ok {
+		return
+	}
+	if err := aws.DeleteDNSRecord(c.Request.Context(), cli, strings.TrimSpace(c.Param("domain")), strings.TrimSpace(c.Param("id"))); err != nil {
+		apiDNSFail(c, err)
+		return
+	}
+	invalidateDomainCache(key)
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
+
+func apiPointDNSAtInstance(c *gin.Context) {
+	var in apiPointDNSInput
+	if !apiBind(c, &in) {
+		return
+	}
+	name := strings.TrimSpace(c.Param("name"))
+	c.Set("audit_instance", name)
+	region := apiRegion(c, "")
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	changes, err := pointDomainAtInstance(c.Request.Context(), key, region, name, strings.TrimSpace(in.Domain), in.Name)
+	if err != nil {
+		apiDNSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
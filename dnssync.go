@@ -0,0 +1,663 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/dnsprovider"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+const (
+	// 单次同步所有绑定的总超时，外部 DNS 服务商较慢时避免拖住后台任务
+	dnsSyncTimeout = 2 * time.Minute
+	// 等待实例拿到新公网地址时的轮询间隔
+	dnsSyncPollInterval = 10 * time.Second
+)
+
+// dnsSyncResult 是一条绑定的同步结果。
+type dnsSyncResult struct {
+	BindingID int64  `json:"binding_id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Value     string `json:"value,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// instanceAddresses 不走缓存，重新查询实例当前的 IPv4（Lightsail 优先静态 IP）与 IPv6。
+func instanceAddresses(ctx context.Context, key *store.Key, service, region, instance string) (string, string, error) {
+	ak, sk, proxy := strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy)
+	if service == "ec2" {
+		cli, err := aws.NewEC2Client(ctx, region, ak, sk, proxy)
+		if err != nil {
+			return "", "", err
+		}
+		list, err := aws.ListEC2Instances(ctx, cli)
+		if err != nil {
+			return "", "", err
+		}
+		for _, inst := range list {
+			if inst.ID == instance {
+				return inst.PublicIPv4, inst.PublicIPv6, nil
+			}
+		}
+		return "", "", fmt.Errorf("实例 %s 不存在", instance)
+	}
+	cli, err := aws.NewLightsailClient(ctx, region, ak, sk, proxy)
+	if err != nil {
+		return "", "", err
+	}
+	list, err := aws.ListInstances(ctx, cli)
+	if err != nil {
+		return "", "", err
+	}
+	for _, inst := range list {
+		if inst.Name == instance {
+			return aws.InstanceIPv4(inst), inst.PublicIPv6, nil
+		}
+	}
+	return "", "", fmt.Errorf("实例 %s 不存在", instance)
+}
+
+// loadDNSProvider 读取服务商配置，请求经过 proxy（实例所属密钥的代理）发出。
+func loadDNSProvider(ctx context.Context, userID, id int64, proxy string) (dnsprovider.Provider, error) {
+	p, err := appStore.GetDNSProvider(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	var cfg dnsprovider.Config
+	if err := json.Unmarshal([]byte(p.Config), &cfg); err != nil {
+		return nil, fmt.Errorf("DNS 服务商 %s 的配置无效：%w", p.Name, err)
+	}
+	hc, err := aws.NewHTTPClient(strings.TrimSpace(proxy))
+	if err != nil {
+		return nil, fmt.Errorf("代理地址无效：%w", err)
+	}
+	return dnsprovider.New(p.Kind, cfg, hc)
+}
+
+// syncInstanceDNS 把绑定到实例的外部 DNS 记录改写为实例当前的地址，每条绑定的结果写回数据库。
+// 没有绑定时返回空结果；任一记录失败时返回错误，其余记录照常更新。
+func syncInstanceDNS(ctx context.Context, userID int64, key *store.Key, region, instance string) ([]dnsSyncResult, error) {
+	bindings, err := appStore.ListInstanceDNSBindings(ctx, userID, key.ID, region, instance)
+	if err != nil || len(bindings) == 0 {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dnsSyncTimeout)
+	defer cancel()
+	v4, v6, err := instanceAddresses(ctx, key, bindings[0].Service, region, instance)
+	if err != nil {
+		return nil, err
+	}
+	providers := map[int64]dnsprovider.Provider{}
+	out := make([]dnsSyncResult, 0, len(bindings))
+	failed := 0
+	for _, b := range bindings {
+		res := dnsSyncResult{BindingID: b.ID, Name: b.Name, Type: b.Type, Value: v4}
+		if b.Type == "AAAA" {
+			res.Value = v6
+		}
+		err := func() error {
+			if res.Value == "" {
+				return fmt.Errorf("实例当前没有公网 %s 地址", map[string]string{"A": "IPv4", "AAAA": "IPv6"}[b.Type])
+			}
+			p, ok := providers[b.ProviderID]
+			if !ok {
+				var err error
+				if p, err = loadDNSProvider(ctx, userID, b.ProviderID, key.Proxy); err != nil {
+					return err
+				}
+				providers[b.ProviderID] = p
+			}
+			return p.SetRecord(ctx, dnsprovider.Record{Zone: b.Zone, Name: b.Name, Type: b.Type, Value: res.Value, TTL: b.TTL})
+		}()
+		if err != nil {
+			res.Error = err.Error()
+			failed++
+		}
+		if e := appStore.RecordDNSBindingSync(ctx, b.ID, res.Value, res.Error); e != nil && err == nil {
+			res.Error = e.Error()
+			failed++
+		}
+		out = append(out, res)
+	}
+	if failed > 0 {
+		return out, fmt.Errorf("%d 条 DNS 记录更新失败", failed)
+	}
+	return out, nil
+}
+
+// syncJobDNS 在换 IP 等后台任务之后同步外部 DNS，每条记录的结果写入任务步骤。
+func syncJobDNS(ctx context.Context, job *store.Job, report func(string)) error {
+	key, err := loadJobKey(ctx, job)
+	if err != nil {
+		return err
+	}
+	results, err := syncInstanceDNS(ctx, job.UserID, key, job.Region, job.Target)
+	for _, r := range results {
+		if r.Error != "" {
+			report(fmt.Sprintf("DNS %s %s 更新失败：%s", r.Type, r.Name, r.Error))
+		} else {
+			report(fmt.Sprintf("DNS %s %s → %s", r.Type, r.Name, r.Value))
+		}
+	}
+	return err
+}
+
+// enqueueDNSSync 在会改变实例地址、但本身不是后台任务的操作（EC2 启动、从快照重建实例）之后调用：
+// 实例有绑定的记录时排队一个任务，等实例拿到新地址再改写外部 DNS。排队失败只记日志，不影响原操作。
+func enqueueDNSSync(ctx context.Context, userID int64, key *store.Key, kind, region, instance string) {
+	bindings, err := appStore.ListInstanceDNSBindings(ctx, userID, key.ID, region, instance)
+	if err != nil {
+		log.Printf("list dns bindings for %s failed: %v", instance, err)
+		return
+	}
+	if len(bindings) == 0 {
+		return
+	}
+	if _, err := jobRunner.Enqueue(ctx, store.Job{UserID: userID, KeyID: key.ID, Kind: kind, Region: region, Target: instance}); err != nil {
+		log.Printf("enqueue dns sync for %s failed: %v", instance, err)
+	}
+}
+
+// runDNSSyncJob 等实例拿到绑定记录需要的公网地址（最多 instanceStateTimeout）后同步外部 DNS。
+// 超时仍按当前地址同步，缺少的地址会记为该条记录失败。
+func runDNSSyncJob(ctx context.Context, job *store.Job, report func(string)) error {
+	key, err := loadJobKey(ctx, job)
+	if err != nil {
+		return err
+	}
+	bindings, err := appStore.ListInstanceDNSBindings(ctx, job.UserID, key.ID, job.Region, job.Target)
+	if err != nil {
+		return err
+	}
+	if len(bindings) == 0 {
+		report("实例没有绑定的外部 DNS 记录")
+		return nil
+	}
+	needV4, needV6 := false, false
+	for _, b := range bindings {
+		if b.Type == "AAAA" {
+			needV6 = true
+		} else {
+			needV4 = true
+		}
+	}
+	report("等待实例拿到公网地址")
+	deadline := time.Now().Add(instanceStateTimeout)
+	for {
+		v4, v6, err := instanceAddresses(ctx, key, bindings[0].Service, job.Region, job.Target)
+		if err == nil && (!needV4 || v4 != "") && (!needV6 || v6 != "") {
+			break
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return err
+			}
+			report("等待公网地址超时，按当前地址同步")
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(dnsSyncPollInterval):
+		}
+	}
+	return syncJobDNS(ctx, job, report)
+}
+
+type DNSProviderView struct {
+	ID        int64
+	Name      string
+	Kind      string
+	KindLabel string
+	Summary   string
+	CreatedAt time.Time
+}
+
+type DNSBindingView struct {
+	store.DNSBinding
+	ProviderName string
+	KeyName      string
+}
+
+type DNSKindOption struct {
+	ID    string
+	Label string
+}
+
+type DNSSyncPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	Flash     Flash
+
+	Region    string
+	Regions   []RegionOption
+	KeyName   string
+	Kinds     []DNSKindOption
+	Providers []DNSProviderView
+	Bindings  []DNSBindingView
+}
+
+func dnsProviderViews(list []store.DNSProvider) []DNSProviderView {
+	out := make([]DNSProviderView, 0, len(list))
+	for _, p := range list {
+		var cfg dnsprovider.Config
+		_ = json.Unmarshal([]byte(p.Config), &cfg)
+		out = append(out, DNSProviderView{ID: p.ID, Name: p.Name, Kind: p.Kind, KindLabel: dnsprovider.KindLabel(p.Kind), Summary: dnsprovider.Describe(p.Kind, cfg), CreatedAt: p.CreatedAt})
+	}
+	return out
+}
+
+// newDNSProvider 校验配置能创建出 Provider 后再保存，避免保存了缺少字段的账号。
+func newDNSProvider(ctx context.Context, userID int64, name, kind string, cfg dnsprovider.Config) (*store.DNSProvider, error) {
+	if _, err := dnsprovider.New(kind, cfg, nil); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &store.DNSProvider{UserID: userID, Name: name, Kind: kind, Config: string(b)}
+	return p, appStore.CreateDNSProvider(ctx, p)
+}
+
+func dnsSyncRedirect(c *gin.Context, msg string, err error) {
+	q := url.Values{"msg": {msg}}
+	if err != nil {
+		auditError(c, err)
+		q.Set("err", formatFlashError(err))
+	}
+	c.Redirect(http.StatusFound, "/dns-sync?"+q.Encode())
+}
+
+func registerDNSSyncRoutes(r *gin.Engine) {
+	r.GET("/dns-sync", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		ctx := c.Request.Context()
+		keys, _ := appStore.ListKeys(ctx, userID)
+		data := DNSSyncPageData{
+			Title:     "AutoSail 外部 DNS",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Region:    normalizeRegion(s.GetString("region", "us-east-1")),
+			Regions:   allRegionOptions(),
+		}
+		for _, k := range dnsprovider.Kinds {
+			data.Kinds = append(data.Kinds, DNSKindOption{ID: k, Label: dnsprovider.KindLabel(k)})
+		}
+		if key, _ := resolveActiveKey(s, keys); key != nil {
+			data.KeyName = key.Name
+		}
+		providers, err := appStore.ListDNSProviders(ctx, userID)
+		if err != nil {
+			data.Flash.Error = "读取 DNS 服务商失败：" + formatFlashError(err)
+		}
+		data.Providers = dnsProviderViews(providers)
+		bindings, _ := appStore.ListDNSBindings(ctx, userID)
+		for _, b := range bindings {
+			v := DNSBindingView{DNSBinding: b}
+			for _, p := range data.Providers {
+				if p.ID == b.ProviderID {
+					v.ProviderName = p.Name
+				}
+			}
+			if k := findKeyByID(keys, b.KeyID); k != nil {
+				v.KeyName = k.Name
+			}
+			data.Bindings = append(data.Bindings, v)
+		}
+		errText := strings.TrimSpace(c.Query("err"))
+		switch c.Query("msg") {
+		case "provider_ok":
+			data.Flash.Success = "已保存 DNS 服务商"
+		case "provider_failed":
+			data.Flash.Error = "保存 DNS 服务商失败：" + errText
+		case "providerdelete_ok":
+			data.Flash.Success = "已删除 DNS 服务商及其绑定"
+		case "binding_ok":
+			data.Flash.Success = "已绑定记录，实例换 IP 后会自动更新；可点击「立即同步」写入当前地址"
+		case "binding_failed":
+			data.Flash.Error = "绑定记录失败：" + errText
+		case "bindingdelete_ok":
+			data.Flash.Success = "已删除绑定（外部 DNS 上的记录保持不变）"
+		case "sync_ok":
+			data.Flash.Success = "已将实例 " + c.Query("instance") + " 的绑定记录更新为当前地址"
+		case "sync_failed":
+			data.Flash.Error = "同步失败：" + errText
+		case "needuse":
+			data.Flash.Warn = "请先在首页启用一个密钥，绑定会关联到当前启用的密钥"
+		}
+		c.HTML(http.StatusOK, "dnssync", data)
+	})
+
+	r.POST("/aws/dns-sync/providers", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		cfg := dnsprovider.Config{
+			APIToken:      c.PostForm("api_token"),
+			AccessKey:     c.PostForm("access_key"),
+			SecretKey:     c.PostForm("secret_key"),
+			HostedZoneID:  c.PostForm("hosted_zone_id"),
+			Server:        c.PostForm("server"),
+			TSIGName:      c.PostForm("tsig_name"),
+			TSIGSecret:    c.PostForm("tsig_secret"),
+			TSIGAlgorithm: c.PostForm("tsig_algorithm"),
+		}
+		if _, err := newDNSProvider(c.Request.Context(), userID, c.PostForm("name"), c.PostForm("kind"), cfg); err != nil {
+			dnsSyncRedirect(c, "provider_failed", err)
+			return
+		}
+		dnsSyncRedirect(c, "provider_ok", nil)
+	})
+
+	r.POST("/aws/dns-sync/providers/delete", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		id, _ := strconv.ParseInt(strings.TrimSpace(c.PostForm("provider_id")), 10, 64)
+		if err := appStore.DeleteDNSProvider(c.Request.Context(), userID, id); err != nil && !errors.Is(err, store.ErrDNSProviderNotFound) {
+			dnsSyncRedirect(c, "provider_failed", err)
+			return
+		}
+		dnsSyncRedirect(c, "providerdelete_ok", nil)
+	})
+
+	r.POST("/aws/dns-sync/bindings", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+		activeKey, _ := resolveActiveKey(s, keys)
+		if activeKey == nil {
+			c.Redirect(http.StatusFound, "/dns-sync?msg=needuse")
+			return
+		}
+		providerID, _ := strconv.ParseInt(strings.TrimSpace(c.PostForm("provider_id")), 10, 64)
+		ttl, _ := strconv.Atoi(strings.TrimSpace(c.PostForm("ttl")))
+		b := &store.DNSBinding{
+			UserID:     userID,
+			ProviderID: providerID,
+			KeyID:      activeKey.ID,
+			Service:    firstNonEmpty(c.PostForm("service"), "lightsail"),
+			Region:     normalizeRegion(c.PostForm("region")),
+			Instance:   c.PostForm("instance"),
+			Zone:       c.PostForm("zone"),
+			Name:       c.PostForm("name"),
+			Type:       c.PostForm("type"),
+			TTL:        ttl,
+		}
+		if err := appStore.CreateDNSBinding(c.Request.Context(), b); err != nil {
+			dnsSyncRedirect(c, "binding_failed", dnsBindingError(err))
+			return
+		}
+		dnsSyncRedirect(c, "binding_ok", nil)
+	})
+
+	r.POST("/aws/dns-sync/bindings/delete", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		id, _ := strconv.ParseInt(strings.TrimSpace(c.PostForm("binding_id")), 10, 64)
+		if err := appStore.DeleteDNSBinding(c.Request.Context(), userID, id); err != nil && !errors.Is(err, store.ErrDNSBindingNotFound) {
+			dnsSyncRedirect(c, "binding_failed", err)
+			return
+		}
+		dnsSyncRedirect(c, "bindingdelete_ok", nil)
+	})
+
+	// 「立即同步」按绑定所属的密钥、区域与实例同步该实例的全部绑定
+	r.POST("/aws/dns-sync/sync", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		ctx := c.Request.Context()
+		region := normalizeRegion(c.PostForm("region"))
+		instance := strings.TrimSpace(c.PostForm("instance"))
+		keyID, _ := strconv.ParseInt(strings.TrimSpace(c.PostForm("key_id")), 10, 64)
+		keys, _ := appStore.ListKeys(ctx, userID)
+		key := findKeyByID(keys, keyID)
+		if !keyUsable(key) {
+			dnsSyncRedirect(c, "sync_failed", errors.New("绑定使用的密钥已被删除或不可用"))
+			return
+		}
+		if _, err := syncInstanceDNS(ctx, userID, key, region, instance); err != nil {
+			dnsSyncRedirect(c, "sync_failed", err)
+			return
+		}
+		c.Redirect(http.StatusFound, "/dns-sync?"+url.Values{"msg": {"sync_ok"}, "instance": {instance}}.Encode())
+	})
+}
+
+// dnsBindingError 把校验错误换成可读的提示。
+func dnsBindingError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrInvalidDNSBinding):
+		return errors.New("记录名需位于区域内，类型为 A 或 AAAA，且需填写区域与实例")
+	case errors.Is(err, store.ErrDNSBindingExists):
+		return errors.New("该服务商下的同名同类型记录已绑定到其他实例")
+	case errors.Is(err, store.ErrDNSProviderNotFound):
+		return errors.New("DNS 服务商不存在")
+	}
+	return err
+}
+
+type apiDNSProvider struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Summary   string    `json:"summary"` // 不含密钥的配置摘要
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type apiDNSProviderInput struct {
+	Name string `json:"name" binding:"required"`
+	Kind string `json:"kind" binding:"required"` // cloudflare、route53 或 rfc2136
+	dnsprovider.Config
+}
+
+type apiDNSBinding struct {
+	ID         int64      `json:"id"`
+	ProviderID int64      `json:"provider_id"`
+	KeyID      int64      `json:"key_id"`
+	Service    string     `json:"service"`
+	Region     string     `json:"region"`
+	Instance   string     `json:"instance"`
+	Zone       string     `json:"zone"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	TTL        int        `json:"ttl"`
+	LastValue  string     `json:"last_value,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	SyncedAt   *time.Time `json:"synced_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type apiDNSBindingInput struct {
+	ProviderID int64  `json:"provider_id" binding:"required"`
+	Service    string `json:"service"` // lightsail（默认）或 ec2
+	Region     string `json:"region" binding:"required"`
+	Instance   string `json:"instance" binding:"required"` // Lightsail 为实例名，EC2 为实例 ID
+	Zone       string `json:"zone" binding:"required"`
+	Name       string `json:"name" binding:"required"` // 完整域名
+	Type       string `json:"type" binding:"required"` // A 或 AAAA
+	TTL        int    `json:"ttl,omitempty"`           // 默认 300
+}
+
+type apiDNSSyncInput struct {
+	Region   string `json:"region" binding:"required"`
+	Instance string `json:"instance" binding:"required"`
+}
+
+func toAPIDNSBinding(b *store.DNSBinding) apiDNSBinding {
+	out := apiDNSBinding{ID: b.ID, ProviderID: b.ProviderID, KeyID: b.KeyID, Service: b.Service, Region: b.Region, Instance: b.Instance, Zone: b.Zone, Name: b.Name, Type: b.Type, TTL: b.TTL, LastValue: b.LastValue, LastError: b.LastError, CreatedAt: b.CreatedAt}
+	if !b.SyncedAt.IsZero() {
+		out.SyncedAt = &b.SyncedAt
+	}
+	return out
+}
+
+func apiListDNSProviders(c *gin.Context) {
+	list, err := appStore.ListDNSProviders(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取 DNS 服务商失败")
+		return
+	}
+	out := make([]apiDNSProvider, 0, len(list))
+	for _, v := range dnsProviderViews(list) {
+		out = append(out, apiDNSProvider{ID: v.ID, Name: v.Name, Kind: v.Kind, Summary: v.Summary, CreatedAt: v.CreatedAt})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateDNSProvider(c *gin.Context) {
+	var in apiDNSProviderInput
+	if !apiBind(c, &in) {
+		return
+	}
+	p, err := newDNSProvider(c.Request.Context(), apiUserID(c), in.Name, in.Kind, in.Config)
+	switch {
+	case errors.Is(err, dnsprovider.ErrUnknownKind), errors.Is(err, dnsprovider.ErrInvalidConfig), errors.Is(err, store.ErrInvalidDNSProvider):
+		apiFail(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	case errors.Is(err, store.ErrDNSProviderExists):
+		apiFail(c, http.StatusConflict, "provider_exists", "同名 DNS 服务商已存在")
+		return
+	case err != nil:
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "保存 DNS 服务商失败")
+		return
+	}
+	c.JSON(http.StatusCreated, apiDNSProvider{ID: p.ID, Name: p.Name, Kind: p.Kind, Summary: dnsprovider.Describe(p.Kind, in.Config), CreatedAt: p.CreatedAt})
+}
+
+func apiDeleteDNSProvider(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "服务商 ID 无效")
+		return
+	}
+	if err := appStore.DeleteDNSProvider(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, store.ErrDNSProviderNotFound) {
+			apiFail(c, http.StatusNotFound, "provider_not_found", "DNS 服务商不存在")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "删除 DNS 服务商失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
+
+func apiListDNSBindings(c *gin.Context) {
+	list, err := appStore.ListDNSBindings(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取 DNS 绑定失败")
+		return
+	}
+	out := make([]apiDNSBinding, 0, len(list))
+	for i := range list {
+		out = append(out, toAPIDNSBinding(&list[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateDNSBinding(c *gin.Context) {
+	var in apiDNSBindingInput
+	if !apiBind(c, &in) {
+		return
+	}
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	b := &store.DNSBinding{
+		UserID:     apiUserID(c),
+		ProviderID: in.ProviderID,
+		KeyID:      key.ID,
+		Service:    firstNonEmpty(in.Service, "lightsail"),
+		Region:     normalizeRegion(in.Region),
+		Instance:   in.Instance,
+		Zone:       in.Zone,
+		Name:       in.Name,
+		Type:       in.Type,
+		TTL:        in.TTL,
+	}
+	c.Set("audit_region", b.Region)
+	c.Set("audit_instance", strings.TrimSpace(b.Instance))
+	if err := appStore.CreateDNSBinding(c.Request.Context(), b); err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidDNSBinding):
+			apiFail(c, http.StatusBadRequest, "invalid_request", dnsBindingError(err).Error())
+		case errors.Is(err, store.ErrDNSProviderNotFound):
+			apiFail(c, http.StatusNotFound, "provider_not_found", "DNS 服务商不存在")
+		case errors.Is(err, store.ErrDNSBindingExists):
+			apiFail(c, http.StatusConflict, "binding_exists", dnsBindingError(err).Error())
+		default:
+			auditError(c, err)
+			apiFail(c, http.StatusInternalServerError, "internal", "保存 DNS 绑定失败")
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, toAPIDNSBinding(b))
+}
+
+func apiDeleteDNSBinding(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "绑定 ID 无效")
+		return
+	}
+	if err := appStore.DeleteDNSBinding(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, store.ErrDNSBindingNotFound) {
+			apiFail(c, http.StatusNotFound, "binding_not_found", "DNS 绑定不存在")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "删除 DNS 绑定失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
+
+// apiSyncDNSBindings 立即把实例的绑定记录改写为当前地址；部分记录失败时返回 502 及逐条结果。
+func apiSyncDNSBindings(c *gin.Context) {
+	var in apiDNSSyncInput
+	if !apiBind(c, &in) {
+		return
+	}
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	region := normalizeRegion(in.Region)
+	instance := strings.TrimSpace(in.Instance)
+	c.Set("audit_region", region)
+	c.Set("audit_instance", instance)
+	results, err := syncInstanceDNS(c.Request.Context(), apiUserID(c), key, region, instance)
+	if results == nil {
+		results = []dnsSyncResult{}
+	}
+	if err != nil {
+		auditError(c, err)
+		if len(results) == 0 {
+			apiAWSFail(c, err)
+			return
+		}
+		c.JSON(http.StatusBadGateway, results)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
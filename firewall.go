@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+// 创建实例时 firewall 字段的取值：除这两个外都是防火墙模板 ID
+const (
+	firewallDefault = "default"
+	firewallAll     = "all"
+)
+
+type FirewallProfileView struct {
+	ID        int64
+	Name      string
+	Rules     []aws.FirewallRule
+	RulesText string
+}
+
+type FirewallPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	Flash     Flash
+
+	Region    string
+	Instance  string
+	Rules     []aws.FirewallRule
+	RulesText string
+	Profiles  []FirewallProfileView
+}
+
+func toFirewallProfileView(p *store.FirewallProfile) FirewallProfileView {
+	rules, _ := decodeFirewallRules(p.Rules)
+	return FirewallProfileView{ID: p.ID, Name: p.Name, Rules: rules, RulesText: aws.FormatFirewallRules(rules)}
+}
+
+func decodeFirewallRules(raw string) ([]aws.FirewallRule, error) {
+	var rules []aws.FirewallRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func saveFirewallProfile(ctx context.Context, userID int64, name string, rules []aws.FirewallRule) (*store.FirewallProfile, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, errors.New("模板名称不能为空")
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("模板至少需要一条规则")
+	}
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	p := &store.FirewallProfile{UserID: userID, Name: name, Rules: string(raw)}
+	if err := appStore.CreateFirewallProfile(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// firewallRulesFor 把创建表单的 firewall 取值转换成规则：默认规则返回 nil，“all” 为开放全部端口。
+func firewallRulesFor(ctx context.Context, userID int64, choice string) ([]aws.FirewallRule, error) {
+	switch choice {
+	case "", firewallDefault:
+		return nil, nil
+	case firewallAll:
+		return []aws.FirewallRule{aws.AllPortsRule()}, nil
+	}
+	id, err := strconv.ParseInt(choice, 10, 64)
+	if err != nil {
+		return nil, store.ErrProfileNotFound
+	}
+	return firewallProfileRules(ctx, userID, id)
+}
+
+func firewallProfileRules(ctx context.Context, userID, id int64) ([]aws.FirewallRule, error) {
+	p, err := appStore.GetFirewallProfile(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFirewallRules(p.Rules)
+}
+
+func firewallOptionsFor(profiles []store.FirewallProfile) []Option {
+	out := []Option{{ID: firewallDefault, Name: "默认规则"}, {ID: firewallAll, Name: "⚠️ 开放全部端口"}}
+	for _, p := range profiles {
+		out = append(out, Option{ID: strconv.FormatInt(p.ID, 10), Name: "模板：" + p.Name})
+	}
+	return out
+}
+
+func firewallPageURL(region, instance string) string {
+	return "/firewall?region=" + url.QueryEscape(region) + "&instance=" + url.QueryEscape(instance)
+}
+
+// doFirewallAction 与 doManageAction 类似，但操作后回到防火墙页面。
+func doFirewallAction(c *gin.Context, action string, fn func(ctx context.Context, cli aws.LightsailAPI, userID int64, name string) error) {
+	s := session.Must(c)
+	userID, _ := userIDFromSession(s)
+	region := normalizeRegion(firstNonEmpty(c.PostForm("region"), s.GetString("region", "us-east-1")))
+	name := strings.TrimSpace(c.PostForm("instance"))
+	back := firewallPageURL(region, name)
+	keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+	activeKey, _ := resolveActiveKey(s, keys)
+	if !keyUsable(activeKey) {
+		c.Redirect(http.StatusFound, back+"&msg=needuse")
+		return
+	}
+	if name == "" {
+		c.Redirect(http.StatusFound, "/?tab=manage&region="+region)
+		return
+	}
+	cli, err := aws.NewLightsailClient(c.Request.Context(), region, strings.TrimSpace(activeKey.AccessKey), strings.TrimSpace(activeKey.SecretKey), strings.TrimSpace(activeKey.Proxy))
+	if err != nil {
+		auditError(c, err)
+		c.Redirect(http.StatusFound, back+"&msg=err_client")
+		return
+	}
+	if err := fn(c.Request.Context(), cli, userID, name); err != nil {
+		auditError(c, err)
+		c.Redirect(http.StatusFound, back+"&msg="+action+"_failed&err="+url.QueryEscape(formatFlashError(err)))
+		return
+	}
+	c.Redirect(http.StatusFound, back+"&msg="+action+"_ok")
+}
+
+func registerFirewallRoutes(r *gin.Engine) {
+	r.GET("/firewall", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		region := normalizeRegion(firstNonEmpty(c.Query("region"), s.GetString("region", "us-east-1")))
+		data := FirewallPageData{
+			Title:     "AutoSail 防火墙",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Region:    region,
+			Instance:  strings.TrimSpace(c.Query("instance")),
+		}
+		profiles, err := appStore.ListFirewallProfiles(c.Request.Context(), userID)
+		if err != nil {
+			data.Flash.Error = "读取防火墙模板失败：" + err.Error()
+		}
+		for i := range profiles {
+			data.Profiles = append(data.Profiles, toFirewallProfileView(&profiles[i]))
+		}
+
+		if data.Instance != "" {
+			keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+			activeKey, _ := resolveActiveKey(s, keys)
+			if !keyUsable(activeKey) {
+				data.Flash.Warn = "请先启用一个有效密钥"
+			} else if cli, err := aws.NewLightsailClient(c.Request.Context(), region, strings.TrimSpace(activeKey.AccessKey), strings.TrimSpace(activeKey.SecretKey), strings.TrimSpace(activeKey.Proxy)); err != nil {
+				data.Flash.Error = "创建 Lightsail client 失败：" + err.Error()
+			} else if rules, err := aws.GetFirewallRules(c.Request.Context(), cli, data.Instance); err != nil {
+				data.Flash.Error = formatFlashError(err)
+			} else {
+				data.Rules = rules
+				data.RulesText = aws.FormatFirewallRules(rules)
+			}
+		}
+
+		errMsg := strings.TrimSpace(c.Query("err"))
+		switch c.Query("msg") {
+		case "needuse":
+			data.Flash.Warn = "请先选择密钥并点击“使用此密钥”"
+		case "err_client":
+			data.Flash.Error = "AWS 客户端初始化失败"
+		case "open_ok":
+			data.Flash.Success = "已添加规则"
+		case "close_ok":
+			data.Flash.Success = "已删除规则"
+		case "put_ok":
+			data.Flash.Success = "已应用整套规则"
+		case "open_failed", "close_failed", "put_failed":
+			data.Flash.Error = "操作失败：" + errMsg
+		case "profile_saved":
+			data.Flash.Success = "已保存防火墙模板"
+		case "profile_deleted":
+			data.Flash.Success = "已删除防火墙模板"
+		case "profile_exists":
+			data.Flash.Warn = "已存在同名模板"
+		case "profile_failed":
+			data.Flash.Error = "保存模板失败：" + errMsg
+		}
+		c.HTML(http.StatusOK, "firewall", data)
+	})
+
+	r.POST("/aws/firewall/open", func(c *gin.Context) {
+		doFirewallAction(c, "open", func(ctx context.Context, cli aws.LightsailAPI, _ int64, name string) error {
+			line := strings.Join([]string{c.PostForm("protocol"), c.PostForm("ports"), strings.ReplaceAll(c.PostForm("cidrs"), ",", " ")}, " ")
+			rules, err := aws.ParseFirewallRules(line)
+			if err != nil {
+				return err
+			}
+			return aws.OpenFirewallRule(ctx, cli, name, rules[0])
+		})
+	})
+
+	r.POST("/aws/firewall/close", func(c *gin.Context) {
+		doFirewallAction(c, "close", func(ctx context.Context, cli aws.LightsailAPI, _ int64, name string) error {
+			rules, err := aws.ParseFirewallRules(c.PostForm("rule"))
+			if err != nil {
+				return err
+			}
+			if len(rules) != 1 {
+				return errors.New("每次只能删除一条规则")
+			}
+			return aws.CloseFirewallRule(ctx, cli, name, rules[0])
+		})
+	})
+
+	// 整体替换：使用文本规则或防火墙模板
+	r.POST("/aws/firewall/put", func(c *gin.Context) {
+		doFirewallAction(c, "put", func(ctx context.Context, cli aws.LightsailAPI, userID int64, name string) error {
+			var rules []aws.FirewallRule
+			var err error
+			if id := strings.TrimSpace(c.PostForm("profile_id")); id != "" {
+				rules, err = firewallRulesFor(ctx, userID, id)
+			} else {
+				rules, err = aws.ParseFirewallRules(c.PostForm("rules"))
+			}
+			if err != nil {
+				return err
+			}
+			return aws.PutFirewallRules(ctx, cli, name, rules)
+		})
+	})
+
+	r.POST("/aws/firewall/profiles", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		back := firewallPageURL(normalizeRegion(firstNonEmpty(c.PostForm("region"), s.GetString("region", "us-east-1"))), strings.TrimSpace(c.PostForm("instance")))
+		rules, err := aws.ParseFirewallRules(c.PostForm("rules"))
+		if err == nil {
+			_, err = saveFirewallProfile(c.Request.Context(), userID, c.PostForm("name"), rules)
+		}
+		if err != nil {
+			if errors.Is(err, store.ErrProfileExists) {
+				c.Redirect(http.StatusFound, back+"&msg=profile_exists")
+				return
+			}
+			auditError(c, err)
+			c.Redirect(http.StatusFound, back+"&msg=profile_failed&err="+url.QueryEscape(formatFlashError(err)))
+			return
+		}
+		c.Redirect(http.StatusFound, back+"&msg=profile_saved")
+	})
+
+	r.POST("/aws/firewall/profiles/delete", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		back := firewallPageURL(normalizeRegion(firstNonEmpty(c.PostForm("region"), s.GetString("region", "us-east-1"))), strings.TrimSpace(c.PostForm("instance")))
+		id, err := strconv.ParseInt(strings.TrimSpace(c.PostForm("profile_id")), 10, 64)
+		if err != nil {
+			c.Redirect(http.StatusFound, back)
+			return
+		}
+		if err := appStore.DeleteFirewallProfile(c.Request.Context(), userID, id); err != nil && !errors.Is(err, store.ErrProfileNotFound) {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, back+"&msg=profile_failed&err="+url.QueryEscape(formatFlashError(err)))
+			return
+		}
+		c.Redirect(http.StatusFound, back+"&msg=profile_deleted")
+	})
+}
+
+type apiFirewallProfile struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	Rules     []aws.FirewallRule `json:"rules"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type apiFirewallProfileInput struct {
+	Name  string             `json:"name" binding:"required"`
+	Rules []aws.FirewallRule `json:"rules" binding:"required"`
+}
+
+// apiFirewallPut 整体替换实例规则：指定 profile_id 时使用模板，否则使用 rules。
+type apiFirewallPut struct {
+	ProfileID int64              `json:"profile_id,omitempty"`
+	Rules     []aws.FirewallRule `json:"rules,omitempty"`
+}
+
+func toAPIFirewallProfile(p *store.FirewallProfile) apiFirewallProfile {
+	rules, _ := decodeFirewallRules(p.Rules)
+	return apiFirewallProfile{ID: p.ID, Name: p.Name, Rules: rules, CreatedAt: p.CreatedAt}
+}
+
+func apiGetFirewall(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	region := apiRegion(c, "")
+	cli, _, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	rules, err := aws.GetFirewallRules(c.Request.Context(), cli, name)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func apiPutFirewall(c *gin.Context) {
+	var in apiFirewallPut
+	if !apiBind(c, &in) {
+		return
+	}
+	name := strings.TrimSpace(c.Param("name"))
+	c.Set("audit_instance", name)
+	rules := in.Rules
+	if in.ProfileID != 0 {
+		var err error
+		if rules, err = firewallProfileRules(c.Request.Context(), apiUserID(c), in.ProfileID); err != nil {
+			apiFail(c, http.StatusNotFound, "profile_not_found", "防火墙模板不存在")
+			return
+		}
+	}
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			apiFail(c, http.StatusBadRequest, "invalid_rule", err.Error())
+			return
+		}
+	}
+	region := apiRegion(c, "")
+	cli, _, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	if err := aws.PutFirewallRules(c.Request.Context(), cli, name, rules); err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func apiFirewallRuleAction(action string, fn func(ctx context.Context, cli aws.LightsailAPI, name string, rule aws.FirewallRule) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule aws.FirewallRule
+		if !apiBind(c, &rule) {
+			return
+		}
+		name := strings.TrimSpace(c.Param("name"))
+		c.Set("audit_instance", name)
+		if err := rule.Validate(); err != nil {
+			apiFail(c, http.StatusBadRequest, "invalid_rule", err.Error())
+			return
+		}
+		region := apiRegion(c, "")
+		cli, _, ok := apiLightsailClient(c, region)
+		if !ok {
+			return
+		}
+		if err := fn(c.Request.Context(), cli, name, rule); err != nil {
+			apiAWSFail(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, apiActionResult{Action: action, Region: region, Target: name})
+	}
+}
+
+func apiListFirewallProfiles(c *gin.Context) {
+	list, err := appStore.ListFirewallProfiles(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取防火墙模板失败")
+		return
+	}
+	out := make([]apiFirewallProfile, 0, len(list))
+	for i := range list {
+		out = append(out, toAPIFirewallProfile(&list[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateFirewallProfile(c *gin.Context) {
+	var in apiFirewallProfileInput
+	if !apiBind(c, &in) {
+		return
+	}
+	p, err := saveFirewallProfile(c.Request.Context(), apiUserID(c), in.Name, in.Rules)
+	if err != nil {
+		if errors.Is(err, store.ErrProfileExists) {
+			apiFail(c, http.StatusConflict, "profile_exists", "已存在同名模板")
+			return
+		}
+		apiFail(c, http.StatusBadRequest, "invalid_rule", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, toAPIFirewallProfile(p))
+}
+
+func apiDeleteFirewallProfile(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "模板 ID 无效")
+		return
+	}
+	if err := appStore.DeleteFirewallProfile(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, store.ErrProfileNotFound) {
+			apiFail(c, http.StatusNotFound, "profile_not_found", "防火墙模板不存在")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "删除防火墙模板失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
@@ -0,0 +1,182 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// EC2ImageAPI 是解析 AMI 需要的 EC2 接口，*ec2.Client 满足该接口。
+type EC2ImageAPI interface {
+	DescribeImages(context.Context, *ec2.DescribeImagesInput, ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+	DescribeInstanceTypes(context.Context, *ec2.DescribeInstanceTypesInput, ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error)
+}
+
+// EC2AMIOption 是内置的系统镜像，按名称模式与架构查找区域内最新的官方 AMI。
+type EC2AMIOption struct {
+	Key     string
+	Name    string
+	Owner   string
+	Pattern string
+}
+
+var defaultEC2AMIOptions = []EC2AMIOption{
+	{Key: "ubuntu-24.04", Name: "Ubuntu 24.04 LTS", Owner: "099720109477", Pattern: "ubuntu/images/hvm-ssd-gp3/ubuntu-noble-24.04-*"},
+	{Key: "ubuntu-22.04", Name: "Ubuntu 22.04 LTS", Owner: "099720109477", Pattern: "ubuntu/images/hvm-ssd/ubuntu-jammy-22.04-*"},
+	{Key: "debian-12", Name: "Debian 12", Owner: "136693071363", Pattern: "debian-12-*"},
+	{Key: "amzn-2023", Name: "Amazon Linux 2023", Owner: "137112412989", Pattern: "al2023-ami-2023.*"},
+}
+
+var ErrInvalidAMI = errors.New("invalid ami")
+
+// AMIInfo 是校验自定义 AMI 时读取到的镜像信息。
+type AMIInfo struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Architecture string `json:"architecture"`
+}
+
+func IsAMIID(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "ami-")
+}
+
+// ResolveEC2AMI 把内置镜像名或 ami- 开头的 ID 解析为可用于该实例类型的 AMI。
+// 内置镜像按实例类型支持的架构选择 x86_64 或 arm64 版本；自定义 AMI 会校验存在且架构兼容。
+func ResolveEC2AMI(ctx context.Context, cli EC2ImageAPI, key, instanceType string) (string, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		key = "ubuntu-22.04"
+	}
+	archs, err := InstanceTypeArchitectures(ctx, cli, instanceType)
+	if err != nil {
+		return "", err
+	}
+
+	if IsAMIID(key) {
+		info, err := DescribeAMI(ctx, cli, key)
+		if err != nil {
+			return "", err
+		}
+		if !containsString(archs, info.Architecture) {
+			return "", fmt.Errorf("%w：AMI %s 的架构 %s 与实例类型 %s（%s）不兼容", ErrInvalidAMI, key, info.Architecture, instanceType, strings.Join(archs, "/"))
+		}
+		return info.ID, nil
+	}
+
+	for _, opt := range defaultEC2AMIOptions {
+		if opt.Key != key {
+			continue
+		}
+		arch := preferredArch(archs)
+		amiID, err := latestAMI(ctx, cli, opt.Owner, opt.Pattern, arch)
+		if err != nil {
+			return "", err
+		}
+		if amiID == "" {
+			return "", fmt.Errorf("未找到 AMI：%s（%s）", opt.Name, arch)
+		}
+		return amiID, nil
+	}
+	return "", fmt.Errorf("未知 AMI 选项：%s", key)
+}
+
+// DescribeAMI 校验 AMI 在当前区域存在且可用。
+func DescribeAMI(ctx context.Context, cli EC2ImageAPI, amiID string) (*AMIInfo, error) {
+	amiID = strings.TrimSpace(amiID)
+	if !IsAMIID(amiID) {
+		return nil, fmt.Errorf("%w：%s 不是 ami- 开头的 ID", ErrInvalidAMI, amiID)
+	}
+	out, err := cli.DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: []string{amiID}})
+	if err != nil {
+		if isEC2ErrorCode(err, "InvalidAMIID.Malformed", "InvalidAMIID.NotFound", "InvalidAMIID.Unavailable") {
+			return nil, fmt.Errorf("%w：当前区域找不到 %s", ErrInvalidAMI, amiID)
+		}
+		return nil, fmt.Errorf("查询 AMI 失败：%w", err)
+	}
+	if len(out.Images) == 0 {
+		return nil, fmt.Errorf("%w：当前区域找不到 %s", ErrInvalidAMI, amiID)
+	}
+	img := out.Images[0]
+	if img.State != ec2types.ImageStateAvailable {
+		return nil, fmt.Errorf("%w：%s 当前状态为 %s", ErrInvalidAMI, amiID, img.State)
+	}
+	return &AMIInfo{
+		ID:           aws.ToString(img.ImageId),
+		Name:         aws.ToString(img.Name),
+		Architecture: string(img.Architecture),
+	}, nil
+}
+
+// InstanceTypeArchitectures 返回实例类型支持的 CPU 架构（x86_64 / arm64）。
+func InstanceTypeArchitectures(ctx context.Context, cli EC2ImageAPI, instanceType string) ([]string, error) {
+	instanceType = strings.TrimSpace(instanceType)
+	if instanceType == "" {
+		return nil, errors.New("实例类型不能为空")
+	}
+	out, err := cli.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []ec2types.InstanceType{ec2types.InstanceType(instanceType)},
+	})
+	if err != nil {
+		if isEC2ErrorCode(err, "InvalidInstanceType") {
+			return nil, fmt.Errorf("实例类型 %s 无效", instanceType)
+		}
+		return nil, fmt.Errorf("查询实例类型失败：%w", err)
+	}
+	if len(out.InstanceTypes) == 0 || out.InstanceTypes[0].ProcessorInfo == nil {
+		return nil, fmt.Errorf("实例类型 %s 无效", instanceType)
+	}
+	var archs []string
+	for _, a := range out.InstanceTypes[0].ProcessorInfo.SupportedArchitectures {
+		archs = append(archs, string(a))
+	}
+	return archs, nil
+}
+
+// preferredArch 优先 x86_64；只支持 ARM 的 Graviton 类型（t4g / m6g …）使用 arm64。
+func preferredArch(archs []string) string {
+	for _, a := range []string{"x86_64", "arm64"} {
+		if containsString(archs, a) {
+			return a
+		}
+	}
+	if len(archs) > 0 {
+		return archs[0]
+	}
+	return "x86_64"
+}
+
+func latestAMI(ctx context.Context, cli EC2ImageAPI, owner, pattern, arch string) (string, error) {
+	out, err := cli.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Owners: []string{owner},
+		Filters: []ec2types.Filter{
+			{Name: aws.String("name"), Values: []string{pattern}},
+			{Name: aws.String("architecture"), Values: []string{arch}},
+			{Name: aws.String("virtualization-type"), Values: []string{"hvm"}},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(out.Images) == 0 {
+		return "", nil
+	}
+	sort.Slice(out.Images, func(i, j int) bool {
+		return aws.ToString(out.Images[i].CreationDate) > aws.ToString(out.Images[j].CreationDate)
+	})
+	return aws.ToString(out.Images[0].ImageId), nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type fakeEC2Images struct {
+	archs   map[string][]ec2types.ArchitectureType
+	images  map[string]ec2types.Image
+	lastArc string
+}
+
+func (f *fakeEC2Images) DescribeInstanceTypes(_ context.Context, in *ec2.DescribeInstanceTypesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	archs, ok := f.archs[string(in.InstanceTypes[0])]
+	if !ok {
+		return &ec2.DescribeInstanceTypesOutput{}, nil
+	}
+	return &ec2.DescribeInstanceTypesOutput{InstanceTypes: []ec2types.InstanceTypeInfo{{
+		InstanceType:  in.InstanceTypes[0],
+		ProcessorInfo: &ec2types.ProcessorInfo{SupportedArchitectures: archs},
+	}}}, nil
+}
+
+func (f *fakeEC2Images) DescribeImages(_ context.Context, in *ec2.DescribeImagesInput, _ ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	if len(in.ImageIds) > 0 {
+		img, ok := f.images[in.ImageIds[0]]
+		if !ok {
+			return &ec2.DescribeImagesOutput{}, nil
+		}
+		return &ec2.DescribeImagesOutput{Images: []ec2types.Image{img}}, nil
+	}
+	for _, flt := range in.Filters {
+		if aws.ToString(flt.Name) == "architecture" {
+			f.lastArc = flt.Values[0]
+		}
+	}
+	return &ec2.DescribeImagesOutput{Images: []ec2types.Image{
+		{ImageId: aws.String("ami-old-" + f.lastArc), CreationDate: aws.String("2024-01-01T00:00:00.000Z")},
+		{ImageId: aws.String("ami-new-" + f.lastArc), CreationDate: aws.String("2025-01-01T00:00:00.000Z")},
+	}}, nil
+}
+
+func TestResolveEC2AMI(t *testing.T) {
+	cli := &fakeEC2Images{
+		archs: map[string][]ec2types.ArchitectureType{
+			"t3.micro":  {ec2types.ArchitectureTypeX8664},
+			"t4g.micro": {ec2types.ArchitectureTypeArm64},
+		},
+		images: map[string]ec2types.Image{
+			"ami-arm":     {ImageId: aws.String("ami-arm"), Architecture: ec2types.ArchitectureValuesArm64, State: ec2types.ImageStateAvailable},
+			"ami-pending": {ImageId: aws.String("ami-pending"), Architecture: ec2types.ArchitectureValuesX8664, State: ec2types.ImageStatePending},
+		},
+	}
+	cases := []struct {
+		name, key, instanceType string
+		want                    string
+		wantInvalid             bool
+		wantErr                 bool
+	}{
+		{name: "preset-x86", key: "debian-12", instanceType: "t3.micro", want: "ami-new-x86_64"},
+		{name: "preset-graviton", key: "ubuntu-24.04", instanceType: "t4g.micro", want: "ami-new-arm64"},
+		{name: "custom-ok", key: "ami-arm", instanceType: "t4g.micro", want: "ami-arm"},
+		{name: "custom-arch-mismatch", key: "ami-arm", instanceType: "t3.micro", wantInvalid: true},
+		{name: "custom-missing", key: "ami-nope", instanceType: "t3.micro", wantInvalid: true},
+		{name: "custom-not-available", key: "ami-pending", instanceType: "t3.micro", wantInvalid: true},
+		{name: "unknown-type", key: "debian-12", instanceType: "x9.huge", wantErr: true},
+		{name: "unknown-preset", key: "gentoo", instanceType: "t3.micro", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ResolveEC2AMI(context.Background(), cli, tc.key, tc.instanceType)
+			switch {
+			case tc.wantInvalid:
+				if !errors.Is(err, ErrInvalidAMI) {
+					t.Fatalf("err = %v, want ErrInvalidAMI", err)
+				}
+			case tc.wantErr:
+				if err == nil {
+					t.Fatalf("got %q, want error", got)
+				}
+			case err != nil:
+				t.Fatalf("ResolveEC2AMI: %v", err)
+			case got != tc.want:
+				t.Fatalf("ResolveEC2AMI = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type BlueprintView struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	MinPower int32  `json:"min_power"`
+}
+
+type BundleView struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	CPUCount   int32   `json:"cpu_count"`
+	RAMGB      float32 `json:"ram_gb"`
+	DiskGB     int32   `json:"disk_gb"`
+	TransferGB int32   `json:"transfer_gb"`
+	Price      float32 `json:"price"`
+	Power      int32   `json:"power"`
+	// IPv6 是同规格仅 IPv6 套餐的 ID 与价格，区域不提供时为空
+	IPv6ID    string  `json:"ipv6_id,omitempty"`
+	IPv6Price float32 `json:"ipv6_price,omitempty"`
+}
+
+// Label 是下拉框中显示的套餐说明。
+func (b BundleView) Label() string {
+	return fmt.Sprintf("%s (%d vCPUs, 内存 %s GB, 硬盘 %d GB, 流量 %d GB / 月, $%s / 月)",
+		strings.ToLower(b.Name), b.CPUCount, trimFloat(b.RAMGB), b.DiskGB, b.TransferGB, trimFloat(b.Price))
+}
+
+// LightsailCatalog 是某个区域当前可用的 Linux 镜像与套餐。
+type LightsailCatalog struct {
+	Blueprints []BlueprintView `json:"blueprints"`
+	Bundles    []BundleView    `json:"bundles"`
+}
+
+// IPv6BundleID 返回双栈套餐对应的仅 IPv6 套餐，不存在时返回 false。
+func (c *LightsailCatalog) IPv6BundleID(bundleID string) (string, bool) {
+	for _, b := range c.Bundles {
+		if b.ID == bundleID && b.IPv6ID != "" {
+			return b.IPv6ID, true
+		}
+	}
+	return "", false
+}
+
+func (c *LightsailCatalog) HasBlueprint(id string) bool {
+	for _, b := range c.Blueprints {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Bundle 按套餐 ID 查找，仅 IPv6 套餐返回对应的双栈套餐规格。
+func (c *LightsailCatalog) Bundle(id string) (BundleView, bool) {
+	for _, b := range c.Bundles {
+		if b.ID == id || (b.IPv6ID != "" && b.IPv6ID == id) {
+			return b, true
+		}
+	}
+	return BundleView{}, false
+}
+
+func (c *LightsailCatalog) HasBundle(id string) bool {
+	for _, b := range c.Bundles {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLightsailCatalog 拉取区域内可用的 Linux 系统镜像与套餐（实例创建脚本只支持 Linux）。
+// 仅 IPv6 套餐不单独列出，而是按相同规格挂到对应的双栈套餐上。
+func GetLightsailCatalog(ctx context.Context, cli LightsailAPI) (*LightsailCatalog, error) {
+	blueprints, err := listBlueprints(ctx, cli)
+	if err != nil {
+		return nil, fmt.Errorf("拉取镜像列表失败：%w", err)
+	}
+	bundles, err := listBundles(ctx, cli)
+	if err != nil {
+		return nil, fmt.Errorf("拉取套餐列表失败：%w", err)
+	}
+
+	cat := &LightsailCatalog{}
+	for _, bp := range blueprints {
+		if bp.IsActive != nil && !*bp.IsActive {
+			continue
+		}
+		if bp.Type != types.BlueprintTypeOs || bp.Platform != types.InstancePlatformLinuxUnix {
+			continue
+		}
+		cat.Blueprints = append(cat.Blueprints, BlueprintView{
+			ID:       str(bp.BlueprintId),
+			Name:     str(bp.Name) + " " + str(bp.Version),
+			Group:    str(bp.Group),
+			Version:  str(bp.Version),
+			MinPower: int32Val(bp.MinPower),
+		})
+	}
+	sort.SliceStable(cat.Blueprints, func(i, j int) bool {
+		if cat.Blueprints[i].Group != cat.Blueprints[j].Group {
+			return cat.Blueprints[i].Group < cat.Blueprints[j].Group
+		}
+		return cat.Blueprints[i].Version > cat.Blueprints[j].Version
+	})
+
+	var ipv6Only []types.Bundle
+	for _, b := range bundles {
+		if b.IsActive != nil && !*b.IsActive {
+			continue
+		}
+		if !supportsLinux(b) {
+			continue
+		}
+		if b.PublicIpv4AddressCount != nil && *b.PublicIpv4AddressCount == 0 {
+			ipv6Only = append(ipv6Only, b)
+			continue
+		}
+		cat.Bundles = append(cat.Bundles, BundleView{
+			ID:         str(b.BundleId),
+			Name:       str(b.Name),
+			CPUCount:   int32Val(b.CpuCount),
+			RAMGB:      float32Val(b.RamSizeInGb),
+			DiskGB:     int32Val(b.DiskSizeInGb),
+			TransferGB: int32Val(b.TransferPerMonthInGb),
+			Price:      float32Val(b.Price),
+			Power:      int32Val(b.Power),
+		})
+	}
+	for i := range cat.Bundles {
+		for _, v6 := range ipv6Only {
+			if sameBundleSpec(cat.Bundles[i], v6) {
+				cat.Bundles[i].IPv6ID = str(v6.BundleId)
+				cat.Bundles[i].IPv6Price = float32Val(v6.Price)
+				break
+			}
+		}
+	}
+	sort.SliceStable(cat.Bundles, func(i, j int) bool { return cat.Bundles[i].Price < cat.Bundles[j].Price })
+	return cat, nil
+}
+
+func listBlueprints(ctx context.Context, cli LightsailAPI) ([]types.Blueprint, error) {
+	var out []types.Blueprint
+	var token *string
+	for {
+		page, err := cli.GetBlueprints(ctx, &lightsail.GetBlueprintsInput{PageToken: token})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page.Blueprints...)
+		if page.NextPageToken == nil || *page.NextPageToken == "" {
+			return out, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+func listBundles(ctx context.Context, cli LightsailAPI) ([]types.Bundle, error) {
+	var out []types.Bundle
+	var token *string
+	for {
+		page, err := cli.GetBundles(ctx, &lightsail.GetBundlesInput{PageToken: token})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page.Bundles...)
+		if page.NextPageToken == nil || *page.NextPageToken == "" {
+			return out, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+func supportsLinux(b types.Bundle) bool {
+	for _, p := range b.SupportedPlatforms {
+		if p == types.InstancePlatformLinuxUnix {
+			return true
+		}
+	}
+	return false
+}
+
+func sameBundleSpec(v BundleView, b types.Bundle) bool {
+	return v.CPUCount == int32Val(b.CpuCount) &&
+		v.RAMGB == float32Val(b.RamSizeInGb) &&
+		v.DiskGB == int32Val(b.DiskSizeInGb) &&
+		v.TransferGB == int32Val(b.TransferPerMonthInGb)
+}
+
+func int32Val(p *int32) int32 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func float32Val(p *float32) float32 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+func trimFloat(v float32) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+}
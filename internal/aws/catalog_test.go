@@ -0,0 +1,95 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+// fakeLightsail 只实现测试用到的方法，其余方法调用时会因 nil 接口而 panic。
+type fakeLightsail struct {
+	LightsailAPI
+	blueprints [][]types.Blueprint
+	bundles    []types.Bundle
+}
+
+func (f *fakeLightsail) GetBlueprints(_ context.Context, in *lightsail.GetBlueprintsInput, _ ...func(*lightsail.Options)) (*lightsail.GetBlueprintsOutput, error) {
+	page := 0
+	if in.PageToken != nil {
+		page = 1
+	}
+	out := &lightsail.GetBlueprintsOutput{Blueprints: f.blueprints[page]}
+	if page+1 < len(f.blueprints) {
+		out.NextPageToken = aws.String("next")
+	}
+	return out, nil
+}
+
+func (f *fakeLightsail) GetBundles(context.Context, *lightsail.GetBundlesInput, ...func(*lightsail.Options)) (*lightsail.GetBundlesOutput, error) {
+	return &lightsail.GetBundlesOutput{Bundles: f.bundles}, nil
+}
+
+func linuxBundle(id string, price float32, ram float32, ipv4 int32) types.Bundle {
+	return types.Bundle{
+		BundleId:               aws.String(id),
+		Name:                   aws.String(id),
+		IsActive:               aws.Bool(true),
+		CpuCount:               aws.Int32(2),
+		RamSizeInGb:            aws.Float32(ram),
+		DiskSizeInGb:           aws.Int32(20),
+		TransferPerMonthInGb:   aws.Int32(1024),
+		Price:                  aws.Float32(price),
+		PublicIpv4AddressCount: aws.Int32(ipv4),
+		SupportedPlatforms:     []types.InstancePlatform{types.InstancePlatformLinuxUnix},
+	}
+}
+
+func TestGetLightsailCatalog(t *testing.T) {
+	blueprint := func(id, version string, active bool, platform types.InstancePlatform) types.Blueprint {
+		return types.Blueprint{BlueprintId: aws.String(id), Name: aws.String("Debian"), Group: aws.String("debian"), Version: aws.String(version), IsActive: aws.Bool(active), Type: types.BlueprintTypeOs, Platform: platform}
+	}
+	windows := linuxBundle("nano_win_3_0", 9.5, 0.5, 1)
+	windows.SupportedPlatforms = []types.InstancePlatform{types.InstancePlatformWindows}
+	cli := &fakeLightsail{
+		blueprints: [][]types.Blueprint{
+			{blueprint("debian_12", "12", true, types.InstancePlatformLinuxUnix), blueprint("centos_7", "7", false, types.InstancePlatformLinuxUnix)},
+			{blueprint("windows_2022", "2022", true, types.InstancePlatformWindows), blueprint("debian_13", "13", true, types.InstancePlatformLinuxUnix)},
+		},
+		bundles: []types.Bundle{
+			linuxBundle("micro_3_0", 7, 1, 1),
+			linuxBundle("nano_3_0", 5, 0.5, 1),
+			linuxBundle("nano_ipv6_3_0", 3.5, 0.5, 0),
+			windows,
+		},
+	}
+
+	cat, err := GetLightsailCatalog(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("GetLightsailCatalog: %v", err)
+	}
+	var ids []string
+	for _, b := range cat.Blueprints {
+		ids = append(ids, b.ID)
+	}
+	if len(ids) != 2 || ids[0] != "debian_13" || ids[1] != "debian_12" {
+		t.Fatalf("blueprints = %v, want [debian_13 debian_12]", ids)
+	}
+	if len(cat.Bundles) != 2 || cat.Bundles[0].ID != "nano_3_0" {
+		t.Fatalf("bundles = %+v", cat.Bundles)
+	}
+	if v6, ok := cat.IPv6BundleID("nano_3_0"); !ok || v6 != "nano_ipv6_3_0" || cat.Bundles[0].IPv6Price != 3.5 {
+		t.Fatalf("IPv6BundleID(nano_3_0) = %q, %v", v6, ok)
+	}
+	if _, ok := cat.IPv6BundleID("micro_3_0"); ok {
+		t.Fatalf("micro_3_0 should have no ipv6 bundle")
+	}
+	if cat.HasBundle("nano_win_3_0") || cat.HasBlueprint("centos_7") {
+		t.Fatalf("unsupported entries leaked into catalog")
+	}
+	if got, want := cat.Bundles[0].Label(), "nano_3_0 (2 vCPUs, 内存 0.5 GB, 硬盘 20 GB, 流量 1024 GB / 月, $5 / 月)"; got != want {
+		t.Fatalf("Label() = %q, want %q", got, want)
+	}
+}
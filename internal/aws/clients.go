@@ -28,7 +28,29 @@ type LightsailAPI interface {
 	CreateInstances(context.Context, *lightsail.CreateInstancesInput, ...func(*lightsail.Options)) (*lightsail.CreateInstancesOutput, error)
 	OpenInstancePublicPorts(context.Context, *lightsail.OpenInstancePublicPortsInput, ...func(*lightsail.Options)) (*lightsail.OpenInstancePublicPortsOutput, error)
 	RebootInstance(context.Context, *lightsail.RebootInstanceInput, ...func(*lightsail.Options)) (*lightsail.RebootInstanceOutput, error)
+	StartInstance(context.Context, *lightsail.StartInstanceInput, ...func(*lightsail.Options)) (*lightsail.StartInstanceOutput, error)
+	StopInstance(context.Context, *lightsail.StopInstanceInput, ...func(*lightsail.Options)) (*lightsail.StopInstanceOutput, error)
+	GetInstance(context.Context, *lightsail.GetInstanceInput, ...func(*lightsail.Options)) (*lightsail.GetInstanceOutput, error)
 	DeleteInstance(context.Context, *lightsail.DeleteInstanceInput, ...func(*lightsail.Options)) (*lightsail.DeleteInstanceOutput, error)
+	GetBlueprints(context.Context, *lightsail.GetBlueprintsInput, ...func(*lightsail.Options)) (*lightsail.GetBlueprintsOutput, error)
+	GetBundles(context.Context, *lightsail.GetBundlesInput, ...func(*lightsail.Options)) (*lightsail.GetBundlesOutput, error)
+	GetRegions(context.Context, *lightsail.GetRegionsInput, ...func(*lightsail.Options)) (*lightsail.GetRegionsOutput, error)
+	CreateInstanceSnapshot(context.Context, *lightsail.CreateInstanceSnapshotInput, ...func(*lightsail.Options)) (*lightsail.CreateInstanceSnapshotOutput, error)
+	GetInstanceSnapshots(context.Context, *lightsail.GetInstanceSnapshotsInput, ...func(*lightsail.Options)) (*lightsail.GetInstanceSnapshotsOutput, error)
+	CreateInstancesFromSnapshot(context.Context, *lightsail.CreateInstancesFromSnapshotInput, ...func(*lightsail.Options)) (*lightsail.CreateInstancesFromSnapshotOutput, error)
+	DeleteInstanceSnapshot(context.Context, *lightsail.DeleteInstanceSnapshotInput, ...func(*lightsail.Options)) (*lightsail.DeleteInstanceSnapshotOutput, error)
+	GetInstancePortStates(context.Context, *lightsail.GetInstancePortStatesInput, ...func(*lightsail.Options)) (*lightsail.GetInstancePortStatesOutput, error)
+	PutInstancePublicPorts(context.Context, *lightsail.PutInstancePublicPortsInput, ...func(*lightsail.Options)) (*lightsail.PutInstancePublicPortsOutput, error)
+	CloseInstancePublicPorts(context.Context, *lightsail.CloseInstancePublicPortsInput, ...func(*lightsail.Options)) (*lightsail.CloseInstancePublicPortsOutput, error)
+	GetKeyPair(context.Context, *lightsail.GetKeyPairInput, ...func(*lightsail.Options)) (*lightsail.GetKeyPairOutput, error)
+	ImportKeyPair(context.Context, *lightsail.ImportKeyPairInput, ...func(*lightsail.Options)) (*lightsail.ImportKeyPairOutput, error)
+	GetInstanceMetricData(context.Context, *lightsail.GetInstanceMetricDataInput, ...func(*lightsail.Options)) (*lightsail.GetInstanceMetricDataOutput, error)
+	CreateDisk(context.Context, *lightsail.CreateDiskInput, ...func(*lightsail.Options)) (*lightsail.CreateDiskOutput, error)
+	GetDisk(context.Context, *lightsail.GetDiskInput, ...func(*lightsail.Options)) (*lightsail.GetDiskOutput, error)
+	GetDisks(context.Context, *lightsail.GetDisksInput, ...func(*lightsail.Options)) (*lightsail.GetDisksOutput, error)
+	AttachDisk(context.Context, *lightsail.AttachDiskInput, ...func(*lightsail.Options)) (*lightsail.AttachDiskOutput, error)
+	DetachDisk(context.Context, *lightsail.DetachDiskInput, ...func(*lightsail.Options)) (*lightsail.DetachDiskOutput, error)
+	DeleteDisk(context.Context, *lightsail.DeleteDiskInput, ...func(*lightsail.Options)) (*lightsail.DeleteDiskOutput, error)
 }
 
 func baseHTTPClient(proxy string) (*http.Client, error) {
@@ -52,6 +74,11 @@ func baseHTTPClient(proxy string) (*http.Client, error) {
 	return &http.Client{Transport: tr, Timeout: 25 * time.Second}, nil
 }
 
+// NewHTTPClient 返回与 AWS 客户端相同设置的 HTTP 客户端，用于需要走密钥代理的其他请求（如外部 DNS）。
+func NewHTTPClient(proxy string) (*http.Client, error) {
+	return baseHTTPClient(proxy)
+}
+
 func NewLightsailClient(ctx context.Context, region, ak, sk, proxy string) (*lightsail.Client, error) {
 	if region == "" || ak == "" || sk == "" {
 		return nil, errors.New("missing region/ak/sk")
@@ -0,0 +1,267 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+// 挂载点保存在磁盘标签里，挂载到其他实例时沿用
+const diskMountTag = "autosail:mount"
+
+// Lightsail 块存储磁盘的容量范围（GB）
+const (
+	MinDiskSizeGB = 8
+	MaxDiskSizeGB = 16384
+)
+
+var (
+	ErrInvalidDiskSize   = errors.New("invalid disk size")
+	ErrInvalidMountPoint = errors.New("invalid mount point")
+	ErrNoFreeDiskPath    = errors.New("no free disk path")
+
+	mountPointRe = regexp.MustCompile(`^(/[A-Za-z0-9._-]+)+$`)
+)
+
+// 这些目录挂载磁盘会覆盖系统文件
+var reservedMountPoints = map[string]bool{
+	"/bin": true, "/boot": true, "/dev": true, "/etc": true, "/lib": true, "/lib64": true,
+	"/proc": true, "/root": true, "/run": true, "/sbin": true, "/sys": true, "/usr": true, "/var": true, "/tmp": true,
+}
+
+type DiskView struct {
+	Name       string `json:"name"`
+	SizeGB     int32  `json:"size_gb"`
+	State      string `json:"state"`
+	AttachedTo string `json:"attached_to,omitempty"`
+	Path       string `json:"path,omitempty"`
+	MountPoint string `json:"mount_point,omitempty"`
+	Zone       string `json:"zone"`
+	Created    string `json:"created"`
+}
+
+type CreateDiskInput struct {
+	DiskName         string
+	AvailabilityZone string
+	SizeGB           int32
+	MountPoint       string
+}
+
+// ValidateMountPoint 检查挂载点是绝对路径，且不是根目录或系统目录。
+func ValidateMountPoint(p string) error {
+	if !mountPointRe.MatchString(p) || strings.Contains(p, "..") {
+		return fmt.Errorf("%w：需为绝对路径，例如 /data", ErrInvalidMountPoint)
+	}
+	if reservedMountPoints[p] {
+		return fmt.Errorf("%w：不能挂载到系统目录 %s", ErrInvalidMountPoint, p)
+	}
+	return nil
+}
+
+// DiskName 生成磁盘名，例如 disk-vps-1700000000-1700000100；不指定实例时为 disk-1700000100。
+func DiskName(instanceName string) string {
+	if instanceName == "" {
+		return fmt.Sprintf("disk-%d", time.Now().Unix())
+	}
+	return fmt.Sprintf("disk-%s-%d", sanitize(instanceName), time.Now().Unix())
+}
+
+func diskView(d types.Disk) DiskView {
+	v := DiskView{
+		Name:   str(d.Name),
+		SizeGB: aws.ToInt32(d.SizeInGb),
+		State:  string(d.State),
+	}
+	if aws.ToBool(d.IsAttached) {
+		v.AttachedTo, v.Path = str(d.AttachedTo), str(d.Path)
+	}
+	if d.Location != nil {
+		v.Zone = str(d.Location.AvailabilityZone)
+	}
+	if d.CreatedAt != nil {
+		v.Created = d.CreatedAt.Format("2006-01-02 15:04:05")
+	}
+	for _, t := range d.Tags {
+		if str(t.Key) == diskMountTag {
+			v.MountPoint = str(t.Value)
+		}
+	}
+	return v
+}
+
+// ListDisks 返回区域内的全部块存储磁盘，按名称排序。
+func ListDisks(ctx context.Context, cli LightsailAPI) ([]DiskView, error) {
+	var list []DiskView
+	var token *string
+	for {
+		out, err := cli.GetDisks(ctx, &lightsail.GetDisksInput{PageToken: token})
+		if err != nil {
+			return nil, fmt.Errorf("拉取磁盘失败：%w", err)
+		}
+		for _, d := range out.Disks {
+			list = append(list, diskView(d))
+		}
+		if str(out.NextPageToken) == "" {
+			break
+		}
+		token = out.NextPageToken
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// FindDisk 在列表中按名称查找磁盘。
+func FindDisk(list []DiskView, name string) (DiskView, bool) {
+	for _, d := range list {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return DiskView{}, false
+}
+
+// DisksAttachedTo 返回挂载在实例上的磁盘。
+func DisksAttachedTo(list []DiskView, instanceName string) []DiskView {
+	var out []DiskView
+	for _, d := range list {
+		if d.AttachedTo == instanceName {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// NextDiskPath 返回实例上第一个未使用的设备路径（/dev/xvdf 到 /dev/xvdp）。
+func NextDiskPath(list []DiskView, instanceName string) (string, error) {
+	used := map[string]bool{}
+	for _, d := range DisksAttachedTo(list, instanceName) {
+		used[d.Path] = true
+	}
+	for c := 'f'; c <= 'p'; c++ {
+		if p := "/dev/xvd" + string(c); !used[p] {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%w：实例 %s 已挂载的磁盘过多", ErrNoFreeDiskPath, instanceName)
+}
+
+// CreateDisk 只提交创建请求，磁盘变为 available 后才能挂载，见 WaitDiskState。
+func CreateDisk(ctx context.Context, cli LightsailAPI, in CreateDiskInput) error {
+	if in.SizeGB < MinDiskSizeGB || in.SizeGB > MaxDiskSizeGB {
+		return fmt.Errorf("%w：容量需在 %d-%d GB 之间", ErrInvalidDiskSize, MinDiskSizeGB, MaxDiskSizeGB)
+	}
+	if err := ValidateMountPoint(in.MountPoint); err != nil {
+		return err
+	}
+	_, err := cli.CreateDisk(ctx, &lightsail.CreateDiskInput{
+		DiskName:         &in.DiskName,
+		AvailabilityZone: &in.AvailabilityZone,
+		SizeInGb:         &in.SizeGB,
+		Tags:             []types.Tag{{Key: aws.String(diskMountTag), Value: aws.String(in.MountPoint)}},
+	})
+	if err != nil {
+		return fmt.Errorf("创建磁盘失败：%w", err)
+	}
+	return nil
+}
+
+// WaitDiskState 轮询磁盘直到进入 state 或超时。
+func WaitDiskState(ctx context.Context, cli LightsailAPI, name, state string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	progress(ctx, "等待磁盘 "+name+" 变为 "+state)
+	current := ""
+	for {
+		out, err := cli.GetDisk(ctx, &lightsail.GetDiskInput{DiskName: &name})
+		if err == nil && out.Disk != nil {
+			current = string(out.Disk.State)
+			if current == state {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待磁盘 %s 变为 %s 超时（当前 %s）", name, state, current)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(3*time.Second, time.Until(deadline)+time.Millisecond)):
+		}
+	}
+}
+
+func AttachDisk(ctx context.Context, cli LightsailAPI, diskName, instanceName, path string) error {
+	progress(ctx, "挂载磁盘 "+diskName+" 到 "+instanceName+"（"+path+"）")
+	return SafeRetry("挂载磁盘", 6, 1500*time.Millisecond, func() error {
+		_, err := cli.AttachDisk(ctx, &lightsail.AttachDiskInput{DiskName: &diskName, InstanceName: &instanceName, DiskPath: &path})
+		return err
+	})
+}
+
+// DetachDisk 卸载磁盘。Lightsail 要求实例处于停止状态。
+func DetachDisk(ctx context.Context, cli LightsailAPI, diskName string) error {
+	_, err := cli.DetachDisk(ctx, &lightsail.DetachDiskInput{DiskName: &diskName})
+	if err != nil {
+		return fmt.Errorf("卸载磁盘失败（需先停止实例）：%w", err)
+	}
+	return nil
+}
+
+func DeleteDisk(ctx context.Context, cli LightsailAPI, diskName string) error {
+	_, err := cli.DeleteDisk(ctx, &lightsail.DeleteDiskInput{DiskName: &diskName})
+	if err != nil {
+		return fmt.Errorf("删除磁盘失败：%w", err)
+	}
+	return nil
+}
+
+// DiskMountScript 生成在实例内格式化并挂载磁盘的脚本片段：等待设备出现，没有文件系统时格式化为 ext4，
+// 按 UUID 写入 /etc/fstab（nofail）。Nitro 机型上磁盘显示为 NVMe 设备，找不到 device 时使用第一块非系统盘。
+// 脚本在后台执行，不阻塞 cloud-init，日志写入 /var/log/autosail-disk.log。
+func DiskMountScript(device, mountPoint string) string {
+	return fmt.Sprintf(`
+# 挂载块存储磁盘 %[1]s -> %[2]s
+cat > /root/autosail-mount-disk.sh <<'AUTOSAIL_DISK'
+#!/bin/sh
+dev=""
+for i in $(seq 1 180); do
+  if [ -b %[1]s ]; then dev=%[1]s; break; fi
+  for d in /dev/nvme[1-9]n1; do
+    if [ -b "$d" ] && ! grep -q "^$d" /proc/mounts; then dev="$d"; break 2; fi
+  done
+  sleep 5
+done
+[ -n "$dev" ] || { echo "disk not found"; exit 1; }
+blkid "$dev" >/dev/null 2>&1 || mkfs.ext4 -q "$dev"
+mkdir -p %[2]s
+uuid="$(blkid -s UUID -o value "$dev")"
+grep -q "$uuid" /etc/fstab || echo "UUID=$uuid %[2]s ext4 defaults,nofail 0 2" >> /etc/fstab
+mount -a
+AUTOSAIL_DISK
+chmod +x /root/autosail-mount-disk.sh
+nohup /root/autosail-mount-disk.sh >/var/log/autosail-disk.log 2>&1 &
+`, device, mountPoint)
+}
+
+// MountScript 返回在实例内挂载该磁盘的命令，未挂载到实例或没有记录挂载点时为空。
+func (d DiskView) MountScript() string {
+	if d.Path == "" || d.MountPoint == "" {
+		return ""
+	}
+	return strings.TrimSpace(DiskMountScript(d.Path, d.MountPoint))
+}
+
+// AppendUserData 把脚本片段追加到 User-Data 末尾；原 User-Data 为空时补上 shebang。
+func AppendUserData(userData, snippet string) string {
+	if strings.TrimSpace(userData) == "" {
+		return "#!/bin/bash\n" + snippet
+	}
+	return strings.TrimRight(userData, "\n") + "\n" + snippet
+}
@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type fakeLightsailDisks struct {
+	LightsailAPI
+	created *lightsail.CreateDiskInput
+}
+
+func (f *fakeLightsailDisks) GetDisks(context.Context, *lightsail.GetDisksInput, ...func(*lightsail.Options)) (*lightsail.GetDisksOutput, error) {
+	return &lightsail.GetDisksOutput{Disks: []types.Disk{
+		{Name: aws.String("disk-b"), SizeInGb: aws.Int32(32), State: types.DiskStateAvailable, Location: &types.ResourceLocation{AvailabilityZone: aws.String("us-east-1a")}},
+		{Name: aws.String("disk-a"), SizeInGb: aws.Int32(64), State: types.DiskStateInUse, IsAttached: aws.Bool(true), AttachedTo: aws.String("vps-1"), Path: aws.String("/dev/xvdf"),
+			Tags: []types.Tag{{Key: aws.String(diskMountTag), Value: aws.String("/data")}}},
+	}}, nil
+}
+
+func (f *fakeLightsailDisks) CreateDisk(_ context.Context, in *lightsail.CreateDiskInput, _ ...func(*lightsail.Options)) (*lightsail.CreateDiskOutput, error) {
+	f.created = in
+	return &lightsail.CreateDiskOutput{}, nil
+}
+
+func TestListDisksAndNextPath(t *testing.T) {
+	list, err := ListDisks(context.Background(), &fakeLightsailDisks{})
+	if err != nil {
+		t.Fatalf("ListDisks: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "disk-a" || list[0].MountPoint != "/data" || list[1].Zone != "us-east-1a" || list[1].AttachedTo != "" {
+		t.Fatalf("disks = %+v", list)
+	}
+	if got := DisksAttachedTo(list, "vps-1"); len(got) != 1 {
+		t.Fatalf("attached = %+v", got)
+	}
+	if p, err := NextDiskPath(list, "vps-1"); err != nil || p != "/dev/xvdg" {
+		t.Fatalf("NextDiskPath(vps-1) = %q, %v", p, err)
+	}
+	if p, err := NextDiskPath(list, "vps-2"); err != nil || p != "/dev/xvdf" {
+		t.Fatalf("NextDiskPath(vps-2) = %q, %v", p, err)
+	}
+}
+
+func TestCreateDiskValidates(t *testing.T) {
+	cli := &fakeLightsailDisks{}
+	for _, mp := range []string{"data", "/", "/etc", "/data/../etc", "/da ta"} {
+		if err := CreateDisk(context.Background(), cli, CreateDiskInput{DiskName: "d", SizeGB: 32, MountPoint: mp}); !errors.Is(err, ErrInvalidMountPoint) {
+			t.Fatalf("CreateDisk(mount %q) err = %v, want ErrInvalidMountPoint", mp, err)
+		}
+	}
+	if err := CreateDisk(context.Background(), cli, CreateDiskInput{DiskName: "d", SizeGB: 4, MountPoint: "/data"}); !errors.Is(err, ErrInvalidDiskSize) {
+		t.Fatalf("CreateDisk(4GB) err = %v, want ErrInvalidDiskSize", err)
+	}
+	if err := CreateDisk(context.Background(), cli, CreateDiskInput{DiskName: "d", AvailabilityZone: "us-east-1a", SizeGB: 32, MountPoint: "/srv/data"}); err != nil {
+		t.Fatalf("CreateDisk: %v", err)
+	}
+	if cli.created == nil || len(cli.created.Tags) != 1 || *cli.created.Tags[0].Value != "/srv/data" {
+		t.Fatalf("create input = %+v", cli.created)
+	}
+}
+
+func TestAppendDiskUserData(t *testing.T) {
+	ud := AppendUserData("", DiskMountScript("/dev/xvdf", "/data"))
+	if !strings.HasPrefix(ud, "#!/bin/bash\n") || !strings.Contains(ud, "UUID=$uuid /data ext4 defaults,nofail") {
+		t.Fatalf("user data = %s", ud)
+	}
+	ud = AppendUserData(BuildRootPasswordUserData("pw", false), DiskMountScript("/dev/xvdf", "/data"))
+	if strings.Count(ud, "#!/bin/bash") != 1 || !strings.Contains(ud, "chpasswd") || !strings.Contains(ud, "[ -b /dev/xvdf ]") {
+		t.Fatalf("combined user data = %s", ud)
+	}
+}
@@ -0,0 +1,304 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+// Lightsail DNS 区域是全局资源，只能通过 us-east-1 的接口管理。
+const DNSRegion = "us-east-1"
+
+// 页面上管理的记录类型；NS、SOA 由 Lightsail 维护，MX、SRV 暂不支持。
+var DNSRecordTypes = []string{"A", "AAAA", "CNAME", "TXT"}
+
+var (
+	ErrInvalidDomain     = errors.New("invalid domain")
+	ErrInvalidDNSRecord  = errors.New("invalid dns record")
+	ErrDNSRecordNotFound = errors.New("dns record not found")
+
+	domainRe = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+	labelRe  = regexp.MustCompile(`^(\*|[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9])?)(\.[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9])?)*$`)
+)
+
+// LightsailDNSAPI 是管理 DNS 区域需要的接口，*lightsail.Client 满足该接口。
+type LightsailDNSAPI interface {
+	GetDomains(context.Context, *lightsail.GetDomainsInput, ...func(*lightsail.Options)) (*lightsail.GetDomainsOutput, error)
+	GetDomain(context.Context, *lightsail.GetDomainInput, ...func(*lightsail.Options)) (*lightsail.GetDomainOutput, error)
+	CreateDomain(context.Context, *lightsail.CreateDomainInput, ...func(*lightsail.Options)) (*lightsail.CreateDomainOutput, error)
+	CreateDomainEntry(context.Context, *lightsail.CreateDomainEntryInput, ...func(*lightsail.Options)) (*lightsail.CreateDomainEntryOutput, error)
+	DeleteDomainEntry(context.Context, *lightsail.DeleteDomainEntryInput, ...func(*lightsail.Options)) (*lightsail.DeleteDomainEntryOutput, error)
+}
+
+type DomainView struct {
+	Name    string `json:"name"`
+	Records int    `json:"records"` // A/AAAA/CNAME/TXT 记录数
+	Created string `json:"created"`
+}
+
+// DNSRecord 是一条解析记录，Name 为完整域名（例如 www.example.com）。
+type DNSRecord struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Target  string `json:"target"`
+	IsAlias bool   `json:"is_alias,omitempty"`
+}
+
+func managedRecordType(t string) bool {
+	for _, v := range DNSRecordTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func dnsRecords(entries []types.DomainEntry) []DNSRecord {
+	var out []DNSRecord
+	for _, e := range entries {
+		t := str(e.Type)
+		if !managedRecordType(t) {
+			continue
+		}
+		out = append(out, DNSRecord{
+			ID:      str(e.Id),
+			Name:    strings.TrimSuffix(str(e.Name), "."),
+			Type:    t,
+			Target:  str(e.Target),
+			IsAlias: aws.ToBool(e.IsAlias),
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Type < out[j].Type
+	})
+	return out
+}
+
+// NormalizeDomain 转为小写并去掉末尾的点，校验是合法域名。
+func NormalizeDomain(domain string) (string, error) {
+	d := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if len(d) > 253 || !domainRe.MatchString(d) {
+		return "", fmt.Errorf("%w：%q 不是合法域名", ErrInvalidDomain, domain)
+	}
+	return d, nil
+}
+
+// RecordFQDN 把记录名转为区域内的完整域名：空或 @ 为根域名，不带根域名后缀时自动补上。
+func RecordFQDN(domain, name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if name == "" || name == "@" || name == domain {
+		return domain, nil
+	}
+	name = strings.TrimSuffix(name, "."+domain)
+	if !labelRe.MatchString(name) {
+		return "", fmt.Errorf("%w：记录名 %q 不合法", ErrInvalidDNSRecord, name)
+	}
+	return name + "." + domain, nil
+}
+
+// ValidateDNSRecord 校验记录类型与值；TXT 的值会补上 Lightsail 要求的双引号。
+func ValidateDNSRecord(r DNSRecord) (DNSRecord, error) {
+	r.Type = strings.ToUpper(strings.TrimSpace(r.Type))
+	r.Target = strings.TrimSpace(r.Target)
+	if r.Target == "" {
+		return r, fmt.Errorf("%w：记录值不能为空", ErrInvalidDNSRecord)
+	}
+	switch r.Type {
+	case "A":
+		if ip := net.ParseIP(r.Target); ip == nil || ip.To4() == nil {
+			return r, fmt.Errorf("%w：A 记录的值需为 IPv4 地址", ErrInvalidDNSRecord)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(r.Target); ip == nil || ip.To4() != nil {
+			return r, fmt.Errorf("%w：AAAA 记录的值需为 IPv6 地址", ErrInvalidDNSRecord)
+		}
+	case "CNAME":
+		t, err := NormalizeDomain(r.Target)
+		if err != nil {
+			return r, fmt.Errorf("%w：CNAME 记录的值需为域名", ErrInvalidDNSRecord)
+		}
+		r.Target = t
+	case "TXT":
+		if !strings.HasPrefix(r.Target, `"`) || !strings.HasSuffix(r.Target, `"`) || len(r.Target) < 2 {
+			r.Target = `"` + strings.ReplaceAll(r.Target, `"`, `\"`) + `"`
+		}
+	default:
+		return r, fmt.Errorf("%w：不支持的记录类型 %q", ErrInvalidDNSRecord, r.Type)
+	}
+	return r, nil
+}
+
+// ListDomains 返回账号下的 DNS 区域，按名称排序。
+func ListDomains(ctx context.Context, cli LightsailDNSAPI) ([]DomainView, error) {
+	var list []DomainView
+	var token *string
+	for {
+		out, err := cli.GetDomains(ctx, &lightsail.GetDomainsInput{PageToken: token})
+		if err != nil {
+			return nil, fmt.Errorf("拉取域名失败：%w", err)
+		}
+		for _, d := range out.Domains {
+			v := DomainView{Name: str(d.Name), Records: len(dnsRecords(d.DomainEntries))}
+			if d.CreatedAt != nil {
+				v.Created = d.CreatedAt.Format("2006-01-02 15:04:05")
+			}
+			list = append(list, v)
+		}
+		if str(out.NextPageToken) == "" {
+			break
+		}
+		token = out.NextPageToken
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// ListDNSRecords 返回区域内的 A/AAAA/CNAME/TXT 记录。
+func ListDNSRecords(ctx context.Context, cli LightsailDNSAPI, domain string) ([]DNSRecord, error) {
+	out, err := cli.GetDomain(ctx, &lightsail.GetDomainInput{DomainName: &domain})
+	if err != nil {
+		return nil, fmt.Errorf("拉取解析记录失败：%w", err)
+	}
+	if out.Domain == nil {
+		return nil, nil
+	}
+	return dnsRecords(out.Domain.DomainEntries), nil
+}
+
+func CreateDomain(ctx context.Context, cli LightsailDNSAPI, domain string) error {
+	d, err := NormalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+	if _, err := cli.CreateDomain(ctx, &lightsail.CreateDomainInput{DomainName: &d}); err != nil {
+		return fmt.Errorf("创建 DNS 区域失败：%w", err)
+	}
+	return nil
+}
+
+// CreateDNSRecord 校验后新增一条记录，r.Name 可以是相对名（www）或完整域名。
+func CreateDNSRecord(ctx context.Context, cli LightsailDNSAPI, domain string, r DNSRecord) error {
+	name, err := RecordFQDN(domain, r.Name)
+	if err != nil {
+		return err
+	}
+	r.Name = name
+	if r, err = ValidateDNSRecord(r); err != nil {
+		return err
+	}
+	_, err = cli.CreateDomainEntry(ctx, &lightsail.CreateDomainEntryInput{
+		DomainName:  &domain,
+		DomainEntry: &types.DomainEntry{Name: &r.Name, Type: &r.Type, Target: &r.Target},
+	})
+	if err != nil {
+		return fmt.Errorf("创建 %s 记录 %s 失败：%w", r.Type, r.Name, err)
+	}
+	return nil
+}
+
+func deleteDNSRecord(ctx context.Context, cli LightsailDNSAPI, domain string, r DNSRecord) error {
+	_, err := cli.DeleteDomainEntry(ctx, &lightsail.DeleteDomainEntryInput{
+		DomainName:  &domain,
+		DomainEntry: &types.DomainEntry{Id: &r.ID, Name: &r.Name, Type: &r.Type, Target: &r.Target, IsAlias: aws.Bool(r.IsAlias)},
+	})
+	if err != nil {
+		return fmt.Errorf("删除 %s 记录 %s 失败：%w", r.Type, r.Name, err)
+	}
+	return nil
+}
+
+// DeleteDNSRecord 按 ID 删除记录；Lightsail 要求带上完整的记录内容，所以先查出记录。
+func DeleteDNSRecord(ctx context.Context, cli LightsailDNSAPI, domain, id string) error {
+	list, err := ListDNSRecords(ctx, cli, domain)
+	if err != nil {
+		return err
+	}
+	for _, r := range list {
+		if r.ID == id {
+			return deleteDNSRecord(ctx, cli, domain, r)
+		}
+	}
+	return fmt.Errorf("%w：%s", ErrDNSRecordNotFound, id)
+}
+
+// DNSChange 是同步记录时的一次变更，Action 为 create、delete 或 keep。
+type DNSChange struct {
+	Action string `json:"action"`
+	DNSRecord
+}
+
+// InstanceIPv4 返回实例对外的 IPv4，优先使用静态 IP。
+func InstanceIPv4(inst InstanceView) string {
+	if inst.StaticIPv4 != "" {
+		return inst.StaticIPv4
+	}
+	return inst.PublicIPv4
+}
+
+// PointRecordAtInstance 让 name 的 A/AAAA 记录指向实例：先补上缺少的记录，再删除指向其他地址的同名记录，
+// 中途失败时旧记录仍在，不会出现解析不到的情况；实例没有 IPv6 时同名 AAAA 记录也会被删除，避免解析到旧地址。
+// 同名存在 CNAME 时拒绝修改。
+func PointRecordAtInstance(ctx context.Context, cli LightsailDNSAPI, domain, name string, inst InstanceView) ([]DNSChange, error) {
+	fqdn, err := RecordFQDN(domain, name)
+	if err != nil {
+		return nil, err
+	}
+	want := map[string]string{"A": InstanceIPv4(inst), "AAAA": inst.PublicIPv6}
+	if want["A"] == "" && want["AAAA"] == "" {
+		return nil, fmt.Errorf("实例 %s 没有公网 IP", inst.Name)
+	}
+	list, err := ListDNSRecords(ctx, cli, domain)
+	if err != nil {
+		return nil, err
+	}
+	var changes []DNSChange
+	var stale []DNSRecord
+	have := map[string]bool{}
+	for _, r := range list {
+		if r.Name != fqdn {
+			continue
+		}
+		if r.Type == "CNAME" {
+			return nil, fmt.Errorf("%w：%s 已有 CNAME 记录，请先删除", ErrInvalidDNSRecord, fqdn)
+		}
+		target, ok := want[r.Type]
+		if !ok {
+			continue
+		}
+		if r.Target == target && !r.IsAlias {
+			have[r.Type] = true
+			changes = append(changes, DNSChange{Action: "keep", DNSRecord: r})
+			continue
+		}
+		stale = append(stale, r)
+	}
+	for _, t := range []string{"A", "AAAA"} {
+		if want[t] == "" || have[t] {
+			continue
+		}
+		r := DNSRecord{Name: fqdn, Type: t, Target: want[t]}
+		if err := CreateDNSRecord(ctx, cli, domain, r); err != nil {
+			return changes, err
+		}
+		changes = append(changes, DNSChange{Action: "create", DNSRecord: r})
+	}
+	for _, r := range stale {
+		if err := deleteDNSRecord(ctx, cli, domain, r); err != nil {
+			return changes, err
+		}
+		changes = append(changes, DNSChange{Action: "delete", DNSRecord: r})
+	}
+	return changes, nil
+}
@@ -0,0 +1,123 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type fakeLightsailDNS struct {
+	LightsailDNSAPI
+	entries   []types.DomainEntry
+	deleted   []string
+	createErr error
+}
+
+func (f *fakeLightsailDNS) GetDomain(_ context.Context, in *lightsail.GetDomainInput, _ ...func(*lightsail.Options)) (*lightsail.GetDomainOutput, error) {
+	return &lightsail.GetDomainOutput{Domain: &types.Domain{Name: in.DomainName, DomainEntries: f.entries}}, nil
+}
+
+func (f *fakeLightsailDNS) CreateDomainEntry(_ context.Context, in *lightsail.CreateDomainEntryInput, _ ...func(*lightsail.Options)) (*lightsail.CreateDomainEntryOutput, error) {
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	e := *in.DomainEntry
+	e.Id = aws.String("new-" + strconv.Itoa(len(f.entries)))
+	f.entries = append(f.entries, e)
+	return &lightsail.CreateDomainEntryOutput{}, nil
+}
+
+func (f *fakeLightsailDNS) DeleteDomainEntry(_ context.Context, in *lightsail.DeleteDomainEntryInput, _ ...func(*lightsail.Options)) (*lightsail.DeleteDomainEntryOutput, error) {
+	f.deleted = append(f.deleted, *in.DomainEntry.Id)
+	return &lightsail.DeleteDomainEntryOutput{}, nil
+}
+
+func entry(id, name, typ, target string) types.DomainEntry {
+	return types.DomainEntry{Id: aws.String(id), Name: aws.String(name), Type: aws.String(typ), Target: aws.String(target)}
+}
+
+func TestRecordFQDN(t *testing.T) {
+	cases := map[string]string{
+		"":                "example.com",
+		"@":               "example.com",
+		"www":             "www.example.com",
+		"WWW.example.com": "www.example.com",
+		"*.dev":           "*.dev.example.com",
+	}
+	for in, want := range cases {
+		if got, err := RecordFQDN("example.com", in); err != nil || got != want {
+			t.Fatalf("RecordFQDN(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"-bad", "a..b", "sp ace"} {
+		if _, err := RecordFQDN("example.com", in); !errors.Is(err, ErrInvalidDNSRecord) {
+			t.Fatalf("RecordFQDN(%q) err = %v, want ErrInvalidDNSRecord", in, err)
+		}
+	}
+}
+
+func TestValidateDNSRecord(t *testing.T) {
+	bad := []DNSRecord{
+		{Type: "A", Target: "2001:db8::1"},
+		{Type: "AAAA", Target: "192.0.2.1"},
+		{Type: "CNAME", Target: "not a host"},
+		{Type: "MX", Target: "10 mail.example.com"},
+		{Type: "TXT", Target: " "},
+	}
+	for _, r := range bad {
+		if _, err := ValidateDNSRecord(r); !errors.Is(err, ErrInvalidDNSRecord) {
+			t.Fatalf("ValidateDNSRecord(%+v) err = %v, want ErrInvalidDNSRecord", r, err)
+		}
+	}
+	r, err := ValidateDNSRecord(DNSRecord{Type: "txt", Target: "v=spf1 -all"})
+	if err != nil || r.Type != "TXT" || r.Target != `"v=spf1 -all"` {
+		t.Fatalf("txt = %+v, %v", r, err)
+	}
+}
+
+func TestPointRecordAtInstance(t *testing.T) {
+	cli := &fakeLightsailDNS{entries: []types.DomainEntry{
+		entry("ns", "example.com", "NS", "ns-1.awsdns-01.org"),
+		entry("old-a", "vps.example.com", "A", "198.51.100.1"),
+		entry("same-aaaa", "vps.example.com", "AAAA", "2001:db8::1"),
+		entry("other", "www.example.com", "A", "198.51.100.1"),
+	}}
+	inst := InstanceView{Name: "vps-1", PublicIPv4: "203.0.113.5", StaticIPv4: "203.0.113.9", PublicIPv6: "2001:db8::1"}
+	changes, err := PointRecordAtInstance(context.Background(), cli, "example.com", "vps", inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cli.deleted) != 1 || cli.deleted[0] != "old-a" {
+		t.Fatalf("deleted = %v", cli.deleted)
+	}
+	// 先建新记录再删旧记录
+	if len(changes) != 3 || changes[1].Action != "create" || changes[1].Target != "203.0.113.9" || changes[2].Action != "delete" {
+		t.Fatalf("changes = %+v", changes)
+	}
+
+	// 新记录建不出来时保留旧记录
+	cli = &fakeLightsailDNS{entries: []types.DomainEntry{entry("old-a", "vps.example.com", "A", "198.51.100.1")}, createErr: errors.New("boom")}
+	if _, err := PointRecordAtInstance(context.Background(), cli, "example.com", "vps", inst); err == nil || len(cli.deleted) != 0 {
+		t.Fatalf("create failure: err = %v, deleted = %v", err, cli.deleted)
+	}
+
+	cli.entries = append(cli.entries, entry("cname", "app.example.com", "CNAME", "vps.example.com"))
+	if _, err := PointRecordAtInstance(context.Background(), cli, "example.com", "app", inst); !errors.Is(err, ErrInvalidDNSRecord) {
+		t.Fatalf("cname conflict err = %v", err)
+	}
+}
+
+func TestDeleteDNSRecord(t *testing.T) {
+	cli := &fakeLightsailDNS{entries: []types.DomainEntry{entry("r1", "example.com", "TXT", `"x"`)}}
+	if err := DeleteDNSRecord(context.Background(), cli, "example.com", "r1"); err != nil || len(cli.deleted) != 1 {
+		t.Fatalf("delete = %v, %v", err, cli.deleted)
+	}
+	if err := DeleteDNSRecord(context.Background(), cli, "example.com", "missing"); !errors.Is(err, ErrDNSRecordNotFound) {
+		t.Fatalf("missing err = %v", err)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"net"
 	"sort"
@@ -14,58 +13,18 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
-	"github.com/aws/smithy-go"
 )
 
 type EC2InstanceView struct {
-	ID          string
-	Name        string
-	State       string
-	InstanceTyp string
-	PublicIPv4  string
-	PublicIPv6  string
-	PrivateIPv4 string
-	Zone        string
-	LaunchedAt  string
-}
-
-type EC2AMIOption struct {
-	Key     string
-	Name    string
-	Owner   string
-	Pattern string
-	Arch    string
-}
-
-var defaultEC2AMIOptions = []EC2AMIOption{
-	{
-		Key:     "ubuntu-24.04",
-		Name:    "Ubuntu 24.04 LTS",
-		Owner:   "099720109477",
-		Pattern: "ubuntu/images/hvm-ssd-gp3/ubuntu-noble-24.04-*",
-		Arch:    "x86_64",
-	},
-	{
-		Key:     "ubuntu-22.04",
-		Name:    "Ubuntu 22.04 LTS",
-		Owner:   "099720109477",
-		Pattern: "ubuntu/images/hvm-ssd/ubuntu-jammy-22.04-*",
-		Arch:    "x86_64",
-	},
-	{
-		Key:     "debian-12",
-		Name:    "Debian 12",
-		Owner:   "136693071363",
-		Pattern: "debian-12-*",
-		Arch:    "x86_64",
-	},
-	{
-		Key:     "amzn-2023",
-		Name:    "Amazon Linux 2023",
-		Owner:   "137112412989",
-		Pattern: "al2023-ami-2023.*",
-		Arch:    "x86_64",
-	},
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	InstanceTyp string `json:"instance_type"`
+	PublicIPv4  string `json:"public_ipv4"`
+	PublicIPv6  string `json:"public_ipv6"`
+	PrivateIPv4 string `json:"private_ipv4"`
+	Zone        string `json:"zone"`
+	LaunchedAt  string `json:"launched_at"`
 }
 
 type CreateEC2InstanceInput struct {
@@ -74,54 +33,16 @@ type CreateEC2InstanceInput struct {
 	InstanceType string
 	Count        int32
 	UserData     string
+	KeyName      string // 已导入的 EC2 密钥对，见 EnsureEC2KeyPair
 	EnableIPv6   bool
-}
-
-func ResolveEC2AMI(ctx context.Context, cli *ec2.Client, key string) (string, error) {
-	key = strings.TrimSpace(key)
-	if key == "" {
-		key = "ubuntu-22.04"
-	}
-	for _, opt := range defaultEC2AMIOptions {
-		if opt.Key == key {
-			amiID, err := latestAMI(ctx, cli, opt.Owner, opt.Pattern, opt.Arch)
-			if err != nil {
-				return "", err
-			}
-			if amiID == "" {
-				return "", fmt.Errorf("未找到 AMI：%s", opt.Name)
-			}
-			return amiID, nil
-		}
-	}
-	return "", fmt.Errorf("未知 AMI 选项：%s", key)
-}
-
-func latestAMI(ctx context.Context, cli *ec2.Client, owner, pattern, arch string) (string, error) {
-	out, err := cli.DescribeImages(ctx, &ec2.DescribeImagesInput{
-		Owners: []string{owner},
-		Filters: []ec2types.Filter{
-			{Name: aws.String("name"), Values: []string{pattern}},
-			{Name: aws.String("architecture"), Values: []string{arch}},
-			{Name: aws.String("virtualization-type"), Values: []string{"hvm"}},
-		},
-	})
-	if err != nil {
-		return "", err
-	}
-	if len(out.Images) == 0 {
-		return "", nil
-	}
-	sort.Slice(out.Images, func(i, j int) bool {
-		return aws.ToString(out.Images[i].CreationDate) > aws.ToString(out.Images[j].CreationDate)
-	})
-	return aws.ToString(out.Images[0].ImageId), nil
+	// AvailabilityZone 为空时由 AWS 选择；开启 IPv6 时优先使用该可用区内的 IPv6 子网
+	AvailabilityZone string
 }
 
 func ListEC2Instances(ctx context.Context, cli *ec2.Client) ([]EC2InstanceView, error) {
 	out, err := cli.DescribeInstances(ctx, &ec2.DescribeInstancesInput{})
 	if err != nil {
-		return nil, fmt.Errorf("拉取 EC2 实例失败：%v", err)
+		return nil, fmt.Errorf("拉取 EC2 实例失败：%w", err)
 	}
 	var list []EC2InstanceView
 	for _, res := range out.Reservations {
@@ -191,7 +112,7 @@ func CreateEC2Instance(ctx context.Context, cli *ec2.Client, in CreateEC2Instanc
 		},
 	}
 	if in.EnableIPv6 {
-		subnetID, err := selectIPv6Subnet(ctx, cli)
+		subnetID, err := selectIPv6Subnet(ctx, cli, in.AvailabilityZone)
 		if err != nil {
 			return err
 		}
@@ -200,6 +121,11 @@ func CreateEC2Instance(ctx context.Context, cli *ec2.Client, in CreateEC2Instanc
 		}
 		runIn.SubnetId = aws.String(subnetID)
 		runIn.Ipv6AddressCount = aws.Int32(1)
+	} else if in.AvailabilityZone != "" {
+		runIn.Placement = &ec2types.Placement{AvailabilityZone: aws.String(in.AvailabilityZone)}
+	}
+	if in.KeyName != "" {
+		runIn.KeyName = aws.String(in.KeyName)
 	}
 	if strings.TrimSpace(in.UserData) != "" {
 		runIn.UserData = aws.String(base64.StdEncoding.EncodeToString([]byte(in.UserData)))
@@ -214,15 +140,15 @@ func CreateEC2Instance(ctx context.Context, cli *ec2.Client, in CreateEC2Instanc
 	}
 	_, err := cli.RunInstances(ctx, runIn)
 	if err != nil {
-		return fmt.Errorf("创建 EC2 实例失败：%v", err)
+		return fmt.Errorf("创建 EC2 实例失败：%w", err)
 	}
 	return nil
 }
 
-func selectIPv6Subnet(ctx context.Context, cli *ec2.Client) (string, error) {
+func selectIPv6Subnet(ctx context.Context, cli *ec2.Client, zone string) (string, error) {
 	out, err := cli.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{})
 	if err != nil {
-		return "", fmt.Errorf("查询子网失败：%v", err)
+		return "", fmt.Errorf("查询子网失败：%w", err)
 	}
 	type subnetInfo struct {
 		ID           string
@@ -255,6 +181,9 @@ func selectIPv6Subnet(ctx context.Context, cli *ec2.Client) (string, error) {
 		return subnetID, nil
 	}
 	sort.Slice(candidates, func(i, j int) bool {
+		if (candidates[i].Zone == zone) != (candidates[j].Zone == zone) {
+			return candidates[i].Zone == zone
+		}
 		if candidates[i].DefaultForAZ != candidates[j].DefaultForAZ {
 			return candidates[i].DefaultForAZ
 		}
@@ -273,7 +202,7 @@ func ensureDefaultIPv6Subnet(ctx context.Context, cli *ec2.Client) (string, erro
 		},
 	})
 	if err != nil {
-		return "", fmt.Errorf("查询默认 VPC 失败：%v", err)
+		return "", fmt.Errorf("查询默认 VPC 失败：%w", err)
 	}
 	if len(vpcOut.Vpcs) == 0 {
 		return "", fmt.Errorf("未找到支持 IPv6 的子网，且当前账号没有默认 VPC")
@@ -292,7 +221,7 @@ func ensureDefaultIPv6Subnet(ctx context.Context, cli *ec2.Client) (string, erro
 		},
 	})
 	if err != nil {
-		return "", fmt.Errorf("查询默认 VPC 子网失败：%v", err)
+		return "", fmt.Errorf("查询默认 VPC 子网失败：%w", err)
 	}
 	if len(subnetOut.Subnets) == 0 {
 		return "", fmt.Errorf("默认 VPC 没有可用子网")
@@ -325,7 +254,7 @@ func ensureVpcIPv6(ctx context.Context, cli *ec2.Client, vpcID string) (string,
 		AmazonProvidedIpv6CidrBlock: aws.Bool(true),
 	})
 	if err != nil {
-		return "", fmt.Errorf("为默认 VPC 开启 IPv6 失败：%v", err)
+		return "", fmt.Errorf("为默认 VPC 开启 IPv6 失败：%w", err)
 	}
 
 	for i := 0; i < 10; i++ {
@@ -347,7 +276,7 @@ func describeVpc(ctx context.Context, cli *ec2.Client, vpcID string) (ec2types.V
 		VpcIds: []string{vpcID},
 	})
 	if err != nil {
-		return ec2types.Vpc{}, fmt.Errorf("查询 VPC 失败：%v", err)
+		return ec2types.Vpc{}, fmt.Errorf("查询 VPC 失败：%w", err)
 	}
 	if len(out.Vpcs) == 0 {
 		return ec2types.Vpc{}, fmt.Errorf("未找到 VPC：%s", vpcID)
@@ -422,7 +351,7 @@ func enableSubnetIPv6(ctx context.Context, cli *ec2.Client, subnets []ec2types.S
 		Ipv6CidrBlock: aws.String(cidr),
 	})
 	if err != nil {
-		return "", fmt.Errorf("为默认子网开启 IPv6 失败：%v", err)
+		return "", fmt.Errorf("为默认子网开启 IPv6 失败：%w", err)
 	}
 
 	for i := 0; i < 10; i++ {
@@ -431,7 +360,7 @@ func enableSubnetIPv6(ctx context.Context, cli *ec2.Client, subnets []ec2types.S
 			SubnetIds: []string{subnetID},
 		})
 		if err != nil {
-			return "", fmt.Errorf("查询子网 IPv6 状态失败：%v", err)
+			return "", fmt.Errorf("查询子网 IPv6 状态失败：%w", err)
 		}
 		if len(subnetOut.Subnets) == 0 {
 			continue
@@ -450,7 +379,7 @@ func ensureSubnetIPv6Route(ctx context.Context, cli *ec2.Client, subnetID string
 		SubnetIds: []string{subnetID},
 	})
 	if err != nil {
-		return fmt.Errorf("查询子网失败：%v", err)
+		return fmt.Errorf("查询子网失败：%w", err)
 	}
 	if len(subnetOut.Subnets) == 0 {
 		return fmt.Errorf("未找到子网：%s", subnetID)
@@ -463,7 +392,7 @@ func ensureSubnetIPv6Route(ctx context.Context, cli *ec2.Client, subnetID string
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("查询 Internet Gateway 失败：%v", err)
+		return fmt.Errorf("查询 Internet Gateway 失败：%w", err)
 	}
 	if len(igwOut.InternetGateways) == 0 {
 		return fmt.Errorf("未找到 Internet Gateway：%s", vpcID)
@@ -476,7 +405,7 @@ func ensureSubnetIPv6Route(ctx context.Context, cli *ec2.Client, subnetID string
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("查询路由表失败：%v", err)
+		return fmt.Errorf("查询路由表失败：%w", err)
 	}
 	if len(rtOut.RouteTables) == 0 {
 		rtOut, err = cli.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{
@@ -486,7 +415,7 @@ func ensureSubnetIPv6Route(ctx context.Context, cli *ec2.Client, subnetID string
 			},
 		})
 		if err != nil {
-			return fmt.Errorf("查询主路由表失败：%v", err)
+			return fmt.Errorf("查询主路由表失败：%w", err)
 		}
 		if len(rtOut.RouteTables) == 0 {
 			return fmt.Errorf("未找到可用路由表：%s", vpcID)
@@ -506,7 +435,7 @@ func ensureSubnetIPv6Route(ctx context.Context, cli *ec2.Client, subnetID string
 		GatewayId:                aws.String(igwID),
 	})
 	if err != nil && !isDuplicateRoute(err) {
-		return fmt.Errorf("创建 IPv6 路由失败：%v", err)
+		return fmt.Errorf("创建 IPv6 路由失败：%w", err)
 	}
 	return nil
 }
@@ -514,7 +443,7 @@ func ensureSubnetIPv6Route(ctx context.Context, cli *ec2.Client, subnetID string
 func nextSubnetIPv6CIDR(vpcIPv6 string, subnets []ec2types.Subnet) (string, error) {
 	ip, netCIDR, err := net.ParseCIDR(vpcIPv6)
 	if err != nil {
-		return "", fmt.Errorf("解析 VPC IPv6 CIDR 失败：%v", err)
+		return "", fmt.Errorf("解析 VPC IPv6 CIDR 失败：%w", err)
 	}
 	prefixLen, _ := netCIDR.Mask.Size()
 	if prefixLen > 64 {
@@ -566,7 +495,7 @@ func nextSubnetIPv6CIDR(vpcIPv6 string, subnets []ec2types.Subnet) (string, erro
 func StartEC2Instance(ctx context.Context, cli *ec2.Client, id string) error {
 	_, err := cli.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: []string{id}})
 	if err != nil {
-		return fmt.Errorf("启动失败：%v", err)
+		return fmt.Errorf("启动失败：%w", err)
 	}
 	return nil
 }
@@ -574,7 +503,7 @@ func StartEC2Instance(ctx context.Context, cli *ec2.Client, id string) error {
 func StopEC2Instance(ctx context.Context, cli *ec2.Client, id string) error {
 	_, err := cli.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: []string{id}})
 	if err != nil {
-		return fmt.Errorf("停止失败：%v", err)
+		return fmt.Errorf("停止失败：%w", err)
 	}
 	return nil
 }
@@ -582,7 +511,7 @@ func StopEC2Instance(ctx context.Context, cli *ec2.Client, id string) error {
 func RebootEC2Instance(ctx context.Context, cli *ec2.Client, id string) error {
 	_, err := cli.RebootInstances(ctx, &ec2.RebootInstancesInput{InstanceIds: []string{id}})
 	if err != nil {
-		return fmt.Errorf("重启失败：%v", err)
+		return fmt.Errorf("重启失败：%w", err)
 	}
 	return nil
 }
@@ -590,7 +519,7 @@ func RebootEC2Instance(ctx context.Context, cli *ec2.Client, id string) error {
 func TerminateEC2Instance(ctx context.Context, cli *ec2.Client, id string) error {
 	_, err := cli.TerminateInstances(ctx, &ec2.TerminateInstancesInput{InstanceIds: []string{id}})
 	if err != nil {
-		return fmt.Errorf("终止失败：%v", err)
+		return fmt.Errorf("终止失败：%w", err)
 	}
 	return nil
 }
@@ -600,7 +529,7 @@ func OpenAllEC2Ports(ctx context.Context, cli *ec2.Client, id string) error {
 		InstanceIds: []string{id},
 	})
 	if err != nil {
-		return fmt.Errorf("查询实例失败：%v", err)
+		return fmt.Errorf("查询实例失败：%w", err)
 	}
 	sgIDs := map[string]struct{}{}
 	for _, res := range out.Reservations {
@@ -637,28 +566,28 @@ func OpenAllEC2Ports(ctx context.Context, cli *ec2.Client, id string) error {
 			IpPermissions: permIPv4,
 		})
 		if err != nil && !isDuplicatePermission(err) {
-			return fmt.Errorf("开放入站失败：%v", err)
+			return fmt.Errorf("开放入站失败：%w", err)
 		}
 		_, err = cli.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
 			GroupId:       aws.String(sgID),
 			IpPermissions: permIPv6,
 		})
 		if err != nil && !isDuplicatePermission(err) {
-			return fmt.Errorf("开放入站失败：%v", err)
+			return fmt.Errorf("开放入站失败：%w", err)
 		}
 		_, err = cli.AuthorizeSecurityGroupEgress(ctx, &ec2.AuthorizeSecurityGroupEgressInput{
 			GroupId:       aws.String(sgID),
 			IpPermissions: permIPv4,
 		})
 		if err != nil && !isDuplicatePermission(err) {
-			return fmt.Errorf("开放出站失败：%v", err)
+			return fmt.Errorf("开放出站失败：%w", err)
 		}
 		_, err = cli.AuthorizeSecurityGroupEgress(ctx, &ec2.AuthorizeSecurityGroupEgressInput{
 			GroupId:       aws.String(sgID),
 			IpPermissions: permIPv6,
 		})
 		if err != nil && !isDuplicatePermission(err) {
-			return fmt.Errorf("开放出站失败：%v", err)
+			return fmt.Errorf("开放出站失败：%w", err)
 		}
 	}
 	return nil
@@ -667,7 +596,7 @@ func OpenAllEC2Ports(ctx context.Context, cli *ec2.Client, id string) error {
 func describeEC2Instance(ctx context.Context, cli *ec2.Client, id string) (ec2types.Instance, error) {
 	out, err := cli.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{id}})
 	if err != nil {
-		return ec2types.Instance{}, fmt.Errorf("查询 EC2 实例失败：%v", err)
+		return ec2types.Instance{}, fmt.Errorf("查询 EC2 实例失败：%w", err)
 	}
 	for _, res := range out.Reservations {
 		for _, ins := range res.Instances {
@@ -680,28 +609,19 @@ func describeEC2Instance(ctx context.Context, cli *ec2.Client, id string) (ec2ty
 }
 
 func isDuplicatePermission(err error) bool {
-	var apiErr smithy.APIError
-	if !errors.As(err, &apiErr) {
-		return false
-	}
-	return apiErr.ErrorCode() == "InvalidPermission.Duplicate"
+	return ErrorCode(err) == "InvalidPermission.Duplicate"
 }
 
 func isDuplicateRoute(err error) bool {
-	var apiErr smithy.APIError
-	if !errors.As(err, &apiErr) {
-		return false
-	}
-	code := apiErr.ErrorCode()
+	code := ErrorCode(err)
 	return code == "RouteAlreadyExists" || code == "InvalidRoute.Duplicate"
 }
 
 func isEC2ErrorCode(err error, codes ...string) bool {
-	var apiErr smithy.APIError
-	if !errors.As(err, &apiErr) {
+	code := ErrorCode(err)
+	if code == "" {
 		return false
 	}
-	code := apiErr.ErrorCode()
 	for _, c := range codes {
 		if code == c {
 			return true
@@ -0,0 +1,35 @@
+package aws
+
+import (
+	"errors"
+
+	"github.com/aws/smithy-go"
+)
+
+// ErrorCode 返回错误链中 AWS API 错误的错误码（如 UnauthorizedOperation），不是 AWS 返回的错误时为空。
+func ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+	return apiErr.ErrorCode()
+}
+
+// IsAuthError 表示密钥无效、已停用或没有权限，换个时间重试也不会成功；限流、网络等临时错误返回 false。
+func IsAuthError(err error) bool {
+	switch ErrorCode(err) {
+	case "UnrecognizedClientException", "InvalidClientTokenId", "InvalidAccessKeyId", "SignatureDoesNotMatch",
+		"AuthFailure", "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+		return true
+	}
+	return false
+}
+
+// HTTPStatus 返回 AWS 响应的 HTTP 状态码，请求未到达 AWS（网络、代理等）时为 0。
+func HTTPStatus(err error) int {
+	var respErr interface{ HTTPStatusCode() int }
+	if !errors.As(err, &respErr) {
+		return 0
+	}
+	return respErr.HTTPStatusCode()
+}
@@ -0,0 +1,201 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+// FirewallRule 是一条 Lightsail 公网端口规则。ICMP 规则的 FromPort / ToPort 是 ICMP type / code。
+type FirewallRule struct {
+	Protocol  string   `json:"protocol"`
+	FromPort  int32    `json:"from_port"`
+	ToPort    int32    `json:"to_port"`
+	CIDRs     []string `json:"cidrs,omitempty"`
+	IPv6CIDRs []string `json:"ipv6_cidrs,omitempty"`
+}
+
+// AllPortsRule 对应原来的“开放全部端口”。
+func AllPortsRule() FirewallRule {
+	return FirewallRule{Protocol: "all", FromPort: 0, ToPort: 65535, CIDRs: []string{"0.0.0.0/0"}, IPv6CIDRs: []string{"::/0"}}
+}
+
+// Validate 检查协议、端口范围和 CIDR，并把 CIDR 规范化。没有任何来源时视为对所有地址开放。
+func (r *FirewallRule) Validate() error {
+	r.Protocol = strings.ToLower(strings.TrimSpace(r.Protocol))
+	switch r.Protocol {
+	case "tcp", "udp", "all", "icmp", "icmpv6":
+	default:
+		return fmt.Errorf("不支持的协议：%q（可用 tcp / udp / all / icmp / icmpv6）", r.Protocol)
+	}
+	if r.FromPort < -1 || r.ToPort > 65535 || r.FromPort > r.ToPort {
+		return fmt.Errorf("端口范围无效：%d-%d", r.FromPort, r.ToPort)
+	}
+	if r.Protocol == "all" && (r.FromPort != 0 || r.ToPort != 65535) {
+		return fmt.Errorf("协议 all 只能使用 0-65535")
+	}
+	v4, v6 := []string{}, []string{}
+	for _, c := range append(append([]string{}, r.CIDRs...), r.IPv6CIDRs...) {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("CIDR 无效：%q", c)
+		}
+		if ipNet.IP.To4() != nil {
+			v4 = append(v4, ipNet.String())
+		} else {
+			v6 = append(v6, ipNet.String())
+		}
+	}
+	if len(v4) == 0 && len(v6) == 0 {
+		v4, v6 = []string{"0.0.0.0/0"}, []string{"::/0"}
+	}
+	r.CIDRs, r.IPv6CIDRs = v4, v6
+	return nil
+}
+
+// String 返回规则的文本形式，例如 “tcp 22 0.0.0.0/0 ::/0”，可由 ParseFirewallRules 解析。
+func (r FirewallRule) String() string {
+	ports := strconv.Itoa(int(r.FromPort))
+	if r.ToPort != r.FromPort {
+		ports += "-" + strconv.Itoa(int(r.ToPort))
+	}
+	parts := append([]string{r.Protocol, ports}, r.CIDRs...)
+	return strings.Join(append(parts, r.IPv6CIDRs...), " ")
+}
+
+// ParseFirewallRules 解析每行一条的规则文本：“协议 端口[-端口] [CIDR ...]”。
+// 空行和 # 开头的行会被忽略；all 协议可以省略端口。
+func ParseFirewallRules(text string) ([]FirewallRule, error) {
+	var out []FirewallRule
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		r := FirewallRule{Protocol: fields[0]}
+		rest := fields[1:]
+		if strings.EqualFold(r.Protocol, "all") && (len(rest) == 0 || strings.Contains(rest[0], "/")) {
+			r.FromPort, r.ToPort = 0, 65535
+		} else {
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("第 %d 行缺少端口", i+1)
+			}
+			from, to, err := parsePortRange(rest[0])
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 行：%w", i+1, err)
+			}
+			r.FromPort, r.ToPort = from, to
+			rest = rest[1:]
+		}
+		r.CIDRs = rest
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("第 %d 行：%w", i+1, err)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// FormatFirewallRules 是 ParseFirewallRules 的逆操作。
+func FormatFirewallRules(rules []FirewallRule) string {
+	lines := make([]string, 0, len(rules))
+	for _, r := range rules {
+		lines = append(lines, r.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func parsePortRange(s string) (int32, int32, error) {
+	fromStr, toStr, ok := strings.Cut(s, "-")
+	if !ok {
+		toStr = fromStr
+	}
+	from, err1 := strconv.ParseInt(fromStr, 10, 32)
+	to, err2 := strconv.ParseInt(toStr, 10, 32)
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("端口无效：%q", s)
+	}
+	return int32(from), int32(to), nil
+}
+
+func (r FirewallRule) portInfo() types.PortInfo {
+	return types.PortInfo{
+		Protocol:  types.NetworkProtocol(r.Protocol),
+		FromPort:  r.FromPort,
+		ToPort:    r.ToPort,
+		Cidrs:     r.CIDRs,
+		Ipv6Cidrs: r.IPv6CIDRs,
+	}
+}
+
+// GetFirewallRules 返回实例当前开放的端口规则。
+func GetFirewallRules(ctx context.Context, cli LightsailAPI, instanceName string) ([]FirewallRule, error) {
+	out, err := cli.GetInstancePortStates(ctx, &lightsail.GetInstancePortStatesInput{InstanceName: &instanceName})
+	if err != nil {
+		return nil, fmt.Errorf("拉取防火墙规则失败：%w", err)
+	}
+	list := make([]FirewallRule, 0, len(out.PortStates))
+	for _, ps := range out.PortStates {
+		if ps.State != types.PortStateOpen {
+			continue
+		}
+		list = append(list, FirewallRule{
+			Protocol:  string(ps.Protocol),
+			FromPort:  ps.FromPort,
+			ToPort:    ps.ToPort,
+			CIDRs:     ps.Cidrs,
+			IPv6CIDRs: ps.Ipv6Cidrs,
+		})
+	}
+	return list, nil
+}
+
+// OpenFirewallRule 在现有规则之外新增一条规则。
+func OpenFirewallRule(ctx context.Context, cli LightsailAPI, instanceName string, rule FirewallRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	pi := rule.portInfo()
+	return SafeRetry("开放端口", 6, 1200*time.Millisecond, func() error {
+		_, err := cli.OpenInstancePublicPorts(ctx, &lightsail.OpenInstancePublicPortsInput{InstanceName: &instanceName, PortInfo: &pi})
+		return err
+	})
+}
+
+// CloseFirewallRule 删除一条规则，协议、端口和 CIDR 需要与现有规则一致。
+func CloseFirewallRule(ctx context.Context, cli LightsailAPI, instanceName string, rule FirewallRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	pi := rule.portInfo()
+	return SafeRetry("关闭端口", 6, 1200*time.Millisecond, func() error {
+		_, err := cli.CloseInstancePublicPorts(ctx, &lightsail.CloseInstancePublicPortsInput{InstanceName: &instanceName, PortInfo: &pi})
+		return err
+	})
+}
+
+// PutFirewallRules 用 rules 整体替换实例的全部规则，未列出的端口都会被关闭。
+func PutFirewallRules(ctx context.Context, cli LightsailAPI, instanceName string, rules []FirewallRule) error {
+	infos := make([]types.PortInfo, 0, len(rules))
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return err
+		}
+		infos = append(infos, rules[i].portInfo())
+	}
+	return SafeRetry("应用防火墙规则", 6, 1200*time.Millisecond, func() error {
+		_, err := cli.PutInstancePublicPorts(ctx, &lightsail.PutInstancePublicPortsInput{InstanceName: &instanceName, PortInfos: infos})
+		return err
+	})
+}
@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type fakeLightsailFirewall struct {
+	LightsailAPI
+	states []types.InstancePortState
+	put    *lightsail.PutInstancePublicPortsInput
+}
+
+func (f *fakeLightsailFirewall) GetInstancePortStates(context.Context, *lightsail.GetInstancePortStatesInput, ...func(*lightsail.Options)) (*lightsail.GetInstancePortStatesOutput, error) {
+	return &lightsail.GetInstancePortStatesOutput{PortStates: f.states}, nil
+}
+
+func (f *fakeLightsailFirewall) PutInstancePublicPorts(_ context.Context, in *lightsail.PutInstancePublicPortsInput, _ ...func(*lightsail.Options)) (*lightsail.PutInstancePublicPortsOutput, error) {
+	f.put = in
+	return &lightsail.PutInstancePublicPortsOutput{}, nil
+}
+
+func TestParseFirewallRules(t *testing.T) {
+	rules, err := ParseFirewallRules("# ssh\ntcp 22 1.2.3.4/32\n\nudp 8000-9000 2001:db8::/32 10.0.0.0/8\nall\n")
+	if err != nil {
+		t.Fatalf("ParseFirewallRules: %v", err)
+	}
+	want := []string{
+		"tcp 22 1.2.3.4/32",
+		"udp 8000-9000 10.0.0.0/8 2001:db8::/32",
+		"all 0-65535 0.0.0.0/0 ::/0",
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("rules = %+v", rules)
+	}
+	for i, r := range rules {
+		if r.String() != want[i] {
+			t.Fatalf("rule %d = %q, want %q", i, r.String(), want[i])
+		}
+	}
+	if again, err := ParseFirewallRules(FormatFirewallRules(rules)); err != nil || len(again) != len(rules) {
+		t.Fatalf("round trip = %+v, %v", again, err)
+	}
+
+	for _, bad := range []string{"tcp", "sctp 22", "tcp 22-21", "tcp 70000", "tcp 22 1.2.3.4", "all 22"} {
+		if _, err := ParseFirewallRules(bad); err == nil {
+			t.Fatalf("ParseFirewallRules(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestGetAndPutFirewallRules(t *testing.T) {
+	cli := &fakeLightsailFirewall{states: []types.InstancePortState{
+		{Protocol: types.NetworkProtocolTcp, FromPort: 22, ToPort: 22, State: types.PortStateOpen, Cidrs: []string{"0.0.0.0/0"}},
+		{Protocol: types.NetworkProtocolTcp, FromPort: 80, ToPort: 80, State: types.PortStateClosed},
+	}}
+	rules, err := GetFirewallRules(context.Background(), cli, "vps-1")
+	if err != nil {
+		t.Fatalf("GetFirewallRules: %v", err)
+	}
+	if len(rules) != 1 || rules[0].String() != "tcp 22 0.0.0.0/0" {
+		t.Fatalf("rules = %+v", rules)
+	}
+
+	if err := PutFirewallRules(context.Background(), cli, "vps-1", []FirewallRule{{Protocol: "TCP", FromPort: 443, ToPort: 443}}); err != nil {
+		t.Fatalf("PutFirewallRules: %v", err)
+	}
+	if len(cli.put.PortInfos) != 1 {
+		t.Fatalf("put = %+v", cli.put.PortInfos)
+	}
+	pi := cli.put.PortInfos[0]
+	if pi.Protocol != types.NetworkProtocolTcp || pi.FromPort != 443 || len(pi.Cidrs) != 1 || len(pi.Ipv6Cidrs) != 1 {
+		t.Fatalf("port info = %+v", pi)
+	}
+}
@@ -0,0 +1,198 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// EC2InstanceTypeAPI 是查询区域内实例类型需要的 EC2 接口，*ec2.Client 满足该接口。
+type EC2InstanceTypeAPI interface {
+	DescribeInstanceTypeOfferings(context.Context, *ec2.DescribeInstanceTypeOfferingsInput, ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error)
+	DescribeInstanceTypes(context.Context, *ec2.DescribeInstanceTypesInput, ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error)
+}
+
+var ErrInstanceTypeUnavailable = errors.New("instance type unavailable")
+
+type InstanceTypeView struct {
+	Type          string   `json:"type"`
+	VCPUs         int32    `json:"vcpus"`
+	MemoryMiB     int64    `json:"memory_mib"`
+	Architectures []string `json:"architectures"`
+	Burstable     bool     `json:"burstable"`
+	FreeTier      bool     `json:"free_tier"`
+}
+
+func (v InstanceTypeView) MemoryGB() string {
+	return strconv.FormatFloat(float64(v.MemoryMiB)/1024, 'f', -1, 64)
+}
+
+// Label 是下拉框中显示的说明，例如 “t4g.small (2 vCPU, 2 GB, ARM, 突发)”。
+func (v InstanceTypeView) Label() string {
+	parts := []string{fmt.Sprintf("%d vCPU", v.VCPUs), v.MemoryGB() + " GB"}
+	if !containsString(v.Architectures, "x86_64") && containsString(v.Architectures, "arm64") {
+		parts = append(parts, "ARM")
+	}
+	if v.Burstable {
+		parts = append(parts, "突发")
+	}
+	if v.FreeTier {
+		parts = append(parts, "免费套餐")
+	}
+	return v.Type + " (" + strings.Join(parts, ", ") + ")"
+}
+
+// ListEC2InstanceTypes 返回区域内可以启动的实例类型，按系列、vCPU、内存排序。
+func ListEC2InstanceTypes(ctx context.Context, cli EC2InstanceTypeAPI) ([]InstanceTypeView, error) {
+	var offered []ec2types.InstanceType
+	var token *string
+	for {
+		out, err := cli.DescribeInstanceTypeOfferings(ctx, &ec2.DescribeInstanceTypeOfferingsInput{
+			LocationType: ec2types.LocationTypeRegion,
+			NextToken:    token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("查询可用实例类型失败：%w", err)
+		}
+		for _, o := range out.InstanceTypeOfferings {
+			offered = append(offered, o.InstanceType)
+		}
+		if out.NextToken == nil || *out.NextToken == "" {
+			break
+		}
+		token = out.NextToken
+	}
+
+	var list []InstanceTypeView
+	// DescribeInstanceTypes 每次最多查询 100 个类型
+	for start := 0; start < len(offered); start += 100 {
+		end := start + 100
+		if end > len(offered) {
+			end = len(offered)
+		}
+		out, err := cli.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{InstanceTypes: offered[start:end]})
+		if err != nil {
+			return nil, fmt.Errorf("查询实例类型规格失败：%w", err)
+		}
+		for _, it := range out.InstanceTypes {
+			list = append(list, instanceTypeView(it))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		fi, fj := instanceFamily(list[i].Type), instanceFamily(list[j].Type)
+		if fi != fj {
+			return fi < fj
+		}
+		if list[i].VCPUs != list[j].VCPUs {
+			return list[i].VCPUs < list[j].VCPUs
+		}
+		return list[i].MemoryMiB < list[j].MemoryMiB
+	})
+	return list, nil
+}
+
+func instanceTypeView(it ec2types.InstanceTypeInfo) InstanceTypeView {
+	v := InstanceTypeView{
+		Type:      string(it.InstanceType),
+		Burstable: aws.ToBool(it.BurstablePerformanceSupported),
+		FreeTier:  aws.ToBool(it.FreeTierEligible),
+	}
+	if it.VCpuInfo != nil {
+		v.VCPUs = aws.ToInt32(it.VCpuInfo.DefaultVCpus)
+	}
+	if it.MemoryInfo != nil {
+		v.MemoryMiB = aws.ToInt64(it.MemoryInfo.SizeInMiB)
+	}
+	if it.ProcessorInfo != nil {
+		for _, a := range it.ProcessorInfo.SupportedArchitectures {
+			v.Architectures = append(v.Architectures, string(a))
+		}
+	}
+	return v
+}
+
+func instanceFamily(t string) string {
+	family, _, _ := strings.Cut(t, ".")
+	return family
+}
+
+// CheckInstanceTypeInZone 确认可用区提供该实例类型，不提供时返回 ErrInstanceTypeUnavailable。
+// 区域内提供的类型不一定每个可用区都有，指定可用区创建前需要单独确认。
+func CheckInstanceTypeInZone(ctx context.Context, cli EC2InstanceTypeAPI, instanceType, zone string) error {
+	instanceType = strings.TrimSpace(instanceType)
+	out, err := cli.DescribeInstanceTypeOfferings(ctx, &ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: ec2types.LocationTypeAvailabilityZone,
+		Filters: []ec2types.Filter{
+			{Name: aws.String("location"), Values: []string{zone}},
+			{Name: aws.String("instance-type"), Values: []string{instanceType}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("查询可用区实例类型失败：%w", err)
+	}
+	if len(out.InstanceTypeOfferings) == 0 {
+		return fmt.Errorf("%w：可用区 %s 不提供实例类型 %s", ErrInstanceTypeUnavailable, zone, instanceType)
+	}
+	return nil
+}
+
+// FindInstanceType 在列表中查找实例类型，找不到时返回 ErrInstanceTypeUnavailable。
+func FindInstanceType(list []InstanceTypeView, instanceType string) (*InstanceTypeView, error) {
+	instanceType = strings.TrimSpace(instanceType)
+	for i := range list {
+		if list[i].Type == instanceType {
+			return &list[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w：当前区域不提供实例类型 %s", ErrInstanceTypeUnavailable, instanceType)
+}
+
+// SearchInstanceTypes 按空格分隔的关键字过滤，所有关键字都要命中。
+// 关键字匹配类型名，另外支持 arm / x86 / burst（突发）/ free（免费套餐）以及 “2c”“4g” 形式的 vCPU / 内存。
+func SearchInstanceTypes(list []InstanceTypeView, query string) []InstanceTypeView {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return list
+	}
+	var out []InstanceTypeView
+	for _, v := range list {
+		ok := true
+		for _, t := range terms {
+			if !instanceTypeMatches(v, t) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func instanceTypeMatches(v InstanceTypeView, term string) bool {
+	switch term {
+	case "arm", "arm64", "graviton":
+		return containsString(v.Architectures, "arm64")
+	case "x86", "x86_64", "amd64":
+		return containsString(v.Architectures, "x86_64")
+	case "burst", "burstable", "突发":
+		return v.Burstable
+	case "free", "免费":
+		return v.FreeTier
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(term, "c")); err == nil && strings.HasSuffix(term, "c") {
+		return v.VCPUs == int32(n)
+	}
+	if n, err := strconv.ParseFloat(strings.TrimSuffix(term, "g"), 64); err == nil && strings.HasSuffix(term, "g") {
+		return float64(v.MemoryMiB)/1024 == n
+	}
+	return strings.Contains(v.Type, term)
+}
@@ -0,0 +1,137 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type fakeEC2Types struct {
+	offerings [][]string
+	zones     map[string][]string // 可用区 -> 提供的实例类型
+	infos     map[string]ec2types.InstanceTypeInfo
+	batches   []int
+}
+
+func (f *fakeEC2Types) DescribeInstanceTypeOfferings(_ context.Context, in *ec2.DescribeInstanceTypeOfferingsInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstanceTypeOfferingsOutput, error) {
+	if in.LocationType == ec2types.LocationTypeAvailabilityZone {
+		filter := map[string]string{}
+		for _, f := range in.Filters {
+			filter[aws.ToString(f.Name)] = f.Values[0]
+		}
+		out := &ec2.DescribeInstanceTypeOfferingsOutput{}
+		for _, t := range f.zones[filter["location"]] {
+			if t == filter["instance-type"] {
+				out.InstanceTypeOfferings = append(out.InstanceTypeOfferings, ec2types.InstanceTypeOffering{InstanceType: ec2types.InstanceType(t)})
+			}
+		}
+		return out, nil
+	}
+	page := 0
+	if in.NextToken != nil {
+		page, _ = strconv.Atoi(*in.NextToken)
+	}
+	out := &ec2.DescribeInstanceTypeOfferingsOutput{}
+	for _, t := range f.offerings[page] {
+		out.InstanceTypeOfferings = append(out.InstanceTypeOfferings, ec2types.InstanceTypeOffering{InstanceType: ec2types.InstanceType(t)})
+	}
+	if page+1 < len(f.offerings) {
+		out.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return out, nil
+}
+
+func (f *fakeEC2Types) DescribeInstanceTypes(_ context.Context, in *ec2.DescribeInstanceTypesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	f.batches = append(f.batches, len(in.InstanceTypes))
+	out := &ec2.DescribeInstanceTypesOutput{}
+	for _, t := range in.InstanceTypes {
+		if info, ok := f.infos[string(t)]; ok {
+			out.InstanceTypes = append(out.InstanceTypes, info)
+		}
+	}
+	return out, nil
+}
+
+func typeInfo(t string, vcpu int32, mib int64, arch ec2types.ArchitectureType, burst, free bool) ec2types.InstanceTypeInfo {
+	return ec2types.InstanceTypeInfo{
+		InstanceType:                  ec2types.InstanceType(t),
+		VCpuInfo:                      &ec2types.VCpuInfo{DefaultVCpus: aws.Int32(vcpu)},
+		MemoryInfo:                    &ec2types.MemoryInfo{SizeInMiB: aws.Int64(mib)},
+		ProcessorInfo:                 &ec2types.ProcessorInfo{SupportedArchitectures: []ec2types.ArchitectureType{arch}},
+		BurstablePerformanceSupported: aws.Bool(burst),
+		FreeTierEligible:              aws.Bool(free),
+	}
+}
+
+func TestListEC2InstanceTypes(t *testing.T) {
+	filler := make([]string, 120)
+	for i := range filler {
+		filler[i] = "z1.size" + strconv.Itoa(i)
+	}
+	cli := &fakeEC2Types{
+		offerings: [][]string{{"t3.small", "t4g.micro", "t3.micro"}, append([]string{"c7i.large"}, filler...)},
+		infos: map[string]ec2types.InstanceTypeInfo{
+			"t3.micro":  typeInfo("t3.micro", 2, 1024, ec2types.ArchitectureTypeX8664, true, true),
+			"t3.small":  typeInfo("t3.small", 2, 2048, ec2types.ArchitectureTypeX8664, true, false),
+			"t4g.micro": typeInfo("t4g.micro", 2, 1024, ec2types.ArchitectureTypeArm64, true, false),
+			"c7i.large": typeInfo("c7i.large", 2, 4096, ec2types.ArchitectureTypeX8664, false, false),
+		},
+	}
+	list, err := ListEC2InstanceTypes(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("ListEC2InstanceTypes: %v", err)
+	}
+	if len(cli.batches) != 2 || cli.batches[0] != 100 || cli.batches[1] != 24 {
+		t.Fatalf("DescribeInstanceTypes batches = %v, want [100 24]", cli.batches)
+	}
+	var got []string
+	for _, v := range list {
+		got = append(got, v.Type)
+	}
+	if want := []string{"c7i.large", "t3.micro", "t3.small", "t4g.micro"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[3] != want[3] {
+		t.Fatalf("types = %v, want %v", got, want)
+	}
+	if l := list[1].Label(); l != "t3.micro (2 vCPU, 1 GB, 突发, 免费套餐)" {
+		t.Fatalf("Label() = %q", l)
+	}
+
+	cases := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: 4},
+		{query: "arm", want: 1},
+		{query: "t3", want: 2},
+		{query: "free", want: 1},
+		{query: "x86 4g", want: 1},
+		{query: "burst 2c 1g", want: 2},
+	}
+	for _, tc := range cases {
+		if n := len(SearchInstanceTypes(list, tc.query)); n != tc.want {
+			t.Errorf("SearchInstanceTypes(%q) = %d results, want %d", tc.query, n, tc.want)
+		}
+	}
+
+	if _, err := FindInstanceType(list, "m5.large"); !errors.Is(err, ErrInstanceTypeUnavailable) {
+		t.Fatalf("FindInstanceType(m5.large) err = %v", err)
+	}
+}
+
+func TestCheckInstanceTypeInZone(t *testing.T) {
+	ctx := context.Background()
+	cli := &fakeEC2Types{zones: map[string][]string{
+		"us-east-1a": {"t3.micro"},
+		"us-east-1e": {"t3.micro", "t4g.micro"},
+	}}
+	if err := CheckInstanceTypeInZone(ctx, cli, "t4g.micro", "us-east-1e"); err != nil {
+		t.Fatalf("CheckInstanceTypeInZone(1e): %v", err)
+	}
+	if err := CheckInstanceTypeInZone(ctx, cli, "t4g.micro", "us-east-1a"); !errors.Is(err, ErrInstanceTypeUnavailable) {
+		t.Fatalf("CheckInstanceTypeInZone(1a) err = %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultProbeTimeout = 5 * time.Second
+	// 静态 IP 绑定后路由生效需要一点时间，探测前先等待
+	defaultProbeSettle = 10 * time.Second
+	maxSwapBackoff     = 5 * time.Minute
+	// 开始下一次换 IP 前至少要剩下的时间（一次换 IP 加探测），不够时提前结束，避免换到一半被任务超时打断
+	swapAttemptReserve = 5 * time.Minute
+)
+
+var (
+	ErrSwapUnhealthy = errors.New("no reachable static ip")
+	// ErrCheckTargetBlocked 表示外部检测地址指向本机、内网或链路本地地址
+	ErrCheckTargetBlocked = errors.New("检测地址不能指向本机或内网")
+)
+
+// ProbeSpec 描述换 IP 后的可达性检查：依次 TCP 连接 Ports，CheckURL 非空时再请求外部检测接口。
+// CheckURL 中的 {ip}、{port} 会替换为新地址和第一个端口，返回 2xx 视为可达。
+type ProbeSpec struct {
+	Ports    []int
+	CheckURL string
+	Timeout  time.Duration
+}
+
+// Enabled 为 false 时不做探测，换 IP 只执行一次。
+func (p ProbeSpec) Enabled() bool {
+	return len(p.Ports) > 0 || strings.TrimSpace(p.CheckURL) != ""
+}
+
+type ProbeResult struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// SwapAttempt 记录一次换 IP 拿到的地址及其探测结果。
+type SwapAttempt struct {
+	Attempt int       `json:"attempt"`
+	IP      string    `json:"ip"`
+	OK      bool      `json:"ok"`
+	Detail  string    `json:"detail"`
+	At      time.Time `json:"at"`
+}
+
+type SwapUntilHealthyOptions struct {
+	MaxAttempts int
+	// Backoff 为第一次失败后的等待时间，之后每次翻倍，最长 5 分钟
+	Backoff time.Duration
+	// Settle 为绑定后到探测前的等待时间，0 为默认 10 秒，负数不等待
+	Settle time.Duration
+	Probe  ProbeSpec
+	// Swap 为每次换 IP 的选项（如黑名单）
+	Swap SwapOptions
+	// OnSwap 在每次换 IP 后调用（含失败），OnAttempt 在每次探测后调用，用于记录尝试过的 IP
+	OnSwap    func(SwapResult, error)
+	OnAttempt func(SwapAttempt)
+}
+
+// ParsePorts 解析逗号或空格分隔的端口列表，去重并保持顺序。
+func ParsePorts(s string) ([]int, error) {
+	var out []int
+	seen := map[int]bool{}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '，' }) {
+		p, err := strconv.Atoi(f)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("端口 %q 无效", f)
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// ProbeAddress 检查 ip 是否可达，所有端口都能连接且外部检测通过才算成功。
+func ProbeAddress(ctx context.Context, ip string, spec ProbeSpec) ProbeResult {
+	timeout := spec.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	var ok []string
+	for _, port := range spec.Ports {
+		addr := net.JoinHostPort(ip, strconv.Itoa(port))
+		d := net.Dialer{Timeout: timeout}
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return ProbeResult{Detail: fmt.Sprintf("TCP %d 不通：%s", port, shortNetError(err))}
+		}
+		conn.Close()
+		ok = append(ok, "TCP "+strconv.Itoa(port))
+	}
+	if u := strings.TrimSpace(spec.CheckURL); u != "" {
+		port := ""
+		if len(spec.Ports) > 0 {
+			port = strconv.Itoa(spec.Ports[0])
+		}
+		u = strings.NewReplacer("{ip}", ip, "{port}", port).Replace(u)
+		if err := checkEndpoint(ctx, u, timeout*2); err != nil {
+			return ProbeResult{Detail: "外部检测失败：" + err.Error()}
+		}
+		ok = append(ok, "外部检测")
+	}
+	return ProbeResult{OK: true, Detail: strings.Join(ok, "、") + " 通过"}
+}
+
+// checkBlockedIPv4 是标准库 IsPrivate 等没有覆盖、但同样不能作为检测目标的 IPv4 网段，
+// 按 To4 后的地址比较，IPv4 映射地址（::ffff:a.b.c.d）也会命中。
+var checkBlockedIPv4 = mustParseCIDRs(
+	"0.0.0.0/8",     // 本网络
+	"100.64.0.0/10", // 运营商级 NAT（CGNAT）
+	"198.18.0.0/15", // 网络设备基准测试
+	"240.0.0.0/4",   // 保留及受限广播
+)
+
+var (
+	// nat64WellKnown 是 NAT64 知名前缀，低 32 位为内嵌的 IPv4 地址
+	nat64WellKnown = mustParseCIDRs("64:ff9b::/96")[0]
+	// nat64LocalUse 是本地使用的 NAT64 前缀，内嵌位置随前缀长度变化，整段拒绝
+	nat64LocalUse = mustParseCIDRs("64:ff9b:1::/48")[0]
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	out := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// checkTargetAllowed 判断外部检测能否连接该地址，测试中替换以允许本机地址。
+// NAT64 地址按内嵌的 IPv4 判断。
+var checkTargetAllowed = func(ip net.IP) bool {
+	if nat64LocalUse.Contains(ip) {
+		return false
+	}
+	if nat64WellKnown.Contains(ip) {
+		ip = net.IP(ip.To16()[12:]).To4()
+	}
+	if v4 := ip.To4(); v4 != nil {
+		for _, n := range checkBlockedIPv4 {
+			if n.Contains(v4) {
+				return false
+			}
+		}
+		ip = v4
+	}
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// checkClient 只用于外部检测：不走环境代理、不跟随跳转，并在连接时校验解析出的地址，防止借检测地址访问内网。
+var checkClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Control: checkDialControl}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func checkDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !checkTargetAllowed(ip) {
+		return fmt.Errorf("%w：%s", ErrCheckTargetBlocked, host)
+	}
+	return nil
+}
+
+// ValidateCheckURL 校验外部检测地址：需为 http(s)，主机不能是本机或内网地址。
+// {ip}、{port} 占位符可能出现在主机名中，替换后再校验；域名在连接时按解析结果再检查一次。
+func ValidateCheckURL(raw string) error {
+	u, err := url.Parse(strings.NewReplacer("{ip}", "192.0.2.1", "{port}", "1").Replace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("检测地址需为 http(s) URL")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrCheckTargetBlocked
+	}
+	if ip := net.ParseIP(host); ip != nil && !checkTargetAllowed(ip) {
+		return ErrCheckTargetBlocked
+	}
+	return nil
+}
+
+// checkEndpoint 请求外部检测接口，2xx 视为通过；失败时不回显响应内容。
+func checkEndpoint(ctx context.Context, u string, timeout time.Duration) error {
+	if err := ValidateCheckURL(u); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := checkClient.Do(req)
+	if err != nil {
+		return errors.New(shortNetError(err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func shortNetError(err error) string {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return "超时"
+	}
+	var oe *net.OpError
+	if errors.As(err, &oe) && oe.Err != nil {
+		return oe.Err.Error()
+	}
+	return err.Error()
+}
+
+// SwapStaticIPUntilHealthy 反复更换静态 IP，直到新地址通过探测或达到最大次数；ctx 剩余时间不够再换一次时提前结束。
+// 换下的 IP 会被释放（Swap.KeepOld 只保留最初的那个）；全部失败时实例保留最后一次的 IP，并返回 ErrSwapUnhealthy。
+func SwapStaticIPUntilHealthy(ctx context.Context, cli LightsailAPI, instanceName string, opt SwapUntilHealthyOptions) ([]SwapAttempt, error) {
+	swapOpt := opt.Swap
+	return swapUntilHealthy(ctx, opt, func(ctx context.Context) (string, error) {
+		res, err := SwapStaticIP(ctx, cli, instanceName, swapOpt)
+		if res.Kept {
+			swapOpt.KeepOld = false
+		}
+		if opt.OnSwap != nil {
+			opt.OnSwap(res, err)
+		}
+		if err != nil {
+			return "", err
+		}
+		ip := res.NewIP
+		if ip == "" {
+			_, ip = FindAttachedStaticIPName(ctx, cli, instanceName)
+		}
+		if ip == "" {
+			return "", errors.New("新静态IP已绑定，但查询不到地址")
+		}
+		return ip, nil
+	})
+}
+
+func swapUntilHealthy(ctx context.Context, opt SwapUntilHealthyOptions, swap func(context.Context) (string, error)) ([]SwapAttempt, error) {
+	if opt.MaxAttempts < 1 {
+		opt.MaxAttempts = 1
+	}
+	if opt.Settle == 0 {
+		opt.Settle = defaultProbeSettle
+	}
+	backoff := opt.Backoff
+	var attempts []SwapAttempt
+	for i := 1; i <= opt.MaxAttempts; i++ {
+		progress(ctx, fmt.Sprintf("第 %d/%d 次更换静态IP", i, opt.MaxAttempts))
+		ip, err := swap(ctx)
+		if err != nil {
+			return attempts, err
+		}
+		if err := sleepCtx(ctx, opt.Settle); err != nil {
+			return attempts, err
+		}
+		res := ProbeAddress(ctx, ip, opt.Probe)
+		a := SwapAttempt{Attempt: i, IP: ip, OK: res.OK, Detail: res.Detail, At: time.Now().UTC()}
+		attempts = append(attempts, a)
+		if opt.OnAttempt != nil {
+			opt.OnAttempt(a)
+		}
+		if res.OK {
+			return attempts, nil
+		}
+		if i == opt.MaxAttempts {
+			break
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff+opt.Settle+swapAttemptReserve {
+			progress(ctx, "剩余时间不足以再换一次，停止更换")
+			break
+		}
+		if backoff > 0 {
+			progress(ctx, fmt.Sprintf("%s 不可达，%s 后重试", ip, backoff))
+			if err := sleepCtx(ctx, backoff); err != nil {
+				return attempts, err
+			}
+			backoff = min(backoff*2, maxSwapBackoff)
+		}
+	}
+	return attempts, fmt.Errorf("%w：已尝试 %d 个 IP 均不可达", ErrSwapUnhealthy, len(attempts))
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
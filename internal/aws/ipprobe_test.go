@@ -0,0 +1,222 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePorts(t *testing.T) {
+	got, err := ParsePorts("22, 443 22，8080")
+	if err != nil || len(got) != 3 || got[0] != 22 || got[2] != 8080 {
+		t.Fatalf("ParsePorts = %v, %v", got, err)
+	}
+	for _, in := range []string{"0", "65536", "ssh"} {
+		if _, err := ParsePorts(in); err == nil {
+			t.Fatalf("ParsePorts(%q) = nil error", in)
+		}
+	}
+}
+
+func TestProbeAddress(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("tcp not available:", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	open := ln.Addr().(*net.TCPAddr).Port
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	var checked string
+	check := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checked = r.URL.RawQuery
+		if r.URL.Query().Get("port") != strconv.Itoa(open) {
+			http.Error(w, "blocked", http.StatusServiceUnavailable)
+		}
+	}))
+	defer check.Close()
+
+	ctx := context.Background()
+	// 默认不允许检测本机地址
+	if res := ProbeAddress(ctx, "127.0.0.1", ProbeSpec{CheckURL: check.URL + "/?ip={ip}"}); res.OK || checked != "" {
+		t.Fatalf("loopback check url = %+v, requested %q", res, checked)
+	}
+	allowed := checkTargetAllowed
+	checkTargetAllowed = func(net.IP) bool { return true }
+	defer func() { checkTargetAllowed = allowed }()
+
+	if res := ProbeAddress(ctx, "127.0.0.1", ProbeSpec{Ports: []int{open}, CheckURL: check.URL + "/?ip={ip}&port={port}"}); !res.OK {
+		t.Fatalf("reachable probe = %+v", res)
+	}
+	if checked != "ip=127.0.0.1&port="+strconv.Itoa(open) {
+		t.Fatalf("check url query = %q", checked)
+	}
+	if res := ProbeAddress(ctx, "127.0.0.1", ProbeSpec{Ports: []int{open, closedPort}}); res.OK || !strings.Contains(res.Detail, strconv.Itoa(closedPort)) {
+		t.Fatalf("closed port probe = %+v", res)
+	}
+	if res := ProbeAddress(ctx, "127.0.0.1", ProbeSpec{CheckURL: check.URL + "/?port=1"}); res.OK || !strings.Contains(res.Detail, "503") || strings.Contains(res.Detail, "blocked") {
+		t.Fatalf("check endpoint probe = %+v", res)
+	}
+}
+
+func TestCheckEndpointNoRedirect(t *testing.T) {
+	allowed := checkTargetAllowed
+	checkTargetAllowed = func(net.IP) bool { return true }
+	defer func() { checkTargetAllowed = allowed }()
+	target := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("redirect followed")
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer redirect.Close()
+
+	if err := checkEndpoint(context.Background(), redirect.URL, time.Second); err == nil || !strings.Contains(err.Error(), "302") {
+		t.Fatalf("redirect err = %v", err)
+	}
+}
+
+func TestValidateCheckURL(t *testing.T) {
+	for _, u := range []string{"https://check.example.com/?ip={ip}", "http://{ip}:{port}/", "https://{ip}.check.example.com/"} {
+		if err := ValidateCheckURL(u); err != nil {
+			t.Fatalf("ValidateCheckURL(%q) = %v", u, err)
+		}
+	}
+	for _, u := range []string{"http://127.0.0.1/", "http://localhost:8080/", "http://169.254.169.254/latest/meta-data/", "http://10.0.0.1/", "http://[::1]/", "http://0.0.0.0/"} {
+		if err := ValidateCheckURL(u); !errors.Is(err, ErrCheckTargetBlocked) {
+			t.Fatalf("ValidateCheckURL(%q) = %v, want ErrCheckTargetBlocked", u, err)
+		}
+	}
+}
+
+func TestCheckTargetAllowed(t *testing.T) {
+	cases := []struct {
+		ip   string
+		want bool
+	}{
+		{"203.0.113.10", true},
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"64:ff9b::808:808", true},
+		{"::ffff:8.8.8.8", true},
+		// 0.0.0.0/8
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		// 100.64.0.0/10
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		// 198.18.0.0/15
+		{"198.18.0.1", false},
+		{"198.19.255.254", false},
+		// 240.0.0.0/4
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		// IPv4 映射地址
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:0.0.0.0", false},
+		// NAT64 知名前缀内嵌内网地址
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b::6440:1", false},
+		// 本地使用的 NAT64 前缀
+		{"64:ff9b:1::808:808", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+	}
+	for _, tc := range cases {
+		if got := checkTargetAllowed(net.ParseIP(tc.ip)); got != tc.want {
+			t.Fatalf("checkTargetAllowed(%s) = %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+	for _, u := range []string{"http://100.64.0.1/", "http://[::ffff:10.0.0.1]/", "http://[64:ff9b::a9fe:a9fe]/latest/meta-data/"} {
+		if err := ValidateCheckURL(u); !errors.Is(err, ErrCheckTargetBlocked) {
+			t.Fatalf("ValidateCheckURL(%q) = %v, want ErrCheckTargetBlocked", u, err)
+		}
+	}
+}
+
+func TestSwapUntilHealthy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("tcp not available:", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// 前两次换到的地址不可达（TEST-NET 地址 + 极短超时），第三次换到本机
+	ips := []string{"192.0.2.1", "192.0.2.2", "127.0.0.1", "127.0.0.2"}
+	swaps := 0
+	swap := func(context.Context) (string, error) {
+		swaps++
+		return ips[swaps-1], nil
+	}
+	var recorded []SwapAttempt
+	opt := SwapUntilHealthyOptions{
+		MaxAttempts: 5,
+		Settle:      -1,
+		Probe:       ProbeSpec{Ports: []int{port}, Timeout: 50 * time.Millisecond},
+		OnAttempt:   func(a SwapAttempt) { recorded = append(recorded, a) },
+	}
+	attempts, err := swapUntilHealthy(context.Background(), opt, swap)
+	if err != nil || swaps != 3 || len(attempts) != 3 || !attempts[2].OK || attempts[0].OK {
+		t.Fatalf("attempts = %+v, swaps = %d, err = %v", attempts, swaps, err)
+	}
+	if len(recorded) != 3 || recorded[1].IP != "192.0.2.2" || recorded[1].Attempt != 2 {
+		t.Fatalf("recorded = %+v", recorded)
+	}
+
+	swaps = 0
+	opt.MaxAttempts = 2
+	recorded = nil
+	attempts, err = swapUntilHealthy(context.Background(), opt, swap)
+	if !errors.Is(err, ErrSwapUnhealthy) || len(attempts) != 2 || swaps != 2 {
+		t.Fatalf("exhausted: attempts = %+v, err = %v", attempts, err)
+	}
+
+	// 任务剩余时间不够再换一次时提前结束
+	swaps = 0
+	opt.MaxAttempts = 5
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	attempts, err = swapUntilHealthy(ctx, opt, swap)
+	if !errors.Is(err, ErrSwapUnhealthy) || len(attempts) != 1 || swaps != 1 {
+		t.Fatalf("deadline: attempts = %+v, swaps = %d, err = %v", attempts, swaps, err)
+	}
+
+	swapErr := errors.New("quota")
+	_, err = swapUntilHealthy(context.Background(), opt, func(context.Context) (string, error) { return "", swapErr })
+	if !errors.Is(err, swapErr) {
+		t.Fatalf("swap error = %v", err)
+	}
+}
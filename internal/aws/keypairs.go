@@ -0,0 +1,83 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrInvalidSSHKey = errors.New("invalid ssh public key")
+
+// EC2KeyPairAPI 是导入 EC2 密钥对需要的接口，*ec2.Client 满足该接口。
+type EC2KeyPairAPI interface {
+	DescribeKeyPairs(context.Context, *ec2.DescribeKeyPairsInput, ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error)
+	ImportKeyPair(context.Context, *ec2.ImportKeyPairInput, ...func(*ec2.Options)) (*ec2.ImportKeyPairOutput, error)
+}
+
+// ParseSSHPublicKey 校验 authorized_keys 格式的公钥，返回规范化后的公钥行和 SHA256 指纹。
+// 只接受 EC2 与 Lightsail 都能导入的 ssh-rsa / ssh-ed25519。
+func ParseSSHPublicKey(text string) (string, string, error) {
+	pk, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(text)))
+	if err != nil {
+		return "", "", fmt.Errorf("%w：无法解析，请粘贴 .pub 文件中的一整行", ErrInvalidSSHKey)
+	}
+	switch pk.Type() {
+	case ssh.KeyAlgoRSA, ssh.KeyAlgoED25519:
+	default:
+		return "", "", fmt.Errorf("%w：不支持 %s，请使用 ssh-rsa 或 ssh-ed25519", ErrInvalidSSHKey, pk.Type())
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pk)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line, ssh.FingerprintSHA256(pk), nil
+}
+
+// KeyPairName 返回公钥导入到 AWS 时使用的密钥对名称。名称带指纹摘要，
+// 同名但内容不同的公钥不会复用 AWS 上已有的密钥对。
+func KeyPairName(name, fingerprint string) string {
+	sum := sha256.Sum256([]byte(fingerprint))
+	return "autosail-" + sanitize(name) + "-" + hex.EncodeToString(sum[:4])
+}
+
+// EnsureLightsailKeyPair 在区域内没有同名密钥对时导入公钥。Lightsail 只支持 ssh-rsa。
+func EnsureLightsailKeyPair(ctx context.Context, cli LightsailAPI, keyPairName, publicKey string) error {
+	if !strings.HasPrefix(publicKey, ssh.KeyAlgoRSA+" ") {
+		return fmt.Errorf("%w：Lightsail 只支持 ssh-rsa 公钥", ErrInvalidSSHKey)
+	}
+	_, err := cli.GetKeyPair(ctx, &lightsail.GetKeyPairInput{KeyPairName: &keyPairName})
+	if err == nil {
+		return nil
+	}
+	if ErrorCode(err) != "NotFoundException" {
+		return fmt.Errorf("查询密钥对失败：%w", err)
+	}
+	progress(ctx, "导入密钥对 "+keyPairName)
+	if _, err := cli.ImportKeyPair(ctx, &lightsail.ImportKeyPairInput{KeyPairName: &keyPairName, PublicKeyBase64: &publicKey}); err != nil {
+		return fmt.Errorf("导入密钥对失败：%w", err)
+	}
+	return nil
+}
+
+// EnsureEC2KeyPair 在区域内没有同名密钥对时导入公钥。
+func EnsureEC2KeyPair(ctx context.Context, cli EC2KeyPairAPI, keyPairName, publicKey string) error {
+	_, err := cli.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{KeyNames: []string{keyPairName}})
+	if err == nil {
+		return nil
+	}
+	if ErrorCode(err) != "InvalidKeyPair.NotFound" {
+		return fmt.Errorf("查询密钥对失败：%w", err)
+	}
+	progress(ctx, "导入密钥对 "+keyPairName)
+	if _, err := cli.ImportKeyPair(ctx, &ec2.ImportKeyPairInput{KeyName: &keyPairName, PublicKeyMaterial: []byte(publicKey)}); err != nil {
+		return fmt.Errorf("导入密钥对失败：%w", err)
+	}
+	return nil
+}
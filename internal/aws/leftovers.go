@@ -0,0 +1,244 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+)
+
+const (
+	LeftoverStaticIP    = "static_ip"    // Lightsail 未绑定的静态 IP
+	LeftoverElasticIP   = "eip"          // 未关联的弹性 IP
+	LeftoverVolume      = "volume"       // 未挂载（available）的 EBS 卷
+	LeftoverEBSSnapshot = "ebs_snapshot" // 源卷已删除且未被 AMI 使用的 EBS 快照
+)
+
+// 按 us-east-1 公开价格估算（美元），其他区域略有差异。
+// 闲置的 IPv4 地址按小时计费，EBS 快照按源卷大小估算（实际为增量存储，通常更少）。
+const (
+	idleIPv4MonthlyUSD        = 0.005 * 730
+	snapshotGBMonthlyUSD      = 0.05
+	defaultVolumeGBMonthlyUSD = 0.08
+)
+
+var volumeGBMonthlyUSD = map[ec2types.VolumeType]float64{
+	ec2types.VolumeTypeGp3:      0.08,
+	ec2types.VolumeTypeGp2:      0.10,
+	ec2types.VolumeTypeIo1:      0.125,
+	ec2types.VolumeTypeIo2:      0.125,
+	ec2types.VolumeTypeSt1:      0.045,
+	ec2types.VolumeTypeSc1:      0.015,
+	ec2types.VolumeTypeStandard: 0.05,
+}
+
+// Leftover 是实例删除后仍在计费的遗留资源。
+type Leftover struct {
+	Service    string     `json:"service"`
+	Kind       string     `json:"kind"`
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Detail     string     `json:"detail"`
+	SizeGB     int32      `json:"size_gb,omitempty"`
+	MonthlyUSD float64    `json:"monthly_usd"`
+	CreatedAt  time.Time  `json:"created_at"`
+	HeldUntil  *time.Time `json:"held_until,omitempty"` // 换 IP 时保留的旧静态 IP，到期前不能作为遗留资源释放
+}
+
+// Ref 是资源在批量操作中的标识，形如 volume:vol-0123。
+func (l Leftover) Ref() string {
+	return l.Kind + ":" + l.ID
+}
+
+// EC2LeftoverAPI 是查找与清理 EC2 遗留资源需要的接口，*ec2.Client 满足该接口。
+type EC2LeftoverAPI interface {
+	DescribeAddresses(context.Context, *ec2.DescribeAddressesInput, ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error)
+	ReleaseAddress(context.Context, *ec2.ReleaseAddressInput, ...func(*ec2.Options)) (*ec2.ReleaseAddressOutput, error)
+	DescribeVolumes(context.Context, *ec2.DescribeVolumesInput, ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error)
+	DeleteVolume(context.Context, *ec2.DeleteVolumeInput, ...func(*ec2.Options)) (*ec2.DeleteVolumeOutput, error)
+	DescribeSnapshots(context.Context, *ec2.DescribeSnapshotsInput, ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error)
+	DeleteSnapshot(context.Context, *ec2.DeleteSnapshotInput, ...func(*ec2.Options)) (*ec2.DeleteSnapshotOutput, error)
+	DescribeImages(context.Context, *ec2.DescribeImagesInput, ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+}
+
+// ListLightsailLeftovers 返回区域内未绑定实例的静态 IP。
+func ListLightsailLeftovers(ctx context.Context, cli LightsailAPI) ([]Leftover, error) {
+	var out []Leftover
+	var token *string
+	for {
+		resp, err := cli.GetStaticIps(ctx, &lightsail.GetStaticIpsInput{PageToken: token})
+		if err != nil {
+			return nil, fmt.Errorf("拉取静态 IP 失败：%w", err)
+		}
+		for _, si := range resp.StaticIps {
+			if aws.ToBool(si.IsAttached) {
+				continue
+			}
+			out = append(out, Leftover{
+				Service:    "lightsail",
+				Kind:       LeftoverStaticIP,
+				ID:         str(si.Name),
+				Name:       str(si.Name),
+				Detail:     str(si.IpAddress),
+				MonthlyUSD: idleIPv4MonthlyUSD,
+				CreatedAt:  aws.ToTime(si.CreatedAt),
+			})
+		}
+		if str(resp.NextPageToken) == "" {
+			break
+		}
+		token = resp.NextPageToken
+	}
+	return out, nil
+}
+
+// ListEC2Leftovers 返回区域内未关联的弹性 IP、未挂载的 EBS 卷，以及源卷已删除且没有 AMI 引用的快照。
+func ListEC2Leftovers(ctx context.Context, cli EC2LeftoverAPI) ([]Leftover, error) {
+	var out []Leftover
+
+	addrs, err := cli.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{})
+	if err != nil {
+		return nil, fmt.Errorf("拉取弹性 IP 失败：%w", err)
+	}
+	for _, a := range addrs.Addresses {
+		if a.AssociationId != nil || a.InstanceId != nil || a.NetworkInterfaceId != nil {
+			continue
+		}
+		out = append(out, Leftover{
+			Service:    "ec2",
+			Kind:       LeftoverElasticIP,
+			ID:         aws.ToString(a.AllocationId),
+			Name:       firstTag(a.Tags, "Name"),
+			Detail:     aws.ToString(a.PublicIp),
+			MonthlyUSD: idleIPv4MonthlyUSD,
+		})
+	}
+
+	volumes := map[string]bool{}
+	var token *string
+	for {
+		resp, err := cli.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{NextToken: token})
+		if err != nil {
+			return nil, fmt.Errorf("拉取 EBS 卷失败：%w", err)
+		}
+		for _, v := range resp.Volumes {
+			id := aws.ToString(v.VolumeId)
+			volumes[id] = true
+			if v.State != ec2types.VolumeStateAvailable {
+				continue
+			}
+			size := aws.ToInt32(v.Size)
+			price, ok := volumeGBMonthlyUSD[v.VolumeType]
+			if !ok {
+				price = defaultVolumeGBMonthlyUSD
+			}
+			out = append(out, Leftover{
+				Service:    "ec2",
+				Kind:       LeftoverVolume,
+				ID:         id,
+				Name:       firstTag(v.Tags, "Name"),
+				Detail:     fmt.Sprintf("%s %d GB · %s", v.VolumeType, size, aws.ToString(v.AvailabilityZone)),
+				SizeGB:     size,
+				MonthlyUSD: float64(size) * price,
+				CreatedAt:  aws.ToTime(v.CreateTime),
+			})
+		}
+		if aws.ToString(resp.NextToken) == "" {
+			break
+		}
+		token = resp.NextToken
+	}
+
+	images, err := cli.DescribeImages(ctx, &ec2.DescribeImagesInput{Owners: []string{"self"}})
+	if err != nil {
+		return nil, fmt.Errorf("拉取 AMI 失败：%w", err)
+	}
+	usedByImage := map[string]bool{}
+	for _, img := range images.Images {
+		for _, bdm := range img.BlockDeviceMappings {
+			if bdm.Ebs != nil && bdm.Ebs.SnapshotId != nil {
+				usedByImage[*bdm.Ebs.SnapshotId] = true
+			}
+		}
+	}
+
+	token = nil
+	for {
+		resp, err := cli.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{OwnerIds: []string{"self"}, NextToken: token})
+		if err != nil {
+			return nil, fmt.Errorf("拉取 EBS 快照失败：%w", err)
+		}
+		for _, s := range resp.Snapshots {
+			id := aws.ToString(s.SnapshotId)
+			if usedByImage[id] || volumes[aws.ToString(s.VolumeId)] {
+				continue
+			}
+			size := aws.ToInt32(s.VolumeSize)
+			out = append(out, Leftover{
+				Service:    "ec2",
+				Kind:       LeftoverEBSSnapshot,
+				ID:         id,
+				Name:       firstTag(s.Tags, "Name"),
+				Detail:     fmt.Sprintf("%d GB · 源卷 %s 已删除", size, aws.ToString(s.VolumeId)),
+				SizeGB:     size,
+				MonthlyUSD: float64(size) * snapshotGBMonthlyUSD,
+				CreatedAt:  aws.ToTime(s.StartTime),
+			})
+		}
+		if aws.ToString(resp.NextToken) == "" {
+			break
+		}
+		token = resp.NextToken
+	}
+	return out, nil
+}
+
+// SortLeftovers 按估算月费从高到低排序。
+func SortLeftovers(list []Leftover) {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].MonthlyUSD > list[j].MonthlyUSD })
+}
+
+// ReleaseLightsailLeftover 释放未绑定的静态 IP。
+func ReleaseLightsailLeftover(ctx context.Context, cli LightsailAPI, l Leftover) error {
+	if l.Kind != LeftoverStaticIP {
+		return fmt.Errorf("不支持的资源类型：%s", l.Kind)
+	}
+	_, err := cli.ReleaseStaticIp(ctx, &lightsail.ReleaseStaticIpInput{StaticIpName: &l.ID})
+	if err != nil {
+		return fmt.Errorf("释放静态 IP 失败：%w", err)
+	}
+	return nil
+}
+
+// DeleteEC2Leftover 释放弹性 IP，或删除 EBS 卷 / 快照。
+func DeleteEC2Leftover(ctx context.Context, cli EC2LeftoverAPI, l Leftover) error {
+	var err error
+	switch l.Kind {
+	case LeftoverElasticIP:
+		_, err = cli.ReleaseAddress(ctx, &ec2.ReleaseAddressInput{AllocationId: &l.ID})
+	case LeftoverVolume:
+		_, err = cli.DeleteVolume(ctx, &ec2.DeleteVolumeInput{VolumeId: &l.ID})
+	case LeftoverEBSSnapshot:
+		_, err = cli.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{SnapshotId: &l.ID})
+	default:
+		return fmt.Errorf("不支持的资源类型：%s", l.Kind)
+	}
+	if err != nil {
+		return fmt.Errorf("删除 %s 失败：%w", l.ID, err)
+	}
+	return nil
+}
+
+func firstTag(tags []ec2types.Tag, key string) string {
+	for _, t := range tags {
+		if aws.ToString(t.Key) == key {
+			return aws.ToString(t.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type fakeLightsailLeftovers struct {
+	LightsailAPI
+	released []string
+}
+
+func (f *fakeLightsailLeftovers) GetStaticIps(context.Context, *lightsail.GetStaticIpsInput, ...func(*lightsail.Options)) (*lightsail.GetStaticIpsOutput, error) {
+	return &lightsail.GetStaticIpsOutput{StaticIps: []types.StaticIp{
+		{Name: aws.String("sip-used"), IsAttached: aws.Bool(true), AttachedTo: aws.String("vps-1")},
+		{Name: aws.String("sip-old"), IpAddress: aws.String("203.0.113.9"), IsAttached: aws.Bool(false)},
+	}}, nil
+}
+
+func (f *fakeLightsailLeftovers) ReleaseStaticIp(_ context.Context, in *lightsail.ReleaseStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.ReleaseStaticIpOutput, error) {
+	f.released = append(f.released, *in.StaticIpName)
+	return &lightsail.ReleaseStaticIpOutput{}, nil
+}
+
+type fakeEC2Leftovers struct {
+	EC2LeftoverAPI
+	deleted []string
+}
+
+func (f *fakeEC2Leftovers) DescribeAddresses(context.Context, *ec2.DescribeAddressesInput, ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error) {
+	return &ec2.DescribeAddressesOutput{Addresses: []ec2types.Address{
+		{AllocationId: aws.String("eipalloc-used"), AssociationId: aws.String("eipassoc-1")},
+		{AllocationId: aws.String("eipalloc-idle"), PublicIp: aws.String("198.51.100.7")},
+	}}, nil
+}
+
+func (f *fakeEC2Leftovers) DescribeVolumes(context.Context, *ec2.DescribeVolumesInput, ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	return &ec2.DescribeVolumesOutput{Volumes: []ec2types.Volume{
+		{VolumeId: aws.String("vol-root"), State: ec2types.VolumeStateInUse, Size: aws.Int32(8), VolumeType: ec2types.VolumeTypeGp3},
+		{VolumeId: aws.String("vol-idle"), State: ec2types.VolumeStateAvailable, Size: aws.Int32(100), VolumeType: ec2types.VolumeTypeGp2},
+	}}, nil
+}
+
+func (f *fakeEC2Leftovers) DescribeImages(context.Context, *ec2.DescribeImagesInput, ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	return &ec2.DescribeImagesOutput{Images: []ec2types.Image{{BlockDeviceMappings: []ec2types.BlockDeviceMapping{{Ebs: &ec2types.EbsBlockDevice{SnapshotId: aws.String("snap-ami")}}}}}}, nil
+}
+
+func (f *fakeEC2Leftovers) DescribeSnapshots(context.Context, *ec2.DescribeSnapshotsInput, ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	return &ec2.DescribeSnapshotsOutput{Snapshots: []ec2types.Snapshot{
+		{SnapshotId: aws.String("snap-live"), VolumeId: aws.String("vol-root"), VolumeSize: aws.Int32(8)},
+		{SnapshotId: aws.String("snap-ami"), VolumeId: aws.String("vol-gone"), VolumeSize: aws.Int32(8)},
+		{SnapshotId: aws.String("snap-orphan"), VolumeId: aws.String("vol-gone"), VolumeSize: aws.Int32(20)},
+	}}, nil
+}
+
+func (f *fakeEC2Leftovers) DeleteVolume(_ context.Context, in *ec2.DeleteVolumeInput, _ ...func(*ec2.Options)) (*ec2.DeleteVolumeOutput, error) {
+	f.deleted = append(f.deleted, *in.VolumeId)
+	return &ec2.DeleteVolumeOutput{}, nil
+}
+
+func TestListLightsailLeftovers(t *testing.T) {
+	cli := &fakeLightsailLeftovers{}
+	list, err := ListLightsailLeftovers(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("ListLightsailLeftovers: %v", err)
+	}
+	if len(list) != 1 || list[0].Ref() != "static_ip:sip-old" || list[0].Detail != "203.0.113.9" {
+		t.Fatalf("leftovers = %+v", list)
+	}
+	if err := ReleaseLightsailLeftover(context.Background(), cli, list[0]); err != nil || len(cli.released) != 1 {
+		t.Fatalf("release = %v, %v", cli.released, err)
+	}
+}
+
+func TestListEC2Leftovers(t *testing.T) {
+	cli := &fakeEC2Leftovers{}
+	list, err := ListEC2Leftovers(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("ListEC2Leftovers: %v", err)
+	}
+	SortLeftovers(list)
+	var refs []string
+	for _, l := range list {
+		refs = append(refs, l.Ref())
+	}
+	want := []string{"volume:vol-idle", "eip:eipalloc-idle", "ebs_snapshot:snap-orphan"}
+	if len(refs) != len(want) {
+		t.Fatalf("refs = %v, want %v", refs, want)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Fatalf("refs = %v, want %v", refs, want)
+		}
+	}
+	if list[0].MonthlyUSD != 10 {
+		t.Fatalf("gp2 100GB monthly = %v, want 10", list[0].MonthlyUSD)
+	}
+	if err := DeleteEC2Leftover(context.Background(), cli, list[0]); err != nil || len(cli.deleted) != 1 || cli.deleted[0] != "vol-idle" {
+		t.Fatalf("delete = %v, %v", cli.deleted, err)
+	}
+}
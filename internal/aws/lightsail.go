@@ -3,6 +3,7 @@ package aws
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -12,20 +13,20 @@ import (
 )
 
 type InstanceView struct {
-	Name       string
-	State      string
-	PublicIPv4 string
-	PublicIPv6 string
-	StaticIPv4 string
-	Zone       string
-	BundleID   string
-	Created    string
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	PublicIPv4 string `json:"public_ipv4"`
+	PublicIPv6 string `json:"public_ipv6"`
+	StaticIPv4 string `json:"static_ipv4"`
+	Zone       string `json:"zone"`
+	BundleID   string `json:"bundle_id"`
+	Created    string `json:"created"`
 }
 
 func ListInstances(ctx context.Context, cli LightsailAPI) ([]InstanceView, error) {
 	out, err := cli.GetInstances(ctx, &lightsail.GetInstancesInput{})
 	if err != nil {
-		return nil, fmt.Errorf("拉取实例失败：%v", err)
+		return nil, fmt.Errorf("拉取实例失败：%w", err)
 	}
 
 	// static ips
@@ -83,6 +84,10 @@ type CreateInstanceInput struct {
 	UserData         string
 	IPAddressType    string // dualstack/ipv6
 	EnableFWAll      bool
+	// FirewallRules 非空时在创建后整体替换默认规则，优先于 EnableFWAll
+	FirewallRules []FirewallRule
+	// KeyPairName 为空时使用区域默认密钥对，需先用 EnsureLightsailKeyPair 导入
+	KeyPairName string
 }
 
 func CreateInstance(ctx context.Context, cli LightsailAPI, in CreateInstanceInput) error {
@@ -90,18 +95,31 @@ func CreateInstance(ctx context.Context, cli LightsailAPI, in CreateInstanceInpu
 	if ipType == "" {
 		ipType = "dualstack"
 	}
-	_, err := cli.CreateInstances(ctx, &lightsail.CreateInstancesInput{
+	createIn := &lightsail.CreateInstancesInput{
 		InstanceNames:    []string{in.InstanceName},
 		AvailabilityZone: &in.AvailabilityZone,
 		BlueprintId:      &in.BlueprintID,
 		BundleId:         &in.BundleID,
-		UserData:         &in.UserData,
 		IpAddressType:    types.IpAddressType(ipType),
-	})
+	}
+	if in.UserData != "" {
+		createIn.UserData = &in.UserData
+	}
+	if in.KeyPairName != "" {
+		createIn.KeyPairName = &in.KeyPairName
+	}
+	_, err := cli.CreateInstances(ctx, createIn)
 	if err != nil {
-		return fmt.Errorf("创建实例失败：%v", err)
+		return fmt.Errorf("创建实例失败：%w", err)
 	}
 
+	if len(in.FirewallRules) > 0 {
+		time.Sleep(4 * time.Second)
+		if err := PutFirewallRules(ctx, cli, in.InstanceName, in.FirewallRules); err != nil {
+			return fmt.Errorf("已创建，但应用防火墙规则失败：%w", err)
+		}
+		return nil
+	}
 	if in.EnableFWAll {
 		// your python has a small sleep before opening ports
 		time.Sleep(4 * time.Second)
@@ -115,7 +133,7 @@ func CreateInstance(ctx context.Context, cli LightsailAPI, in CreateInstanceInpu
 		})
 		if err != nil {
 			// keep instance created but still return error for visibility
-			return fmt.Errorf("已创建，但开启全端口失败：%v", err)
+			return fmt.Errorf("已创建，但开启全端口失败：%w", err)
 		}
 	}
 	return nil
@@ -128,6 +146,49 @@ func RebootInstance(ctx context.Context, cli LightsailAPI, name string) error {
 	})
 }
 
+func StartInstance(ctx context.Context, cli LightsailAPI, name string) error {
+	return SafeRetry("启动实例", 6, 1200*time.Millisecond, func() error {
+		_, err := cli.StartInstance(ctx, &lightsail.StartInstanceInput{InstanceName: &name})
+		return err
+	})
+}
+
+// StopInstance 停止实例；force 为 true 时强制停止，用于实例卡在 stopping 状态的情况。
+func StopInstance(ctx context.Context, cli LightsailAPI, name string, force bool) error {
+	return SafeRetry("停止实例", 6, 1200*time.Millisecond, func() error {
+		_, err := cli.StopInstance(ctx, &lightsail.StopInstanceInput{InstanceName: &name, Force: &force})
+		return err
+	})
+}
+
+// WaitInstanceState 轮询实例状态直到变为 state（如 running / stopped），超时返回错误。
+func WaitInstanceState(ctx context.Context, cli LightsailAPI, name, state string, timeout time.Duration) error {
+	progress(ctx, "等待实例进入 "+state+" 状态")
+	deadline := time.Now().Add(timeout)
+	last := "未知"
+	for {
+		out, err := cli.GetInstance(ctx, &lightsail.GetInstanceInput{InstanceName: &name})
+		if err == nil && out != nil && out.Instance != nil && out.Instance.State != nil {
+			last = str(out.Instance.State.Name)
+			if last == state {
+				return nil
+			}
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return fmt.Errorf("等待实例进入 %s 状态超时（当前：%s）", state, last)
+		}
+		if wait > 3*time.Second {
+			wait = 3 * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
 func OpenAllPorts(ctx context.Context, cli LightsailAPI, instanceName string) error {
 	return SafeRetry("开放全端口", 6, 1200*time.Millisecond, func() error {
 		_, err := cli.OpenInstancePublicPorts(ctx, &lightsail.OpenInstancePublicPortsInput{
@@ -142,53 +203,181 @@ func OpenAllPorts(ctx context.Context, cli LightsailAPI, instanceName string) er
 	})
 }
 
+// DeleteInstanceWithStaticIPCleanup 先解绑并释放实例的静态 IP，再删除实例。
+// 静态 IP 释放失败时仍会删除实例，但返回错误，遗留的静态 IP 可在遗留资源页释放。
 func DeleteInstanceWithStaticIPCleanup(ctx context.Context, cli LightsailAPI, name string) error {
-	// try detach & release any attached static ip first
-	_, _ = DeletePreviousStaticIPOnlyForInstance(ctx, cli, name)
+	_, ipErr := DeletePreviousStaticIPOnlyForInstance(ctx, cli, name)
 
-	return SafeRetry("删除实例", 8, 1200*time.Millisecond, func() error {
+	progress(ctx, "删除实例 "+name)
+	if err := SafeRetry("删除实例", 8, 1200*time.Millisecond, func() error {
 		_, err := cli.DeleteInstance(ctx, &lightsail.DeleteInstanceInput{InstanceName: &name})
 		return err
-	})
+	}); err != nil {
+		return err
+	}
+	if ipErr != nil {
+		return fmt.Errorf("实例已删除，但静态 IP 未能释放，请在遗留资源页处理：%w", ipErr)
+	}
+	return nil
 }
 
 func SwapStaticIPForInstance(ctx context.Context, cli LightsailAPI, instanceName string) error {
+	res, err := SwapStaticIP(ctx, cli, instanceName, SwapOptions{})
+	if err == nil && res.ReleaseErr != nil {
+		return fmt.Errorf("已换上新静态IP，但旧静态IP %s 未能释放，请在遗留资源页处理：%w", res.OldName, res.ReleaseErr)
+	}
+	return err
+}
+
+// 申请到的静态 IP 连续命中黑名单的默认上限
+const defaultMaxBlockedRejects = 5
+
+var ErrAllBlocked = errors.New("allocated static ips are all blocklisted")
+
+type SwapOptions struct {
+	// Blocked 对申请到的地址返回 true 时不绑定，立即释放并重新申请
+	Blocked func(ip string) bool
+	// MaxRejects 为连续命中黑名单的最多次数，0 为默认 5 次
+	MaxRejects int
+	// KeepOld 为 true 时旧静态 IP 只解绑、不释放，可用 RollbackStaticIP 换回；
+	// 实例原来没有静态 IP 时没有可保留的地址
+	KeepOld bool
+}
+
+// SwapResult 是一次换 IP 的结果。OldIP 为换下的地址（没有静态 IP 时为原公网 IP），
+// Rejected 为命中黑名单后未绑定就释放的地址。Kept 为 true 时 OldName 仍保留在账号中。
+// ReleaseErr 不为空表示旧静态 IP 已解绑但没能释放，OldName 仍在账号中计费，需要在遗留资源页处理。
+type SwapResult struct {
+	OldIP      string
+	OldName    string
+	Kept       bool
+	NewName    string
+	NewIP      string
+	Rejected   []string
+	ReleaseErr error
+}
+
+// SwapStaticIP 释放实例当前的静态 IP，申请并绑定新的静态 IP。
+// 旧静态 IP 解绑失败时不做任何更改直接返回；解绑后释放失败不影响换 IP，错误记在 SwapResult.ReleaseErr。
+func SwapStaticIP(ctx context.Context, cli LightsailAPI, instanceName string, opt SwapOptions) (SwapResult, error) {
+	var res SwapResult
 	// sanity: ipv6-only instances cannot use IPv4 Static IP
 	insOut, err := cli.GetInstances(ctx, &lightsail.GetInstancesInput{})
 	if err == nil && insOut != nil {
 		for _, ins := range insOut.Instances {
 			if str(ins.Name) == instanceName {
 				if str(ins.PublicIpAddress) == "" {
-					return fmt.Errorf("该实例无公网 IPv4（可能是 IPv6-only），无法换静态IP")
+					return res, fmt.Errorf("该实例无公网 IPv4（可能是 IPv6-only），无法换静态IP")
 				}
+				res.OldIP = str(ins.PublicIpAddress)
 				break
 			}
 		}
 	}
+	oldName, oldIP := FindAttachedStaticIPName(ctx, cli, instanceName)
+	if oldIP != "" {
+		res.OldIP = oldIP
+	}
 
-	// detach/release old
-	_, _ = DeletePreviousStaticIPOnlyForInstance(ctx, cli, instanceName)
+	if opt.KeepOld && oldName != "" {
+		if err := DetachStaticIP(ctx, cli, oldName); err != nil {
+			return res, err
+		}
+		res.OldName, res.Kept = oldName, true
+	} else if oldName != "" {
+		if _, err := DeletePreviousStaticIPOnlyForInstance(ctx, cli, instanceName); err != nil {
+			if name, _ := FindAttachedStaticIPName(ctx, cli, instanceName); name != "" {
+				return res, err
+			}
+			progress(ctx, "旧静态IP "+oldName+" 释放失败："+err.Error())
+			res.OldName, res.ReleaseErr = oldName, err
+		}
+	}
+	// 新 IP 没能绑上时先释放它，保留了旧静态 IP 的再把旧的绑回去；
+	// 旧 IP 绑不回去时 Kept 仍为 true，调用方需要照常记录保留。
+	// 清理不受 ctx 取消影响，任务超时打断时也会执行
+	fail := func(err error) (SwapResult, error) {
+		ctx := context.WithoutCancel(ctx)
+		if res.NewName != "" {
+			if e := ReleaseStaticIP(ctx, cli, res.NewName); e != nil {
+				err = fmt.Errorf("%w；新静态IP %s 释放失败，请在遗留资源页处理：%v", err, res.NewName, e)
+			} else {
+				res.NewName = ""
+			}
+			res.NewIP = ""
+		}
+		if res.Kept {
+			if e := attachStaticIP(ctx, cli, res.OldName, instanceName); e == nil {
+				res.Kept = false
+				return res, fmt.Errorf("%w（已重新绑定原静态IP %s）", err, res.OldName)
+			}
+		}
+		return res, err
+	}
 
-	// allocate new and attach
-	newName := fmt.Sprintf("sip-%s-%d", sanitize(instanceName), time.Now().Unix())
-	if err := SafeRetry("申请新静态IP", 8, 1200*time.Millisecond, func() error {
-		_, err := cli.AllocateStaticIp(ctx, &lightsail.AllocateStaticIpInput{StaticIpName: &newName})
-		return err
-	}); err != nil {
-		return err
+	// allocate new, skipping blocklisted addresses
+	maxRejects := opt.MaxRejects
+	if maxRejects <= 0 {
+		maxRejects = defaultMaxBlockedRejects
+	}
+	for {
+		newName := fmt.Sprintf("sip-%s-%d", sanitize(instanceName), time.Now().Unix())
+		if len(res.Rejected) > 0 {
+			newName = fmt.Sprintf("%s-%d", newName, len(res.Rejected))
+		}
+		progress(ctx, "申请新静态IP "+newName)
+		if err := SafeRetry("申请新静态IP", 8, 1200*time.Millisecond, func() error {
+			_, err := cli.AllocateStaticIp(ctx, &lightsail.AllocateStaticIpInput{StaticIpName: &newName})
+			return err
+		}); err != nil {
+			return fail(err)
+		}
+		res.NewName = newName
+		ip, err := staticIPAddress(ctx, cli, newName)
+		if err != nil {
+			return fail(err)
+		}
+		res.NewIP = ip
+		if opt.Blocked == nil || !opt.Blocked(res.NewIP) {
+			break
+		}
+		progress(ctx, res.NewIP+" 在黑名单中，释放后重新申请")
+		if err := SafeRetry("释放黑名单静态IP", 12, 1300*time.Millisecond, func() error {
+			_, err := cli.ReleaseStaticIp(ctx, &lightsail.ReleaseStaticIpInput{StaticIpName: &newName})
+			return err
+		}); err != nil {
+			return fail(err)
+		}
+		res.Rejected = append(res.Rejected, res.NewIP)
+		res.NewName, res.NewIP = "", ""
+		if len(res.Rejected) >= maxRejects {
+			return fail(fmt.Errorf("%w：连续 %d 次申请到黑名单中的地址", ErrAllBlocked, len(res.Rejected)))
+		}
 	}
 
-	if err := SafeRetry("绑定新静态IP", 8, 1200*time.Millisecond, func() error {
-		_, err := cli.AttachStaticIp(ctx, &lightsail.AttachStaticIpInput{
-			StaticIpName: &newName,
-			InstanceName: &instanceName,
-		})
-		return err
-	}); err != nil {
-		return err
+	progress(ctx, "绑定新静态IP到 "+instanceName)
+	if err := attachStaticIP(ctx, cli, res.NewName, instanceName); err != nil {
+		return fail(err)
 	}
 
-	return nil
+	return res, nil
+}
+
+// staticIPAddress 查询刚申请的静态 IP 地址，刚申请时可能还查不到，会重试几次；仍查不到时返回错误。
+func staticIPAddress(ctx context.Context, cli LightsailAPI, name string) (string, error) {
+	var ip string
+	err := SafeRetry("查询新静态IP地址", 5, time.Second, func() error {
+		out, err := cli.GetStaticIp(ctx, &lightsail.GetStaticIpInput{StaticIpName: &name})
+		if err != nil {
+			return err
+		}
+		if out == nil || out.StaticIp == nil || str(out.StaticIp.IpAddress) == "" {
+			return fmt.Errorf("静态IP %s 没有地址", name)
+		}
+		ip = str(out.StaticIp.IpAddress)
+		return nil
+	})
+	return ip, err
 }
 
 func DeletePreviousStaticIPOnlyForInstance(ctx context.Context, cli LightsailAPI, instanceName string) (string, error) {
@@ -197,6 +386,7 @@ func DeletePreviousStaticIPOnlyForInstance(ctx context.Context, cli LightsailAPI
 		return "", nil
 	}
 
+	progress(ctx, "解绑旧静态IP "+oldName)
 	if err := SafeRetry("解绑旧静态IP", 8, 1200*time.Millisecond, func() error {
 		_, err := cli.DetachStaticIp(ctx, &lightsail.DetachStaticIpInput{StaticIpName: &oldName})
 		return err
@@ -204,11 +394,13 @@ func DeletePreviousStaticIPOnlyForInstance(ctx context.Context, cli LightsailAPI
 		return "", err
 	}
 
+	progress(ctx, "等待旧静态IP解绑完成")
 	ok := WaitStaticIPDetached(ctx, cli, oldName, 120*time.Second)
 	if !ok {
 		return "", fmt.Errorf("旧静态IP解绑超时：%s", oldName)
 	}
 
+	progress(ctx, "释放旧静态IP "+oldName)
 	if err := SafeRetry("释放旧静态IP", 12, 1300*time.Millisecond, func() error {
 		_, err := cli.ReleaseStaticIp(ctx, &lightsail.ReleaseStaticIpInput{StaticIpName: &oldName})
 		return err
@@ -217,6 +409,7 @@ func DeletePreviousStaticIPOnlyForInstance(ctx context.Context, cli LightsailAPI
 	}
 
 	// wait deleted
+	progress(ctx, "等待旧静态IP释放生效")
 	deadline := time.Now().Add(90 * time.Second)
 	for time.Now().Before(deadline) {
 		_, err := cli.GetStaticIp(ctx, &lightsail.GetStaticIpInput{StaticIpName: &oldName})
@@ -263,11 +456,17 @@ func WaitStaticIPDetached(ctx context.Context, cli LightsailAPI, staticIPName st
 	return false
 }
 
-func BuildRootPasswordUserData(password string) string {
+// BuildRootPasswordUserData 生成开启 root 密码登录的 User-Data。keepPubkey 为 true 时（同时选择了密钥对）不关闭公钥登录。
+func BuildRootPasswordUserData(password string, keepPubkey bool) string {
 	// 按你 python 逻辑（核心部分）：设置 root 密码、修改 sshd_config、重启 ssh
 	// 注意：保持脚本尽量兼容常见发行版
 	// 使用 base64 传递密码，避免 $, `, \, 换行等被 shell 解释；大多数发行版自带 coreutils/busybox 的 base64。
 	pw := base64.StdEncoding.EncodeToString([]byte(password))
+	pubkey := `sed -i 's/^#\?PubkeyAuthentication.*/PubkeyAuthentication no/g' /etc/ssh/sshd_config
+sed -i '/^AuthorizedKeysFile/s/^/#/' /etc/ssh/sshd_config`
+	if keepPubkey {
+		pubkey = `sed -i 's/^#\?PubkeyAuthentication.*/PubkeyAuthentication yes/g' /etc/ssh/sshd_config`
+	}
 	return fmt.Sprintf(`#!/bin/bash
 set -e
 
@@ -284,8 +483,7 @@ passwd -u root || true
 
 sed -i 's@^\(Include[ ]*/etc/ssh/sshd_config.d/\*\.conf\)@# \1@' /etc/ssh/sshd_config
 sed -i 's/^#\?PermitRootLogin.*/PermitRootLogin yes/g;s/^#\?PasswordAuthentication.*/PasswordAuthentication yes/g' /etc/ssh/sshd_config
-sed -i 's/^#\?PubkeyAuthentication.*/PubkeyAuthentication no/g' /etc/ssh/sshd_config
-sed -i '/^AuthorizedKeysFile/s/^/#/' /etc/ssh/sshd_config
+%s
 sed -i 's/^#[[:space:]]*KbdInteractiveAuthentication.*\|^KbdInteractiveAuthentication.*/KbdInteractiveAuthentication yes/' /etc/ssh/sshd_config
 
 # 重启 SSH（兼容）
@@ -304,7 +502,7 @@ else
 fi
 
 echo -e "\033[32m 请重新登录，用户名：root ， 密码：$password \033[0m"
-`, pw)
+`, pw, pubkey)
 }
 
 func sanitize(s string) string {
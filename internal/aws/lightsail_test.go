@@ -0,0 +1,121 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type fakeLightsailPower struct {
+	LightsailAPI
+	states  []string
+	polls   int
+	stopped *lightsail.StopInstanceInput
+}
+
+func (f *fakeLightsailPower) StopInstance(_ context.Context, in *lightsail.StopInstanceInput, _ ...func(*lightsail.Options)) (*lightsail.StopInstanceOutput, error) {
+	f.stopped = in
+	return &lightsail.StopInstanceOutput{}, nil
+}
+
+func (f *fakeLightsailPower) GetInstance(context.Context, *lightsail.GetInstanceInput, ...func(*lightsail.Options)) (*lightsail.GetInstanceOutput, error) {
+	state := f.states[min(f.polls, len(f.states)-1)]
+	f.polls++
+	return &lightsail.GetInstanceOutput{Instance: &types.Instance{State: &types.InstanceState{Name: aws.String(state)}}}, nil
+}
+
+func TestStopInstanceForce(t *testing.T) {
+	cli := &fakeLightsailPower{}
+	if err := StopInstance(context.Background(), cli, "vps-1", true); err != nil {
+		t.Fatalf("StopInstance: %v", err)
+	}
+	if cli.stopped == nil || *cli.stopped.InstanceName != "vps-1" || !*cli.stopped.Force {
+		t.Fatalf("stop input = %+v", cli.stopped)
+	}
+}
+
+func TestWaitInstanceState(t *testing.T) {
+	cli := &fakeLightsailPower{states: []string{"running"}}
+	if err := WaitInstanceState(context.Background(), cli, "vps-1", "running", time.Second); err != nil {
+		t.Fatalf("WaitInstanceState: %v", err)
+	}
+
+	cli = &fakeLightsailPower{states: []string{"stopping"}}
+	err := WaitInstanceState(context.Background(), cli, "vps-1", "stopped", 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "stopping") {
+		t.Fatalf("err = %v, want timeout mentioning current state", err)
+	}
+}
+
+type fakeLightsailSwap struct {
+	LightsailAPI
+	pool     []string
+	ips      map[string]string
+	released []string
+	attached string
+}
+
+func (f *fakeLightsailSwap) GetInstances(context.Context, *lightsail.GetInstancesInput, ...func(*lightsail.Options)) (*lightsail.GetInstancesOutput, error) {
+	return &lightsail.GetInstancesOutput{Instances: []types.Instance{{Name: aws.String("vps-1"), PublicIpAddress: aws.String("198.51.100.1")}}}, nil
+}
+
+func (f *fakeLightsailSwap) GetStaticIps(context.Context, *lightsail.GetStaticIpsInput, ...func(*lightsail.Options)) (*lightsail.GetStaticIpsOutput, error) {
+	return &lightsail.GetStaticIpsOutput{}, nil
+}
+
+func (f *fakeLightsailSwap) AllocateStaticIp(_ context.Context, in *lightsail.AllocateStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.AllocateStaticIpOutput, error) {
+	if f.ips == nil {
+		f.ips = map[string]string{}
+	}
+	f.ips[*in.StaticIpName], f.pool = f.pool[0], f.pool[1:]
+	return &lightsail.AllocateStaticIpOutput{}, nil
+}
+
+func (f *fakeLightsailSwap) GetStaticIp(_ context.Context, in *lightsail.GetStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.GetStaticIpOutput, error) {
+	return &lightsail.GetStaticIpOutput{StaticIp: &types.StaticIp{Name: in.StaticIpName, IpAddress: aws.String(f.ips[*in.StaticIpName])}}, nil
+}
+
+func (f *fakeLightsailSwap) ReleaseStaticIp(_ context.Context, in *lightsail.ReleaseStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.ReleaseStaticIpOutput, error) {
+	f.released = append(f.released, f.ips[*in.StaticIpName])
+	return &lightsail.ReleaseStaticIpOutput{}, nil
+}
+
+func (f *fakeLightsailSwap) AttachStaticIp(_ context.Context, in *lightsail.AttachStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.AttachStaticIpOutput, error) {
+	f.attached = f.ips[*in.StaticIpName]
+	return &lightsail.AttachStaticIpOutput{}, nil
+}
+
+func TestSwapStaticIPSkipsBlocked(t *testing.T) {
+	blocked := func(ip string) bool { return strings.HasPrefix(ip, "203.0.113.") }
+	cli := &fakeLightsailSwap{pool: []string{"203.0.113.5", "203.0.113.6", "192.0.2.7"}}
+	res, err := SwapStaticIP(context.Background(), cli, "vps-1", SwapOptions{Blocked: blocked})
+	if err != nil {
+		t.Fatalf("SwapStaticIP: %v", err)
+	}
+	if res.OldIP != "198.51.100.1" || res.NewIP != "192.0.2.7" || cli.attached != "192.0.2.7" || len(res.Rejected) != 2 || len(cli.released) != 2 {
+		t.Fatalf("result = %+v, attached = %q, released = %v", res, cli.attached, cli.released)
+	}
+
+	cli = &fakeLightsailSwap{pool: []string{"203.0.113.5", "203.0.113.6", "192.0.2.7"}}
+	res, err = SwapStaticIP(context.Background(), cli, "vps-1", SwapOptions{Blocked: blocked, MaxRejects: 2})
+	if !errors.Is(err, ErrAllBlocked) || cli.attached != "" || len(res.Rejected) != 2 {
+		t.Fatalf("exhausted = %+v, %v, attached = %q", res, err, cli.attached)
+	}
+}
+
+func TestSwapStaticIPMissingAddress(t *testing.T) {
+	defer func(orig func(time.Duration)) { retrySleep = orig }(retrySleep)
+	retrySleep = func(time.Duration) {}
+	// 新静态 IP 一直查不到地址：释放它并失败，不绑定到实例
+	cli := &fakeLightsailSwap{pool: []string{""}}
+	res, err := SwapStaticIP(context.Background(), cli, "vps-1", SwapOptions{Blocked: func(string) bool { return false }})
+	if err == nil || cli.attached != "" || len(cli.released) != 1 || res.NewName != "" || res.NewIP != "" {
+		t.Fatalf("missing address = %+v, %v, attached = %q, released = %v", res, err, cli.attached, cli.released)
+	}
+}
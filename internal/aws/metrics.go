@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+// MetricPeriod 是监控页可选的时间范围，Step 为每个数据点的聚合周期（秒，须为 60 的倍数）。
+type MetricPeriod struct {
+	Key    string
+	Label  string
+	Window time.Duration
+	Step   int32
+}
+
+var MetricPeriods = []MetricPeriod{
+	{Key: "1h", Label: "最近 1 小时", Window: time.Hour, Step: 60},
+	{Key: "24h", Label: "最近 24 小时", Window: 24 * time.Hour, Step: 1800},
+	{Key: "7d", Label: "最近 7 天", Window: 7 * 24 * time.Hour, Step: 3600},
+}
+
+// FindMetricPeriod 按 key 查找时间范围，未知的 key 返回 1h。
+func FindMetricPeriod(key string) MetricPeriod {
+	for _, p := range MetricPeriods {
+		if p.Key == key {
+			return p
+		}
+	}
+	return MetricPeriods[0]
+}
+
+type MetricPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+type MetricSeries struct {
+	Name      string        `json:"name"`
+	Label     string        `json:"label"`
+	Unit      string        `json:"unit"`
+	Statistic string        `json:"statistic"`
+	Points    []MetricPoint `json:"points"`
+}
+
+type instanceMetric struct {
+	name  types.InstanceMetricName
+	label string
+	unit  types.MetricUnit
+	stat  types.MetricStatistic
+}
+
+// instanceMetrics 是监控页展示的指标，统计方式参考 Lightsail 控制台。
+var instanceMetrics = []instanceMetric{
+	{types.InstanceMetricNameCPUUtilization, "CPU 使用率", types.MetricUnitPercent, types.MetricStatisticAverage},
+	{types.InstanceMetricNameBurstCapacityPercentage, "突发容量", types.MetricUnitPercent, types.MetricStatisticAverage},
+	{types.InstanceMetricNameNetworkIn, "入站流量", types.MetricUnitBytes, types.MetricStatisticSum},
+	{types.InstanceMetricNameNetworkOut, "出站流量", types.MetricUnitBytes, types.MetricStatisticSum},
+	{types.InstanceMetricNameStatusCheckFailed, "状态检查失败", types.MetricUnitCount, types.MetricStatisticSum},
+}
+
+// GetInstanceMetrics 拉取实例在 period 范围内的全部监控指标，数据点按时间升序排列。
+func GetInstanceMetrics(ctx context.Context, cli LightsailAPI, instanceName string, period MetricPeriod) ([]MetricSeries, error) {
+	end := time.Now().UTC().Truncate(time.Minute)
+	start := end.Add(-period.Window)
+	out := make([]MetricSeries, 0, len(instanceMetrics))
+	for _, m := range instanceMetrics {
+		resp, err := cli.GetInstanceMetricData(ctx, &lightsail.GetInstanceMetricDataInput{
+			InstanceName: &instanceName,
+			MetricName:   m.name,
+			StartTime:    &start,
+			EndTime:      &end,
+			Period:       &period.Step,
+			Statistics:   []types.MetricStatistic{m.stat},
+			Unit:         m.unit,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("拉取监控指标 %s 失败：%w", m.name, err)
+		}
+		points := make([]MetricPoint, 0, len(resp.MetricData))
+		for _, dp := range resp.MetricData {
+			if dp.Timestamp == nil {
+				continue
+			}
+			v := dp.Average
+			if m.stat == types.MetricStatisticSum {
+				v = dp.Sum
+			}
+			if v == nil {
+				continue
+			}
+			points = append(points, MetricPoint{Time: *dp.Timestamp, Value: *v})
+		}
+		sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+		out = append(out, MetricSeries{
+			Name:      string(m.name),
+			Label:     m.label,
+			Unit:      string(m.unit),
+			Statistic: string(m.stat),
+			Points:    points,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,58 @@
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type fakeLightsailMetrics struct {
+	LightsailAPI
+	calls []*lightsail.GetInstanceMetricDataInput
+}
+
+func (f *fakeLightsailMetrics) GetInstanceMetricData(_ context.Context, in *lightsail.GetInstanceMetricDataInput, _ ...func(*lightsail.Options)) (*lightsail.GetInstanceMetricDataOutput, error) {
+	f.calls = append(f.calls, in)
+	t0 := in.EndTime.Add(-2 * time.Minute)
+	t1 := in.EndTime.Add(-time.Minute)
+	// 故意倒序返回，结果应按时间升序
+	return &lightsail.GetInstanceMetricDataOutput{MetricData: []types.MetricDatapoint{
+		{Timestamp: &t1, Average: aws.Float64(20), Sum: aws.Float64(2000)},
+		{Timestamp: &t0, Average: aws.Float64(10), Sum: aws.Float64(1000)},
+	}}, nil
+}
+
+func TestGetInstanceMetrics(t *testing.T) {
+	cli := &fakeLightsailMetrics{}
+	period := FindMetricPeriod("24h")
+	series, err := GetInstanceMetrics(context.Background(), cli, "vps-1", period)
+	if err != nil {
+		t.Fatalf("GetInstanceMetrics: %v", err)
+	}
+	if len(series) != len(instanceMetrics) || len(cli.calls) != len(instanceMetrics) {
+		t.Fatalf("series = %d, calls = %d", len(series), len(cli.calls))
+	}
+	for i, s := range series {
+		in := cli.calls[i]
+		if *in.Period != period.Step || in.EndTime.Sub(*in.StartTime) != period.Window {
+			t.Fatalf("%s: period = %d, window = %v", s.Name, *in.Period, in.EndTime.Sub(*in.StartTime))
+		}
+		if len(s.Points) != 2 || !s.Points[0].Time.Before(s.Points[1].Time) {
+			t.Fatalf("%s points = %+v", s.Name, s.Points)
+		}
+		want := 10.0
+		if s.Statistic == string(types.MetricStatisticSum) {
+			want = 1000
+		}
+		if s.Points[0].Value != want {
+			t.Fatalf("%s first value = %v, want %v", s.Name, s.Points[0].Value, want)
+		}
+	}
+	if FindMetricPeriod("bogus").Key != "1h" {
+		t.Fatalf("unknown period should fall back to 1h")
+	}
+}
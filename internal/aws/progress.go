@@ -0,0 +1,16 @@
+package aws
+
+import "context"
+
+type progressKey struct{}
+
+// WithProgress 让长时间运行的操作（换 IP、删除实例等）通过 fn 上报当前步骤。
+func WithProgress(ctx context.Context, fn func(step string)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func progress(ctx context.Context, step string) {
+	if fn, ok := ctx.Value(progressKey{}).(func(string)); ok && fn != nil {
+		fn(step)
+	}
+}
@@ -2,6 +2,7 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -59,7 +60,11 @@ func TestVCPUQuotas(ctx context.Context, cli *servicequotas.Client) (onVal, spot
 
 	// 两个都没有值：把真实错误拼出来（你就能看清是 AccessDenied / region / 网络）
 	if onVal == "" && spotVal == "" {
-		return "", "", "", "", fmt.Errorf("配额未返回（可能无权限/region不对/网络或代理问题）：onDemandErr=%v; spotErr=%v", e1, e2)
+		cause := errors.Join(e1, e2)
+		if cause == nil {
+			cause = errors.New("配额值为空")
+		}
+		return "", "", "", "", fmt.Errorf("配额未返回（可能无权限/region不对/网络或代理问题）：%w", cause)
 	}
 
 	return onVal, spotVal, onName, spotName, nil
@@ -0,0 +1,105 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+)
+
+// EC2RegionAPI 是查询区域与可用区需要的 EC2 接口，*ec2.Client 满足该接口。
+type EC2RegionAPI interface {
+	DescribeRegions(context.Context, *ec2.DescribeRegionsInput, ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+	DescribeAvailabilityZones(context.Context, *ec2.DescribeAvailabilityZonesInput, ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error)
+}
+
+// 账号级的区域启用状态（EC2 DescribeRegions 的 OptInStatus）
+const (
+	OptInNotRequired = "opt-in-not-required"
+	OptedIn          = "opted-in"
+	NotOptedIn       = "not-opted-in"
+)
+
+type ZoneInfo struct {
+	Name        string `json:"name"`
+	ID          string `json:"id,omitempty"`
+	State       string `json:"state"`
+	OptInStatus string `json:"opt_in_status,omitempty"`
+}
+
+// Usable 表示可用区存在且当前账号可以在其中创建资源。
+func (z ZoneInfo) Usable() bool {
+	return z.State == "available" && z.OptInStatus != NotOptedIn
+}
+
+type RegionInfo struct {
+	ID          string     `json:"id"`
+	DisplayName string     `json:"display_name,omitempty"`
+	OptInStatus string     `json:"opt_in_status,omitempty"`
+	Zones       []ZoneInfo `json:"zones,omitempty"`
+}
+
+func (r RegionInfo) Enabled() bool {
+	return r.OptInStatus != NotOptedIn
+}
+
+// ListLightsailRegions 返回 Lightsail 支持的区域及其可用区。Lightsail 不返回启用状态，OptInStatus 为空。
+func ListLightsailRegions(ctx context.Context, cli LightsailAPI) ([]RegionInfo, error) {
+	out, err := cli.GetRegions(ctx, &lightsail.GetRegionsInput{IncludeAvailabilityZones: aws.Bool(true)})
+	if err != nil {
+		return nil, fmt.Errorf("拉取 Lightsail 区域失败：%w", err)
+	}
+	list := make([]RegionInfo, 0, len(out.Regions))
+	for _, r := range out.Regions {
+		info := RegionInfo{ID: string(r.Name), DisplayName: str(r.DisplayName)}
+		for _, z := range r.AvailabilityZones {
+			info.Zones = append(info.Zones, ZoneInfo{Name: str(z.ZoneName), State: str(z.State)})
+		}
+		sort.Slice(info.Zones, func(i, j int) bool { return info.Zones[i].Name < info.Zones[j].Name })
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// ListEC2Regions 返回全部 EC2 区域（包括未启用的），OptInStatus 反映当前账号的启用状态。
+func ListEC2Regions(ctx context.Context, cli EC2RegionAPI) ([]RegionInfo, error) {
+	out, err := cli.DescribeRegions(ctx, &ec2.DescribeRegionsInput{AllRegions: aws.Bool(true)})
+	if err != nil {
+		return nil, fmt.Errorf("拉取 EC2 区域失败：%w", err)
+	}
+	list := make([]RegionInfo, 0, len(out.Regions))
+	for _, r := range out.Regions {
+		list = append(list, RegionInfo{ID: aws.ToString(r.RegionName), OptInStatus: aws.ToString(r.OptInStatus)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// ListEC2Zones 返回客户端所在区域的可用区（不含本地区域和 Wavelength 区域）。
+func ListEC2Zones(ctx context.Context, cli EC2RegionAPI) ([]ZoneInfo, error) {
+	out, err := cli.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
+		AllAvailabilityZones: aws.Bool(true),
+		Filters: []ec2types.Filter{
+			{Name: aws.String("zone-type"), Values: []string{"availability-zone"}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("拉取可用区失败：%w", err)
+	}
+	list := make([]ZoneInfo, 0, len(out.AvailabilityZones))
+	for _, z := range out.AvailabilityZones {
+		list = append(list, ZoneInfo{
+			Name:        aws.ToString(z.ZoneName),
+			ID:          aws.ToString(z.ZoneId),
+			State:       string(z.State),
+			OptInStatus: string(z.OptInStatus),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
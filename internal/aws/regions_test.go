@@ -0,0 +1,87 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type fakeLightsailRegions struct {
+	LightsailAPI
+	in *lightsail.GetRegionsInput
+}
+
+func (f *fakeLightsailRegions) GetRegions(_ context.Context, in *lightsail.GetRegionsInput, _ ...func(*lightsail.Options)) (*lightsail.GetRegionsOutput, error) {
+	f.in = in
+	return &lightsail.GetRegionsOutput{Regions: []types.Region{
+		{Name: types.RegionNameUsEast1, DisplayName: aws.String("Virginia"), AvailabilityZones: []types.AvailabilityZone{
+			{ZoneName: aws.String("us-east-1b"), State: aws.String("available")},
+			{ZoneName: aws.String("us-east-1a"), State: aws.String("available")},
+		}},
+		{Name: types.RegionNameApNortheast1, DisplayName: aws.String("Tokyo")},
+	}}, nil
+}
+
+type fakeEC2Regions struct{}
+
+func (fakeEC2Regions) DescribeRegions(context.Context, *ec2.DescribeRegionsInput, ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	return &ec2.DescribeRegionsOutput{Regions: []ec2types.Region{
+		{RegionName: aws.String("us-east-1"), OptInStatus: aws.String(OptInNotRequired)},
+		{RegionName: aws.String("af-south-1"), OptInStatus: aws.String(NotOptedIn)},
+	}}, nil
+}
+
+func (fakeEC2Regions) DescribeAvailabilityZones(context.Context, *ec2.DescribeAvailabilityZonesInput, ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	return &ec2.DescribeAvailabilityZonesOutput{AvailabilityZones: []ec2types.AvailabilityZone{
+		{ZoneName: aws.String("us-west-2d"), State: ec2types.AvailabilityZoneStateAvailable, OptInStatus: ec2types.AvailabilityZoneOptInStatusOptInNotRequired},
+		{ZoneName: aws.String("us-west-2a"), State: ec2types.AvailabilityZoneStateAvailable, OptInStatus: ec2types.AvailabilityZoneOptInStatusOptInNotRequired},
+		{ZoneName: aws.String("us-west-2e"), State: ec2types.AvailabilityZoneStateImpaired},
+		{ZoneName: aws.String("us-west-2x"), State: ec2types.AvailabilityZoneStateAvailable, OptInStatus: ec2types.AvailabilityZoneOptInStatusNotOptedIn},
+	}}, nil
+}
+
+func TestListLightsailRegions(t *testing.T) {
+	cli := &fakeLightsailRegions{}
+	list, err := ListLightsailRegions(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("ListLightsailRegions: %v", err)
+	}
+	if !aws.ToBool(cli.in.IncludeAvailabilityZones) {
+		t.Fatalf("GetRegions called without IncludeAvailabilityZones")
+	}
+	if len(list) != 2 || list[0].ID != "ap-northeast-1" || list[1].ID != "us-east-1" {
+		t.Fatalf("regions = %+v", list)
+	}
+	if zones := list[1].Zones; len(zones) != 2 || zones[0].Name != "us-east-1a" || !zones[0].Usable() {
+		t.Fatalf("zones = %+v", zones)
+	}
+}
+
+func TestListEC2RegionsAndZones(t *testing.T) {
+	regions, err := ListEC2Regions(context.Background(), fakeEC2Regions{})
+	if err != nil {
+		t.Fatalf("ListEC2Regions: %v", err)
+	}
+	if len(regions) != 2 || regions[0].ID != "af-south-1" || regions[0].Enabled() || !regions[1].Enabled() {
+		t.Fatalf("regions = %+v", regions)
+	}
+
+	zones, err := ListEC2Zones(context.Background(), fakeEC2Regions{})
+	if err != nil {
+		t.Fatalf("ListEC2Zones: %v", err)
+	}
+	var usable []string
+	for _, z := range zones {
+		if z.Usable() {
+			usable = append(usable, z.Name)
+		}
+	}
+	if len(usable) != 2 || usable[0] != "us-west-2a" || usable[1] != "us-west-2d" {
+		t.Fatalf("usable zones = %v, want [us-west-2a us-west-2d]", usable)
+	}
+}
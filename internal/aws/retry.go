@@ -5,6 +5,9 @@ import (
 	"time"
 )
 
+// retrySleep 是重试之间的等待，测试中替换掉以免真的等待。
+var retrySleep = time.Sleep
+
 func SafeRetry(actionName string, retries int, baseSleep time.Duration, fn func() error) error {
 	if retries < 1 {
 		retries = 1
@@ -16,7 +19,7 @@ func SafeRetry(actionName string, retries int, baseSleep time.Duration, fn func(
 		} else {
 			last = err
 		}
-		time.Sleep(time.Duration(float64(baseSleep) * (1.0 + float64(i)*0.35)))
+		retrySleep(time.Duration(float64(baseSleep) * (1.0 + float64(i)*0.35)))
 	}
-	return fmt.Errorf("%s 失败：%v", actionName, last)
+	return fmt.Errorf("%s 失败：%w", actionName, last)
 }
@@ -0,0 +1,145 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type SnapshotView struct {
+	Name         string `json:"name"`
+	FromInstance string `json:"from_instance"`
+	FromBundleID string `json:"from_bundle_id"`
+	State        string `json:"state"`
+	Progress     string `json:"progress,omitempty"`
+	SizeGB       int32  `json:"size_gb"`
+	Zone         string `json:"zone"`
+	Created      string `json:"created"`
+	Age          string `json:"age"`
+}
+
+// SnapshotName 生成快照名，例如 snap-vps-1700000000-1700000100。
+func SnapshotName(instanceName string) string {
+	return fmt.Sprintf("snap-%s-%d", sanitize(instanceName), time.Now().Unix())
+}
+
+// CreateInstanceSnapshot 只提交创建请求，快照在后台生成，可通过 ListInstanceSnapshots 查看进度。
+// 不重试：重复提交同名快照会直接失败。
+func CreateInstanceSnapshot(ctx context.Context, cli LightsailAPI, instanceName, snapshotName string) error {
+	_, err := cli.CreateInstanceSnapshot(ctx, &lightsail.CreateInstanceSnapshotInput{
+		InstanceName:         &instanceName,
+		InstanceSnapshotName: &snapshotName,
+	})
+	if err != nil {
+		return fmt.Errorf("创建快照失败：%w", err)
+	}
+	return nil
+}
+
+// ListInstanceSnapshots 返回区域内的全部实例快照，按创建时间倒序。
+func ListInstanceSnapshots(ctx context.Context, cli LightsailAPI) ([]SnapshotView, error) {
+	var snaps []types.InstanceSnapshot
+	var token *string
+	for {
+		out, err := cli.GetInstanceSnapshots(ctx, &lightsail.GetInstanceSnapshotsInput{PageToken: token})
+		if err != nil {
+			return nil, fmt.Errorf("拉取快照失败：%w", err)
+		}
+		snaps = append(snaps, out.InstanceSnapshots...)
+		if str(out.NextPageToken) == "" {
+			break
+		}
+		token = out.NextPageToken
+	}
+	sort.SliceStable(snaps, func(i, j int) bool {
+		if snaps[i].CreatedAt == nil || snaps[j].CreatedAt == nil {
+			return snaps[j].CreatedAt == nil && snaps[i].CreatedAt != nil
+		}
+		return snaps[i].CreatedAt.After(*snaps[j].CreatedAt)
+	})
+
+	now := time.Now()
+	list := make([]SnapshotView, 0, len(snaps))
+	for _, sn := range snaps {
+		v := SnapshotView{
+			Name:         str(sn.Name),
+			FromInstance: str(sn.FromInstanceName),
+			FromBundleID: str(sn.FromBundleId),
+			State:        string(sn.State),
+			Progress:     str(sn.Progress),
+		}
+		if sn.SizeInGb != nil {
+			v.SizeGB = *sn.SizeInGb
+		}
+		if sn.Location != nil {
+			v.Zone = str(sn.Location.AvailabilityZone)
+		}
+		if sn.CreatedAt != nil {
+			v.Created = sn.CreatedAt.Format("2006-01-02 15:04:05")
+			v.Age = formatAge(now.Sub(*sn.CreatedAt))
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+type RestoreSnapshotInput struct {
+	SnapshotName     string
+	InstanceName     string
+	AvailabilityZone string
+	BundleID         string
+	IPAddressType    string // 为空时保持 dualstack
+}
+
+// RestoreInstanceSnapshot 用快照创建新实例；套餐不能小于快照来源实例的磁盘大小，由 AWS 校验。
+func RestoreInstanceSnapshot(ctx context.Context, cli LightsailAPI, in RestoreSnapshotInput) error {
+	ipType := in.IPAddressType
+	if ipType == "" {
+		ipType = "dualstack"
+	}
+	_, err := cli.CreateInstancesFromSnapshot(ctx, &lightsail.CreateInstancesFromSnapshotInput{
+		InstanceNames:        []string{in.InstanceName},
+		InstanceSnapshotName: &in.SnapshotName,
+		AvailabilityZone:     &in.AvailabilityZone,
+		BundleId:             &in.BundleID,
+		IpAddressType:        types.IpAddressType(ipType),
+	})
+	if err != nil {
+		return fmt.Errorf("从快照恢复失败：%w", err)
+	}
+	return nil
+}
+
+func DeleteInstanceSnapshot(ctx context.Context, cli LightsailAPI, snapshotName string) error {
+	return SafeRetry("删除快照", 6, 1200*time.Millisecond, func() error {
+		_, err := cli.DeleteInstanceSnapshot(ctx, &lightsail.DeleteInstanceSnapshotInput{InstanceSnapshotName: &snapshotName})
+		return err
+	})
+}
+
+// FindSnapshot 在列表中按名称查找快照。
+func FindSnapshot(list []SnapshotView, name string) (SnapshotView, bool) {
+	name = strings.TrimSpace(name)
+	for _, sn := range list {
+		if sn.Name == name {
+			return sn, true
+		}
+	}
+	return SnapshotView{}, false
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%d 分钟", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d 小时", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d 天", int(d.Hours()/24))
+	}
+}
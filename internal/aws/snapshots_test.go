@@ -0,0 +1,116 @@
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+type fakeLightsailSnapshots struct {
+	LightsailAPI
+	pages    [][]types.InstanceSnapshot
+	created  *lightsail.CreateInstanceSnapshotInput
+	restored *lightsail.CreateInstancesFromSnapshotInput
+	deleted  []string
+}
+
+func (f *fakeLightsailSnapshots) CreateInstanceSnapshot(_ context.Context, in *lightsail.CreateInstanceSnapshotInput, _ ...func(*lightsail.Options)) (*lightsail.CreateInstanceSnapshotOutput, error) {
+	f.created = in
+	return &lightsail.CreateInstanceSnapshotOutput{}, nil
+}
+
+func (f *fakeLightsailSnapshots) GetInstanceSnapshots(_ context.Context, in *lightsail.GetInstanceSnapshotsInput, _ ...func(*lightsail.Options)) (*lightsail.GetInstanceSnapshotsOutput, error) {
+	page := 0
+	if in.PageToken != nil {
+		page = 1
+	}
+	out := &lightsail.GetInstanceSnapshotsOutput{InstanceSnapshots: f.pages[page]}
+	if page+1 < len(f.pages) {
+		out.NextPageToken = aws.String("next")
+	}
+	return out, nil
+}
+
+func (f *fakeLightsailSnapshots) CreateInstancesFromSnapshot(_ context.Context, in *lightsail.CreateInstancesFromSnapshotInput, _ ...func(*lightsail.Options)) (*lightsail.CreateInstancesFromSnapshotOutput, error) {
+	f.restored = in
+	return &lightsail.CreateInstancesFromSnapshotOutput{}, nil
+}
+
+func (f *fakeLightsailSnapshots) DeleteInstanceSnapshot(_ context.Context, in *lightsail.DeleteInstanceSnapshotInput, _ ...func(*lightsail.Options)) (*lightsail.DeleteInstanceSnapshotOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(in.InstanceSnapshotName))
+	return &lightsail.DeleteInstanceSnapshotOutput{}, nil
+}
+
+func TestListInstanceSnapshots(t *testing.T) {
+	snapshot := func(name string, age time.Duration) types.InstanceSnapshot {
+		return types.InstanceSnapshot{
+			Name:             aws.String(name),
+			FromInstanceName: aws.String("vps-1"),
+			FromBundleId:     aws.String("nano_3_0"),
+			State:            types.InstanceSnapshotStateAvailable,
+			SizeInGb:         aws.Int32(20),
+			CreatedAt:        aws.Time(time.Now().Add(-age)),
+			Location:         &types.ResourceLocation{AvailabilityZone: aws.String("us-east-1a")},
+		}
+	}
+	cli := &fakeLightsailSnapshots{pages: [][]types.InstanceSnapshot{
+		{snapshot("old", 72*time.Hour)},
+		{snapshot("new", 2*time.Hour)},
+	}}
+
+	list, err := ListInstanceSnapshots(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("ListInstanceSnapshots: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "new" || list[1].Name != "old" {
+		t.Fatalf("snapshots = %+v, want [new old]", list)
+	}
+	if list[0].Age != "2 小时" || list[1].Age != "3 天" {
+		t.Fatalf("ages = %q, %q", list[0].Age, list[1].Age)
+	}
+	if list[1].SizeGB != 20 || list[1].Zone != "us-east-1a" || list[1].FromBundleID != "nano_3_0" {
+		t.Fatalf("snapshot = %+v", list[1])
+	}
+	if _, ok := FindSnapshot(list, " old "); !ok {
+		t.Fatalf("FindSnapshot did not find old")
+	}
+}
+
+func TestSnapshotCreateRestoreDelete(t *testing.T) {
+	ctx := context.Background()
+	cli := &fakeLightsailSnapshots{}
+
+	if err := CreateInstanceSnapshot(ctx, cli, "vps-1", "snap-1"); err != nil {
+		t.Fatalf("CreateInstanceSnapshot: %v", err)
+	}
+	if aws.ToString(cli.created.InstanceName) != "vps-1" || aws.ToString(cli.created.InstanceSnapshotName) != "snap-1" {
+		t.Fatalf("create input = %+v", cli.created)
+	}
+
+	err := RestoreInstanceSnapshot(ctx, cli, RestoreSnapshotInput{
+		SnapshotName:     "snap-1",
+		InstanceName:     "vps-2",
+		AvailabilityZone: "us-east-1b",
+		BundleID:         "micro_3_0",
+	})
+	if err != nil {
+		t.Fatalf("RestoreInstanceSnapshot: %v", err)
+	}
+	in := cli.restored
+	if aws.ToString(in.InstanceSnapshotName) != "snap-1" || in.InstanceNames[0] != "vps-2" ||
+		aws.ToString(in.AvailabilityZone) != "us-east-1b" || aws.ToString(in.BundleId) != "micro_3_0" ||
+		in.IpAddressType != types.IpAddressTypeDualstack {
+		t.Fatalf("restore input = %+v", in)
+	}
+
+	if err := DeleteInstanceSnapshot(ctx, cli, "snap-1"); err != nil {
+		t.Fatalf("DeleteInstanceSnapshot: %v", err)
+	}
+	if len(cli.deleted) != 1 || cli.deleted[0] != "snap-1" {
+		t.Fatalf("deleted = %v", cli.deleted)
+	}
+}
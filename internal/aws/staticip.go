@@ -0,0 +1,113 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+)
+
+var (
+	ErrStaticIPGone        = errors.New("static ip no longer exists")
+	ErrStaticIPInUse       = errors.New("static ip attached to another instance")
+	ErrStaticIPNotReleased = errors.New("static ip swapped back but the replaced one was not released")
+)
+
+// DetachStaticIP 解绑静态 IP 并等待解绑完成，地址仍保留在账号中。
+func DetachStaticIP(ctx context.Context, cli LightsailAPI, name string) error {
+	progress(ctx, "解绑静态IP "+name)
+	if err := SafeRetry("解绑静态IP", 8, 1200*time.Millisecond, func() error {
+		_, err := cli.DetachStaticIp(ctx, &lightsail.DetachStaticIpInput{StaticIpName: &name})
+		return err
+	}); err != nil {
+		return err
+	}
+	progress(ctx, "等待静态IP解绑完成")
+	if !WaitStaticIPDetached(ctx, cli, name, 120*time.Second) {
+		return fmt.Errorf("静态IP解绑超时：%s", name)
+	}
+	return nil
+}
+
+func attachStaticIP(ctx context.Context, cli LightsailAPI, name, instanceName string) error {
+	return SafeRetry("绑定静态IP", 8, 1200*time.Millisecond, func() error {
+		_, err := cli.AttachStaticIp(ctx, &lightsail.AttachStaticIpInput{
+			StaticIpName: &name,
+			InstanceName: &instanceName,
+		})
+		return err
+	})
+}
+
+// ReleaseStaticIP 释放未绑定的静态 IP；已被绑定到实例时返回 ErrStaticIPInUse，不存在（NotFound）时视为已释放，其他查询错误原样返回。
+func ReleaseStaticIP(ctx context.Context, cli LightsailAPI, name string) error {
+	out, err := cli.GetStaticIp(ctx, &lightsail.GetStaticIpInput{StaticIpName: &name})
+	if err != nil {
+		if ErrorCode(err) == "NotFoundException" {
+			return nil
+		}
+		return fmt.Errorf("查询静态IP %s 失败：%w", name, err)
+	}
+	if out == nil || out.StaticIp == nil {
+		return nil
+	}
+	if out.StaticIp.IsAttached != nil && *out.StaticIp.IsAttached {
+		return fmt.Errorf("%w：%s 已绑定到 %s", ErrStaticIPInUse, name, str(out.StaticIp.AttachedTo))
+	}
+	progress(ctx, "释放静态IP "+name)
+	return SafeRetry("释放静态IP", 12, 1300*time.Millisecond, func() error {
+		_, err := cli.ReleaseStaticIp(ctx, &lightsail.ReleaseStaticIpInput{StaticIpName: &name})
+		return err
+	})
+}
+
+// RollbackStaticIP 把实例换回保留的旧静态 IP，并释放当前绑定的静态 IP。
+// 旧地址绑定失败时会把当前地址重新绑回去，绑不回去时 Kept 为 true，调用方需要记录保留 OldName；
+// 已换回但当前地址释放失败时返回 ErrStaticIPNotReleased。
+// 返回值中 OldIP 为换下的当前地址，NewIP 为换回的旧地址。
+func RollbackStaticIP(ctx context.Context, cli LightsailAPI, instanceName, oldName string) (SwapResult, error) {
+	var res SwapResult
+	out, err := cli.GetStaticIp(ctx, &lightsail.GetStaticIpInput{StaticIpName: &oldName})
+	if err != nil && ErrorCode(err) != "NotFoundException" {
+		return res, fmt.Errorf("查询原静态IP %s 失败：%w", oldName, err)
+	}
+	if err != nil || out == nil || out.StaticIp == nil {
+		return res, fmt.Errorf("%w：%s", ErrStaticIPGone, oldName)
+	}
+	if out.StaticIp.IsAttached != nil && *out.StaticIp.IsAttached {
+		if str(out.StaticIp.AttachedTo) == instanceName {
+			res.NewName, res.NewIP = oldName, str(out.StaticIp.IpAddress)
+			return res, nil
+		}
+		return res, fmt.Errorf("%w：%s 已绑定到 %s", ErrStaticIPInUse, oldName, str(out.StaticIp.AttachedTo))
+	}
+	res.NewName, res.NewIP = oldName, str(out.StaticIp.IpAddress)
+
+	curName, curIP := FindAttachedStaticIPName(ctx, cli, instanceName)
+	res.OldName, res.OldIP = curName, curIP
+	if curName != "" {
+		if err := DetachStaticIP(ctx, cli, curName); err != nil {
+			return res, err
+		}
+	}
+	progress(ctx, "绑定原静态IP "+oldName+" 到 "+instanceName)
+	if err := attachStaticIP(ctx, cli, oldName, instanceName); err != nil {
+		if curName != "" {
+			e := attachStaticIP(ctx, cli, curName, instanceName)
+			if e == nil {
+				return res, fmt.Errorf("%w（已重新绑定 %s）", err, curName)
+			}
+			res.Kept = true
+			return res, fmt.Errorf("%w；%s 也没能重新绑定，已解绑保留：%v", err, curName, e)
+		}
+		return res, err
+	}
+	if curName != "" {
+		if err := ReleaseStaticIP(ctx, cli, curName); err != nil {
+			return res, fmt.Errorf("%w：%s 请在遗留资源页处理（%v）", ErrStaticIPNotReleased, curName, err)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,222 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+	"github.com/aws/smithy-go"
+)
+
+type fakeStaticIP struct {
+	ip, attachedTo string
+}
+
+// fakeLightsailStaticIPs 模拟账号中的静态 IP 及其绑定状态。
+type fakeLightsailStaticIPs struct {
+	LightsailAPI
+	pool       []string
+	ips        map[string]*fakeStaticIP
+	releaseErr error
+	attachErr  map[string]error // 按地址模拟绑定失败
+	getErr     error            // 模拟查询静态 IP 时的限流、网络错误
+}
+
+func (f *fakeLightsailStaticIPs) GetInstances(context.Context, *lightsail.GetInstancesInput, ...func(*lightsail.Options)) (*lightsail.GetInstancesOutput, error) {
+	return &lightsail.GetInstancesOutput{Instances: []types.Instance{{Name: aws.String("vps-1"), PublicIpAddress: aws.String("198.51.100.1")}}}, nil
+}
+
+func (f *fakeLightsailStaticIPs) view(name string, si *fakeStaticIP) types.StaticIp {
+	v := types.StaticIp{Name: aws.String(name), IpAddress: aws.String(si.ip), IsAttached: aws.Bool(si.attachedTo != "")}
+	if si.attachedTo != "" {
+		v.AttachedTo = aws.String(si.attachedTo)
+	}
+	return v
+}
+
+func (f *fakeLightsailStaticIPs) GetStaticIps(context.Context, *lightsail.GetStaticIpsInput, ...func(*lightsail.Options)) (*lightsail.GetStaticIpsOutput, error) {
+	out := &lightsail.GetStaticIpsOutput{}
+	for name, si := range f.ips {
+		out.StaticIps = append(out.StaticIps, f.view(name, si))
+	}
+	return out, nil
+}
+
+func (f *fakeLightsailStaticIPs) GetStaticIp(_ context.Context, in *lightsail.GetStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.GetStaticIpOutput, error) {
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	si, ok := f.ips[*in.StaticIpName]
+	if !ok {
+		return nil, &smithy.GenericAPIError{Code: "NotFoundException"}
+	}
+	v := f.view(*in.StaticIpName, si)
+	return &lightsail.GetStaticIpOutput{StaticIp: &v}, nil
+}
+
+func (f *fakeLightsailStaticIPs) AllocateStaticIp(_ context.Context, in *lightsail.AllocateStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.AllocateStaticIpOutput, error) {
+	f.ips[*in.StaticIpName] = &fakeStaticIP{ip: f.pool[0]}
+	f.pool = f.pool[1:]
+	return &lightsail.AllocateStaticIpOutput{}, nil
+}
+
+func (f *fakeLightsailStaticIPs) AttachStaticIp(_ context.Context, in *lightsail.AttachStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.AttachStaticIpOutput, error) {
+	si := f.ips[*in.StaticIpName]
+	if err := f.attachErr[si.ip]; err != nil {
+		return nil, err
+	}
+	si.attachedTo = *in.InstanceName
+	return &lightsail.AttachStaticIpOutput{}, nil
+}
+
+func (f *fakeLightsailStaticIPs) DetachStaticIp(_ context.Context, in *lightsail.DetachStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.DetachStaticIpOutput, error) {
+	f.ips[*in.StaticIpName].attachedTo = ""
+	return &lightsail.DetachStaticIpOutput{}, nil
+}
+
+func (f *fakeLightsailStaticIPs) ReleaseStaticIp(_ context.Context, in *lightsail.ReleaseStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.ReleaseStaticIpOutput, error) {
+	if f.releaseErr != nil {
+		return nil, f.releaseErr
+	}
+	delete(f.ips, *in.StaticIpName)
+	return &lightsail.ReleaseStaticIpOutput{}, nil
+}
+
+func TestSwapKeepOldAndRollback(t *testing.T) {
+	ctx := context.Background()
+	cli := &fakeLightsailStaticIPs{
+		pool: []string{"192.0.2.7"},
+		ips:  map[string]*fakeStaticIP{"sip-old": {ip: "198.51.100.1", attachedTo: "vps-1"}},
+	}
+	res, err := SwapStaticIP(ctx, cli, "vps-1", SwapOptions{KeepOld: true})
+	if err != nil {
+		t.Fatalf("SwapStaticIP: %v", err)
+	}
+	if !res.Kept || res.OldName != "sip-old" || res.NewIP != "192.0.2.7" {
+		t.Fatalf("result = %+v", res)
+	}
+	if old := cli.ips["sip-old"]; old == nil || old.attachedTo != "" {
+		t.Fatalf("old static ip = %+v, want kept and detached", old)
+	}
+
+	back, err := RollbackStaticIP(ctx, cli, "vps-1", "sip-old")
+	if err != nil {
+		t.Fatalf("RollbackStaticIP: %v", err)
+	}
+	if back.NewIP != "198.51.100.1" || back.OldIP != "192.0.2.7" || cli.ips["sip-old"].attachedTo != "vps-1" || len(cli.ips) != 1 {
+		t.Fatalf("rollback = %+v, ips = %+v", back, cli.ips)
+	}
+
+	if err := ReleaseStaticIP(ctx, cli, "sip-old"); !errors.Is(err, ErrStaticIPInUse) {
+		t.Fatalf("ReleaseStaticIP(attached) err = %v", err)
+	}
+	if _, err := RollbackStaticIP(ctx, cli, "vps-1", "sip-gone"); !errors.Is(err, ErrStaticIPGone) {
+		t.Fatalf("RollbackStaticIP(gone) err = %v", err)
+	}
+}
+
+func TestSwapReportsUnreleasedOldIP(t *testing.T) {
+	defer func(orig func(time.Duration)) { retrySleep = orig }(retrySleep)
+	retrySleep = func(time.Duration) {}
+
+	ctx := context.Background()
+	cli := &fakeLightsailStaticIPs{
+		pool:       []string{"192.0.2.7"},
+		ips:        map[string]*fakeStaticIP{"sip-old": {ip: "198.51.100.1", attachedTo: "vps-1"}},
+		releaseErr: errors.New("ThrottlingException"),
+	}
+	res, err := SwapStaticIP(ctx, cli, "vps-1", SwapOptions{})
+	if err != nil {
+		t.Fatalf("SwapStaticIP: %v", err)
+	}
+	if res.ReleaseErr == nil || res.Kept || res.OldName != "sip-old" || res.OldIP != "198.51.100.1" || res.NewIP != "192.0.2.7" {
+		t.Fatalf("result = %+v", res)
+	}
+	if old := cli.ips["sip-old"]; old == nil || old.attachedTo != "" || cli.ips[res.NewName].attachedTo != "vps-1" {
+		t.Fatalf("ips = %+v", cli.ips)
+	}
+
+	cli.pool = []string{"192.0.2.8"}
+	cli.ips = map[string]*fakeStaticIP{"sip-old": {ip: "198.51.100.1", attachedTo: "vps-1"}}
+	if err := SwapStaticIPForInstance(ctx, cli, "vps-1"); err == nil || !strings.Contains(err.Error(), "sip-old") {
+		t.Fatalf("SwapStaticIPForInstance err = %v", err)
+	}
+}
+
+func TestSwapAttachFailureReleasesNewIP(t *testing.T) {
+	defer func(orig func(time.Duration)) { retrySleep = orig }(retrySleep)
+	retrySleep = func(time.Duration) {}
+
+	ctx := context.Background()
+	attachErr := errors.New("InvalidInputException")
+	cli := &fakeLightsailStaticIPs{
+		pool:      []string{"192.0.2.7"},
+		ips:       map[string]*fakeStaticIP{"sip-old": {ip: "198.51.100.1", attachedTo: "vps-1"}},
+		attachErr: map[string]error{"192.0.2.7": attachErr, "192.0.2.8": attachErr},
+	}
+	res, err := SwapStaticIP(ctx, cli, "vps-1", SwapOptions{KeepOld: true})
+	if !errors.Is(err, attachErr) || res.Kept || res.NewName != "" || res.NewIP != "" {
+		t.Fatalf("SwapStaticIP = %+v, %v", res, err)
+	}
+	if len(cli.ips) != 1 || cli.ips["sip-old"].attachedTo != "vps-1" {
+		t.Fatalf("ips = %+v, want new ip released and old ip rebound", cli.ips)
+	}
+
+	// 旧 IP 也绑不回去时仍报告为保留，由调用方记录
+	cli.pool = []string{"192.0.2.8"}
+	cli.attachErr["198.51.100.1"] = attachErr
+	res, err = SwapStaticIP(ctx, cli, "vps-1", SwapOptions{KeepOld: true})
+	if !errors.Is(err, attachErr) || !res.Kept || res.OldName != "sip-old" || res.NewIP != "" {
+		t.Fatalf("SwapStaticIP(rebind fails) = %+v, %v", res, err)
+	}
+	if len(cli.ips) != 1 || cli.ips["sip-old"].attachedTo != "" {
+		t.Fatalf("ips = %+v, want new ip released and old ip kept detached", cli.ips)
+	}
+}
+
+func TestStaticIPLookupErrorsAreNotGone(t *testing.T) {
+	ctx := context.Background()
+	cli := &fakeLightsailStaticIPs{ips: map[string]*fakeStaticIP{"sip-old": {ip: "198.51.100.1"}}}
+	if err := ReleaseStaticIP(ctx, cli, "sip-gone"); err != nil {
+		t.Fatalf("ReleaseStaticIP(not found) = %v", err)
+	}
+
+	throttled := &smithy.GenericAPIError{Code: "ThrottlingException"}
+	cli.getErr = throttled
+	if err := ReleaseStaticIP(ctx, cli, "sip-old"); !errors.Is(err, throttled) {
+		t.Fatalf("ReleaseStaticIP(throttled) = %v", err)
+	}
+	if _, err := RollbackStaticIP(ctx, cli, "vps-1", "sip-old"); !errors.Is(err, throttled) || errors.Is(err, ErrStaticIPGone) {
+		t.Fatalf("RollbackStaticIP(throttled) = %v", err)
+	}
+	if _, ok := cli.ips["sip-old"]; !ok {
+		t.Fatalf("sip-old released on lookup error")
+	}
+}
+
+func TestRollbackAttachFailureKeepsCurrentIP(t *testing.T) {
+	defer func(orig func(time.Duration)) { retrySleep = orig }(retrySleep)
+	retrySleep = func(time.Duration) {}
+
+	ctx := context.Background()
+	attachErr := errors.New("InvalidInputException")
+	cli := &fakeLightsailStaticIPs{
+		ips: map[string]*fakeStaticIP{
+			"sip-old": {ip: "198.51.100.1"},
+			"sip-cur": {ip: "192.0.2.7", attachedTo: "vps-1"},
+		},
+		attachErr: map[string]error{"198.51.100.1": attachErr, "192.0.2.7": attachErr},
+	}
+	res, err := RollbackStaticIP(ctx, cli, "vps-1", "sip-old")
+	if !errors.Is(err, attachErr) || !res.Kept || res.OldName != "sip-cur" || res.OldIP != "192.0.2.7" {
+		t.Fatalf("RollbackStaticIP = %+v, %v", res, err)
+	}
+	if cli.ips["sip-cur"].attachedTo != "" || len(cli.ips) != 2 {
+		t.Fatalf("ips = %+v, want current ip detached and kept", cli.ips)
+	}
+}
@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+// Lightsail 只保留两周的监控数据，月初的数据超出范围时按已有数据估算。
+const metricRetention = 14 * 24 * time.Hour
+
+const bytesPerGB = 1024 * 1024 * 1024
+
+// TransferUsage 是实例在当前计费月（UTC 自然月）的流量使用情况。
+// Lightsail 的流量配额同时计入入站和出站，超出部分按出站流量计费。
+type TransferUsage struct {
+	AllowanceGB      int32   `json:"allowance_gb"`
+	InGB             float64 `json:"in_gb"`
+	OutGB            float64 `json:"out_gb"`
+	UsedGB           float64 `json:"used_gb"`
+	ProjectedGB      float64 `json:"projected_gb"`
+	ProjectedOutGB   float64 `json:"projected_out_gb"`
+	Percent          float64 `json:"percent"`
+	ProjectedPercent float64 `json:"projected_percent"`
+	// Estimated 为 true 表示月初的数据已超出保留期，用量按已有数据的日均值推算
+	Estimated bool `json:"estimated"`
+	// ObservedOutGB 为实际取到的出站流量之和，不含推算部分；Estimated 时小于本月真实用量
+	ObservedOutGB float64 `json:"observed_out_gb"`
+}
+
+// Over 表示按当前速度月底会超出配额。
+func (u TransferUsage) Over() bool {
+	return u.AllowanceGB > 0 && u.ProjectedGB > float64(u.AllowanceGB)
+}
+
+// BarPercent 是用量进度条的宽度，超出配额时封顶为 100。
+func (u TransferUsage) BarPercent() float64 {
+	return math.Min(u.Percent, 100)
+}
+
+func monthBounds(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// projectTransfer 根据观测窗口 [from, now) 内的流量推算当月用量与月底用量。
+func projectTransfer(inBytes, outBytes float64, allowanceGB int32, from, now time.Time) TransferUsage {
+	monthStart, monthEnd := monthBounds(now)
+	u := TransferUsage{AllowanceGB: allowanceGB, InGB: inBytes / bytesPerGB, OutGB: outBytes / bytesPerGB}
+	u.ObservedOutGB = u.OutGB
+	u.UsedGB = u.InGB + u.OutGB
+	elapsed := now.Sub(monthStart)
+	if observed := now.Sub(from); from.After(monthStart) && observed > 0 {
+		u.Estimated = true
+		scale := float64(elapsed) / float64(observed)
+		u.InGB, u.OutGB, u.UsedGB = u.InGB*scale, u.OutGB*scale, u.UsedGB*scale
+	}
+	u.ProjectedGB, u.ProjectedOutGB = u.UsedGB, u.OutGB
+	if elapsed > 0 {
+		scale := float64(monthEnd.Sub(monthStart)) / float64(elapsed)
+		u.ProjectedGB, u.ProjectedOutGB = u.UsedGB*scale, u.OutGB*scale
+	}
+	if allowanceGB > 0 {
+		u.Percent = u.UsedGB / float64(allowanceGB) * 100
+		u.ProjectedPercent = u.ProjectedGB / float64(allowanceGB) * 100
+	}
+	return u
+}
+
+// GetMonthTransfer 汇总实例本月的 NetworkIn / NetworkOut，并与套餐流量配额比较。
+func GetMonthTransfer(ctx context.Context, cli LightsailAPI, instanceName string, allowanceGB int32, now time.Time) (TransferUsage, error) {
+	now = now.UTC().Truncate(time.Hour)
+	from, _ := monthBounds(now)
+	if oldest := now.Add(-metricRetention).Truncate(time.Hour); oldest.After(from) {
+		from = oldest
+	}
+	if !now.After(from) {
+		return projectTransfer(0, 0, allowanceGB, from, now), nil
+	}
+	sums := make(map[types.InstanceMetricName]float64, 2)
+	for _, name := range []types.InstanceMetricName{types.InstanceMetricNameNetworkIn, types.InstanceMetricNameNetworkOut} {
+		// 按小时聚合，月内最多 14 天 × 24 个数据点，不超过单次返回上限
+		resp, err := cli.GetInstanceMetricData(ctx, &lightsail.GetInstanceMetricDataInput{
+			InstanceName: &instanceName,
+			MetricName:   name,
+			StartTime:    &from,
+			EndTime:      &now,
+			Period:       aws.Int32(3600),
+			Statistics:   []types.MetricStatistic{types.MetricStatisticSum},
+			Unit:         types.MetricUnitBytes,
+		})
+		if err != nil {
+			return TransferUsage{}, fmt.Errorf("拉取流量数据失败：%w", err)
+		}
+		for _, dp := range resp.MetricData {
+			if dp.Sum != nil {
+				sums[name] += *dp.Sum
+			}
+		}
+	}
+	return projectTransfer(sums[types.InstanceMetricNameNetworkIn], sums[types.InstanceMetricNameNetworkOut], allowanceGB, from, now), nil
+}
@@ -0,0 +1,64 @@
+package aws
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+func TestProjectTransfer(t *testing.T) {
+	// 4 月共 30 天，10 日 0 点已过去 9 天
+	now := time.Date(2026, 4, 10, 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	u := projectTransfer(60*bytesPerGB, 30*bytesPerGB, 1024, monthStart, now)
+	if u.UsedGB != 90 || u.Estimated {
+		t.Fatalf("usage = %+v", u)
+	}
+	if math.Abs(u.ProjectedGB-300) > 1e-9 || math.Abs(u.ProjectedOutGB-100) > 1e-9 || u.Over() {
+		t.Fatalf("projected = %v / %v, over = %v", u.ProjectedGB, u.ProjectedOutGB, u.Over())
+	}
+
+	// 只观测到最近 14 天：用量按日均值推回月初
+	now = time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC)
+	u = projectTransfer(7*bytesPerGB, 7*bytesPerGB, 10, now.Add(-metricRetention), now)
+	if !u.Estimated || math.Abs(u.UsedGB-28) > 1e-9 || math.Abs(u.ProjectedGB-31) > 1e-9 || !u.Over() {
+		t.Fatalf("estimated usage = %+v", u)
+	}
+	if u.ObservedOutGB != 7 || math.Abs(u.OutGB-14) > 1e-9 {
+		t.Fatalf("observed out = %v, estimated out = %v", u.ObservedOutGB, u.OutGB)
+	}
+}
+
+type fakeLightsailTransfer struct {
+	LightsailAPI
+	calls []*lightsail.GetInstanceMetricDataInput
+}
+
+func (f *fakeLightsailTransfer) GetInstanceMetricData(_ context.Context, in *lightsail.GetInstanceMetricDataInput, _ ...func(*lightsail.Options)) (*lightsail.GetInstanceMetricDataOutput, error) {
+	f.calls = append(f.calls, in)
+	v := float64(bytesPerGB)
+	if in.MetricName == types.InstanceMetricNameNetworkOut {
+		v *= 2
+	}
+	return &lightsail.GetInstanceMetricDataOutput{MetricData: []types.MetricDatapoint{{Sum: aws.Float64(v)}, {Sum: aws.Float64(v)}}}, nil
+}
+
+func TestGetMonthTransfer(t *testing.T) {
+	cli := &fakeLightsailTransfer{}
+	now := time.Date(2026, 4, 3, 12, 30, 0, 0, time.UTC)
+	u, err := GetMonthTransfer(context.Background(), cli, "vps-1", 2048, now)
+	if err != nil {
+		t.Fatalf("GetMonthTransfer: %v", err)
+	}
+	if len(cli.calls) != 2 || !cli.calls[0].StartTime.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("calls = %+v", cli.calls)
+	}
+	if u.InGB != 2 || u.OutGB != 4 || u.UsedGB != 6 || u.AllowanceGB != 2048 {
+		t.Fatalf("usage = %+v", u)
+	}
+}
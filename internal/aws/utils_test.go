@@ -1,6 +1,11 @@
 package aws
 
-import "testing"
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
 
 func TestFloatPtrToString(t *testing.T) {
 	cases := []struct {
@@ -45,3 +50,25 @@ func TestSanitize(t *testing.T) {
 func floatPtr(v float64) *float64 {
 	return &v
 }
+
+func TestErrorCode(t *testing.T) {
+	apiErr := &smithy.GenericAPIError{Code: "UnauthorizedOperation", Message: "denied"}
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "plain", err: errors.New("dial tcp: timeout"), want: ""},
+		{name: "direct", err: apiErr, want: "UnauthorizedOperation"},
+		{name: "wrapped", err: SafeRetry("测试", 1, 0, func() error { return apiErr }), want: "UnauthorizedOperation"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ErrorCode(tc.err); got != tc.want {
+				t.Fatalf("ErrorCode(%v) = %q, want %q", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package dnsprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+type cloudflare struct {
+	token string
+	base  string
+	hc    *http.Client
+}
+
+type cfEnvelope struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+type cfRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied *bool  `json:"proxied,omitempty"`
+}
+
+func (p *cloudflare) do(ctx context.Context, method, path string, body, out any) error {
+	var rd *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	} else {
+		rd = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.base+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %w", err)
+	}
+	defer resp.Body.Close()
+	var env cfEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return fmt.Errorf("cloudflare: %s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+	if !env.Success {
+		if len(env.Errors) > 0 {
+			return fmt.Errorf("cloudflare: %s（%d）", env.Errors[0].Message, env.Errors[0].Code)
+		}
+		return fmt.Errorf("cloudflare: %s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+	if out != nil {
+		return json.Unmarshal(env.Result, out)
+	}
+	return nil
+}
+
+func (p *cloudflare) zoneID(ctx context.Context, zone string) (string, error) {
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if err := p.do(ctx, http.MethodGet, "/zones?"+url.Values{"name": {zone}}.Encode(), nil, &zones); err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("cloudflare: 找不到区域 %s（检查 Token 的区域权限）", zone)
+	}
+	return zones[0].ID, nil
+}
+
+// SetRecord 更新第一条同名记录并删除其余的；保留记录原有的代理（橙色云）设置。
+func (p *cloudflare) SetRecord(ctx context.Context, r Record) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	zoneID, err := p.zoneID(ctx, r.Zone)
+	if err != nil {
+		return err
+	}
+	base := "/zones/" + url.PathEscape(zoneID) + "/dns_records"
+	var existing []cfRecord
+	if err := p.do(ctx, http.MethodGet, base+"?"+url.Values{"type": {r.Type}, "name": {r.Name}}.Encode(), nil, &existing); err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		proxied := false
+		return p.do(ctx, http.MethodPost, base, cfRecord{Type: r.Type, Name: r.Name, Content: r.Value, TTL: r.TTL, Proxied: &proxied}, nil)
+	}
+	first := existing[0]
+	if first.Content != r.Value || first.TTL != r.TTL {
+		if err := p.do(ctx, http.MethodPatch, base+"/"+url.PathEscape(first.ID), map[string]any{"content": r.Value, "ttl": r.TTL}, nil); err != nil {
+			return err
+		}
+	}
+	for _, extra := range existing[1:] {
+		if err := p.do(ctx, http.MethodDelete, base+"/"+url.PathEscape(extra.ID), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
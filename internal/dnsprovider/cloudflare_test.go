@@ -0,0 +1,133 @@
+package dnsprovider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCloudflare 是只实现 SetRecord 用到的几个接口的 Cloudflare 替身。
+type fakeCloudflare struct {
+	mu      sync.Mutex
+	records []cfRecord
+	calls   []string
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+	reply := func(result any) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "result": result})
+	}
+	if r.Header.Get("Authorization") != "Bearer tok" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/zones":
+		if r.URL.Query().Get("name") == "example.com" {
+			reply([]map[string]string{{"id": "z1"}})
+		} else {
+			reply([]any{})
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/zones/z1/dns_records":
+		var out []cfRecord
+		for _, rec := range f.records {
+			if rec.Name == r.URL.Query().Get("name") && rec.Type == r.URL.Query().Get("type") {
+				out = append(out, rec)
+			}
+		}
+		reply(out)
+	case r.Method == http.MethodPost:
+		var rec cfRecord
+		_ = json.NewDecoder(r.Body).Decode(&rec)
+		rec.ID = "new"
+		f.records = append(f.records, rec)
+		reply(rec)
+	case r.Method == http.MethodPatch:
+		var patch cfRecord
+		_ = json.NewDecoder(r.Body).Decode(&patch)
+		id := strings.TrimPrefix(r.URL.Path, "/zones/z1/dns_records/")
+		for i := range f.records {
+			if f.records[i].ID == id {
+				f.records[i].Content, f.records[i].TTL = patch.Content, patch.TTL
+			}
+		}
+		reply(nil)
+	case r.Method == http.MethodDelete:
+		id := strings.TrimPrefix(r.URL.Path, "/zones/z1/dns_records/")
+		kept := f.records[:0]
+		for _, rec := range f.records {
+			if rec.ID != id {
+				kept = append(kept, rec)
+			}
+		}
+		f.records = kept
+		reply(nil)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCloudflareSetRecord(t *testing.T) {
+	fake := &fakeCloudflare{records: []cfRecord{
+		{ID: "a1", Type: "A", Name: "vps.example.com", Content: "198.51.100.1", TTL: 300},
+		{ID: "a2", Type: "A", Name: "vps.example.com", Content: "198.51.100.2", TTL: 300},
+		{ID: "w1", Type: "A", Name: "www.example.com", Content: "198.51.100.1", TTL: 300},
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p, err := New(KindCloudflare, Config{APIToken: "tok", Endpoint: srv.URL}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetRecord(context.Background(), Record{Zone: "example.com", Name: "VPS.example.com.", Type: "a", Value: "203.0.113.9"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.records) != 2 || fake.records[0].Content != "203.0.113.9" || fake.records[1].ID != "w1" {
+		t.Fatalf("records = %+v", fake.records)
+	}
+
+	if err := p.SetRecord(context.Background(), Record{Zone: "example.com", Name: "v6.example.com", Type: "AAAA", Value: "2001:db8::1", TTL: 60}); err != nil {
+		t.Fatal(err)
+	}
+	last := fake.records[len(fake.records)-1]
+	if last.Type != "AAAA" || last.TTL != 60 || last.Proxied == nil || *last.Proxied {
+		t.Fatalf("created = %+v", last)
+	}
+
+	if err := p.SetRecord(context.Background(), Record{Zone: "other.org", Name: "vps.other.org", Type: "A", Value: "203.0.113.9"}); err == nil || !strings.Contains(err.Error(), "other.org") {
+		t.Fatalf("missing zone err = %v", err)
+	}
+
+	bad, _ := New(KindCloudflare, Config{APIToken: "wrong", Endpoint: srv.URL}, srv.Client())
+	if err := bad.SetRecord(context.Background(), Record{Zone: "example.com", Name: "vps.example.com", Type: "A", Value: "203.0.113.9"}); err == nil || !strings.Contains(err.Error(), "Invalid access token") {
+		t.Fatalf("bad token err = %v", err)
+	}
+}
+
+func TestRecordValidate(t *testing.T) {
+	bad := []Record{
+		{Zone: "example.com", Name: "vps.example.org", Type: "A", Value: "192.0.2.1"},
+		{Zone: "example.com", Name: "vps.example.com", Type: "A", Value: "2001:db8::1"},
+		{Zone: "example.com", Name: "vps.example.com", Type: "AAAA", Value: "192.0.2.1"},
+		{Zone: "example.com", Name: "vps.example.com", Type: "CNAME", Value: "a.example.com"},
+	}
+	for _, r := range bad {
+		if err := r.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) = nil", r)
+		}
+	}
+	r := Record{Zone: "Example.com.", Name: "example.com", Type: "a", Value: " 192.0.2.1 "}
+	if err := r.Validate(); err != nil || r.Zone != "example.com" || r.Value != "192.0.2.1" || r.TTL != DefaultTTL {
+		t.Fatalf("apex = %+v, %v", r, err)
+	}
+}
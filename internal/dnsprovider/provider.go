@@ -0,0 +1,154 @@
+// Package dnsprovider 更新外部 DNS 服务商的解析记录，用于实例换 IP 后同步绑定的域名。
+package dnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	KindCloudflare = "cloudflare"
+	KindRoute53    = "route53"
+	KindRFC2136    = "rfc2136"
+)
+
+// DefaultTTL 是未指定 TTL 时使用的值（秒），换 IP 后希望尽快生效，所以取得较短。
+const DefaultTTL = 300
+
+var (
+	ErrUnknownKind   = errors.New("unknown dns provider")
+	ErrInvalidConfig = errors.New("invalid dns provider config")
+	ErrInvalidRecord = errors.New("invalid dns record")
+)
+
+// Provider 把一条记录设置为唯一的值：同名同类型的其他值会被替换。
+type Provider interface {
+	SetRecord(ctx context.Context, r Record) error
+}
+
+// Record 是要写入的记录。Zone 为托管区域（example.com），Name 为完整域名（vps.example.com）。
+type Record struct {
+	Zone  string
+	Name  string
+	Type  string // A 或 AAAA
+	Value string
+	TTL   int
+}
+
+// Config 保存各服务商需要的参数，只填写对应服务商的字段。整体加密后存入数据库。
+type Config struct {
+	// Cloudflare：需要 Zone.DNS 编辑权限的 API Token
+	APIToken string `json:"api_token,omitempty"`
+
+	// Route53：HostedZoneID 为空时按区域名查找
+	AccessKey    string `json:"access_key,omitempty"`
+	SecretKey    string `json:"secret_key,omitempty"`
+	HostedZoneID string `json:"hosted_zone_id,omitempty"`
+
+	// RFC 2136：Server 为 host:port，TSIG 密钥为 base64
+	Server        string `json:"server,omitempty"`
+	TSIGName      string `json:"tsig_name,omitempty"`
+	TSIGSecret    string `json:"tsig_secret,omitempty"`
+	TSIGAlgorithm string `json:"tsig_algorithm,omitempty"`
+
+	// Endpoint 覆盖 Cloudflare / Route53 的 API 地址，用于测试或兼容服务
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// Kinds 是支持的服务商，按页面显示顺序排列。
+var Kinds = []string{KindCloudflare, KindRoute53, KindRFC2136}
+
+// KindLabel 返回服务商的显示名称。
+func KindLabel(kind string) string {
+	switch kind {
+	case KindCloudflare:
+		return "Cloudflare"
+	case KindRoute53:
+		return "Route 53"
+	case KindRFC2136:
+		return "RFC 2136 (nsupdate)"
+	}
+	return kind
+}
+
+// New 按服务商类型创建 Provider；hc 为空时使用 15 秒超时的默认客户端，需要走代理时由调用方传入。
+func New(kind string, cfg Config, hc *http.Client) (Provider, error) {
+	if hc == nil {
+		hc = &http.Client{Timeout: 15 * time.Second}
+	}
+	switch kind {
+	case KindCloudflare:
+		if strings.TrimSpace(cfg.APIToken) == "" {
+			return nil, fmt.Errorf("%w：缺少 API Token", ErrInvalidConfig)
+		}
+		return &cloudflare{token: strings.TrimSpace(cfg.APIToken), base: strings.TrimRight(firstNonEmpty(cfg.Endpoint, cloudflareAPI), "/"), hc: hc}, nil
+	case KindRoute53:
+		if strings.TrimSpace(cfg.AccessKey) == "" || strings.TrimSpace(cfg.SecretKey) == "" {
+			return nil, fmt.Errorf("%w：缺少 Access Key / Secret Key", ErrInvalidConfig)
+		}
+		return newRoute53(cfg, hc), nil
+	case KindRFC2136:
+		return newRFC2136(cfg)
+	}
+	return nil, fmt.Errorf("%w：%q", ErrUnknownKind, kind)
+}
+
+// Describe 返回不含密钥的配置摘要，用于列表展示。
+func Describe(kind string, cfg Config) string {
+	switch kind {
+	case KindCloudflare:
+		return "token " + mask(cfg.APIToken)
+	case KindRoute53:
+		s := "AK " + mask(cfg.AccessKey)
+		if cfg.HostedZoneID != "" {
+			s += " · zone " + cfg.HostedZoneID
+		}
+		return s
+	case KindRFC2136:
+		return cfg.Server + " · " + cfg.TSIGName
+	}
+	return ""
+}
+
+// Validate 检查记录是否可以写入：类型只支持 A / AAAA，值与类型匹配，名称位于区域内。
+func (r *Record) Validate() error {
+	r.Zone = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(r.Zone)), ".")
+	r.Name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(r.Name)), ".")
+	r.Type = strings.ToUpper(strings.TrimSpace(r.Type))
+	if r.Zone == "" || (r.Name != r.Zone && !strings.HasSuffix(r.Name, "."+r.Zone)) {
+		return fmt.Errorf("%w：%s 不在区域 %s 内", ErrInvalidRecord, r.Name, r.Zone)
+	}
+	ip := net.ParseIP(strings.TrimSpace(r.Value))
+	switch {
+	case r.Type == "A" && ip != nil && ip.To4() != nil:
+	case r.Type == "AAAA" && ip != nil && ip.To4() == nil:
+	default:
+		return fmt.Errorf("%w：%s 记录的值 %q 无效", ErrInvalidRecord, r.Type, r.Value)
+	}
+	r.Value = ip.String()
+	if r.TTL <= 0 {
+		r.TTL = DefaultTTL
+	}
+	return nil
+}
+
+func mask(s string) string {
+	if len(s) <= 4 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,229 @@
+package dnsprovider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNS 报文常量，见 RFC 1035 / 2136 / 8945。
+const (
+	dnsOpcodeUpdate = 5
+	dnsClassIN      = 1
+	dnsClassANY     = 255
+	dnsTypeA        = 1
+	dnsTypeSOA      = 6
+	dnsTypeAAAA     = 28
+	dnsTypeTSIG     = 250
+	tsigFudge       = 300
+	rfc2136Timeout  = 5 * time.Second
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha256": sha256.New,
+	"hmac-sha512": sha512.New,
+}
+
+var dnsRcodes = map[int]string{
+	1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+	6: "YXDOMAIN", 7: "YXRRSET", 8: "NXRRSET", 9: "NOTAUTH", 10: "NOTZONE",
+}
+
+// rfc2136 通过 UDP 发送带 TSIG 签名的 DNS UPDATE，适用于 BIND、Knot、PowerDNS 等自建服务器。
+type rfc2136 struct {
+	server  string
+	keyName string
+	secret  []byte
+	alg     string
+	now     func() time.Time
+}
+
+func newRFC2136(cfg Config) (*rfc2136, error) {
+	server := strings.TrimSpace(cfg.Server)
+	if server == "" {
+		return nil, fmt.Errorf("%w：缺少 DNS 服务器地址", ErrInvalidConfig)
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	alg := strings.TrimSuffix(strings.ToLower(firstNonEmpty(cfg.TSIGAlgorithm, "hmac-sha256")), ".")
+	if _, ok := tsigAlgorithms[alg]; !ok {
+		return nil, fmt.Errorf("%w：不支持的 TSIG 算法 %q（可用 hmac-sha256、hmac-sha512）", ErrInvalidConfig, alg)
+	}
+	keyName := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(cfg.TSIGName)), ".")
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cfg.TSIGSecret))
+	if keyName == "" || err != nil || len(secret) == 0 {
+		return nil, fmt.Errorf("%w：TSIG 密钥名称或密钥（base64）无效", ErrInvalidConfig)
+	}
+	return &rfc2136{server: server, keyName: keyName, secret: secret, alg: alg, now: time.Now}, nil
+}
+
+// SetRecord 在一个 UPDATE 里删除整个记录集再添加新值，服务器会原子地执行。
+func (p *rfc2136) SetRecord(ctx context.Context, r Record) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	msg, id, err := p.buildUpdate(r)
+	if err != nil {
+		return err
+	}
+	d := net.Dialer{Timeout: rfc2136Timeout}
+	conn, err := d.DialContext(ctx, "udp", p.server)
+	if err != nil {
+		return fmt.Errorf("rfc2136: %w", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(rfc2136Timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	_ = conn.SetDeadline(deadline)
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("rfc2136: %w", err)
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return fmt.Errorf("rfc2136: 等待 %s 响应失败：%w", p.server, err)
+		}
+		if n < 12 || binary.BigEndian.Uint16(buf) != id || buf[2]&0x80 == 0 {
+			continue
+		}
+		if rcode := int(buf[3] & 0x0f); rcode != 0 {
+			name := dnsRcodes[rcode]
+			if name == "" {
+				name = fmt.Sprintf("RCODE %d", rcode)
+			}
+			return fmt.Errorf("rfc2136: 服务器拒绝更新：%s", name)
+		}
+		return nil
+	}
+}
+
+// buildUpdate 生成已签名的 UPDATE 报文，返回报文和事务 ID。
+func (p *rfc2136) buildUpdate(r Record) ([]byte, uint16, error) {
+	rrType := uint16(dnsTypeA)
+	rdata := net.ParseIP(r.Value).To4()
+	if r.Type == "AAAA" {
+		rrType, rdata = dnsTypeAAAA, net.ParseIP(r.Value).To16()
+	}
+	var idb [2]byte
+	if _, err := rand.Read(idb[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idb[:])
+
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsOpcodeUpdate<<11)
+	binary.BigEndian.PutUint16(msg[4:], 1) // ZOCOUNT
+	binary.BigEndian.PutUint16(msg[8:], 2) // UPCOUNT
+
+	var err error
+	// Zone section
+	if msg, err = packName(msg, r.Zone); err != nil {
+		return nil, 0, err
+	}
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeSOA)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	// Update section：删除记录集（CLASS ANY，TTL 0，空 RDATA）
+	if msg, err = packName(msg, r.Name); err != nil {
+		return nil, 0, err
+	}
+	msg = appendRRHeader(msg, rrType, dnsClassANY, 0, nil)
+	// Update section：添加新记录
+	if msg, err = packName(msg, r.Name); err != nil {
+		return nil, 0, err
+	}
+	msg = appendRRHeader(msg, rrType, dnsClassIN, uint32(r.TTL), rdata)
+
+	signed, err := p.sign(msg, id)
+	return signed, id, err
+}
+
+// sign 按 RFC 8945 计算 TSIG 并追加到附加段。
+func (p *rfc2136) sign(msg []byte, id uint16) ([]byte, error) {
+	signedAt := uint64(p.now().Unix())
+	var vars []byte
+	var err error
+	if vars, err = packName(vars, p.keyName); err != nil {
+		return nil, err
+	}
+	vars = binary.BigEndian.AppendUint16(vars, dnsClassANY)
+	vars = binary.BigEndian.AppendUint32(vars, 0)
+	if vars, err = packName(vars, p.alg); err != nil {
+		return nil, err
+	}
+	vars = appendUint48(vars, signedAt)
+	vars = binary.BigEndian.AppendUint16(vars, tsigFudge)
+	vars = binary.BigEndian.AppendUint16(vars, 0) // Error
+	vars = binary.BigEndian.AppendUint16(vars, 0) // Other Len
+
+	mac := hmac.New(tsigAlgorithms[p.alg], p.secret)
+	mac.Write(msg)
+	mac.Write(vars)
+	sum := mac.Sum(nil)
+
+	var rdata []byte
+	if rdata, err = packName(rdata, p.alg); err != nil {
+		return nil, err
+	}
+	rdata = appendUint48(rdata, signedAt)
+	rdata = binary.BigEndian.AppendUint16(rdata, tsigFudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = binary.BigEndian.AppendUint16(rdata, id)
+	rdata = binary.BigEndian.AppendUint16(rdata, 0) // Error
+	rdata = binary.BigEndian.AppendUint16(rdata, 0) // Other Len
+
+	out := append([]byte(nil), msg...)
+	if out, err = packName(out, p.keyName); err != nil {
+		return nil, err
+	}
+	out = appendRRHeader(out, dnsTypeTSIG, dnsClassANY, 0, rdata)
+	binary.BigEndian.PutUint16(out[10:], 1) // ARCOUNT
+	return out, nil
+}
+
+func appendRRHeader(b []byte, typ, class uint16, ttl uint32, rdata []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, typ)
+	b = binary.BigEndian.AppendUint16(b, class)
+	b = binary.BigEndian.AppendUint32(b, ttl)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...)
+}
+
+func appendUint48(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+var errDNSName = errors.New("rfc2136: 域名格式无效")
+
+// packName 以未压缩的线格式写入域名。
+func packName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > 253 {
+		return nil, errDNSName
+	}
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > 63 {
+				return nil, errDNSName
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
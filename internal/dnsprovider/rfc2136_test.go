@@ -0,0 +1,139 @@
+package dnsprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveUpdate 在本地 UDP 端口上接收一条 UPDATE，校验 TSIG 后按 rcode 应答。
+func serveUpdate(t *testing.T, secret []byte, rcode byte) (string, <-chan []byte) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("udp not available:", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	got := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg := append([]byte(nil), buf[:n]...)
+		got <- msg
+		reply := make([]byte, 12)
+		copy(reply, msg[:4])
+		reply[2] |= 0x80
+		reply[3] = rcode
+		if verifyTSIG(msg, "update-key", secret) != nil {
+			reply[3] = 9 // NOTAUTH
+		}
+		_, _ = pc.WriteTo(reply, addr)
+	}()
+	return pc.LocalAddr().String(), got
+}
+
+// verifyTSIG 独立地按 RFC 8945 重新计算 MAC。
+func verifyTSIG(msg []byte, keyName string, secret []byte) error {
+	owner, _ := packName(nil, keyName)
+	marker := append(owner, 0, dnsTypeTSIG, 0, dnsClassANY)
+	start := bytes.LastIndex(msg, marker)
+	if start < 0 || binary.BigEndian.Uint16(msg[10:]) != 1 {
+		return errors.New("no tsig")
+	}
+	unsigned := append([]byte(nil), msg[:start]...)
+	binary.BigEndian.PutUint16(unsigned[10:], 0)
+	rdata := msg[start+len(marker)+6:]
+	alg, _ := packName(nil, "hmac-sha256")
+	if !bytes.HasPrefix(rdata, alg) {
+		return errors.New("bad algorithm")
+	}
+	timeFudge := rdata[len(alg) : len(alg)+8]
+	macLen := int(binary.BigEndian.Uint16(rdata[len(alg)+8:]))
+	mac := rdata[len(alg)+10 : len(alg)+10+macLen]
+
+	h := hmac.New(sha256.New, secret)
+	h.Write(unsigned)
+	h.Write(owner)
+	h.Write([]byte{0, dnsClassANY, 0, 0, 0, 0})
+	h.Write(alg)
+	h.Write(timeFudge)
+	h.Write([]byte{0, 0, 0, 0})
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return errors.New("bad mac")
+	}
+	return nil
+}
+
+func TestRFC2136SetRecord(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	addr, got := serveUpdate(t, secret, 0)
+	p, err := New(KindRFC2136, Config{Server: addr, TSIGName: "update-key.", TSIGSecret: base64.StdEncoding.EncodeToString(secret)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.SetRecord(ctx, Record{Zone: "example.com", Name: "vps.example.com", Type: "A", Value: "203.0.113.9", TTL: 120}); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-got
+	if op := binary.BigEndian.Uint16(msg[2:]) >> 11 & 0xf; op != dnsOpcodeUpdate {
+		t.Fatalf("opcode = %d", op)
+	}
+	if zo, up := binary.BigEndian.Uint16(msg[4:]), binary.BigEndian.Uint16(msg[8:]); zo != 1 || up != 2 {
+		t.Fatalf("counts = %d/%d", zo, up)
+	}
+	zone, _ := packName(nil, "example.com")
+	if !bytes.HasPrefix(msg[12:], zone) {
+		t.Fatalf("zone section = %x", msg[12:40])
+	}
+	add := []byte{0, dnsTypeA, 0, dnsClassIN, 0, 0, 0, 120, 0, 4, 203, 0, 113, 9}
+	if !bytes.Contains(msg, add) {
+		t.Fatalf("add rr missing: %x", msg)
+	}
+}
+
+func TestRFC2136Refused(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	addr, _ := serveUpdate(t, secret, 5)
+	p, _ := New(KindRFC2136, Config{Server: addr, TSIGName: "update-key", TSIGSecret: base64.StdEncoding.EncodeToString(secret)}, nil)
+	err := p.SetRecord(context.Background(), Record{Zone: "example.com", Name: "vps.example.com", Type: "AAAA", Value: "2001:db8::1"})
+	if err == nil || !strings.Contains(err.Error(), "REFUSED") {
+		t.Fatalf("err = %v", err)
+	}
+
+	addr, _ = serveUpdate(t, []byte("another-secret"), 0)
+	p, _ = New(KindRFC2136, Config{Server: addr, TSIGName: "update-key", TSIGSecret: base64.StdEncoding.EncodeToString(secret)}, nil)
+	err = p.SetRecord(context.Background(), Record{Zone: "example.com", Name: "vps.example.com", Type: "A", Value: "203.0.113.9"})
+	if err == nil || !strings.Contains(err.Error(), "NOTAUTH") {
+		t.Fatalf("bad key err = %v", err)
+	}
+}
+
+func TestNewRFC2136Config(t *testing.T) {
+	bad := []Config{
+		{TSIGName: "k", TSIGSecret: "c2VjcmV0"},
+		{Server: "ns1.example.com", TSIGName: "k", TSIGSecret: "not base64!"},
+		{Server: "ns1.example.com", TSIGName: "k", TSIGSecret: "c2VjcmV0", TSIGAlgorithm: "hmac-md5"},
+	}
+	for _, cfg := range bad {
+		if _, err := New(KindRFC2136, cfg, nil); !errors.Is(err, ErrInvalidConfig) {
+			t.Fatalf("New(%+v) err = %v", cfg, err)
+		}
+	}
+	p, err := newRFC2136(Config{Server: "ns1.example.com", TSIGName: "k", TSIGSecret: "c2VjcmV0"})
+	if err != nil || p.server != "ns1.example.com:53" || p.alg != "hmac-sha256" {
+		t.Fatalf("p = %+v, %v", p, err)
+	}
+}
@@ -0,0 +1,98 @@
+package dnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	r53 "github.com/aws/aws-sdk-go-v2/service/route53"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Route53 是全局服务，签名固定使用 us-east-1。
+const route53Region = "us-east-1"
+
+type route53 struct {
+	cli    *r53.Client
+	zoneID string
+}
+
+// newRoute53 创建 Route53 客户端；endpoint 非空时覆盖 API 地址，hc 决定超时与代理。
+func newRoute53(cfg Config, hc *http.Client) *route53 {
+	opts := r53.Options{
+		Region:      route53Region,
+		Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(strings.TrimSpace(cfg.AccessKey), strings.TrimSpace(cfg.SecretKey), "")),
+		HTTPClient:  hc,
+	}
+	if endpoint := strings.TrimRight(strings.TrimSpace(cfg.Endpoint), "/"); endpoint != "" {
+		opts.BaseEndpoint = aws.String(endpoint)
+	}
+	return &route53{
+		cli:    r53.New(opts),
+		zoneID: strings.TrimPrefix(strings.TrimSpace(cfg.HostedZoneID), "/hostedzone/"),
+	}
+}
+
+// route53Error 把批量修改的错误明细展开，其他错误原样包装。
+func route53Error(err error) error {
+	var batch *r53types.InvalidChangeBatch
+	if errors.As(err, &batch) && len(batch.Messages) > 0 {
+		return fmt.Errorf("route53: %s", strings.Join(batch.Messages, "; "))
+	}
+	return fmt.Errorf("route53: %w", err)
+}
+
+// hostedZone 返回配置的托管区域 ID；未配置时按名称查找公有区域。
+func (p *route53) hostedZone(ctx context.Context, zone string) (string, error) {
+	if p.zoneID != "" {
+		return p.zoneID, nil
+	}
+	out, err := p.cli.ListHostedZonesByName(ctx, &r53.ListHostedZonesByNameInput{
+		DNSName:  aws.String(zone + "."),
+		MaxItems: aws.Int32(10),
+	})
+	if err != nil {
+		return "", route53Error(err)
+	}
+	for _, z := range out.HostedZones {
+		private := z.Config != nil && z.Config.PrivateZone
+		if strings.EqualFold(strings.TrimSuffix(aws.ToString(z.Name), "."), zone) && !private {
+			return strings.TrimPrefix(aws.ToString(z.Id), "/hostedzone/"), nil
+		}
+	}
+	return "", fmt.Errorf("route53: 找不到公有托管区域 %s", zone)
+}
+
+// SetRecord 用 UPSERT 覆盖同名同类型的记录集。
+func (p *route53) SetRecord(ctx context.Context, r Record) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	zoneID, err := p.hostedZone(ctx, r.Zone)
+	if err != nil {
+		return err
+	}
+	_, err = p.cli.ChangeResourceRecordSets(ctx, &r53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch: &r53types.ChangeBatch{
+			Comment: aws.String("aws-lightsail-go: instance ip changed"),
+			Changes: []r53types.Change{{
+				Action: r53types.ChangeActionUpsert,
+				ResourceRecordSet: &r53types.ResourceRecordSet{
+					Name:            aws.String(r.Name + "."),
+					Type:            r53types.RRType(r.Type),
+					TTL:             aws.Int64(int64(r.TTL)),
+					ResourceRecords: []r53types.ResourceRecord{{Value: aws.String(r.Value)}},
+				},
+			}},
+		},
+	})
+	if err != nil {
+		return route53Error(err)
+	}
+	return nil
+}
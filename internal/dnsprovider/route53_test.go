@@ -0,0 +1,109 @@
+package dnsprovider
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// r53ChangeRequest 是 ChangeResourceRecordSets 请求体中测试关心的部分。
+type r53ChangeRequest struct {
+	XMLName xml.Name `xml:"ChangeResourceRecordSetsRequest"`
+	Changes []struct {
+		Action string   `xml:"Action"`
+		Name   string   `xml:"ResourceRecordSet>Name"`
+		Type   string   `xml:"ResourceRecordSet>Type"`
+		TTL    int      `xml:"ResourceRecordSet>TTL"`
+		Values []string `xml:"ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+	} `xml:"ChangeBatch>Changes>Change"`
+}
+
+func TestRoute53SetRecord(t *testing.T) {
+	var got r53ChangeRequest
+	var changePath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") || !strings.Contains(auth, "/us-east-1/route53/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `<ErrorResponse><Error><Code>SignatureDoesNotMatch</Code><Message>bad</Message></Error></ErrorResponse>`)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/2013-04-01/hostedzonesbyname":
+			_, _ = io.WriteString(w, `<ListHostedZonesByNameResponse><HostedZones>
+<HostedZone><Id>/hostedzone/ZPRIV</Id><Name>example.com.</Name><Config><PrivateZone>true</PrivateZone></Config></HostedZone>
+<HostedZone><Id>/hostedzone/ZPUB</Id><Name>example.com.</Name><Config><PrivateZone>false</PrivateZone></Config></HostedZone>
+</HostedZones></ListHostedZonesByNameResponse>`)
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/rrset"):
+			changePath = r.URL.Path
+			got = r53ChangeRequest{}
+			body, _ := io.ReadAll(r.Body)
+			if err := xml.Unmarshal(body, &got); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if got.Changes[0].Name == "bad.example.com." {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = io.WriteString(w, `<InvalidChangeBatch><Messages><Message>RRSet of type A with DNS name bad.example.com. is not permitted</Message></Messages></InvalidChangeBatch>`)
+				return
+			}
+			_, _ = io.WriteString(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := New(KindRoute53, Config{AccessKey: "AKIDTEST", SecretKey: "secret", Endpoint: srv.URL}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetRecord(context.Background(), Record{Zone: "example.com", Name: "vps.example.com", Type: "A", Value: "203.0.113.9", TTL: 60}); err != nil {
+		t.Fatal(err)
+	}
+	if changePath != "/2013-04-01/hostedzone/ZPUB/rrset" {
+		t.Fatalf("path = %q", changePath)
+	}
+	c := got.Changes[0]
+	if c.Action != "UPSERT" || c.Name != "vps.example.com." || c.Type != "A" || c.TTL != 60 || len(c.Values) != 1 || c.Values[0] != "203.0.113.9" {
+		t.Fatalf("change = %+v", c)
+	}
+
+	fixed, _ := New(KindRoute53, Config{AccessKey: "AKIDTEST", SecretKey: "secret", HostedZoneID: "/hostedzone/ZFIX", Endpoint: srv.URL}, srv.Client())
+	if err := fixed.SetRecord(context.Background(), Record{Zone: "example.com", Name: "vps.example.com", Type: "A", Value: "203.0.113.9"}); err != nil || changePath != "/2013-04-01/hostedzone/ZFIX/rrset" {
+		t.Fatalf("fixed zone: path = %q, err = %v", changePath, err)
+	}
+	if err := p.SetRecord(context.Background(), Record{Zone: "example.com", Name: "bad.example.com", Type: "A", Value: "203.0.113.9"}); err == nil || !strings.Contains(err.Error(), "not permitted") {
+		t.Fatalf("batch err = %v", err)
+	}
+	other, _ := New(KindRoute53, Config{AccessKey: "OTHER", SecretKey: "secret", Endpoint: srv.URL}, srv.Client())
+	if err := other.SetRecord(context.Background(), Record{Zone: "example.com", Name: "vps.example.com", Type: "A", Value: "203.0.113.9"}); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("auth err = %v", err)
+	}
+}
+
+func TestRoute53UsesProxyClient(t *testing.T) {
+	var host string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		_, _ = io.WriteString(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+	hc := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+
+	p, err := New(KindRoute53, Config{AccessKey: "AKIDTEST", SecretKey: "secret", HostedZoneID: "ZFIX", Endpoint: "http://route53.example.invalid"}, hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetRecord(context.Background(), Record{Zone: "example.com", Name: "vps.example.com", Type: "A", Value: "203.0.113.9"}); err != nil {
+		t.Fatal(err)
+	}
+	if host != "route53.example.invalid" {
+		t.Fatalf("request host via proxy = %q", host)
+	}
+}
@@ -0,0 +1,188 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"aws-lightsail-go/internal/store"
+)
+
+// Handler 执行一个任务；report 用于记录进度步骤（写入 job_steps）。
+type Handler func(ctx context.Context, job *store.Job, report func(step string)) error
+
+// DefaultTimeout 是单个任务的最长执行时间。
+const DefaultTimeout = 20 * time.Minute
+
+// maxRecoverAttempts 是可恢复任务最多被领取的次数；每次重启都中断的任务（如执行时导致进程崩溃）不再重新排队。
+const maxRecoverAttempts = 3
+
+type kindSpec struct {
+	handler   Handler
+	resumable bool
+}
+
+// Runner 从 jobs 表领取任务并用固定数量的 worker 执行。
+type Runner struct {
+	st       *store.Store
+	workers  int
+	timeout  time.Duration
+	mu       sync.RWMutex
+	kinds    map[string]kindSpec
+	wake     chan struct{}
+	onFinish func(job *store.Job, err error)
+}
+
+func NewRunner(st *store.Store, workers int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Runner{
+		st:      st,
+		workers: workers,
+		timeout: DefaultTimeout,
+		kinds:   map[string]kindSpec{},
+		wake:    make(chan struct{}, workers),
+	}
+}
+
+// Register 注册任务类型。resumable 表示进程重启时中断的任务可以安全地重新执行（最多领取 maxRecoverAttempts 次），否则会被标记为失败。
+func (r *Runner) Register(kind string, resumable bool, h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[kind] = kindSpec{handler: h, resumable: resumable}
+}
+
+// OnFinish 设置任务结束（成功或失败）后的回调。
+func (r *Runner) OnFinish(fn func(job *store.Job, err error)) {
+	r.onFinish = fn
+}
+
+func (r *Runner) Enqueue(ctx context.Context, job store.Job) (int64, error) {
+	r.mu.RLock()
+	_, ok := r.kinds[job.Kind]
+	r.mu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("unknown job kind: %s", job.Kind)
+	}
+	id, err := r.st.CreateJob(ctx, job)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// Start 先处理上次退出时遗留的 running 任务，然后启动 worker；ctx 取消后 worker 退出。
+func (r *Runner) Start(ctx context.Context) error {
+	if err := r.recover(ctx); err != nil {
+		return err
+	}
+	for i := 0; i < r.workers; i++ {
+		go r.loop(ctx)
+	}
+	return nil
+}
+
+func (r *Runner) recover(ctx context.Context) error {
+	stale, err := r.st.ListJobsByStatus(ctx, store.JobRunning)
+	if err != nil {
+		return err
+	}
+	for _, job := range stale {
+		r.mu.RLock()
+		spec, ok := r.kinds[job.Kind]
+		r.mu.RUnlock()
+		if ok && spec.resumable && job.Attempts < maxRecoverAttempts {
+			_ = r.st.AddJobStep(ctx, job.ID, "服务重启，任务重新排队")
+			if err := r.st.RequeueJob(ctx, job.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		errText := "服务重启时任务仍在执行，已中断，请检查资源状态后重试"
+		if ok && spec.resumable {
+			errText = fmt.Sprintf("任务已执行 %d 次仍被服务重启中断，不再重新排队，请检查资源状态后重试", job.Attempts)
+		}
+		_ = r.st.AddJobStep(ctx, job.ID, "服务重启，任务中断")
+		if err := r.st.FinishJob(ctx, job.ID, store.JobFailed, errText); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) loop(ctx context.Context) {
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+	for {
+		for {
+			job, err := r.st.ClaimNextJob(ctx)
+			if err != nil {
+				log.Printf("claim job failed: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			r.run(ctx, job)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) run(parent context.Context, job *store.Job) {
+	r.mu.RLock()
+	spec, ok := r.kinds[job.Kind]
+	r.mu.RUnlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("unknown job kind: %s", job.Kind)
+	} else {
+		ctx, cancel := context.WithTimeout(parent, r.timeout)
+		report := func(step string) {
+			if e := r.st.AddJobStep(context.Background(), job.ID, step); e != nil {
+				log.Printf("job %d: record step failed: %v", job.ID, e)
+			}
+		}
+		err = safeCall(ctx, spec.handler, job, report)
+		cancel()
+	}
+
+	// 进程退出导致的取消保持 running，下次启动时由 recover 处理
+	if parent.Err() != nil {
+		return
+	}
+	status, errText := store.JobSucceeded, ""
+	if err != nil {
+		status, errText = store.JobFailed, err.Error()
+	}
+	if e := r.st.FinishJob(context.Background(), job.ID, status, errText); e != nil {
+		log.Printf("job %d: finish failed: %v", job.ID, e)
+	}
+	job.Status, job.Error = status, errText
+	if r.onFinish != nil {
+		r.onFinish(job, err)
+	}
+}
+
+func safeCall(ctx context.Context, h Handler, job *store.Job, report func(string)) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New(fmt.Sprint("任务异常：", p))
+		}
+	}()
+	return h(ctx, job, report)
+}
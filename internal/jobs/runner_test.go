@@ -0,0 +1,263 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aws-lightsail-go/internal/store"
+)
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	st, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	return st
+}
+
+func noop(ctx context.Context, job *store.Job, report func(string)) error { return nil }
+
+func jobSteps(t *testing.T, st *store.Store, id int64) []string {
+	t.Helper()
+	steps, err := st.ListJobSteps(context.Background(), id)
+	if err != nil {
+		t.Fatalf("ListJobSteps(%d): %v", id, err)
+	}
+	var out []string
+	for _, s := range steps {
+		out = append(out, s.Message)
+	}
+	return out
+}
+
+func waitJobsDone(t *testing.T, st *store.Store, ids ...int64) map[int64]*store.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	out := map[int64]*store.Job{}
+	for _, id := range ids {
+		for {
+			job, err := st.GetJob(context.Background(), id)
+			if err != nil {
+				t.Fatalf("GetJob(%d): %v", id, err)
+			}
+			if job.Done() {
+				out[id] = job
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("job %d still %s", id, job.Status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return out
+}
+
+func TestRunnerRecover(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	r := NewRunner(st, 1)
+	r.Register("resumable", true, noop)
+	r.Register("once", false, noop)
+
+	var ids []int64
+	for _, kind := range []string{"resumable", "once", "gone"} {
+		id, err := st.CreateJob(ctx, store.Job{UserID: 1, Kind: kind})
+		if err != nil {
+			t.Fatalf("CreateJob(%s): %v", kind, err)
+		}
+		ids = append(ids, id)
+	}
+	queued, err := st.CreateJob(ctx, store.Job{UserID: 1, Kind: "once"})
+	if err != nil {
+		t.Fatalf("CreateJob(queued): %v", err)
+	}
+	// 模拟上次进程退出时前三个任务正在执行
+	for range ids {
+		if job, err := st.ClaimNextJob(ctx); err != nil || job == nil {
+			t.Fatalf("ClaimNextJob = %+v, %v", job, err)
+		}
+	}
+
+	if err := r.recover(ctx); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+
+	want := []struct {
+		status string
+		step   string
+	}{
+		{store.JobQueued, "服务重启，任务重新排队"},
+		{store.JobFailed, "服务重启，任务中断"},
+		{store.JobFailed, "服务重启，任务中断"},
+	}
+	for i, id := range ids {
+		job, _ := st.GetJob(ctx, id)
+		if job.Status != want[i].status {
+			t.Fatalf("job %s status = %s, want %s", job.Kind, job.Status, want[i].status)
+		}
+		if job.Status == store.JobFailed && (job.Error == "" || job.FinishedAt.IsZero()) {
+			t.Fatalf("job %s failed without error/finished_at: %+v", job.Kind, job)
+		}
+		if steps := jobSteps(t, st, id); len(steps) != 1 || steps[0] != want[i].step {
+			t.Fatalf("job %s steps = %q", job.Kind, steps)
+		}
+	}
+	if job, _ := st.GetJob(ctx, queued); job.Status != store.JobQueued || len(jobSteps(t, st, queued)) != 0 {
+		t.Fatalf("queued job touched by recover: %+v", job)
+	}
+
+	// 重新排队的任务会被再次领取
+	job, err := st.ClaimNextJob(ctx)
+	if err != nil || job == nil || job.ID != ids[0] || job.Attempts != 2 {
+		t.Fatalf("ClaimNextJob after recover = %+v, %v", job, err)
+	}
+}
+
+func TestRunnerRunsEachJobOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := newTestStore(t)
+	r := NewRunner(st, 4)
+
+	var (
+		mu       sync.Mutex
+		calls    = map[int64]int{}
+		finished = map[int64]string{}
+	)
+	r.Register("ok", false, func(ctx context.Context, job *store.Job, report func(string)) error {
+		mu.Lock()
+		calls[job.ID]++
+		mu.Unlock()
+		report("第一步")
+		report("第二步 " + job.Target)
+		return nil
+	})
+	r.Register("fail", false, func(ctx context.Context, job *store.Job, report func(string)) error {
+		return errors.New("boom")
+	})
+	r.Register("panic", false, func(ctx context.Context, job *store.Job, report func(string)) error {
+		panic("bad")
+	})
+	r.OnFinish(func(job *store.Job, err error) {
+		mu.Lock()
+		finished[job.ID] = job.Status
+		mu.Unlock()
+	})
+
+	if _, err := r.Enqueue(ctx, store.Job{UserID: 1, Kind: "unknown"}); err == nil {
+		t.Fatalf("Enqueue(unknown kind) should fail")
+	}
+
+	var okIDs []int64
+	for i := 0; i < 20; i++ {
+		id, err := r.Enqueue(ctx, store.Job{UserID: 1, Kind: "ok", Target: "vps"})
+		if err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+		okIDs = append(okIDs, id)
+	}
+	failID, err := r.Enqueue(ctx, store.Job{UserID: 1, Kind: "fail"})
+	if err != nil {
+		t.Fatalf("Enqueue(fail): %v", err)
+	}
+	panicID, err := r.Enqueue(ctx, store.Job{UserID: 1, Kind: "panic"})
+	if err != nil {
+		t.Fatalf("Enqueue(panic): %v", err)
+	}
+
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	done := waitJobsDone(t, st, append(okIDs, failID, panicID)...)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range okIDs {
+		job := done[id]
+		if job.Status != store.JobSucceeded || job.Error != "" || job.Attempts != 1 || calls[id] != 1 {
+			t.Fatalf("job %d = %+v, calls %d", id, job, calls[id])
+		}
+		if steps := jobSteps(t, st, id); len(steps) != 2 || steps[0] != "第一步" || steps[1] != "第二步 vps" {
+			t.Fatalf("job %d steps = %q", id, steps)
+		}
+		if finished[id] != store.JobSucceeded {
+			t.Fatalf("OnFinish(%d) = %q", id, finished[id])
+		}
+	}
+	if job := done[failID]; job.Status != store.JobFailed || job.Error != "boom" || finished[failID] != store.JobFailed {
+		t.Fatalf("fail job = %+v, OnFinish %q", job, finished[failID])
+	}
+	if job := done[panicID]; job.Status != store.JobFailed || !strings.Contains(job.Error, "bad") {
+		t.Fatalf("panic job = %+v", job)
+	}
+}
+
+func TestRunnerShutdownLeavesJobRunning(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	r := NewRunner(st, 1)
+	finished := false
+	r.OnFinish(func(*store.Job, error) { finished = true })
+	r.Register("slow", true, func(ctx context.Context, job *store.Job, report func(string)) error {
+		report("开始")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if _, err := r.Enqueue(ctx, store.Job{UserID: 1, Kind: "slow"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	job, err := st.ClaimNextJob(ctx)
+	if err != nil || job == nil {
+		t.Fatalf("ClaimNextJob = %+v, %v", job, err)
+	}
+
+	parent, cancel := context.WithCancel(ctx)
+	cancel()
+	r.run(parent, job)
+
+	// 进程退出导致的取消不结束任务，留给下次启动的 recover 重新排队
+	got, _ := st.GetJob(ctx, job.ID)
+	if got.Status != store.JobRunning || finished {
+		t.Fatalf("job after shutdown = %+v, OnFinish called %v", got, finished)
+	}
+	if err := r.recover(ctx); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if got, _ := st.GetJob(ctx, job.ID); got.Status != store.JobQueued {
+		t.Fatalf("job after recover = %+v", got)
+	}
+}
+
+func TestRunnerRecoverGivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	r := NewRunner(st, 1)
+	r.Register("crash", true, noop)
+	id, err := r.Enqueue(ctx, store.Job{UserID: 1, Kind: "crash"})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	// 每次领取后进程都退出，任务停在 running
+	for i := 1; i <= maxRecoverAttempts; i++ {
+		if job, err := st.ClaimNextJob(ctx); err != nil || job == nil || job.Attempts != i {
+			t.Fatalf("ClaimNextJob #%d = %+v, %v", i, job, err)
+		}
+		if err := r.recover(ctx); err != nil {
+			t.Fatalf("recover: %v", err)
+		}
+	}
+	job, _ := st.GetJob(ctx, id)
+	if job.Status != store.JobFailed || job.Error == "" {
+		t.Fatalf("job after %d interrupted runs = %+v", maxRecoverAttempts, job)
+	}
+	if steps := jobSteps(t, st, id); len(steps) != maxRecoverAttempts || steps[len(steps)-1] != "服务重启，任务中断" {
+		t.Fatalf("steps = %q", steps)
+	}
+}
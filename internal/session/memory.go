@@ -0,0 +1,101 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryBackend 把会话保存在进程内，重启后全部失效。
+type MemoryBackend struct {
+	mu sync.RWMutex
+	m  map[string]Record
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{m: map[string]Record{}}
+}
+
+func copyData(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func (b *MemoryBackend) Load(_ context.Context, id string) (*Record, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	rec, ok := b.m[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rec.Data = copyData(rec.Data)
+	return &rec, nil
+}
+
+func (b *MemoryBackend) Save(_ context.Context, rec *Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stored := *rec
+	stored.Data = copyData(rec.Data)
+	b.m[rec.ID] = stored
+	return nil
+}
+
+func (b *MemoryBackend) Touch(_ context.Context, id string, at time.Time, ip string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if rec, ok := b.m[id]; ok {
+		rec.LastSeen = at
+		rec.IP = ip
+		b.m[id] = rec
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Delete(_ context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.m, id)
+	return nil
+}
+
+func (b *MemoryBackend) ListByUser(_ context.Context, userID int64) ([]Info, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var out []Info
+	for _, rec := range b.m {
+		if rec.UserID == userID {
+			out = append(out, rec.Info)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out, nil
+}
+
+func (b *MemoryBackend) DeleteByUser(_ context.Context, userID int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for id, rec := range b.m {
+		if rec.UserID == userID {
+			delete(b.m, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (b *MemoryBackend) DeleteExpired(_ context.Context, before time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, rec := range b.m {
+		if rec.LastSeen.Before(before) {
+			delete(b.m, id)
+		}
+	}
+	return nil
+}
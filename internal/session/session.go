@@ -1,16 +1,44 @@
 package session
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+var ErrNotFound = errors.New("session not found")
+
+// touchInterval 内重复访问不更新 last_seen，避免每个请求都写后端。
+const touchInterval = time.Minute
+
 type Session struct {
 	mu         sync.RWMutex
+	id         string // sid 的哈希；为空表示不持久化的临时会话
 	m          map[string]string
+	dirty      map[string]bool
+	createdAt  time.Time
 	lastAccess time.Time
+	lastSaved  time.Time
+	ip         string
+	userAgent  string
+}
+
+// New 返回一个不属于任何 Store 的会话，用于只在单个请求内有效的身份（如 API token）。
+func New() *Session {
+	now := time.Now()
+	return &Session{m: map[string]string{}, dirty: map[string]bool{}, createdAt: now, lastAccess: now}
+}
+
+// ID 返回会话在后端中的标识（cookie 中 sid 的哈希），临时会话为空。
+func (s *Session) ID() string {
+	return s.id
 }
 
 func (s *Session) GetString(key, def string) string {
@@ -26,6 +54,9 @@ func (s *Session) GetString(key, def string) string {
 
 func (s *Session) SetString(key, val string) {
 	s.mu.Lock()
+	if old, ok := s.m[key]; !ok || old != val {
+		s.dirty[key] = true
+	}
 	s.m[key] = val
 	s.lastAccess = time.Now()
 	s.mu.Unlock()
@@ -43,52 +74,174 @@ func (s *Session) LastAccess() time.Time {
 	return s.lastAccess
 }
 
+// Info 是会话的元信息，用于列出与吊销。
+type Info struct {
+	ID        string
+	UserID    int64
+	CreatedAt time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+}
+
+type Record struct {
+	Info
+	Data map[string]string
+}
+
+// Backend 持久化会话。ID 均为 sid 的哈希，后端不接触明文 sid。
+type Backend interface {
+	// Load 找不到时返回 ErrNotFound。
+	Load(ctx context.Context, id string) (*Record, error)
+	Save(ctx context.Context, rec *Record) error
+	Touch(ctx context.Context, id string, at time.Time, ip string) error
+	Delete(ctx context.Context, id string) error
+	ListByUser(ctx context.Context, userID int64) ([]Info, error)
+	DeleteByUser(ctx context.Context, userID int64) (int, error)
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
 type Store struct {
-	mu              sync.RWMutex
-	m               map[string]*Session
+	backend         Backend
 	ttl             time.Duration
 	cleanupInterval time.Duration
 }
 
-func NewStore() *Store {
+func NewStore(backend Backend, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = 30 * time.Minute
+	}
 	st := &Store{
-		m:               map[string]*Session{},
-		ttl:             30 * time.Minute,
+		backend:         backend,
+		ttl:             ttl,
 		cleanupInterval: 5 * time.Minute,
 	}
 	go st.cleanupLoop()
 	return st
 }
 
-func (st *Store) GetOrCreate(id string) *Session {
-	st.mu.Lock()
-	defer st.mu.Unlock()
-	if s, ok := st.m[id]; ok {
-		s.touch()
-		return s
+func hashID(sid string) string {
+	sum := sha256.Sum256([]byte(sid))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load 读取 sid 对应的会话；不存在或已过期时返回新会话（第一次 Save 时才写入后端）。
+func (st *Store) Load(ctx context.Context, sid, ip, userAgent string) (*Session, error) {
+	id := hashID(sid)
+	now := time.Now()
+	rec, err := st.backend.Load(ctx, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if rec != nil && rec.LastSeen.Before(now.Add(-st.ttl)) {
+		_ = st.backend.Delete(ctx, id)
+		rec = nil
+	}
+	s := New()
+	s.id = id
+	s.ip = ip
+	s.userAgent = userAgent
+	if rec == nil {
+		return s, nil
 	}
-	s := &Session{m: map[string]string{}, lastAccess: time.Now()}
-	st.m[id] = s
-	return s
+	for k, v := range rec.Data {
+		s.m[k] = v
+	}
+	s.createdAt = rec.CreatedAt
+	s.lastSaved = rec.LastSeen
+	return s, nil
 }
 
-func (st *Store) cleanupLoop() {
-	ticker := time.NewTicker(st.cleanupInterval)
-	defer ticker.Stop()
-	for range ticker.C {
-		st.cleanupExpired()
+// Save 写回本次请求修改过的字段；只读请求按 touchInterval 更新最近访问时间。
+func (st *Store) Save(ctx context.Context, s *Session) error {
+	if s == nil || s.id == "" {
+		return nil
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if len(s.dirty) == 0 {
+		if s.lastSaved.IsZero() || now.Sub(s.lastSaved) < touchInterval {
+			return nil
+		}
+		if err := st.backend.Touch(ctx, s.id, now, s.ip); err != nil {
+			return err
+		}
+		s.lastSaved = now
+		return nil
+	}
+
+	// 与后端最新数据合并，避免同一会话的并发请求互相覆盖未修改的字段
+	data := map[string]string{}
+	if rec, err := st.backend.Load(ctx, s.id); err == nil {
+		for k, v := range rec.Data {
+			data[k] = v
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	for k := range s.dirty {
+		data[k] = s.m[k]
+	}
+	userID, _ := strconv.ParseInt(strings.TrimSpace(data["user_id"]), 10, 64)
+	rec := &Record{
+		Info: Info{
+			ID:        s.id,
+			UserID:    userID,
+			CreatedAt: s.createdAt,
+			LastSeen:  now,
+			IP:        s.ip,
+			UserAgent: s.userAgent,
+		},
+		Data: data,
+	}
+	if err := st.backend.Save(ctx, rec); err != nil {
+		return err
+	}
+	s.dirty = map[string]bool{}
+	s.lastSaved = now
+	return nil
 }
 
-func (st *Store) cleanupExpired() {
-	expiredBefore := time.Now().Add(-st.ttl)
-	st.mu.Lock()
-	defer st.mu.Unlock()
-	for id, sess := range st.m {
-		if sess.LastAccess().Before(expiredBefore) {
-			delete(st.m, id)
+// ListUser 列出用户未过期的会话。
+func (st *Store) ListUser(ctx context.Context, userID int64) ([]Info, error) {
+	list, err := st.backend.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-st.ttl)
+	out := list[:0]
+	for _, info := range list {
+		if info.LastSeen.After(cutoff) {
+			out = append(out, info)
 		}
 	}
+	return out, nil
+}
+
+// Revoke 删除属于 userID 的某个会话。
+func (st *Store) Revoke(ctx context.Context, userID int64, id string) error {
+	rec, err := st.backend.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rec.UserID != userID {
+		return ErrNotFound
+	}
+	return st.backend.Delete(ctx, id)
+}
+
+// RevokeUser 删除用户的全部会话（强制下线）。
+func (st *Store) RevokeUser(ctx context.Context, userID int64) (int, error) {
+	return st.backend.DeleteByUser(ctx, userID)
+}
+
+func (st *Store) cleanupLoop() {
+	ticker := time.NewTicker(st.cleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_ = st.backend.DeleteExpired(context.Background(), time.Now().Add(-st.ttl))
+	}
 }
 
 func Must(c *gin.Context) *Session {
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreLifecycle(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	st := &Store{backend: backend, ttl: time.Hour}
+
+	s, err := st.Load(ctx, "sid-a", "1.2.3.4", "ua")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	// 未修改的新会话不写入后端
+	if err := st.Save(ctx, s); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := backend.Load(ctx, s.ID()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("untouched session persisted, err = %v", err)
+	}
+
+	s.SetString("user_id", "7")
+	s.SetString("key_id", "3")
+	if err := st.Save(ctx, s); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	again, err := st.Load(ctx, "sid-a", "1.2.3.4", "ua")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := again.GetString("key_id", ""); got != "3" {
+		t.Fatalf("key_id = %q, want 3", got)
+	}
+	list, err := st.ListUser(ctx, 7)
+	if err != nil || len(list) != 1 || list[0].IP != "1.2.3.4" {
+		t.Fatalf("ListUser = %+v, %v", list, err)
+	}
+
+	if err := st.Revoke(ctx, 8, s.ID()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Revoke(other user) err = %v, want ErrNotFound", err)
+	}
+	if n, err := st.RevokeUser(ctx, 7); err != nil || n != 1 {
+		t.Fatalf("RevokeUser = %d, %v", n, err)
+	}
+	gone, _ := st.Load(ctx, "sid-a", "", "")
+	if gone.GetString("user_id", "") != "" {
+		t.Fatalf("revoked session still logged in")
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	st := &Store{backend: backend, ttl: time.Minute}
+	rec := &Record{Info: Info{ID: hashID("old"), UserID: 1, LastSeen: time.Now().Add(-time.Hour)}, Data: map[string]string{"user_id": "1"}}
+	if err := backend.Save(ctx, rec); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	s, err := st.Load(ctx, "old", "", "")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if s.GetString("user_id", "") != "" {
+		t.Fatalf("expired session restored")
+	}
+	if _, err := backend.Load(ctx, rec.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expired session not deleted, err = %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPresetNotFound = errors.New("ami preset not found")
+	ErrPresetExists   = errors.New("ami preset already exists")
+)
+
+// AMIPreset 是用户在某个区域保存的自定义 AMI。AMI ID 只在所属区域有效。
+type AMIPreset struct {
+	ID           int64
+	UserID       int64
+	Region       string
+	Name         string
+	AMIID        string
+	Architecture string
+	CreatedAt    time.Time
+}
+
+func (s *Store) CreateAMIPreset(ctx context.Context, p *AMIPreset) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.AMIID = strings.TrimSpace(p.AMIID)
+	if p.Name == "" {
+		p.Name = p.AMIID
+	}
+	p.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO ami_presets (user_id, region, name, ami_id, architecture, created_at) VALUES (?, ?, ?, ?, ?, ?);`,
+		p.UserID, p.Region, p.Name, p.AMIID, p.Architecture, p.CreatedAt.Format(timeLayout))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return ErrPresetExists
+		}
+		return err
+	}
+	p.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListAMIPresets 列出用户在 region 下的预设；region 为空时列出全部区域。
+func (s *Store) ListAMIPresets(ctx context.Context, userID int64, region string) ([]AMIPreset, error) {
+	query := `SELECT id, user_id, region, name, ami_id, architecture, created_at FROM ami_presets WHERE user_id = ?`
+	args := []any{userID}
+	if region != "" {
+		query += ` AND region = ?`
+		args = append(args, region)
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY region, name;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AMIPreset
+	for rows.Next() {
+		var (
+			p       AMIPreset
+			created string
+		)
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Region, &p.Name, &p.AMIID, &p.Architecture, &created); err != nil {
+			return nil, err
+		}
+		p.CreatedAt = parseTime(created)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) DeleteAMIPreset(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM ami_presets WHERE id = ? AND user_id = ?;`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPresetNotFound
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+type AuditEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	UserID    int64
+	Username  string
+	KeyID     int64
+	Service   string
+	Region    string
+	Instance  string
+	Action    string
+	Params    string
+	Result    string
+	Error     string
+	ClientIP  string
+}
+
+type AuditFilter struct {
+	UserID   int64
+	Username string
+	Action   string
+	Service  string
+	Region   string
+	Instance string
+	Result   string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+	Offset   int
+}
+
+func (s *Store) RecordAudit(ctx context.Context, e AuditEvent) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO audit_events (created_at, user_id, username, key_id, service, region, instance, action, params, result, error, client_ip) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		e.CreatedAt.UTC().Format(timeLayout), e.UserID, e.Username, e.KeyID, e.Service, e.Region, e.Instance, e.Action, e.Params, e.Result, e.Error, e.ClientIP)
+	return err
+}
+
+// ListAuditEvents 按时间倒序返回匹配的事件以及匹配总数（用于分页）。
+func (s *Store) ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, int, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.UserID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if v := strings.TrimSpace(f.Username); v != "" {
+		where = append(where, "username = ?")
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(f.Action); v != "" {
+		where = append(where, "action LIKE ?")
+		args = append(args, "%"+v+"%")
+	}
+	if v := strings.TrimSpace(f.Service); v != "" {
+		where = append(where, "service = ?")
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(f.Region); v != "" {
+		where = append(where, "region = ?")
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(f.Instance); v != "" {
+		where = append(where, "instance LIKE ?")
+		args = append(args, "%"+v+"%")
+	}
+	if v := strings.TrimSpace(f.Result); v != "" {
+		where = append(where, "result = ?")
+		args = append(args, v)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.Since.UTC().Format(timeLayout))
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.Until.UTC().Format(timeLayout))
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM audit_events`+cond+`;`, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	offset := f.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, created_at, user_id, username, key_id, service, region, instance, action, params, result, error, client_ip FROM audit_events`+cond+` ORDER BY id DESC LIMIT ? OFFSET ?;`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var out []AuditEvent
+	for rows.Next() {
+		var (
+			e            AuditEvent
+			createdAtRaw string
+		)
+		if err := rows.Scan(&e.ID, &createdAtRaw, &e.UserID, &e.Username, &e.KeyID, &e.Service, &e.Region, &e.Instance, &e.Action, &e.Params, &e.Result, &e.Error, &e.ClientIP); err != nil {
+			return nil, 0, err
+		}
+		e.CreatedAt = parseTime(createdAtRaw)
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+func parseTime(raw string) time.Time {
+	for _, layout := range []string{timeLayout, time.RFC3339Nano, "2006-01-02T15:04:05Z"} {
+		if t, err := time.ParseInLocation(layout, raw, time.UTC); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
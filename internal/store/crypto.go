@@ -0,0 +1,222 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 密文格式：enc:v1:<master key id>:<被 master key 包裹的数据密钥>:<被数据密钥加密的明文>
+// 每个字段单独生成数据密钥（envelope encryption），轮换 master key 时只需重新包裹数据密钥。
+const encPrefix = "enc:v1:"
+
+const masterKeyLen = 32
+
+var ErrNoKeyring = errors.New("master key not configured")
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring 持有当前 master key（用于加密）以及旧 master key（仅用于解密，便于不停机轮换）。
+type Keyring struct {
+	primary  masterKey
+	previous []masterKey
+}
+
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	p, err := newMasterKey(primary)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{primary: p}
+	for _, raw := range previous {
+		mk, err := newMasterKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		if mk.id == p.id {
+			continue
+		}
+		k.previous = append(k.previous, mk)
+	}
+	return k, nil
+}
+
+func newMasterKey(raw []byte) (masterKey, error) {
+	if len(raw) != masterKeyLen {
+		return masterKey{}, fmt.Errorf("master key must be %d bytes, got %d", masterKeyLen, len(raw))
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return masterKey{}, err
+	}
+	sum := sha256.Sum256(raw)
+	return masterKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// ParseMasterKey 接受 base64 或 hex 编码的 32 字节密钥。
+func ParseMasterKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("empty master key")
+	}
+	if b, err := hex.DecodeString(s); err == nil && len(b) == masterKeyLen {
+		return b, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil && len(b) == masterKeyLen {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("master key must be %d bytes encoded as base64 or hex", masterKeyLen)
+}
+
+// GenerateMasterKey 返回 base64 编码的随机 master key。
+func GenerateMasterKey() (string, error) {
+	b := make([]byte, masterKeyLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (k *Keyring) PrimaryID() string {
+	return k.primary.id
+}
+
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	dek := make([]byte, masterKeyLen)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	body, err := seal(dataAEAD, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.primary.aead, dek)
+	if err != nil {
+		return "", err
+	}
+	return encPrefix + k.primary.id + ":" + b64(wrapped) + ":" + b64(body), nil
+}
+
+func (k *Keyring) Decrypt(val string) (string, error) {
+	if !isEncrypted(val) {
+		return val, nil
+	}
+	kid, wrapped, body, err := splitEnvelope(val)
+	if err != nil {
+		return "", err
+	}
+	dek, err := k.unwrap(kid, wrapped)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(dataAEAD, body)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+// Rewrap 用当前 master key 重新包裹数据密钥，密文主体不变。
+func (k *Keyring) Rewrap(val string) (string, bool, error) {
+	if !isEncrypted(val) {
+		out, err := k.Encrypt(val)
+		return out, true, err
+	}
+	kid, wrapped, body, err := splitEnvelope(val)
+	if err != nil {
+		return "", false, err
+	}
+	if kid == k.primary.id {
+		return val, false, nil
+	}
+	dek, err := k.unwrap(kid, wrapped)
+	if err != nil {
+		return "", false, err
+	}
+	rewrapped, err := seal(k.primary.aead, dek)
+	if err != nil {
+		return "", false, err
+	}
+	return encPrefix + k.primary.id + ":" + b64(rewrapped) + ":" + b64(body), true, nil
+}
+
+func (k *Keyring) unwrap(kid string, wrapped []byte) ([]byte, error) {
+	for _, mk := range append([]masterKey{k.primary}, k.previous...) {
+		if mk.id != kid {
+			continue
+		}
+		dek, err := open(mk.aead, wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap data key: %w", err)
+		}
+		return dek, nil
+	}
+	return nil, fmt.Errorf("unknown master key id %q", kid)
+}
+
+func isEncrypted(val string) bool {
+	return strings.HasPrefix(val, encPrefix)
+}
+
+func splitEnvelope(val string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(val, encPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	body, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	return parts[0], wrapped, body, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ct := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ct, nil)
+}
+
+func b64(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
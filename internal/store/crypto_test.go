@@ -0,0 +1,81 @@
+package store
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestKeyringRoundTrip(t *testing.T) {
+	k, err := NewKeyring(bytes.Repeat([]byte{1}, masterKeyLen))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	enc, err := k.Encrypt("secret-value")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !strings.HasPrefix(enc, encPrefix) || strings.Contains(enc, "secret-value") {
+		t.Fatalf("Encrypt() = %q, want opaque envelope", enc)
+	}
+	got, err := k.Decrypt(enc)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if got != "secret-value" {
+		t.Fatalf("Decrypt() = %q, want %q", got, "secret-value")
+	}
+	if got, _ := k.Decrypt("plain"); got != "plain" {
+		t.Fatalf("Decrypt(plain) = %q, want passthrough", got)
+	}
+}
+
+func TestKeyringRewrap(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, masterKeyLen)
+	newKey := bytes.Repeat([]byte{2}, masterKeyLen)
+	oldRing, _ := NewKeyring(oldKey)
+	enc, err := oldRing.Encrypt("secret-value")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	newOnly, _ := NewKeyring(newKey)
+	if _, err := newOnly.Decrypt(enc); err == nil {
+		t.Fatalf("Decrypt with unrelated key succeeded")
+	}
+
+	rotating, _ := NewKeyring(newKey, oldKey)
+	rewrapped, changed, err := rotating.Rewrap(enc)
+	if err != nil || !changed {
+		t.Fatalf("Rewrap() changed=%v err=%v", changed, err)
+	}
+	got, err := newOnly.Decrypt(rewrapped)
+	if err != nil || got != "secret-value" {
+		t.Fatalf("Decrypt(rewrapped) = %q, %v", got, err)
+	}
+	if _, changed, _ := rotating.Rewrap(rewrapped); changed {
+		t.Fatalf("Rewrap() of current value reported change")
+	}
+}
+
+func TestParseMasterKey(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{name: "base64", in: "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=", wantErr: false},
+		{name: "hex", in: strings.Repeat("01", masterKeyLen), wantErr: false},
+		{name: "short", in: "AQEB", wantErr: true},
+		{name: "empty", in: " ", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseMasterKey(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseMasterKey(%q) err = %v, wantErr %v", tc.in, err, tc.wantErr)
+			}
+		})
+	}
+}
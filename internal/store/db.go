@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"strings"
 	"time"
 
@@ -14,8 +13,9 @@ import (
 )
 
 type Store struct {
-	path string
-	db   *sql.DB
+	path    string
+	db      *sql.DB
+	keyring *Keyring
 }
 
 type User struct {
@@ -41,7 +41,14 @@ type Key struct {
 }
 
 func NewSQLiteStore(path string) (*Store, error) {
-	db, err := sql.Open("sqlite", path)
+	// 后台任务与请求会并发写库，等待锁释放而不是立即返回 SQLITE_BUSY
+	dsn := path
+	if strings.Contains(dsn, "?") {
+		dsn += "&_pragma=busy_timeout(5000)"
+	} else {
+		dsn += "?_pragma=busy_timeout(5000)"
+	}
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -50,134 +57,13 @@ func NewSQLiteStore(path string) (*Store, error) {
 		return nil, err
 	}
 	s := &Store{path: path, db: db}
-	if err := s.initSchema(context.Background()); err != nil {
+	if err := s.migrate(context.Background()); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
 	return s, nil
 }
 
-func (s *Store) initSchema(ctx context.Context) error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT NOT NULL UNIQUE,
-			password_hash TEXT NOT NULL,
-			is_admin INTEGER NOT NULL DEFAULT 0,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);`,
-		`CREATE TABLE IF NOT EXISTS settings (
-			key TEXT PRIMARY KEY,
-			value TEXT NOT NULL
-		);`,
-		`CREATE TABLE IF NOT EXISTS api_keys (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			name TEXT NOT NULL,
-			access_key TEXT NOT NULL,
-			secret_key TEXT NOT NULL,
-			proxy TEXT NOT NULL DEFAULT '',
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-		);`,
-		`CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);`,
-	}
-	for _, q := range queries {
-		if _, err := s.db.ExecContext(ctx, q); err != nil {
-			return err
-		}
-	}
-	if err := s.ensureAPIKeyColumns(ctx); err != nil {
-		return err
-	}
-	if err := s.ensureUserColumns(ctx); err != nil {
-		return err
-	}
-	if err := s.ensureSettingsDefaults(ctx); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (s *Store) ensureUserColumns(ctx context.Context) error {
-	rows, err := s.db.QueryContext(ctx, `PRAGMA table_info(users);`)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	existing := make(map[string]struct{})
-	for rows.Next() {
-		var (
-			cid        int
-			name       string
-			colType    string
-			notNull    int
-			defaultVal *string
-			pk         int
-		)
-		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
-			return err
-		}
-		existing[name] = struct{}{}
-	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
-	if _, ok := existing["is_admin"]; ok {
-		return nil
-	}
-	_, err = s.db.ExecContext(ctx, "ALTER TABLE users ADD COLUMN is_admin INTEGER NOT NULL DEFAULT 0;")
-	return err
-}
-
-func (s *Store) ensureSettingsDefaults(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO settings (key, value) VALUES ('registration_open', '1');`)
-	return err
-}
-
-func (s *Store) ensureAPIKeyColumns(ctx context.Context) error {
-	rows, err := s.db.QueryContext(ctx, `PRAGMA table_info(api_keys);`)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	existing := make(map[string]struct{})
-	for rows.Next() {
-		var (
-			cid        int
-			name       string
-			colType    string
-			notNull    int
-			defaultVal *string
-			pk         int
-		)
-		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
-			return err
-		}
-		existing[name] = struct{}{}
-	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
-
-	columns := map[string]string{
-		"quota_region":  "TEXT NOT NULL DEFAULT ''",
-		"quota_on":      "TEXT NOT NULL DEFAULT ''",
-		"quota_spot":    "TEXT NOT NULL DEFAULT ''",
-		"quota_on_name": "TEXT NOT NULL DEFAULT ''",
-		"quota_sp_name": "TEXT NOT NULL DEFAULT ''",
-	}
-	for name, def := range columns {
-		if _, ok := existing[name]; ok {
-			continue
-		}
-		stmt := fmt.Sprintf("ALTER TABLE api_keys ADD COLUMN %s %s;", name, def)
-		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func (s *Store) EnsureUser(username, password string) (bool, error) {
 	ctx := context.Background()
 	username = strings.TrimSpace(username)
@@ -348,6 +234,45 @@ func (s *Store) DeleteUser(ctx context.Context, userID int64) error {
 	if _, err = tx.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = ?;`, userID); err != nil {
 		return err
 	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM api_tokens WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM ami_presets WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM firewall_profiles WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM ssh_keys WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM transfer_guards WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM transfer_guard_events WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM dns_bindings WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM dns_providers WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM swap_attempts WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM ip_history WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM ip_blocklist WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM held_static_ips WHERE user_id = ?;`, userID); err != nil {
+		return err
+	}
 	if _, err = tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?;`, userID); err != nil {
 		return err
 	}
@@ -402,7 +327,13 @@ func (s *Store) ListKeys(ctx context.Context, userID int64) ([]Key, error) {
 		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.AccessKey, &key.SecretKey, &key.Proxy, &key.QuotaRegion, &key.QuotaOn, &key.QuotaSpot, &key.QuotaOnName, &key.QuotaSpName, &createdAtRaw); err != nil {
 			return nil, err
 		}
-		key.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtRaw)
+		if key.AccessKey, err = s.openSecret(key.AccessKey); err != nil {
+			return nil, err
+		}
+		if key.SecretKey, err = s.openSecret(key.SecretKey); err != nil {
+			return nil, err
+		}
+		key.CreatedAt = parseTime(createdAtRaw)
 		out = append(out, Key{
 			ID:          key.ID,
 			UserID:      key.UserID,
@@ -431,6 +362,14 @@ func (s *Store) CreateKey(ctx context.Context, userID int64, name, accessKey, se
 	if strings.TrimSpace(name) == "" {
 		name = time.Now().Format("2006-01-02 15:04")
 	}
+	encAK, err := s.sealSecret(accessKey)
+	if err != nil {
+		return 0, err
+	}
+	encSK, err := s.sealSecret(secretKey)
+	if err != nil {
+		return 0, err
+	}
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
@@ -445,7 +384,7 @@ func (s *Store) CreateKey(ctx context.Context, userID int64, name, accessKey, se
 		return 0, err
 	}
 	defer insertStmt.Close()
-	if _, err = insertStmt.ExecContext(ctx, userID, name, accessKey, secretKey, proxy); err != nil {
+	if _, err = insertStmt.ExecContext(ctx, userID, name, encAK, encSK, proxy); err != nil {
 		return 0, err
 	}
 	var insertID int64
@@ -481,12 +420,20 @@ func (s *Store) UpdateKey(ctx context.Context, userID, keyID int64, name, access
 	if strings.TrimSpace(name) == "" {
 		name = time.Now().Format("2006-01-02 15:04")
 	}
+	encAK, err := s.sealSecret(accessKey)
+	if err != nil {
+		return err
+	}
+	encSK, err := s.sealSecret(secretKey)
+	if err != nil {
+		return err
+	}
 	stmt, err := s.db.PrepareContext(ctx, `UPDATE api_keys SET name = ?, access_key = ?, secret_key = ?, proxy = ? WHERE id = ? AND user_id = ?;`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.ExecContext(ctx, name, accessKey, secretKey, proxy, keyID, userID)
+	_, err = stmt.ExecContext(ctx, name, encAK, encSK, proxy, keyID, userID)
 	return err
 }
 
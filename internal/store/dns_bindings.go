@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDNSProviderNotFound = errors.New("dns provider not found")
+	ErrDNSProviderExists   = errors.New("dns provider already exists")
+	ErrInvalidDNSProvider  = errors.New("invalid dns provider")
+	ErrDNSBindingNotFound  = errors.New("dns binding not found")
+	ErrDNSBindingExists    = errors.New("dns binding already exists")
+	ErrInvalidDNSBinding   = errors.New("invalid dns binding")
+)
+
+// DNSProvider 是外部 DNS 服务商的账号。Config 为服务商参数的 JSON，含密钥，落库前加密。
+type DNSProvider struct {
+	ID        int64
+	UserID    int64
+	Name      string
+	Kind      string
+	Config    string
+	CreatedAt time.Time
+}
+
+// DNSBinding 把外部 DNS 的一条 A / AAAA 记录绑定到实例，实例换 IP 后按绑定改写记录。
+// LastValue 为最近一次成功写入的值，LastError 为最近一次同步的错误，SyncedAt 为零表示从未同步。
+type DNSBinding struct {
+	ID         int64
+	UserID     int64
+	ProviderID int64
+	KeyID      int64
+	Service    string
+	Region     string
+	Instance   string
+	Zone       string
+	Name       string
+	Type       string
+	TTL        int
+	LastValue  string
+	LastError  string
+	SyncedAt   time.Time
+	CreatedAt  time.Time
+}
+
+func (b *DNSBinding) validate() error {
+	b.Region = strings.TrimSpace(b.Region)
+	b.Instance = strings.TrimSpace(b.Instance)
+	b.Zone = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(b.Zone)), ".")
+	b.Name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(b.Name)), ".")
+	b.Type = strings.ToUpper(strings.TrimSpace(b.Type))
+	if b.ProviderID == 0 || b.KeyID == 0 || b.Region == "" || b.Instance == "" || b.Zone == "" || b.Name == "" || b.TTL < 0 {
+		return ErrInvalidDNSBinding
+	}
+	if b.Name != b.Zone && !strings.HasSuffix(b.Name, "."+b.Zone) {
+		return ErrInvalidDNSBinding
+	}
+	switch b.Service {
+	case "lightsail", "ec2":
+	default:
+		return ErrInvalidDNSBinding
+	}
+	switch b.Type {
+	case "A", "AAAA":
+	default:
+		return ErrInvalidDNSBinding
+	}
+	return nil
+}
+
+func (s *Store) CreateDNSProvider(ctx context.Context, p *DNSProvider) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || p.Kind == "" {
+		return ErrInvalidDNSProvider
+	}
+	sealed, err := s.sealSecret(p.Config)
+	if err != nil {
+		return err
+	}
+	p.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO dns_providers (user_id, name, kind, config, created_at) VALUES (?, ?, ?, ?, ?);`,
+		p.UserID, p.Name, p.Kind, sealed, p.CreatedAt.Format(timeLayout))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return ErrDNSProviderExists
+		}
+		return err
+	}
+	p.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Store) ListDNSProviders(ctx context.Context, userID int64) ([]DNSProvider, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, name, kind, config, created_at FROM dns_providers WHERE user_id = ? ORDER BY name;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DNSProvider
+	for rows.Next() {
+		p, err := s.scanDNSProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetDNSProvider(ctx context.Context, userID, id int64) (*DNSProvider, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT id, user_id, name, kind, config, created_at FROM dns_providers WHERE id = ? AND user_id = ?;`, id, userID)
+	p, err := s.scanDNSProvider(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDNSProviderNotFound
+	}
+	return p, err
+}
+
+func (s *Store) scanDNSProvider(row interface{ Scan(...any) error }) (*DNSProvider, error) {
+	var (
+		p       DNSProvider
+		created string
+	)
+	if err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.Kind, &p.Config, &created); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.Config, err = s.openSecret(p.Config); err != nil {
+		return nil, err
+	}
+	p.CreatedAt = parseTime(created)
+	return &p, nil
+}
+
+// DeleteDNSProvider 同时删除使用该服务商的绑定。
+func (s *Store) DeleteDNSProvider(ctx context.Context, userID, id int64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	res, err := tx.ExecContext(ctx, `DELETE FROM dns_providers WHERE id = ? AND user_id = ?;`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		err = ErrDNSProviderNotFound
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM dns_bindings WHERE provider_id = ? AND user_id = ?;`, id, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) CreateDNSBinding(ctx context.Context, b *DNSBinding) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	if _, err := s.GetDNSProvider(ctx, b.UserID, b.ProviderID); err != nil {
+		return err
+	}
+	b.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO dns_bindings (user_id, provider_id, key_id, service, region, instance, zone, name, type, ttl, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		b.UserID, b.ProviderID, b.KeyID, b.Service, b.Region, b.Instance, b.Zone, b.Name, b.Type, b.TTL, b.CreatedAt.Format(timeLayout))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return ErrDNSBindingExists
+		}
+		return err
+	}
+	b.ID, err = res.LastInsertId()
+	return err
+}
+
+const dnsBindingColumns = `id, user_id, provider_id, key_id, service, region, instance, zone, name, type, ttl, last_value, last_error, synced_at, created_at`
+
+func (s *Store) ListDNSBindings(ctx context.Context, userID int64) ([]DNSBinding, error) {
+	return s.queryDNSBindings(ctx, `SELECT `+dnsBindingColumns+` FROM dns_bindings WHERE user_id = ? ORDER BY instance, name, type;`, userID)
+}
+
+// ListInstanceDNSBindings 返回绑定到某台实例的记录。
+func (s *Store) ListInstanceDNSBindings(ctx context.Context, userID, keyID int64, region, instance string) ([]DNSBinding, error) {
+	return s.queryDNSBindings(ctx, `SELECT `+dnsBindingColumns+` FROM dns_bindings WHERE user_id = ? AND key_id = ? AND region = ? AND instance = ? ORDER BY name, type;`, userID, keyID, region, instance)
+}
+
+func (s *Store) queryDNSBindings(ctx context.Context, q string, args ...any) ([]DNSBinding, error) {
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DNSBinding
+	for rows.Next() {
+		var (
+			b               DNSBinding
+			synced, created string
+		)
+		if err := rows.Scan(&b.ID, &b.UserID, &b.ProviderID, &b.KeyID, &b.Service, &b.Region, &b.Instance, &b.Zone, &b.Name, &b.Type, &b.TTL, &b.LastValue, &b.LastError, &synced, &created); err != nil {
+			return nil, err
+		}
+		b.SyncedAt = parseTime(synced)
+		b.CreatedAt = parseTime(created)
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) DeleteDNSBinding(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM dns_bindings WHERE id = ? AND user_id = ?;`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDNSBindingNotFound
+	}
+	return nil
+}
+
+// RecordDNSBindingSync 记录一次同步结果：成功时更新 LastValue 并清空错误，失败时保留上次的值。
+func (s *Store) RecordDNSBindingSync(ctx context.Context, id int64, value, errText string) error {
+	now := time.Now().UTC().Format(timeLayout)
+	if errText != "" {
+		_, err := s.db.ExecContext(ctx, `UPDATE dns_bindings SET last_error = ?, synced_at = ? WHERE id = ?;`, errText, now, id)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `UPDATE dns_bindings SET last_value = ?, last_error = '', synced_at = ? WHERE id = ?;`, value, now, id)
+	return err
+}
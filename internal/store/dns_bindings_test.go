@@ -0,0 +1,86 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDNSBindings(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	p := &DNSProvider{UserID: 1, Name: "cf", Kind: "cloudflare", Config: `{"api_token":"secret-token"}`}
+	if err := s.CreateDNSProvider(ctx, p); !errors.Is(err, ErrNoKeyring) {
+		t.Fatalf("CreateDNSProvider(no keyring) err = %v", err)
+	}
+	oldKey := bytes.Repeat([]byte{3}, masterKeyLen)
+	ring, _ := NewKeyring(oldKey)
+	s.SetKeyring(ring)
+	if err := s.CreateDNSProvider(ctx, p); err != nil {
+		t.Fatalf("CreateDNSProvider: %v", err)
+	}
+	var raw string
+	if err := s.db.QueryRow(`SELECT config FROM dns_providers WHERE id = ?;`, p.ID).Scan(&raw); err != nil || strings.Contains(raw, "secret-token") {
+		t.Fatalf("stored config = %q, %v", raw, err)
+	}
+	if err := s.CreateDNSProvider(ctx, &DNSProvider{UserID: 1, Name: "cf", Kind: "cloudflare", Config: "{}"}); !errors.Is(err, ErrDNSProviderExists) {
+		t.Fatalf("duplicate provider err = %v", err)
+	}
+	if got, err := s.GetDNSProvider(ctx, 1, p.ID); err != nil || got.Config != p.Config {
+		t.Fatalf("GetDNSProvider = %+v, %v", got, err)
+	}
+	if _, err := s.GetDNSProvider(ctx, 2, p.ID); !errors.Is(err, ErrDNSProviderNotFound) {
+		t.Fatalf("GetDNSProvider(other user) err = %v", err)
+	}
+
+	b := &DNSBinding{UserID: 1, ProviderID: p.ID, KeyID: 7, Service: "lightsail", Region: "us-east-1", Instance: "vps-1", Zone: "Example.com", Name: "vps.example.com.", Type: "a"}
+	if err := s.CreateDNSBinding(ctx, b); err != nil {
+		t.Fatalf("CreateDNSBinding: %v", err)
+	}
+	if b.Name != "vps.example.com" || b.Type != "A" {
+		t.Fatalf("normalized binding = %+v", b)
+	}
+	if err := s.CreateDNSBinding(ctx, &DNSBinding{UserID: 1, ProviderID: p.ID, KeyID: 7, Service: "lightsail", Region: "us-east-1", Instance: "vps-2", Zone: "example.com", Name: "vps.example.com", Type: "A"}); !errors.Is(err, ErrDNSBindingExists) {
+		t.Fatalf("duplicate binding err = %v", err)
+	}
+	if err := s.CreateDNSBinding(ctx, &DNSBinding{UserID: 1, ProviderID: p.ID, KeyID: 7, Service: "lightsail", Region: "us-east-1", Instance: "vps-1", Zone: "example.com", Name: "vps.example.org", Type: "A"}); !errors.Is(err, ErrInvalidDNSBinding) {
+		t.Fatalf("out-of-zone binding err = %v", err)
+	}
+
+	if err := s.RecordDNSBindingSync(ctx, b.ID, "203.0.113.9", ""); err != nil {
+		t.Fatalf("RecordDNSBindingSync: %v", err)
+	}
+	if err := s.RecordDNSBindingSync(ctx, b.ID, "", "timeout"); err != nil {
+		t.Fatalf("RecordDNSBindingSync(err): %v", err)
+	}
+	list, err := s.ListInstanceDNSBindings(ctx, 1, 7, "us-east-1", "vps-1")
+	if err != nil || len(list) != 1 || list[0].LastValue != "203.0.113.9" || list[0].LastError != "timeout" || list[0].SyncedAt.IsZero() {
+		t.Fatalf("ListInstanceDNSBindings = %+v, %v", list, err)
+	}
+
+	rotating, _ := NewKeyring(bytes.Repeat([]byte{4}, masterKeyLen), oldKey)
+	s.SetKeyring(rotating)
+	if n, err := s.RotateMasterKey(ctx); err != nil || n != 1 {
+		t.Fatalf("RotateMasterKey = %d, %v", n, err)
+	}
+	newOnly, _ := NewKeyring(bytes.Repeat([]byte{4}, masterKeyLen))
+	s.SetKeyring(newOnly)
+	if got, err := s.GetDNSProvider(ctx, 1, p.ID); err != nil || got.Config != p.Config {
+		t.Fatalf("GetDNSProvider after rotation = %+v, %v", got, err)
+	}
+
+	if err := s.DeleteDNSProvider(ctx, 1, p.ID); err != nil {
+		t.Fatalf("DeleteDNSProvider: %v", err)
+	}
+	if list, _ := s.ListDNSBindings(ctx, 1); len(list) != 0 {
+		t.Fatalf("bindings left after provider delete: %+v", list)
+	}
+}
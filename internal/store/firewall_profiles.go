@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrProfileNotFound = errors.New("firewall profile not found")
+	ErrProfileExists   = errors.New("firewall profile already exists")
+)
+
+// FirewallProfile 是用户保存的一组 Lightsail 防火墙规则，Rules 为 JSON 编码的规则列表。
+type FirewallProfile struct {
+	ID        int64
+	UserID    int64
+	Name      string
+	Rules     string
+	CreatedAt time.Time
+}
+
+func (s *Store) CreateFirewallProfile(ctx context.Context, p *FirewallProfile) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO firewall_profiles (user_id, name, rules, created_at) VALUES (?, ?, ?, ?);`,
+		p.UserID, p.Name, p.Rules, p.CreatedAt.Format(timeLayout))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return ErrProfileExists
+		}
+		return err
+	}
+	p.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Store) ListFirewallProfiles(ctx context.Context, userID int64) ([]FirewallProfile, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, name, rules, created_at FROM firewall_profiles WHERE user_id = ? ORDER BY name;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []FirewallProfile
+	for rows.Next() {
+		var (
+			p       FirewallProfile
+			created string
+		)
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.Rules, &created); err != nil {
+			return nil, err
+		}
+		p.CreatedAt = parseTime(created)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetFirewallProfile(ctx context.Context, userID, id int64) (*FirewallProfile, error) {
+	var (
+		p       FirewallProfile
+		created string
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT id, user_id, name, rules, created_at FROM firewall_profiles WHERE id = ? AND user_id = ?;`, id, userID).
+		Scan(&p.ID, &p.UserID, &p.Name, &p.Rules, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProfileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.CreatedAt = parseTime(created)
+	return &p, nil
+}
+
+func (s *Store) DeleteFirewallProfile(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM firewall_profiles WHERE id = ? AND user_id = ?;`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProfileNotFound
+	}
+	return nil
+}
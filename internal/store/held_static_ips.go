@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrHeldStaticIPNotFound = errors.New("held static ip not found")
+
+// 保留中的旧静态 IP 的状态。held 可回滚；到期后转为 releasing 并提交释放任务。
+const (
+	HeldStaticIPHeld        = "held"
+	HeldStaticIPRollingBack = "rolling_back"
+	HeldStaticIPRolledBack  = "rolled_back"
+	HeldStaticIPReleasing   = "releasing"
+	HeldStaticIPReleased    = "released"
+	HeldStaticIPFailed      = "failed"
+)
+
+// HeldStaticIP 是换 IP 时只解绑、未释放的旧静态 IP，在 ExpiresAt 之前可以换回。
+type HeldStaticIP struct {
+	ID         int64
+	UserID     int64
+	KeyID      int64
+	JobID      int64
+	Region     string
+	Instance   string
+	Name       string
+	IP         string
+	NewIP      string
+	Status     string
+	Error      string
+	Attempts   int       // 到期释放失败的次数
+	RetryAt    time.Time // 释放失败后下次重试的时间
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Active 表示地址仍保留在账号中（含回滚、释放进行中）。
+func (h HeldStaticIP) Active() bool {
+	switch h.Status {
+	case HeldStaticIPHeld, HeldStaticIPRollingBack, HeldStaticIPReleasing:
+		return true
+	}
+	return false
+}
+
+func (s *Store) CreateHeldStaticIP(ctx context.Context, h *HeldStaticIP) error {
+	h.Status = HeldStaticIPHeld
+	h.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO held_static_ips (user_id, key_id, job_id, region, instance, name, ip, new_ip, status, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		h.UserID, h.KeyID, h.JobID, h.Region, h.Instance, h.Name, h.IP, h.NewIP, h.Status, h.ExpiresAt.UTC().Format(timeLayout), h.CreatedAt.Format(timeLayout))
+	if err != nil {
+		return err
+	}
+	h.ID, err = res.LastInsertId()
+	return err
+}
+
+const heldStaticIPColumns = `id, user_id, key_id, job_id, region, instance, name, ip, new_ip, status, error, attempts, retry_at, expires_at, created_at, finished_at`
+
+// ListHeldStaticIPs 返回用户最近的保留记录，新的在前。
+func (s *Store) ListHeldStaticIPs(ctx context.Context, userID int64, limit int) ([]HeldStaticIP, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.queryHeldStaticIPs(ctx, `SELECT `+heldStaticIPColumns+` FROM held_static_ips WHERE user_id = ? ORDER BY id DESC LIMIT ?;`, userID, limit)
+}
+
+// ListExpiredHeldStaticIPs 返回所有用户中已到期、仍处于 held 且已到重试时间的记录。
+func (s *Store) ListExpiredHeldStaticIPs(ctx context.Context, now time.Time) ([]HeldStaticIP, error) {
+	ts := now.UTC().Format(timeLayout)
+	return s.queryHeldStaticIPs(ctx, `SELECT `+heldStaticIPColumns+` FROM held_static_ips WHERE status = ? AND expires_at <= ? AND retry_at <= ? ORDER BY id;`, HeldStaticIPHeld, ts, ts)
+}
+
+// ListActiveHeldStaticIPs 返回密钥在区域内仍处于保留期（held、回滚中或释放中，同 Active）的记录，遗留资源页据此禁止释放。
+func (s *Store) ListActiveHeldStaticIPs(ctx context.Context, keyID int64, region string) ([]HeldStaticIP, error) {
+	return s.queryHeldStaticIPs(ctx, `SELECT `+heldStaticIPColumns+` FROM held_static_ips WHERE key_id = ? AND region = ? AND status IN (?, ?, ?) ORDER BY id;`, keyID, region, HeldStaticIPHeld, HeldStaticIPRollingBack, HeldStaticIPReleasing)
+}
+
+func (s *Store) GetHeldStaticIP(ctx context.Context, userID, id int64) (*HeldStaticIP, error) {
+	list, err := s.queryHeldStaticIPs(ctx, `SELECT `+heldStaticIPColumns+` FROM held_static_ips WHERE id = ? AND user_id = ?;`, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrHeldStaticIPNotFound
+	}
+	return &list[0], nil
+}
+
+func (s *Store) queryHeldStaticIPs(ctx context.Context, q string, args ...any) ([]HeldStaticIP, error) {
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []HeldStaticIP
+	for rows.Next() {
+		var (
+			h                                 HeldStaticIP
+			retry, expires, created, finished string
+		)
+		if err := rows.Scan(&h.ID, &h.UserID, &h.KeyID, &h.JobID, &h.Region, &h.Instance, &h.Name, &h.IP, &h.NewIP, &h.Status, &h.Error, &h.Attempts, &retry, &expires, &created, &finished); err != nil {
+			return nil, err
+		}
+		h.RetryAt = parseTime(retry)
+		h.ExpiresAt = parseTime(expires)
+		h.CreatedAt = parseTime(created)
+		h.FinishedAt = parseTime(finished)
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// ClaimHeldStaticIP 把状态从 from 改为 to，返回 false 表示已被其他操作抢先处理。
+func (s *Store) ClaimHeldStaticIP(ctx context.Context, id int64, from, to string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE held_static_ips SET status = ?, error = '' WHERE id = ? AND status = ?;`, to, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// FinishHeldStaticIP 记录回滚或释放的结果。status 为 held 时表示回滚或释放失败、地址仍保留。
+func (s *Store) FinishHeldStaticIP(ctx context.Context, id int64, status, errText string) error {
+	finished := ""
+	if status != HeldStaticIPHeld {
+		finished = time.Now().UTC().Format(timeLayout)
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE held_static_ips SET status = ?, error = ?, finished_at = ? WHERE id = ?;`, status, errText, finished, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrHeldStaticIPNotFound
+	}
+	return nil
+}
+
+// DeferHeldStaticIP 记录一次到期释放失败：恢复为 held、失败次数加一，retryAt 之前不再被到期检查选中。
+func (s *Store) DeferHeldStaticIP(ctx context.Context, id int64, errText string, retryAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE held_static_ips SET status = ?, error = ?, attempts = attempts + 1, retry_at = ? WHERE id = ?;`,
+		HeldStaticIPHeld, errText, retryAt.UTC().Format(timeLayout), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrHeldStaticIPNotFound
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHeldStaticIPs(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	now := time.Now()
+	expired := &HeldStaticIP{UserID: 1, KeyID: 2, Region: "us-east-1", Instance: "vps-1", Name: "sip-old", IP: "198.51.100.1", NewIP: "192.0.2.7", ExpiresAt: now.Add(-time.Minute)}
+	fresh := &HeldStaticIP{UserID: 1, KeyID: 2, Region: "us-east-1", Instance: "vps-2", Name: "sip-old-2", IP: "198.51.100.2", ExpiresAt: now.Add(time.Hour)}
+	for _, h := range []*HeldStaticIP{expired, fresh} {
+		if err := s.CreateHeldStaticIP(ctx, h); err != nil || h.ID == 0 || h.Status != HeldStaticIPHeld {
+			t.Fatalf("CreateHeldStaticIP = %+v, %v", h, err)
+		}
+	}
+
+	list, err := s.ListExpiredHeldStaticIPs(ctx, now)
+	if err != nil || len(list) != 1 || list[0].ID != expired.ID {
+		t.Fatalf("ListExpiredHeldStaticIPs = %+v, %v", list, err)
+	}
+	if ok, err := s.ClaimHeldStaticIP(ctx, expired.ID, HeldStaticIPHeld, HeldStaticIPReleasing); err != nil || !ok {
+		t.Fatalf("ClaimHeldStaticIP = %v, %v", ok, err)
+	}
+	if ok, _ := s.ClaimHeldStaticIP(ctx, expired.ID, HeldStaticIPHeld, HeldStaticIPRollingBack); ok {
+		t.Fatal("claimed the same hold twice")
+	}
+	if list, _ := s.ListExpiredHeldStaticIPs(ctx, now); len(list) != 0 {
+		t.Fatalf("claimed hold still listed as expired: %+v", list)
+	}
+	// 释放任务执行期间仍算保留，遗留资源页不能再释放
+	if list, _ := s.ListActiveHeldStaticIPs(ctx, 2, "us-east-1"); len(list) != 2 {
+		t.Fatalf("ListActiveHeldStaticIPs while releasing = %+v", list)
+	}
+	if err := s.FinishHeldStaticIP(ctx, expired.ID, HeldStaticIPReleased, ""); err != nil {
+		t.Fatalf("FinishHeldStaticIP: %v", err)
+	}
+	got, err := s.GetHeldStaticIP(ctx, 1, expired.ID)
+	if err != nil || got.Status != HeldStaticIPReleased || got.FinishedAt.IsZero() || got.Active() || got.NewIP != "192.0.2.7" {
+		t.Fatalf("GetHeldStaticIP = %+v, %v", got, err)
+	}
+	if _, err := s.GetHeldStaticIP(ctx, 2, fresh.ID); !errors.Is(err, ErrHeldStaticIPNotFound) {
+		t.Fatalf("GetHeldStaticIP(other user) err = %v", err)
+	}
+	if list, _ := s.ListHeldStaticIPs(ctx, 1, 0); len(list) != 2 || list[0].ID != fresh.ID || !list[0].Active() {
+		t.Fatalf("ListHeldStaticIPs = %+v", list)
+	}
+}
+
+func TestDeferHeldStaticIP(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	now := time.Now()
+	h := &HeldStaticIP{UserID: 1, KeyID: 2, Region: "us-east-1", Instance: "vps-1", Name: "sip-old", IP: "198.51.100.1", ExpiresAt: now.Add(-time.Hour)}
+	if err := s.CreateHeldStaticIP(ctx, h); err != nil {
+		t.Fatalf("CreateHeldStaticIP: %v", err)
+	}
+	if ok, err := s.ClaimHeldStaticIP(ctx, h.ID, HeldStaticIPHeld, HeldStaticIPReleasing); err != nil || !ok {
+		t.Fatalf("ClaimHeldStaticIP = %v, %v", ok, err)
+	}
+	if err := s.DeferHeldStaticIP(ctx, h.ID, "ThrottlingException", now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("DeferHeldStaticIP: %v", err)
+	}
+	got, _ := s.GetHeldStaticIP(ctx, 1, h.ID)
+	if got.Status != HeldStaticIPHeld || got.Attempts != 1 || got.Error != "ThrottlingException" || got.RetryAt.IsZero() || !got.FinishedAt.IsZero() {
+		t.Fatalf("deferred hold = %+v", got)
+	}
+	// 重试时间之前不会再次被到期检查选中
+	if list, _ := s.ListExpiredHeldStaticIPs(ctx, now); len(list) != 0 {
+		t.Fatalf("deferred hold listed before retry_at: %+v", list)
+	}
+	if list, _ := s.ListExpiredHeldStaticIPs(ctx, now.Add(3*time.Minute)); len(list) != 1 || list[0].Attempts != 1 {
+		t.Fatalf("ListExpiredHeldStaticIPs after retry_at = %+v", list)
+	}
+	if err := s.DeferHeldStaticIP(ctx, 999, "x", now); !errors.Is(err, ErrHeldStaticIPNotFound) {
+		t.Fatalf("DeferHeldStaticIP(missing) err = %v", err)
+	}
+}
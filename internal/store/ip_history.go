@@ -0,0 +1,262 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBlockedIPNotFound = errors.New("blocked ip not found")
+	ErrBlockedIPExists   = errors.New("ip already blocked")
+	ErrInvalidBlockedIP  = errors.New("invalid blocked ip")
+)
+
+// IPHistory 是实例用过的一个公网 / 静态 IPv4。AssignedAt 为零表示启用本功能前就已分配，
+// ReleasedAt 为零表示仍在使用。
+type IPHistory struct {
+	ID            int64
+	UserID        int64
+	KeyID         int64
+	Region        string
+	Instance      string
+	IP            string
+	Static        bool
+	AssignedAt    time.Time
+	ReleasedAt    time.Time
+	ReleaseReason string
+}
+
+// Duration 返回地址的使用时长，分配时间未知时返回 0。
+func (h IPHistory) Duration(now time.Time) time.Duration {
+	if h.AssignedAt.IsZero() {
+		return 0
+	}
+	end := h.ReleasedAt
+	if end.IsZero() {
+		end = now
+	}
+	return end.Sub(h.AssignedAt)
+}
+
+// BlockedIP 是某个密钥下已知不可用的地址，换 IP 申请到时立即释放重申。
+type BlockedIP struct {
+	ID        int64
+	UserID    int64
+	KeyID     int64
+	IP        string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// RecordIPAssigned 记录实例当前的地址。与仍在使用的记录相同时不做改动；
+// 地址变了则以 changedReason 结束旧记录，再新增一条。
+func (s *Store) RecordIPAssigned(ctx context.Context, h *IPHistory, changedReason string) (err error) {
+	if h.IP == "" || h.Instance == "" {
+		return nil
+	}
+	if h.AssignedAt.IsZero() {
+		h.AssignedAt = time.Now().UTC()
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	var (
+		id     int64
+		static bool
+	)
+	err = tx.QueryRowContext(ctx, `SELECT id, static FROM ip_history WHERE key_id = ? AND region = ? AND instance = ? AND ip = ? AND released_at = '' ORDER BY id DESC LIMIT 1;`,
+		h.KeyID, h.Region, h.Instance, h.IP).Scan(&id, &static)
+	switch {
+	case err == nil:
+		if static != h.Static {
+			if _, err = tx.ExecContext(ctx, `UPDATE ip_history SET static = ? WHERE id = ?;`, h.Static, id); err != nil {
+				return err
+			}
+		}
+		h.ID = id
+		return tx.Commit()
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	now := h.AssignedAt.UTC().Format(timeLayout)
+	if _, err = tx.ExecContext(ctx, `UPDATE ip_history SET released_at = ?, release_reason = ? WHERE key_id = ? AND region = ? AND instance = ? AND released_at = '';`,
+		now, changedReason, h.KeyID, h.Region, h.Instance); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO ip_history (user_id, key_id, region, instance, ip, static, assigned_at) VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		h.UserID, h.KeyID, h.Region, h.Instance, h.IP, h.Static, now)
+	if err != nil {
+		return err
+	}
+	if h.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordIPReleased 结束实例使用 h.IP 的记录；IP 为空时结束实例所有仍在使用的记录。
+// 没有对应记录的地址（如启用本功能前分配的）补一条分配时间未知的记录。
+func (s *Store) RecordIPReleased(ctx context.Context, h *IPHistory) error {
+	if h.ReleasedAt.IsZero() {
+		h.ReleasedAt = time.Now().UTC()
+	}
+	released := h.ReleasedAt.UTC().Format(timeLayout)
+	assigned := ""
+	if !h.AssignedAt.IsZero() {
+		assigned = h.AssignedAt.UTC().Format(timeLayout)
+	}
+	q := `UPDATE ip_history SET released_at = ?, release_reason = ? WHERE key_id = ? AND region = ? AND instance = ? AND released_at = ''`
+	args := []any{released, h.ReleaseReason, h.KeyID, h.Region, h.Instance}
+	if h.IP != "" {
+		q += ` AND ip = ?`
+		args = append(args, h.IP)
+	}
+	res, err := s.db.ExecContext(ctx, q+`;`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 || h.IP == "" {
+		return nil
+	}
+	ins, err := s.db.ExecContext(ctx, `INSERT INTO ip_history (user_id, key_id, region, instance, ip, static, assigned_at, released_at, release_reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		h.UserID, h.KeyID, h.Region, h.Instance, h.IP, h.Static, assigned, released, h.ReleaseReason)
+	if err != nil {
+		return err
+	}
+	h.ID, err = ins.LastInsertId()
+	return err
+}
+
+// ListIPHistory 返回密钥在区域内的地址记录，新的在前；instance 为空时返回所有实例。
+func (s *Store) ListIPHistory(ctx context.Context, userID, keyID int64, region, instance string, limit int) ([]IPHistory, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	q := `SELECT id, user_id, key_id, region, instance, ip, static, assigned_at, released_at, release_reason FROM ip_history WHERE user_id = ? AND key_id = ? AND region = ?`
+	args := []any{userID, keyID, region}
+	if instance != "" {
+		q += ` AND instance = ?`
+		args = append(args, instance)
+	}
+	rows, err := s.db.QueryContext(ctx, q+` ORDER BY id DESC LIMIT ?;`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []IPHistory
+	for rows.Next() {
+		var (
+			h                  IPHistory
+			assigned, released string
+		)
+		if err := rows.Scan(&h.ID, &h.UserID, &h.KeyID, &h.Region, &h.Instance, &h.IP, &h.Static, &assigned, &released, &h.ReleaseReason); err != nil {
+			return nil, err
+		}
+		h.AssignedAt = parseTime(assigned)
+		h.ReleasedAt = parseTime(released)
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// OpenIPHistory 返回密钥在区域内各实例仍在使用的地址记录，按实例名索引。
+func (s *Store) OpenIPHistory(ctx context.Context, keyID int64, region string) (map[string]IPHistory, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, key_id, region, instance, ip, static, assigned_at FROM ip_history WHERE key_id = ? AND region = ? AND released_at = '' ORDER BY id ASC;`, keyID, region)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]IPHistory{}
+	for rows.Next() {
+		var (
+			h        IPHistory
+			assigned string
+		)
+		if err := rows.Scan(&h.ID, &h.UserID, &h.KeyID, &h.Region, &h.Instance, &h.IP, &h.Static, &assigned); err != nil {
+			return nil, err
+		}
+		h.AssignedAt = parseTime(assigned)
+		out[h.Instance] = h
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) BlockIP(ctx context.Context, b *BlockedIP) error {
+	ip := net.ParseIP(strings.TrimSpace(b.IP))
+	if ip == nil || b.KeyID == 0 {
+		return ErrInvalidBlockedIP
+	}
+	b.IP = ip.String()
+	b.Reason = strings.TrimSpace(b.Reason)
+	b.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO ip_blocklist (user_id, key_id, ip, reason, created_at) VALUES (?, ?, ?, ?, ?);`,
+		b.UserID, b.KeyID, b.IP, b.Reason, b.CreatedAt.Format(timeLayout))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return ErrBlockedIPExists
+		}
+		return err
+	}
+	b.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Store) ListBlockedIPs(ctx context.Context, userID, keyID int64) ([]BlockedIP, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, key_id, ip, reason, created_at FROM ip_blocklist WHERE user_id = ? AND key_id = ? ORDER BY id DESC;`, userID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []BlockedIP
+	for rows.Next() {
+		var (
+			b       BlockedIP
+			created string
+		)
+		if err := rows.Scan(&b.ID, &b.UserID, &b.KeyID, &b.IP, &b.Reason, &created); err != nil {
+			return nil, err
+		}
+		b.CreatedAt = parseTime(created)
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// BlockedIPSet 返回密钥的黑名单，供换 IP 时查询。
+func (s *Store) BlockedIPSet(ctx context.Context, keyID int64) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT ip FROM ip_blocklist WHERE key_id = ?;`, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]bool{}
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		out[ip] = true
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) UnblockIP(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM ip_blocklist WHERE id = ? AND user_id = ?;`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBlockedIPNotFound
+	}
+	return nil
+}
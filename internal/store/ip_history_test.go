@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIPHistory(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	base := IPHistory{UserID: 1, KeyID: 2, Region: "us-east-1", Instance: "vps-1"}
+	first := base
+	first.IP, first.AssignedAt = "198.51.100.1", time.Now().Add(-time.Hour)
+	if err := s.RecordIPAssigned(ctx, &first, "地址已变化"); err != nil {
+		t.Fatalf("RecordIPAssigned: %v", err)
+	}
+	again := base
+	again.IP, again.Static = "198.51.100.1", true
+	if err := s.RecordIPAssigned(ctx, &again, "地址已变化"); err != nil || again.ID != first.ID {
+		t.Fatalf("RecordIPAssigned(same ip) id = %d, want %d, %v", again.ID, first.ID, err)
+	}
+
+	released := base
+	released.IP, released.ReleaseReason = "198.51.100.1", "手动换 IP"
+	if err := s.RecordIPReleased(ctx, &released); err != nil {
+		t.Fatalf("RecordIPReleased: %v", err)
+	}
+	unknown := base
+	unknown.IP, unknown.ReleaseReason = "203.0.113.9", "命中黑名单"
+	if err := s.RecordIPReleased(ctx, &unknown); err != nil || unknown.ID == 0 {
+		t.Fatalf("RecordIPReleased(untracked) = %+v, %v", unknown, err)
+	}
+	second := base
+	second.IP = "192.0.2.7"
+	if err := s.RecordIPAssigned(ctx, &second, "地址已变化"); err != nil {
+		t.Fatalf("RecordIPAssigned(second): %v", err)
+	}
+	third := base
+	third.IP = "192.0.2.8"
+	if err := s.RecordIPAssigned(ctx, &third, "地址已变化"); err != nil {
+		t.Fatalf("RecordIPAssigned(third): %v", err)
+	}
+
+	open, err := s.OpenIPHistory(ctx, 2, "us-east-1")
+	if err != nil || len(open) != 1 || open["vps-1"].IP != "192.0.2.8" || open["vps-1"].ID != third.ID {
+		t.Fatalf("OpenIPHistory = %+v, %v", open, err)
+	}
+
+	list, err := s.ListIPHistory(ctx, 1, 2, "us-east-1", "vps-1", 0)
+	if err != nil || len(list) != 4 {
+		t.Fatalf("ListIPHistory = %+v, %v", list, err)
+	}
+	if !list[0].ReleasedAt.IsZero() || list[1].ReleaseReason != "地址已变化" || !list[2].AssignedAt.IsZero() || list[3].ReleaseReason != "手动换 IP" || !list[3].Static {
+		t.Fatalf("history = %+v", list)
+	}
+	if d := list[3].Duration(time.Now()); d < time.Hour-time.Minute || d > time.Hour+time.Minute {
+		t.Fatalf("Duration = %s", d)
+	}
+}
+
+func TestIPBlocklist(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	b := &BlockedIP{UserID: 1, KeyID: 2, IP: " 203.0.113.9 ", Reason: "被墙"}
+	if err := s.BlockIP(ctx, b); err != nil || b.IP != "203.0.113.9" {
+		t.Fatalf("BlockIP = %+v, %v", b, err)
+	}
+	if err := s.BlockIP(ctx, &BlockedIP{UserID: 1, KeyID: 2, IP: "203.0.113.9"}); !errors.Is(err, ErrBlockedIPExists) {
+		t.Fatalf("duplicate err = %v", err)
+	}
+	if err := s.BlockIP(ctx, &BlockedIP{UserID: 1, KeyID: 2, IP: "vps"}); !errors.Is(err, ErrInvalidBlockedIP) {
+		t.Fatalf("invalid err = %v", err)
+	}
+	if set, err := s.BlockedIPSet(ctx, 2); err != nil || !set["203.0.113.9"] || len(set) != 1 {
+		t.Fatalf("BlockedIPSet = %v, %v", set, err)
+	}
+	if set, _ := s.BlockedIPSet(ctx, 3); len(set) != 0 {
+		t.Fatalf("BlockedIPSet(other key) = %v", set)
+	}
+	if err := s.UnblockIP(ctx, 2, b.ID); !errors.Is(err, ErrBlockedIPNotFound) {
+		t.Fatalf("UnblockIP(other user) err = %v", err)
+	}
+	if err := s.UnblockIP(ctx, 1, b.ID); err != nil {
+		t.Fatalf("UnblockIP: %v", err)
+	}
+	if list, _ := s.ListBlockedIPs(ctx, 1, 2); len(list) != 0 {
+		t.Fatalf("ListBlockedIPs after unblock = %+v", list)
+	}
+}
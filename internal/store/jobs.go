@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type Job struct {
+	ID         int64
+	UserID     int64
+	KeyID      int64
+	Kind       string
+	Region     string
+	Target     string
+	Params     string
+	Status     string
+	Error      string
+	Attempts   int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+type JobStep struct {
+	CreatedAt time.Time
+	Message   string
+}
+
+func (j Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+const jobColumns = `id, user_id, key_id, kind, region, target, params, status, error, attempts, created_at, updated_at, COALESCE(started_at, ''), COALESCE(finished_at, '')`
+
+func scanJob(row interface{ Scan(...any) error }) (*Job, error) {
+	var (
+		j                                   Job
+		created, updated, started, finished string
+	)
+	if err := row.Scan(&j.ID, &j.UserID, &j.KeyID, &j.Kind, &j.Region, &j.Target, &j.Params, &j.Status, &j.Error, &j.Attempts, &created, &updated, &started, &finished); err != nil {
+		return nil, err
+	}
+	j.CreatedAt = parseTime(created)
+	j.UpdatedAt = parseTime(updated)
+	j.StartedAt = parseTime(started)
+	j.FinishedAt = parseTime(finished)
+	return &j, nil
+}
+
+func (s *Store) CreateJob(ctx context.Context, j Job) (int64, error) {
+	now := time.Now().UTC().Format(timeLayout)
+	res, err := s.db.ExecContext(ctx, `INSERT INTO jobs (user_id, key_id, kind, region, target, params, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		j.UserID, j.KeyID, j.Kind, j.Region, j.Target, j.Params, JobQueued, now, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) GetJob(ctx context.Context, id int64) (*Job, error) {
+	j, err := scanJob(s.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ? LIMIT 1;`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	return j, err
+}
+
+func (s *Store) ListJobs(ctx context.Context, userID int64, limit int) ([]Job, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE user_id = ? ORDER BY id DESC LIMIT ?;`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *j)
+	}
+	return out, rows.Err()
+}
+
+// ClaimNextJob 把最早的 queued 任务标记为 running 并返回；没有任务时返回 nil。
+func (s *Store) ClaimNextJob(ctx context.Context) (*Job, error) {
+	for {
+		var id int64
+		err := s.db.QueryRowContext(ctx, `SELECT id FROM jobs WHERE status = ? ORDER BY id ASC LIMIT 1;`, JobQueued).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC().Format(timeLayout)
+		res, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = ?, attempts = attempts + 1, started_at = ?, updated_at = ? WHERE id = ? AND status = ?;`, JobRunning, now, now, id, JobQueued)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			// 被其他 worker 抢先领取
+			continue
+		}
+		return s.GetJob(ctx, id)
+	}
+}
+
+func (s *Store) AddJobStep(ctx context.Context, jobID int64, message string) error {
+	now := time.Now().UTC().Format(timeLayout)
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO job_steps (job_id, created_at, message) VALUES (?, ?, ?);`, jobID, now, message); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET updated_at = ? WHERE id = ?;`, now, jobID)
+	return err
+}
+
+func (s *Store) ListJobSteps(ctx context.Context, jobID int64) ([]JobStep, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT created_at, message FROM job_steps WHERE job_id = ? ORDER BY id ASC;`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []JobStep
+	for rows.Next() {
+		var (
+			st  JobStep
+			raw string
+		)
+		if err := rows.Scan(&raw, &st.Message); err != nil {
+			return nil, err
+		}
+		st.CreatedAt = parseTime(raw)
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) FinishJob(ctx context.Context, jobID int64, status, errText string) error {
+	now := time.Now().UTC().Format(timeLayout)
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = ?, error = ?, finished_at = ?, updated_at = ? WHERE id = ?;`, status, errText, now, now, jobID)
+	return err
+}
+
+// RequeueJob 把中断的任务放回队列，由 worker 重新执行。
+func (s *Store) RequeueJob(ctx context.Context, jobID int64) error {
+	now := time.Now().UTC().Format(timeLayout)
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = ?, updated_at = ? WHERE id = ?;`, JobQueued, now, jobID)
+	return err
+}
+
+// ListJobsByStatus 用于启动时找出上次进程退出时仍在执行的任务。
+func (s *Store) ListJobsByStatus(ctx context.Context, status string) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE status = ? ORDER BY id ASC;`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *j)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,400 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaTooNew 表示数据库由更新版本的程序迁移过，当前二进制不能安全使用。
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations 按 version 递增排列，只能追加，不能修改已发布的条目。
+var migrations = []migration{
+	{version: 1, name: "baseline", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			is_admin INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			access_key TEXT NOT NULL,
+			secret_key TEXT NOT NULL,
+			proxy TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);`,
+	)},
+	// 早期版本的 users 表没有 is_admin 列
+	{version: 2, name: "users_is_admin", up: addColumns("users", []columnDef{
+		{"is_admin", "INTEGER NOT NULL DEFAULT 0"},
+	})},
+	{version: 3, name: "api_keys_quota", up: addColumns("api_keys", []columnDef{
+		{"quota_region", "TEXT NOT NULL DEFAULT ''"},
+		{"quota_on", "TEXT NOT NULL DEFAULT ''"},
+		{"quota_spot", "TEXT NOT NULL DEFAULT ''"},
+		{"quota_on_name", "TEXT NOT NULL DEFAULT ''"},
+		{"quota_sp_name", "TEXT NOT NULL DEFAULT ''"},
+	})},
+	{version: 4, name: "settings_defaults", up: execStatements(
+		`INSERT OR IGNORE INTO settings (key, value) VALUES ('registration_open', '1');`,
+	)},
+	{version: 5, name: "audit_events", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			username TEXT NOT NULL DEFAULT '',
+			key_id INTEGER NOT NULL DEFAULT 0,
+			service TEXT NOT NULL DEFAULT '',
+			region TEXT NOT NULL DEFAULT '',
+			instance TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			params TEXT NOT NULL DEFAULT '',
+			result TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			client_ip TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_created ON audit_events(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_user ON audit_events(user_id, created_at);`,
+	)},
+	{version: 6, name: "jobs", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			key_id INTEGER NOT NULL DEFAULT 0,
+			kind TEXT NOT NULL,
+			region TEXT NOT NULL DEFAULT '',
+			target TEXT NOT NULL DEFAULT '',
+			params TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			started_at TIMESTAMP,
+			finished_at TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id, id);`,
+		`CREATE TABLE IF NOT EXISTS job_steps (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_id INTEGER NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			message TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_job_steps_job ON job_steps(job_id, id);`,
+	)},
+	{version: 7, name: "api_tokens", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			prefix TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP,
+			last_used_ip TEXT NOT NULL DEFAULT '',
+			revoked_at TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id, id);`,
+	)},
+	{version: 8, name: "sessions", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL DEFAULT 0,
+			data TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			ip TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_last_seen ON sessions(last_seen);`,
+	)},
+	{version: 9, name: "ami_presets", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS ami_presets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			region TEXT NOT NULL,
+			name TEXT NOT NULL,
+			ami_id TEXT NOT NULL,
+			architecture TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, region, ami_id)
+		);`,
+	)},
+	{version: 10, name: "firewall_profiles", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS firewall_profiles (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			rules TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, name)
+		);`,
+	)},
+	{version: 11, name: "ssh_keys", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS ssh_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, name)
+		);`,
+	)},
+	{version: 12, name: "transfer_guards", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS transfer_guards (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			key_id INTEGER NOT NULL,
+			region TEXT NOT NULL,
+			instance TEXT NOT NULL DEFAULT '',
+			basis TEXT NOT NULL,
+			threshold INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS transfer_guard_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			guard_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			region TEXT NOT NULL,
+			instance TEXT NOT NULL,
+			period TEXT NOT NULL,
+			percent REAL NOT NULL,
+			action TEXT NOT NULL,
+			result TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			job_id INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(guard_id, instance, period)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_guard_events_user ON transfer_guard_events(user_id, id);`,
+	)},
+	{version: 13, name: "dns_bindings", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS dns_providers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			config TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, name)
+		);`,
+		`CREATE TABLE IF NOT EXISTS dns_bindings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			provider_id INTEGER NOT NULL,
+			key_id INTEGER NOT NULL,
+			service TEXT NOT NULL,
+			region TEXT NOT NULL,
+			instance TEXT NOT NULL,
+			zone TEXT NOT NULL,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			ttl INTEGER NOT NULL DEFAULT 0,
+			last_value TEXT NOT NULL DEFAULT '',
+			last_error TEXT NOT NULL DEFAULT '',
+			synced_at TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(provider_id, name, type)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_dns_bindings_instance ON dns_bindings(key_id, region, instance);`,
+	)},
+	{version: 14, name: "swap_attempts", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS swap_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_id INTEGER NOT NULL DEFAULT 0,
+			user_id INTEGER NOT NULL,
+			key_id INTEGER NOT NULL,
+			region TEXT NOT NULL,
+			instance TEXT NOT NULL,
+			attempt INTEGER NOT NULL,
+			ip TEXT NOT NULL,
+			ok INTEGER NOT NULL DEFAULT 0,
+			detail TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_swap_attempts_instance ON swap_attempts(user_id, region, instance, id);`,
+	)},
+	{version: 15, name: "ip_history", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS ip_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			key_id INTEGER NOT NULL,
+			region TEXT NOT NULL,
+			instance TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			static INTEGER NOT NULL DEFAULT 0,
+			assigned_at TEXT NOT NULL DEFAULT '',
+			released_at TEXT NOT NULL DEFAULT '',
+			release_reason TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_ip_history_instance ON ip_history(key_id, region, instance, released_at);`,
+		`CREATE TABLE IF NOT EXISTS ip_blocklist (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			key_id INTEGER NOT NULL,
+			ip TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(key_id, ip)
+		);`,
+	)},
+	{version: 16, name: "held_static_ips", up: execStatements(
+		`CREATE TABLE IF NOT EXISTS held_static_ips (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			key_id INTEGER NOT NULL,
+			job_id INTEGER NOT NULL DEFAULT 0,
+			region TEXT NOT NULL,
+			instance TEXT NOT NULL,
+			name TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			new_ip TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			retry_at TEXT NOT NULL DEFAULT '',
+			expires_at TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			finished_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_held_static_ips_status ON held_static_ips(status, expires_at);`,
+	)},
+}
+
+func (s *Store) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`); err != nil {
+		return err
+	}
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("%w: database at version %d, binary knows up to %d", ErrSchemaTooNew, current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) applyMigration(ctx context.Context, m migration) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if err = m.up(ctx, tx); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?);`, m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion 返回已应用的最大迁移版本，未迁移过的数据库返回 0。
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations;`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+func execStatements(stmts ...string) func(context.Context, *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, q := range stmts {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type columnDef struct {
+	name string
+	def  string
+}
+
+// addColumns 只添加缺失的列，兼容引入迁移之前由 ensure*Columns 补过列的旧数据库。
+func addColumns(table string, cols []columnDef) func(context.Context, *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		existing, err := tableColumns(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+		for _, col := range cols {
+			if _, ok := existing[col.name]; ok {
+				continue
+			}
+			stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, col.name, col.def)
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) (map[string]struct{}, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	existing := make(map[string]struct{})
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal *string
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return nil, err
+		}
+		existing[name] = struct{}{}
+	}
+	return existing, rows.Err()
+}
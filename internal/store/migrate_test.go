@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	got, err := s.SchemaVersion(context.Background())
+	if err != nil {
+		t.Fatalf("SchemaVersion: %v", err)
+	}
+	if want := migrations[len(migrations)-1].version; got != want {
+		t.Fatalf("SchemaVersion() = %d, want %d", got, want)
+	}
+	if err := s.migrate(context.Background()); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	legacy := []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL UNIQUE, password_hash TEXT NOT NULL, created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);`,
+		`CREATE TABLE api_keys (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, name TEXT NOT NULL, access_key TEXT NOT NULL, secret_key TEXT NOT NULL, proxy TEXT NOT NULL DEFAULT '', created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);`,
+		`INSERT INTO api_keys (user_id, name, access_key, secret_key) VALUES (1, 'old', 'AK', 'SK');`,
+	}
+	for _, q := range legacy {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("legacy schema: %v", err)
+		}
+	}
+	db.Close()
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+	keys, err := s.ListKeys(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].SecretKey != "SK" || keys[0].QuotaRegion != "" {
+		t.Fatalf("ListKeys() = %+v, want legacy row with empty quota", keys)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	future := migrations[len(migrations)-1].version + 1
+	if _, err := s.db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'future');`, future); err != nil {
+		t.Fatalf("insert future version: %v", err)
+	}
+	s.db.Close()
+
+	if _, err := NewSQLiteStore(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("NewSQLiteStore() err = %v, want ErrSchemaTooNew", err)
+	}
+}
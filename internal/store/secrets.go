@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// rewriteSecretsRounds 是重写密钥的最多轮数：被并发修改而跳过的行在下一轮重新读取后再处理。
+const rewriteSecretsRounds = 3
+
+// ErrSecretsChanged 表示重写结束时仍有行因并发修改被跳过，这些行可能还在使用旧 master key。
+var ErrSecretsChanged = errors.New("secrets changed concurrently during rewrite")
+
+// SetKeyring 配置用于加解密 api_keys 中 access_key / secret_key 的 master key。
+func (s *Store) SetKeyring(k *Keyring) {
+	s.keyring = k
+}
+
+func (s *Store) sealSecret(val string) (string, error) {
+	if s.keyring == nil {
+		return "", ErrNoKeyring
+	}
+	return s.keyring.Encrypt(val)
+}
+
+func (s *Store) openSecret(val string) (string, error) {
+	if !isEncrypted(val) {
+		return val, nil
+	}
+	if s.keyring == nil {
+		return "", ErrNoKeyring
+	}
+	return s.keyring.Decrypt(val)
+}
+
+// HasEncryptedSecrets 返回数据库中是否已有用 master key 加密的数据（api_keys 或 DNS 服务商配置）。
+func (s *Store) HasEncryptedSecrets(ctx context.Context) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM api_keys WHERE substr(access_key, 1, ?) = ? OR substr(secret_key, 1, ?) = ?) +
+		(SELECT COUNT(*) FROM dns_providers WHERE substr(config, 1, ?) = ?);`,
+		len(encPrefix), encPrefix, len(encPrefix), encPrefix, len(encPrefix), encPrefix).Scan(&n)
+	return n > 0, err
+}
+
+// EncryptPlaintextKeys 把历史明文存储的密钥加密（一次性迁移，可重复执行）。
+func (s *Store) EncryptPlaintextKeys(ctx context.Context) (int, error) {
+	if s.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+	return s.rewriteSecrets(ctx, func(val string) (string, bool, error) {
+		if isEncrypted(val) {
+			return val, false, nil
+		}
+		out, err := s.keyring.Encrypt(val)
+		return out, true, err
+	})
+}
+
+// RotateMasterKey 用当前 master key 重新包裹所有密钥（含 DNS 服务商配置）的数据密钥。
+// 旧 master key 需作为 previous 传给 NewKeyring，运行中的服务只要同时持有新旧 key 即可不停机完成轮换。
+func (s *Store) RotateMasterKey(ctx context.Context) (int, error) {
+	if s.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+	return s.rewriteSecrets(ctx, s.keyring.Rewrap)
+}
+
+// rewriteSecrets 反复执行 rewriteKeySecrets，直到没有行被跳过；最后一轮仍有跳过的行时返回 ErrSecretsChanged。
+func (s *Store) rewriteSecrets(ctx context.Context, fn func(string) (string, bool, error)) (int, error) {
+	total := 0
+	for round := 1; ; round++ {
+		updated, skipped, err := s.rewriteKeySecrets(ctx, fn)
+		total += updated
+		if err != nil || skipped == 0 {
+			return total, err
+		}
+		if round == rewriteSecretsRounds {
+			return total, fmt.Errorf("%w：%d 行未能重写，请重新执行", ErrSecretsChanged, skipped)
+		}
+	}
+}
+
+// rewriteKeySecrets 在一个事务里重写所有密钥，返回重写的行数和因并发修改而跳过的行数。
+func (s *Store) rewriteKeySecrets(ctx context.Context, fn func(string) (string, bool, error)) (updated, skipped int, err error) {
+	type row struct {
+		id     int64
+		ak, sk string
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, access_key, secret_key FROM api_keys ORDER BY id ASC;`)
+	if err != nil {
+		return 0, 0, err
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.ak, &r.sk); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		pending = append(pending, r)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, 0, err
+	}
+	rows.Close()
+	providers, err := s.pendingDNSProviderSecrets(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	// 只在值未被并发修改时写回，避免覆盖运行中服务刚写入的新密钥；没写入的行计为跳过
+	exec := func(query string, args ...any) error {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 1 {
+			updated++
+		} else {
+			skipped++
+		}
+		return nil
+	}
+	for _, r := range pending {
+		ak, akChanged, ferr := fn(r.ak)
+		if ferr != nil {
+			err = fmt.Errorf("api key %d: %w", r.id, ferr)
+			return 0, 0, err
+		}
+		sk, skChanged, ferr := fn(r.sk)
+		if ferr != nil {
+			err = fmt.Errorf("api key %d: %w", r.id, ferr)
+			return 0, 0, err
+		}
+		if !akChanged && !skChanged {
+			continue
+		}
+		if err = exec(`UPDATE api_keys SET access_key = ?, secret_key = ? WHERE id = ? AND access_key = ? AND secret_key = ?;`, ak, sk, r.id, r.ak, r.sk); err != nil {
+			return 0, 0, err
+		}
+	}
+	// DNS 服务商配置同样含密钥，与 api_keys 在同一事务里处理
+	for id, cfg := range providers {
+		out, changed, ferr := fn(cfg)
+		if ferr != nil {
+			err = fmt.Errorf("dns provider %d: %w", id, ferr)
+			return 0, 0, err
+		}
+		if !changed {
+			continue
+		}
+		if err = exec(`UPDATE dns_providers SET config = ? WHERE id = ? AND config = ?;`, out, id, cfg); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return updated, skipped, nil
+}
+
+func (s *Store) pendingDNSProviderSecrets(ctx context.Context) (map[int64]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, config FROM dns_providers;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int64]string)
+	for rows.Next() {
+		var (
+			id  int64
+			cfg string
+		)
+		if err := rows.Scan(&id, &cfg); err != nil {
+			return nil, err
+		}
+		out[id] = cfg
+	}
+	return out, rows.Err()
+}
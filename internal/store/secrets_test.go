@@ -0,0 +1,89 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasEncryptedSecrets(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	if ok, err := s.HasEncryptedSecrets(ctx); err != nil || ok {
+		t.Fatalf("empty store = %v, %v", ok, err)
+	}
+	ring, _ := NewKeyring(bytes.Repeat([]byte{5}, masterKeyLen))
+	s.SetKeyring(ring)
+	if _, err := s.CreateKey(ctx, 1, "main", "AKIAEXAMPLE1234", "secret", ""); err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if ok, err := s.HasEncryptedSecrets(ctx); err != nil || !ok {
+		t.Fatalf("after CreateKey = %v, %v", ok, err)
+	}
+}
+
+func TestRotateMasterKeySkipsConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	oldKey := bytes.Repeat([]byte{6}, masterKeyLen)
+	ring, _ := NewKeyring(oldKey)
+	s.SetKeyring(ring)
+	id, err := s.CreateKey(ctx, 1, "main", "AKIAEXAMPLE1234", "secret", "")
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	rotating, _ := NewKeyring(bytes.Repeat([]byte{7}, masterKeyLen), oldKey)
+	s.SetKeyring(rotating)
+
+	// 重写途中另一个连接改写了这一行：这一轮不计入，下一轮重新读取后再重写
+	writes := 0
+	concurrent := func(times int) func(string) (string, bool, error) {
+		return func(val string) (string, bool, error) {
+			if writes < times {
+				writes++
+				sealed, _ := ring.Encrypt("secret-" + string(rune('a'+writes)))
+				if _, err := s.db.ExecContext(ctx, `UPDATE api_keys SET secret_key = ? WHERE id = ?;`, sealed, id); err != nil {
+					t.Fatalf("concurrent update: %v", err)
+				}
+			}
+			return rotating.Rewrap(val)
+		}
+	}
+	if updated, skipped, err := s.rewriteKeySecrets(ctx, concurrent(1)); err != nil || updated != 0 || skipped != 1 {
+		t.Fatalf("rewriteKeySecrets = %d, %d, %v", updated, skipped, err)
+	}
+	writes = 0
+	if n, err := s.rewriteSecrets(ctx, concurrent(1)); err != nil || n != 1 {
+		t.Fatalf("rewriteSecrets after one concurrent write = %d, %v", n, err)
+	}
+
+	// 每一轮都被改写时报告仍未重写的行
+	if _, err := s.db.ExecContext(ctx, `UPDATE api_keys SET access_key = ? WHERE id = ?;`, mustEncrypt(t, ring, "AKIAEXAMPLE1234"), id); err != nil {
+		t.Fatal(err)
+	}
+	writes = 0
+	if _, err := s.rewriteSecrets(ctx, concurrent(rewriteSecretsRounds*2)); !errors.Is(err, ErrSecretsChanged) {
+		t.Fatalf("rewriteSecrets with constant writes err = %v, want ErrSecretsChanged", err)
+	}
+}
+
+func mustEncrypt(t *testing.T, k *Keyring, val string) string {
+	t.Helper()
+	out, err := k.Encrypt(val)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	return out
+}
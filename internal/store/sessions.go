@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"aws-lightsail-go/internal/session"
+)
+
+// SessionBackend 把登录会话保存在 sessions 表，服务重启后会话仍然有效。
+type SessionBackend struct {
+	s *Store
+}
+
+var _ session.Backend = (*SessionBackend)(nil)
+
+func (s *Store) SessionBackend() *SessionBackend {
+	return &SessionBackend{s: s}
+}
+
+func (b *SessionBackend) Load(ctx context.Context, id string) (*session.Record, error) {
+	var (
+		rec                     session.Record
+		data, created, lastSeen string
+	)
+	err := b.s.db.QueryRowContext(ctx, `SELECT id, user_id, data, created_at, last_seen, ip, user_agent FROM sessions WHERE id = ? LIMIT 1;`, id).
+		Scan(&rec.ID, &rec.UserID, &data, &created, &lastSeen, &rec.IP, &rec.UserAgent)
+	if err == sql.ErrNoRows {
+		return nil, session.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &rec.Data); err != nil {
+		return nil, err
+	}
+	rec.CreatedAt = parseTime(created)
+	rec.LastSeen = parseTime(lastSeen)
+	return &rec, nil
+}
+
+func (b *SessionBackend) Save(ctx context.Context, rec *session.Record) error {
+	data, err := json.Marshal(rec.Data)
+	if err != nil {
+		return err
+	}
+	_, err = b.s.db.ExecContext(ctx, `INSERT INTO sessions (id, user_id, data, created_at, last_seen, ip, user_agent) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET user_id = excluded.user_id, data = excluded.data, last_seen = excluded.last_seen, ip = excluded.ip, user_agent = excluded.user_agent;`,
+		rec.ID, rec.UserID, string(data), rec.CreatedAt.UTC().Format(timeLayout), rec.LastSeen.UTC().Format(timeLayout), rec.IP, rec.UserAgent)
+	return err
+}
+
+func (b *SessionBackend) Touch(ctx context.Context, id string, at time.Time, ip string) error {
+	_, err := b.s.db.ExecContext(ctx, `UPDATE sessions SET last_seen = ?, ip = ? WHERE id = ?;`, at.UTC().Format(timeLayout), ip, id)
+	return err
+}
+
+func (b *SessionBackend) Delete(ctx context.Context, id string) error {
+	_, err := b.s.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?;`, id)
+	return err
+}
+
+func (b *SessionBackend) ListByUser(ctx context.Context, userID int64) ([]session.Info, error) {
+	rows, err := b.s.db.QueryContext(ctx, `SELECT id, user_id, created_at, last_seen, ip, user_agent FROM sessions WHERE user_id = ? ORDER BY last_seen DESC;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []session.Info
+	for rows.Next() {
+		var (
+			info              session.Info
+			created, lastSeen string
+		)
+		if err := rows.Scan(&info.ID, &info.UserID, &created, &lastSeen, &info.IP, &info.UserAgent); err != nil {
+			return nil, err
+		}
+		info.CreatedAt = parseTime(created)
+		info.LastSeen = parseTime(lastSeen)
+		out = append(out, info)
+	}
+	return out, rows.Err()
+}
+
+func (b *SessionBackend) DeleteByUser(ctx context.Context, userID int64) (int, error) {
+	res, err := b.s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?;`, userID)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (b *SessionBackend) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := b.s.db.ExecContext(ctx, `DELETE FROM sessions WHERE last_seen < ?;`, before.UTC().Format(timeLayout))
+	return err
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aws-lightsail-go/internal/session"
+)
+
+func TestSessionBackendSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "app.db")
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	sessions := session.NewStore(s.SessionBackend(), time.Hour)
+	sess, err := sessions.Load(ctx, "sid", "10.0.0.1", "curl")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	sess.SetString("user_id", "5")
+	sess.SetString("region", "ap-northeast-1")
+	if err := sessions.Save(ctx, sess); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	s.db.Close()
+
+	s, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.db.Close()
+	sessions = session.NewStore(s.SessionBackend(), time.Hour)
+	sess, err = sessions.Load(ctx, "sid", "10.0.0.1", "curl")
+	if err != nil {
+		t.Fatalf("Load after reopen: %v", err)
+	}
+	if got := sess.GetString("region", ""); got != "ap-northeast-1" {
+		t.Fatalf("region = %q, want ap-northeast-1", got)
+	}
+	list, err := sessions.ListUser(ctx, 5)
+	if err != nil || len(list) != 1 || list[0].UserAgent != "curl" {
+		t.Fatalf("ListUser = %+v, %v", list, err)
+	}
+	if err := s.DeleteUser(ctx, 5); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if list, _ := sessions.ListUser(ctx, 5); len(list) != 0 {
+		t.Fatalf("sessions left after DeleteUser: %+v", list)
+	}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSSHKeyNotFound = errors.New("ssh key not found")
+	ErrSSHKeyExists   = errors.New("ssh key already exists")
+)
+
+// SSHKey 是用户保存的 SSH 公钥，创建实例时按需导入为 Lightsail / EC2 密钥对。
+type SSHKey struct {
+	ID          int64
+	UserID      int64
+	Name        string
+	PublicKey   string
+	Fingerprint string
+	CreatedAt   time.Time
+}
+
+func (s *Store) CreateSSHKey(ctx context.Context, k *SSHKey) error {
+	k.Name = strings.TrimSpace(k.Name)
+	k.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO ssh_keys (user_id, name, public_key, fingerprint, created_at) VALUES (?, ?, ?, ?, ?);`,
+		k.UserID, k.Name, k.PublicKey, k.Fingerprint, k.CreatedAt.Format(timeLayout))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return ErrSSHKeyExists
+		}
+		return err
+	}
+	k.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Store) ListSSHKeys(ctx context.Context, userID int64) ([]SSHKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, name, public_key, fingerprint, created_at FROM ssh_keys WHERE user_id = ? ORDER BY name;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SSHKey
+	for rows.Next() {
+		var (
+			k       SSHKey
+			created string
+		)
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.PublicKey, &k.Fingerprint, &created); err != nil {
+			return nil, err
+		}
+		k.CreatedAt = parseTime(created)
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetSSHKey(ctx context.Context, userID, id int64) (*SSHKey, error) {
+	var (
+		k       SSHKey
+		created string
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT id, user_id, name, public_key, fingerprint, created_at FROM ssh_keys WHERE id = ? AND user_id = ?;`, id, userID).
+		Scan(&k.ID, &k.UserID, &k.Name, &k.PublicKey, &k.Fingerprint, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSSHKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	k.CreatedAt = parseTime(created)
+	return &k, nil
+}
+
+func (s *Store) DeleteSSHKey(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM ssh_keys WHERE id = ? AND user_id = ?;`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSSHKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// SwapAttempt 是「换 IP 直到可达」过程中换到的一个静态 IP 及其探测结果。
+type SwapAttempt struct {
+	ID        int64
+	JobID     int64
+	UserID    int64
+	KeyID     int64
+	Region    string
+	Instance  string
+	Attempt   int
+	IP        string
+	OK        bool
+	Detail    string
+	CreatedAt time.Time
+}
+
+func (s *Store) RecordSwapAttempt(ctx context.Context, a *SwapAttempt) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO swap_attempts (job_id, user_id, key_id, region, instance, attempt, ip, ok, detail, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		a.JobID, a.UserID, a.KeyID, a.Region, a.Instance, a.Attempt, a.IP, a.OK, a.Detail, a.CreatedAt.UTC().Format(timeLayout))
+	if err != nil {
+		return err
+	}
+	a.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListSwapAttempts 返回某台实例最近换到过的 IP，新的在前。
+func (s *Store) ListSwapAttempts(ctx context.Context, userID int64, region, instance string, limit int) ([]SwapAttempt, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, job_id, user_id, key_id, region, instance, attempt, ip, ok, detail, created_at FROM swap_attempts WHERE user_id = ? AND region = ? AND instance = ? ORDER BY id DESC LIMIT ?;`, userID, region, instance, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SwapAttempt
+	for rows.Next() {
+		var (
+			a       SwapAttempt
+			created string
+		)
+		if err := rows.Scan(&a.ID, &a.JobID, &a.UserID, &a.KeyID, &a.Region, &a.Instance, &a.Attempt, &a.IP, &a.OK, &a.Detail, &created); err != nil {
+			return nil, err
+		}
+		a.CreatedAt = parseTime(created)
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
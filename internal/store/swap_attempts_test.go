@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestSwapAttempts(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	for i, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+		a := &SwapAttempt{JobID: 9, UserID: 1, KeyID: 2, Region: "us-east-1", Instance: "vps-1", Attempt: i + 1, IP: ip, OK: i == 1, Detail: "TCP 22"}
+		if err := s.RecordSwapAttempt(ctx, a); err != nil || a.ID == 0 {
+			t.Fatalf("RecordSwapAttempt = %+v, %v", a, err)
+		}
+	}
+	if err := s.RecordSwapAttempt(ctx, &SwapAttempt{UserID: 1, KeyID: 2, Region: "us-east-1", Instance: "vps-2", Attempt: 1, IP: "203.0.113.3"}); err != nil {
+		t.Fatalf("RecordSwapAttempt(other instance): %v", err)
+	}
+	list, err := s.ListSwapAttempts(ctx, 1, "us-east-1", "vps-1", 0)
+	if err != nil || len(list) != 2 || list[0].IP != "203.0.113.2" || !list[0].OK || list[1].OK || list[1].CreatedAt.IsZero() {
+		t.Fatalf("ListSwapAttempts = %+v, %v", list, err)
+	}
+	if list, _ := s.ListSwapAttempts(ctx, 2, "us-east-1", "vps-1", 0); len(list) != 0 {
+		t.Fatalf("ListSwapAttempts(other user) = %+v", list)
+	}
+	if err := s.DeleteUser(ctx, 1); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if list, _ := s.ListSwapAttempts(ctx, 1, "us-east-1", "vps-2", 0); len(list) != 0 {
+		t.Fatalf("attempts left after DeleteUser: %+v", list)
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// API token 权限范围
+const (
+	TokenScopeRead    = "read"
+	TokenScopeOperate = "operate"
+	TokenScopeAdmin   = "admin"
+)
+
+// tokenPrefix 便于在日志和代码仓库中识别泄露的 token。
+const tokenPrefix = "asp_"
+
+var (
+	ErrTokenNotFound = errors.New("api token not found")
+	ErrInvalidScope  = errors.New("invalid token scope")
+)
+
+type APIToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Prefix     string
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	LastUsedIP string
+	RevokedAt  time.Time
+
+	// 仅 LookupAPIToken 填充
+	Username string
+	IsAdmin  bool
+}
+
+func (t APIToken) Revoked() bool {
+	return !t.RevokedAt.IsZero()
+}
+
+func ValidTokenScope(scope string) bool {
+	switch scope {
+	case TokenScopeRead, TokenScopeOperate, TokenScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// 只保存 SHA-256：token 本身是 32 字节随机数，不需要慢哈希。
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken 生成新 token 并返回明文，明文只在此时可见。
+func (s *Store) CreateAPIToken(ctx context.Context, userID int64, name, scope string) (string, *APIToken, error) {
+	if !ValidTokenScope(scope) {
+		return "", nil, ErrInvalidScope
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	raw := tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	now := time.Now().UTC()
+	t := &APIToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    raw[:len(tokenPrefix)+6],
+		Scope:     scope,
+		CreatedAt: now,
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO api_tokens (user_id, name, token_hash, prefix, scope, created_at) VALUES (?, ?, ?, ?, ?, ?);`,
+		t.UserID, t.Name, hashToken(raw), t.Prefix, t.Scope, now.Format(timeLayout))
+	if err != nil {
+		return "", nil, err
+	}
+	if t.ID, err = res.LastInsertId(); err != nil {
+		return "", nil, err
+	}
+	return raw, t, nil
+}
+
+const tokenColumns = `t.id, t.user_id, t.name, t.prefix, t.scope, t.created_at, COALESCE(t.last_used_at, ''), t.last_used_ip, COALESCE(t.revoked_at, '')`
+
+func scanToken(row interface{ Scan(...any) error }, extra ...any) (*APIToken, error) {
+	var (
+		t                      APIToken
+		created, used, revoked string
+	)
+	dest := append([]any{&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scope, &created, &used, &t.LastUsedIP, &revoked}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	t.CreatedAt = parseTime(created)
+	t.LastUsedAt = parseTime(used)
+	t.RevokedAt = parseTime(revoked)
+	return &t, nil
+}
+
+func (s *Store) ListAPITokens(ctx context.Context, userID int64) ([]APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumns+` FROM api_tokens t WHERE t.user_id = ? ORDER BY t.id DESC;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []APIToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIToken 吊销属于 userID 的 token；记录保留用于查看历史。
+func (s *Store) RevokeAPIToken(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL;`,
+		time.Now().UTC().Format(timeLayout), id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// LookupAPIToken 校验明文 token，返回未吊销的 token 及其所属用户信息。
+func (s *Store) LookupAPIToken(ctx context.Context, raw string) (*APIToken, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, tokenPrefix) {
+		return nil, ErrTokenNotFound
+	}
+	var (
+		username string
+		isAdmin  int
+	)
+	t, err := scanToken(s.db.QueryRowContext(ctx, `SELECT `+tokenColumns+`, u.username, u.is_admin FROM api_tokens t JOIN users u ON u.id = t.user_id WHERE t.token_hash = ? AND t.revoked_at IS NULL LIMIT 1;`, hashToken(raw)), &username, &isAdmin)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Username = username
+	t.IsAdmin = isAdmin == 1
+	return t, nil
+}
+
+// TouchAPIToken 记录 token 最近一次使用的时间和来源 IP。
+func (s *Store) TouchAPIToken(ctx context.Context, id int64, ip string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?;`,
+		time.Now().UTC().Format(timeLayout), ip, id)
+	return err
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPITokenLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+	u, err := s.CreateUser(ctx, "alice", "pw")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if _, _, err := s.CreateAPIToken(ctx, u.ID, "bad", "root"); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("CreateAPIToken(bad scope) err = %v, want ErrInvalidScope", err)
+	}
+	raw, tok, err := s.CreateAPIToken(ctx, u.ID, "ci", TokenScopeRead)
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if !strings.HasPrefix(raw, tok.Prefix) {
+		t.Fatalf("token %q does not start with prefix %q", raw, tok.Prefix)
+	}
+	var stored string
+	if err := s.db.QueryRow(`SELECT token_hash FROM api_tokens WHERE id = ?;`, tok.ID).Scan(&stored); err != nil {
+		t.Fatalf("read hash: %v", err)
+	}
+	if stored == raw || strings.Contains(stored, raw) {
+		t.Fatalf("token stored in plaintext")
+	}
+
+	got, err := s.LookupAPIToken(ctx, raw)
+	if err != nil {
+		t.Fatalf("LookupAPIToken: %v", err)
+	}
+	if got.UserID != u.ID || got.Username != "alice" || got.Scope != TokenScopeRead {
+		t.Fatalf("LookupAPIToken() = %+v", got)
+	}
+	if _, err := s.LookupAPIToken(ctx, raw+"x"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("LookupAPIToken(wrong) err = %v, want ErrTokenNotFound", err)
+	}
+
+	if err := s.TouchAPIToken(ctx, tok.ID, "203.0.113.7"); err != nil {
+		t.Fatalf("TouchAPIToken: %v", err)
+	}
+	list, err := s.ListAPITokens(ctx, u.ID)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListAPITokens() = %v, %v", list, err)
+	}
+	if list[0].LastUsedIP != "203.0.113.7" || list[0].LastUsedAt.IsZero() {
+		t.Fatalf("last used not recorded: %+v", list[0])
+	}
+
+	if err := s.RevokeAPIToken(ctx, u.ID+1, tok.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("RevokeAPIToken(other user) err = %v, want ErrTokenNotFound", err)
+	}
+	if err := s.RevokeAPIToken(ctx, u.ID, tok.ID); err != nil {
+		t.Fatalf("RevokeAPIToken: %v", err)
+	}
+	if _, err := s.LookupAPIToken(ctx, raw); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("LookupAPIToken(revoked) err = %v, want ErrTokenNotFound", err)
+	}
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// TransferGuardBasisActual 按本月已用出站流量判断，TransferGuardBasisProjected 按月底预估的出站流量判断
+	TransferGuardBasisActual    = "actual"
+	TransferGuardBasisProjected = "projected"
+
+	TransferGuardActionNotify = "notify"
+	TransferGuardActionStop   = "stop"
+	TransferGuardActionSwapIP = "swapip"
+
+	// 触发记录的执行结果；提交了后台任务的记录在任务结束前为空，失败的记录在下一次检查时可以重新认领
+	TransferGuardResultOK     = "ok"
+	TransferGuardResultFailed = "failed"
+)
+
+var (
+	ErrTransferGuardNotFound = errors.New("transfer guard not found")
+	ErrInvalidTransferGuard  = errors.New("invalid transfer guard")
+)
+
+// TransferGuard 是流量保护策略：实例出站流量达到套餐配额的 Threshold% 时执行 Action。
+// Instance 为空表示对该密钥在 Region 下的所有实例生效。
+type TransferGuard struct {
+	ID        int64
+	UserID    int64
+	KeyID     int64
+	Region    string
+	Instance  string
+	Basis     string
+	Threshold int
+	Action    string
+	CreatedAt time.Time
+}
+
+func (g *TransferGuard) validate() error {
+	g.Region = strings.TrimSpace(g.Region)
+	g.Instance = strings.TrimSpace(g.Instance)
+	if g.KeyID == 0 || g.Region == "" || g.Threshold <= 0 || g.Threshold > 1000 {
+		return ErrInvalidTransferGuard
+	}
+	switch g.Basis {
+	case TransferGuardBasisActual, TransferGuardBasisProjected:
+	default:
+		return ErrInvalidTransferGuard
+	}
+	switch g.Action {
+	case TransferGuardActionNotify, TransferGuardActionStop, TransferGuardActionSwapIP:
+	default:
+		return ErrInvalidTransferGuard
+	}
+	return nil
+}
+
+// TransferGuardEvent 记录一次策略触发。同一策略对同一实例每个计费月（Period，如 2026-04）只成功触发一次。
+type TransferGuardEvent struct {
+	ID        int64
+	GuardID   int64
+	UserID    int64
+	Region    string
+	Instance  string
+	Period    string
+	Percent   float64
+	Action    string
+	Result    string
+	Error     string
+	JobID     int64
+	CreatedAt time.Time
+}
+
+func (s *Store) CreateTransferGuard(ctx context.Context, g *TransferGuard) error {
+	if err := g.validate(); err != nil {
+		return err
+	}
+	g.CreatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO transfer_guards (user_id, key_id, region, instance, basis, threshold, action, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+		g.UserID, g.KeyID, g.Region, g.Instance, g.Basis, g.Threshold, g.Action, g.CreatedAt.Format(timeLayout))
+	if err != nil {
+		return err
+	}
+	g.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListTransferGuards 返回用户的策略；userID 为 0 时返回所有用户的策略（供后台评估使用）。
+func (s *Store) ListTransferGuards(ctx context.Context, userID int64) ([]TransferGuard, error) {
+	q := `SELECT id, user_id, key_id, region, instance, basis, threshold, action, created_at FROM transfer_guards`
+	var args []any
+	if userID != 0 {
+		q += ` WHERE user_id = ?`
+		args = append(args, userID)
+	}
+	rows, err := s.db.QueryContext(ctx, q+` ORDER BY id;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []TransferGuard
+	for rows.Next() {
+		var (
+			g       TransferGuard
+			created string
+		)
+		if err := rows.Scan(&g.ID, &g.UserID, &g.KeyID, &g.Region, &g.Instance, &g.Basis, &g.Threshold, &g.Action, &created); err != nil {
+			return nil, err
+		}
+		g.CreatedAt = parseTime(created)
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) DeleteTransferGuard(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM transfer_guards WHERE id = ? AND user_id = ?;`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTransferGuardNotFound
+	}
+	return nil
+}
+
+// ClaimTransferGuardEvent 写入一条触发记录。本月已触发过时返回 false，调用方不应再执行动作。
+// 以下记录会被重新认领，让动作在下一次检查时重试：执行失败的；staleBefore 之前认领、至今没有结果，
+// 且对应任务不在排队、执行中也没有成功的（认领后进程退出，或任务在重启时被中断）。
+func (s *Store) ClaimTransferGuardEvent(ctx context.Context, e *TransferGuardEvent, staleBefore time.Time) (bool, error) {
+	e.CreatedAt = time.Now().UTC()
+	err := s.db.QueryRowContext(ctx, `INSERT INTO transfer_guard_events (guard_id, user_id, region, instance, period, percent, action, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(guard_id, instance, period) DO UPDATE SET percent = excluded.percent, action = excluded.action, result = '', error = '', job_id = 0, created_at = excluded.created_at
+		WHERE transfer_guard_events.result = ?
+			OR (transfer_guard_events.result = '' AND transfer_guard_events.created_at < ?
+				AND NOT EXISTS (SELECT 1 FROM jobs WHERE jobs.id = transfer_guard_events.job_id AND jobs.status IN (?, ?, ?)))
+		RETURNING id;`,
+		e.GuardID, e.UserID, e.Region, e.Instance, e.Period, e.Percent, e.Action, e.CreatedAt.Format(timeLayout),
+		TransferGuardResultFailed, staleBefore.UTC().Format(timeLayout), JobQueued, JobRunning, JobSucceeded).Scan(&e.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// FinishTransferGuardEvent 记录动作的执行结果；jobID 为对应后台任务，没有时为 0。
+func (s *Store) FinishTransferGuardEvent(ctx context.Context, id int64, result, errText string, jobID int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE transfer_guard_events SET result = ?, error = ?, job_id = ? WHERE id = ?;`, result, errText, jobID, id)
+	return err
+}
+
+// SetTransferGuardEventJob 记下动作提交的后台任务，结果留空，任务结束时由 FinishTransferGuardJob 回写。
+func (s *Store) SetTransferGuardEventJob(ctx context.Context, id, jobID int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE transfer_guard_events SET job_id = ? WHERE id = ?;`, jobID, id)
+	return err
+}
+
+// FinishTransferGuardJob 把后台任务的结果回写到对应的触发记录。
+func (s *Store) FinishTransferGuardJob(ctx context.Context, jobID int64, result, errText string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE transfer_guard_events SET result = ?, error = ? WHERE job_id = ? AND result = '';`, result, errText, jobID)
+	return err
+}
+
+func (s *Store) ListTransferGuardEvents(ctx context.Context, userID int64, limit int) ([]TransferGuardEvent, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, guard_id, user_id, region, instance, period, percent, action, result, error, job_id, created_at FROM transfer_guard_events WHERE user_id = ? ORDER BY id DESC LIMIT ?;`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []TransferGuardEvent
+	for rows.Next() {
+		var (
+			e       TransferGuardEvent
+			created string
+		)
+		if err := rows.Scan(&e.ID, &e.GuardID, &e.UserID, &e.Region, &e.Instance, &e.Period, &e.Percent, &e.Action, &e.Result, &e.Error, &e.JobID, &created); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = parseTime(created)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
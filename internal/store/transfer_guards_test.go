@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransferGuardFiresOncePerPeriod(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.db.Close()
+
+	if err := s.CreateTransferGuard(ctx, &TransferGuard{UserID: 1, KeyID: 1, Region: "us-east-1", Basis: "daily", Threshold: 80, Action: TransferGuardActionStop}); !errors.Is(err, ErrInvalidTransferGuard) {
+		t.Fatalf("CreateTransferGuard(bad basis) err = %v, want ErrInvalidTransferGuard", err)
+	}
+	g := &TransferGuard{UserID: 1, KeyID: 1, Region: "us-east-1", Basis: TransferGuardBasisProjected, Threshold: 90, Action: TransferGuardActionStop}
+	if err := s.CreateTransferGuard(ctx, g); err != nil {
+		t.Fatalf("CreateTransferGuard: %v", err)
+	}
+	if list, err := s.ListTransferGuards(ctx, 0); err != nil || len(list) != 1 || list[0].Threshold != 90 {
+		t.Fatalf("ListTransferGuards(all) = %+v, %v", list, err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	ev := &TransferGuardEvent{GuardID: g.ID, UserID: 1, Region: "us-east-1", Instance: "vps-1", Period: "2026-04", Percent: 93.5, Action: g.Action}
+	if ok, err := s.ClaimTransferGuardEvent(ctx, ev, past); err != nil || !ok {
+		t.Fatalf("first claim = %v, %v", ok, err)
+	}
+	// 执行失败的记录在下一次检查时重新认领
+	if err := s.FinishTransferGuardEvent(ctx, ev.ID, TransferGuardResultFailed, "enqueue failed", 0); err != nil {
+		t.Fatalf("FinishTransferGuardEvent(failed): %v", err)
+	}
+	retry := *ev
+	retry.Percent = 95
+	if ok, err := s.ClaimTransferGuardEvent(ctx, &retry, past); err != nil || !ok || retry.ID != ev.ID {
+		t.Fatalf("claim after failure = %v, %v, id %d", ok, err, retry.ID)
+	}
+	if err := s.FinishTransferGuardEvent(ctx, ev.ID, TransferGuardResultOK, "", 42); err != nil {
+		t.Fatalf("FinishTransferGuardEvent: %v", err)
+	}
+	again := *ev
+	if ok, err := s.ClaimTransferGuardEvent(ctx, &again, past); err != nil || ok {
+		t.Fatalf("second claim in same period = %v, %v", ok, err)
+	}
+	next := *ev
+	next.Period = "2026-05"
+	if ok, err := s.ClaimTransferGuardEvent(ctx, &next, past); err != nil || !ok {
+		t.Fatalf("claim in next period = %v, %v", ok, err)
+	}
+
+	// 提交了任务的记录在任务结束前不重新认领，任务失败后可以重试
+	jobID, err := s.CreateJob(ctx, Job{UserID: 1, KeyID: 1, Kind: "lightsail.stop", Region: "us-east-1", Target: "vps-1"})
+	if err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := s.SetTransferGuardEventJob(ctx, next.ID, jobID); err != nil {
+		t.Fatalf("SetTransferGuardEventJob: %v", err)
+	}
+	future := time.Now().Add(time.Hour)
+	pending := next
+	if ok, err := s.ClaimTransferGuardEvent(ctx, &pending, future); err != nil || ok {
+		t.Fatalf("claim with queued job = %v, %v", ok, err)
+	}
+	if err := s.FinishTransferGuardJob(ctx, jobID, TransferGuardResultFailed, "stop failed"); err != nil {
+		t.Fatalf("FinishTransferGuardJob: %v", err)
+	}
+	if ok, err := s.ClaimTransferGuardEvent(ctx, &pending, past); err != nil || !ok || pending.ID != next.ID {
+		t.Fatalf("claim after job failure = %v, %v", ok, err)
+	}
+	// 认领后没有结果（如进程退出）的记录超时后可以重新认领
+	if ok, err := s.ClaimTransferGuardEvent(ctx, &pending, past); err != nil || ok {
+		t.Fatalf("claim of fresh pending event = %v, %v", ok, err)
+	}
+	if ok, err := s.ClaimTransferGuardEvent(ctx, &pending, future); err != nil || !ok {
+		t.Fatalf("claim of stale pending event = %v, %v", ok, err)
+	}
+
+	events, err := s.ListTransferGuardEvents(ctx, 1, 10)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("ListTransferGuardEvents() = %+v, %v", events, err)
+	}
+	if events[1].JobID != 42 || events[1].Result != TransferGuardResultOK || events[1].Error != "" || events[1].Percent != 95 {
+		t.Fatalf("finished event = %+v", events[1])
+	}
+
+	if err := s.DeleteTransferGuard(ctx, 2, g.ID); !errors.Is(err, ErrTransferGuardNotFound) {
+		t.Fatalf("DeleteTransferGuard(other user) err = %v", err)
+	}
+	if err := s.DeleteTransferGuard(ctx, 1, g.ID); err != nil {
+		t.Fatalf("DeleteTransferGuard: %v", err)
+	}
+}
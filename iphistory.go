@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+// 地址释放原因，写入 ip_history.release_reason
+const (
+	ipReleaseSwap          = "更换静态IP"
+	ipReleaseTransferGuard = "流量保护更换静态IP"
+	ipReleaseUnreachable   = "探测不可达"
+	ipReleaseBlocked       = "命中黑名单，未绑定即释放"
+	ipReleaseChanged       = "地址已变化"
+	ipReleaseStopped       = "实例已停止，公网IP已回收"
+	ipReleaseDeleted       = "删除实例"
+	ipReleaseRollbackFail  = "回滚失败，已解绑保留"
+	// 附加在原因之后：地址已从实例解绑，但静态 IP 仍在账号中计费
+	ipReleaseNotFreed = "（已解绑，静态IP释放失败，请在遗留资源页释放）"
+)
+
+// blockedIPFunc 返回换 IP 时使用的黑名单判断；黑名单读取失败时返回错误，不在没有黑名单的情况下换 IP。
+func blockedIPFunc(ctx context.Context, keyID int64) (func(string) bool, error) {
+	set, err := appStore.BlockedIPSet(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("读取 IP 黑名单失败：%w", err)
+	}
+	if len(set) == 0 {
+		return nil, nil
+	}
+	return func(ip string) bool { return set[ip] }, nil
+}
+
+// recordSwapHistory 记录一次换 IP：被拒绝的地址、换下的旧地址及其原因、新绑定的地址。
+func recordSwapHistory(ctx context.Context, job *store.Job, instance string, res aws.SwapResult, swapErr error, reason string) {
+	base := store.IPHistory{UserID: job.UserID, KeyID: job.KeyID, Region: job.Region, Instance: instance, Static: true}
+	now := time.Now().UTC()
+	for _, ip := range res.Rejected {
+		h := base
+		h.IP, h.AssignedAt, h.ReleasedAt, h.ReleaseReason = ip, now, now, ipReleaseBlocked
+		if err := appStore.RecordIPReleased(ctx, &h); err != nil {
+			log.Printf("record ip history failed: %v", err)
+		}
+	}
+	// 失败时只有旧 IP 已解绑保留（没能绑回）才算实例地址有变化
+	if swapErr != nil && !res.Kept {
+		return
+	}
+	if res.OldIP != "" {
+		h := base
+		h.IP, h.ReleasedAt, h.ReleaseReason = res.OldIP, now, reason
+		if res.ReleaseErr != nil {
+			h.ReleaseReason += ipReleaseNotFreed
+		}
+		if err := appStore.RecordIPReleased(ctx, &h); err != nil {
+			log.Printf("record ip history failed: %v", err)
+		}
+	}
+	if swapErr == nil && res.NewIP != "" {
+		h := base
+		h.IP, h.AssignedAt = res.NewIP, now
+		if err := appStore.RecordIPAssigned(ctx, &h, ipReleaseChanged); err != nil {
+			log.Printf("record ip history failed: %v", err)
+		}
+	}
+}
+
+// observeInstanceIPs 用实例列表补全地址记录，覆盖创建实例、启动后公网 IP 变化等不经换 IP 任务的情况。
+// 只在地址与仍在使用的记录不同时写库；单个实例写入失败不影响其余实例。
+func observeInstanceIPs(ctx context.Context, userID int64, key *store.Key, region string, list []aws.InstanceView) {
+	open, err := appStore.OpenIPHistory(ctx, key.ID, region)
+	if err != nil {
+		log.Printf("load ip history for key %d %s failed: %v", key.ID, region, err)
+		return
+	}
+	for _, inst := range list {
+		h := store.IPHistory{UserID: userID, KeyID: key.ID, Region: region, Instance: inst.Name}
+		cur, tracked := open[inst.Name]
+		var err error
+		switch {
+		case inst.StaticIPv4 != "":
+			if tracked && cur.IP == inst.StaticIPv4 && cur.Static {
+				continue
+			}
+			h.IP, h.Static = inst.StaticIPv4, true
+			err = appStore.RecordIPAssigned(ctx, &h, ipReleaseChanged)
+		case inst.PublicIPv4 != "":
+			if tracked && cur.IP == inst.PublicIPv4 && !cur.Static {
+				continue
+			}
+			h.IP = inst.PublicIPv4
+			err = appStore.RecordIPAssigned(ctx, &h, ipReleaseChanged)
+		case inst.State == "stopped":
+			if !tracked {
+				continue
+			}
+			h.ReleaseReason = ipReleaseStopped
+			err = appStore.RecordIPReleased(ctx, &h)
+		}
+		if err != nil {
+			log.Printf("record ip history for %s failed: %v", inst.Name, err)
+		}
+	}
+}
+
+func formatIPDuration(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "-"
+	case d < time.Minute:
+		return "不到 1 分钟"
+	case d < time.Hour:
+		return fmt.Sprintf("%d 分钟", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d 小时", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d 天", int(d.Hours()/24))
+	}
+}
+
+// blockIPError 把校验错误换成可读的提示。
+func blockIPError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrInvalidBlockedIP):
+		return errors.New("请填写有效的 IP 地址")
+	case errors.Is(err, store.ErrBlockedIPExists):
+		return errors.New("该地址已在黑名单中")
+	}
+	return err
+}
+
+type IPHistoryView struct {
+	store.IPHistory
+	Duration string
+	Blocked  bool
+}
+
+type IPHistoryPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	Flash     Flash
+
+	Region   string
+	Regions  []RegionOption
+	Instance string
+	KeyName  string
+	History  []IPHistoryView
+	Blocked  []store.BlockedIP
+	Holds    []HeldStaticIPView
+}
+
+func ipHistoryRedirect(c *gin.Context, msg string, err error) {
+	q := url.Values{"msg": {msg}}
+	if region := normalizeRegion(c.PostForm("region")); region != "" {
+		q.Set("region", region)
+	}
+	if err != nil {
+		auditError(c, err)
+		q.Set("err", formatFlashError(err))
+	}
+	c.Redirect(http.StatusFound, "/ip-history?"+q.Encode())
+}
+
+func registerIPHistoryRoutes(r *gin.Engine) {
+	r.GET("/ip-history", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		ctx := c.Request.Context()
+		region := normalizeRegion(c.Query("region"))
+		if region == "" {
+			region = normalizeRegion(s.GetString("region", "us-east-1"))
+		}
+		data := IPHistoryPageData{
+			Title:     "AutoSail IP 记录",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Region:    region,
+			Regions:   allRegionOptions(),
+			Instance:  strings.TrimSpace(c.Query("instance")),
+		}
+		keys, _ := appStore.ListKeys(ctx, userID)
+		key, _ := resolveActiveKey(s, keys)
+		if key == nil {
+			data.Flash.Warn = "请先在首页启用一个密钥，IP 记录与黑名单按密钥区分"
+			c.HTML(http.StatusOK, "iphistory", data)
+			return
+		}
+		data.KeyName = key.Name
+		blocked, err := appStore.ListBlockedIPs(ctx, userID, key.ID)
+		if err != nil {
+			data.Flash.Error = "读取黑名单失败：" + formatFlashError(err)
+		}
+		data.Blocked = blocked
+		history, err := appStore.ListIPHistory(ctx, userID, key.ID, region, data.Instance, 0)
+		if err != nil {
+			data.Flash.Error = "读取 IP 记录失败：" + formatFlashError(err)
+		}
+		now := time.Now()
+		holds, err := appStore.ListHeldStaticIPs(ctx, userID, 0)
+		if err != nil {
+			data.Flash.Error = "读取保留的静态 IP 失败：" + formatFlashError(err)
+		}
+		data.Holds = heldStaticIPViews(holds, key.ID, now)
+		for _, h := range history {
+			v := IPHistoryView{IPHistory: h, Duration: formatIPDuration(h.Duration(now))}
+			for _, b := range blocked {
+				v.Blocked = v.Blocked || b.IP == h.IP
+			}
+			data.History = append(data.History, v)
+		}
+		errText := strings.TrimSpace(c.Query("err"))
+		switch c.Query("msg") {
+		case "block_ok":
+			data.Flash.Success = "已加入黑名单，换 IP 时申请到该地址会立即释放重申"
+		case "block_failed":
+			data.Flash.Error = "加入黑名单失败：" + errText
+		case "unblock_ok":
+			data.Flash.Success = "已移出黑名单"
+		case "rollback_failed":
+			data.Flash.Error = "回滚失败：" + errText
+		case "needuse":
+			data.Flash.Warn = "请先在首页启用一个密钥，黑名单会关联到当前启用的密钥"
+		}
+		c.HTML(http.StatusOK, "iphistory", data)
+	})
+
+	r.POST("/aws/ip-blocklist", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+		activeKey, _ := resolveActiveKey(s, keys)
+		if activeKey == nil {
+			c.Redirect(http.StatusFound, "/ip-history?msg=needuse")
+			return
+		}
+		b := &store.BlockedIP{UserID: userID, KeyID: activeKey.ID, IP: c.PostForm("ip"), Reason: c.PostForm("reason")}
+		if err := appStore.BlockIP(c.Request.Context(), b); err != nil {
+			ipHistoryRedirect(c, "block_failed", blockIPError(err))
+			return
+		}
+		ipHistoryRedirect(c, "block_ok", nil)
+	})
+
+	r.POST("/aws/ip-blocklist/delete", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		id, _ := strconv.ParseInt(strings.TrimSpace(c.PostForm("blocked_id")), 10, 64)
+		if err := appStore.UnblockIP(c.Request.Context(), userID, id); err != nil && !errors.Is(err, store.ErrBlockedIPNotFound) {
+			ipHistoryRedirect(c, "block_failed", err)
+			return
+		}
+		ipHistoryRedirect(c, "unblock_ok", nil)
+	})
+}
+
+type apiIPHistory struct {
+	ID            int64      `json:"id"`
+	Region        string     `json:"region"`
+	Instance      string     `json:"instance"`
+	IP            string     `json:"ip"`
+	Static        bool       `json:"static"`
+	AssignedAt    *time.Time `json:"assigned_at,omitempty"` // 为空表示启用记录前就已分配
+	ReleasedAt    *time.Time `json:"released_at,omitempty"` // 为空表示仍在使用
+	ReleaseReason string     `json:"release_reason,omitempty"`
+	Seconds       int64      `json:"seconds"` // 使用时长，分配时间未知时为 0
+}
+
+type apiBlockedIP struct {
+	ID        int64     `json:"id"`
+	KeyID     int64     `json:"key_id"`
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type apiBlockedIPInput struct {
+	IP     string `json:"ip" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+func apiListIPHistory(c *gin.Context) {
+	region := apiRegion(c, "")
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	list, err := appStore.ListIPHistory(c.Request.Context(), apiUserID(c), key.ID, region, strings.TrimSpace(c.Query("instance")), limit)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取 IP 记录失败")
+		return
+	}
+	now := time.Now()
+	out := make([]apiIPHistory, 0, len(list))
+	for i := range list {
+		h := &list[i]
+		v := apiIPHistory{ID: h.ID, Region: h.Region, Instance: h.Instance, IP: h.IP, Static: h.Static, ReleaseReason: h.ReleaseReason, Seconds: int64(h.Duration(now).Seconds())}
+		if !h.AssignedAt.IsZero() {
+			v.AssignedAt = &h.AssignedAt
+		}
+		if !h.ReleasedAt.IsZero() {
+			v.ReleasedAt = &h.ReleasedAt
+		}
+		out = append(out, v)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiListBlockedIPs(c *gin.Context) {
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	list, err := appStore.ListBlockedIPs(c.Request.Context(), apiUserID(c), key.ID)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取黑名单失败")
+		return
+	}
+	out := make([]apiBlockedIP, 0, len(list))
+	for _, b := range list {
+		out = append(out, apiBlockedIP{ID: b.ID, KeyID: b.KeyID, IP: b.IP, Reason: b.Reason, CreatedAt: b.CreatedAt})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateBlockedIP(c *gin.Context) {
+	var in apiBlockedIPInput
+	if !apiBind(c, &in) {
+		return
+	}
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	b := &store.BlockedIP{UserID: apiUserID(c), KeyID: key.ID, IP: in.IP, Reason: in.Reason}
+	switch err := appStore.BlockIP(c.Request.Context(), b); {
+	case errors.Is(err, store.ErrInvalidBlockedIP):
+		apiFail(c, http.StatusBadRequest, "invalid_request", blockIPError(err).Error())
+		return
+	case errors.Is(err, store.ErrBlockedIPExists):
+		apiFail(c, http.StatusConflict, "ip_blocked", blockIPError(err).Error())
+		return
+	case err != nil:
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "加入黑名单失败")
+		return
+	}
+	c.JSON(http.StatusCreated, apiBlockedIP{ID: b.ID, KeyID: b.KeyID, IP: b.IP, Reason: b.Reason, CreatedAt: b.CreatedAt})
+}
+
+func apiDeleteBlockedIP(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "黑名单 ID 无效")
+		return
+	}
+	if err := appStore.UnblockIP(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, store.ErrBlockedIPNotFound) {
+			apiFail(c, http.StatusNotFound, "not_found", "黑名单记录不存在")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "移出黑名单失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
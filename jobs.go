@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/jobs"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+const (
+	jobKindSwapIP = "lightsail.swapip"
+	jobKindDelete = "lightsail.delete"
+
+	jobKindStart     = "lightsail.start"
+	jobKindStop      = "lightsail.stop"
+	jobKindForceStop = "lightsail.forcestop"
+
+	jobKindCreateDisk = "lightsail.disk"
+
+	jobKindRollbackIP    = "lightsail.rollbackip"
+	jobKindReleaseHeldIP = "lightsail.releaseip"
+
+	jobKindSyncDNS    = "lightsail.dnssync"
+	jobKindEC2SyncDNS = "ec2.dnssync"
+)
+
+// 启动、停止后轮询到目标状态再结束任务，任务结束时会清掉实例列表缓存。
+const instanceStateTimeout = 5 * time.Minute
+
+var jobRunner *jobs.Runner
+
+var errJobKeyDeleted = errors.New("任务使用的密钥已被删除")
+
+func startJobRunner(ctx context.Context) error {
+	jobRunner = jobs.NewRunner(appStore, mustEnvInt("JOB_WORKERS", 4))
+	// 换 IP 中断后再执行可能重复申请静态 IP，不自动恢复；删除实例可以安全重试
+	// 换 IP 成功后改写绑定的外部 DNS 记录，DNS 失败时任务标记为失败，但新 IP 已生效
+	// Params 为 swapJobParams 时换到新地址通过探测为止
+	jobRunner.Register(jobKindSwapIP, false, runSwapJob)
+	jobRunner.Register(jobKindDelete, true, func(ctx context.Context, job *store.Job, report func(string)) error {
+		return runLightsailJob(ctx, job, report, func(ctx context.Context, cli aws.LightsailAPI, name string) error {
+			if err := aws.DeleteInstanceWithStaticIPCleanup(ctx, cli, name); err != nil {
+				return err
+			}
+			h := store.IPHistory{UserID: job.UserID, KeyID: job.KeyID, Region: job.Region, Instance: name, ReleaseReason: ipReleaseDeleted}
+			if err := appStore.RecordIPReleased(ctx, &h); err != nil {
+				log.Printf("record ip history failed: %v", err)
+			}
+			return nil
+		})
+	})
+	jobRunner.Register(jobKindStart, true, func(ctx context.Context, job *store.Job, report func(string)) error {
+		return runLightsailJob(ctx, job, report, func(ctx context.Context, cli aws.LightsailAPI, name string) error {
+			if err := aws.StartInstance(ctx, cli, name); err != nil {
+				return err
+			}
+			if err := aws.WaitInstanceState(ctx, cli, name, "running", instanceStateTimeout); err != nil {
+				return err
+			}
+			// 没有静态 IP 的实例启动后公网 IP 会变；DNS 失败只记在步骤里，不影响启动结果
+			if err := syncJobDNS(ctx, job, report); err != nil {
+				report("外部 DNS 更新失败：" + err.Error())
+			}
+			return nil
+		})
+	})
+	for kind, force := range map[string]bool{jobKindStop: false, jobKindForceStop: true} {
+		jobRunner.Register(kind, true, func(ctx context.Context, job *store.Job, report func(string)) error {
+			return runLightsailJob(ctx, job, report, func(ctx context.Context, cli aws.LightsailAPI, name string) error {
+				if err := aws.StopInstance(ctx, cli, name, force); err != nil {
+					return err
+				}
+				return aws.WaitInstanceState(ctx, cli, name, "stopped", instanceStateTimeout)
+			})
+		})
+	}
+	// 创建实例时附加的磁盘：等实例就绪后创建并挂载，Params 为 diskJobParams
+	jobRunner.Register(jobKindCreateDisk, true, func(ctx context.Context, job *store.Job, report func(string)) error {
+		var p diskJobParams
+		if err := json.Unmarshal([]byte(job.Params), &p); err != nil {
+			return fmt.Errorf("任务参数无效：%w", err)
+		}
+		return runLightsailJob(ctx, job, report, func(ctx context.Context, cli aws.LightsailAPI, name string) error {
+			return createAndAttachDisk(ctx, cli, name, p)
+		})
+	})
+	// 回滚与释放保留的旧静态 IP，Params 为 heldIPJobParams；重复执行是安全的
+	jobRunner.Register(jobKindRollbackIP, true, runRollbackIPJob)
+	jobRunner.Register(jobKindReleaseHeldIP, true, runReleaseHeldIPJob)
+	// 从快照重建的实例、启动后的 EC2 实例拿到新地址后改写外部 DNS
+	jobRunner.Register(jobKindSyncDNS, true, runDNSSyncJob)
+	jobRunner.Register(jobKindEC2SyncDNS, true, runDNSSyncJob)
+	jobRunner.OnFinish(func(job *store.Job, err error) {
+		auditJobResult(job, err)
+		finishTransferGuardJob(job, err)
+	})
+	return jobRunner.Start(ctx)
+}
+
+func loadJobKey(ctx context.Context, job *store.Job) (*store.Key, error) {
+	keys, err := appStore.ListKeys(ctx, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+	key := findKeyByID(keys, job.KeyID)
+	if key == nil {
+		return nil, errJobKeyDeleted
+	}
+	return key, nil
+}
+
+func runLightsailJob(ctx context.Context, job *store.Job, report func(string), fn func(ctx context.Context, cli aws.LightsailAPI, name string) error) error {
+	key, err := loadJobKey(ctx, job)
+	if err != nil {
+		return err
+	}
+	ak := strings.TrimSpace(key.AccessKey)
+	proxy := strings.TrimSpace(key.Proxy)
+	cli, err := aws.NewLightsailClient(ctx, job.Region, ak, strings.TrimSpace(key.SecretKey), proxy)
+	if err != nil {
+		return err
+	}
+	report("开始处理实例 " + job.Target)
+	err = fn(aws.WithProgress(ctx, report), cli, job.Target)
+	instCache.Delete(strings.Join([]string{"inst", job.Region, ak, proxy}, "|"))
+	instCache.Delete(strings.Join([]string{"disk", job.Region, ak, proxy}, "|"))
+	if err != nil {
+		return err
+	}
+	report("完成")
+	return nil
+}
+
+func auditJobResult(job *store.Job, err error) {
+	service, _, _ := strings.Cut(job.Kind, ".")
+	ev := store.AuditEvent{
+		UserID:   job.UserID,
+		KeyID:    job.KeyID,
+		Service:  service,
+		Region:   job.Region,
+		Instance: job.Target,
+		Action:   "job:" + job.Kind,
+		Params:   fmt.Sprintf(`{"job_id":%d}`, job.ID),
+		Result:   "ok",
+	}
+	ev.Username = lookupUsername(context.Background(), job.UserID)
+	if err != nil {
+		ev.Result = "failed"
+		ev.Error = err.Error()
+	}
+	if e := appStore.RecordAudit(context.Background(), ev); e != nil {
+		log.Printf("record audit event failed: %v", e)
+	}
+}
+
+// lookupUsername 为后台产生的审计记录补上用户名，查不到时返回空。
+func lookupUsername(ctx context.Context, userID int64) string {
+	users, err := appStore.ListUsers(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, u := range users {
+		if u.ID == userID {
+			return u.Username
+		}
+	}
+	return ""
+}
+
+// enqueueLightsailJob 与 doManageAction 的参数校验一致，但把实际操作交给后台任务执行。
+func enqueueLightsailJob(c *gin.Context, kind string) {
+	enqueueLightsailJobWithParams(c, kind, "")
+}
+
+func enqueueLightsailJobWithParams(c *gin.Context, kind, params string) {
+	s := session.Must(c)
+	userID, _ := userIDFromSession(s)
+	keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+	activeKey, _ := resolveActiveKey(s, keys)
+	if activeKey == nil {
+		c.Redirect(http.StatusFound, "/?tab=manage&msg=needuse")
+		return
+	}
+	region := normalizeRegion(strings.TrimSpace(c.PostForm("region")))
+	if region == "" {
+		region = normalizeRegion(s.GetString("region", "us-east-1"))
+	}
+	name := strings.TrimSpace(c.PostForm("instance"))
+	if name == "" || strings.TrimSpace(activeKey.AccessKey) == "" || strings.TrimSpace(activeKey.SecretKey) == "" {
+		c.Redirect(http.StatusFound, "/?tab=manage&region="+region)
+		return
+	}
+	id, err := jobRunner.Enqueue(c.Request.Context(), store.Job{
+		UserID: userID,
+		KeyID:  activeKey.ID,
+		Kind:   kind,
+		Region: region,
+		Target: name,
+		Params: params,
+	})
+	if err != nil {
+		auditError(c, err)
+		c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg=job_failed")
+		return
+	}
+	c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg=job_queued&job="+strconv.FormatInt(id, 10))
+}
+
+type JobView struct {
+	store.Job
+	Steps []store.JobStep
+}
+
+type JobsPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+
+	Jobs []store.Job
+	Job  *JobView
+}
+
+func jobKindLabel(kind string) string {
+	switch kind {
+	case jobKindSwapIP:
+		return "更换静态IP"
+	case jobKindDelete:
+		return "删除实例"
+	case jobKindStart:
+		return "启动实例"
+	case jobKindStop:
+		return "停止实例"
+	case jobKindForceStop:
+		return "强制停止实例"
+	case jobKindCreateDisk:
+		return "创建并挂载磁盘"
+	case jobKindRollbackIP:
+		return "回滚静态IP"
+	case jobKindReleaseHeldIP:
+		return "释放保留的静态IP"
+	case jobKindSyncDNS, jobKindEC2SyncDNS:
+		return "同步外部 DNS"
+	}
+	return kind
+}
+
+// loadVisibleJob 只允许任务创建者或管理员查看。
+func loadVisibleJob(c *gin.Context) (*store.Job, bool) {
+	s := session.Must(c)
+	userID, _ := userIDFromSession(s)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	job, err := appStore.GetJob(c.Request.Context(), id)
+	if err != nil {
+		return nil, false
+	}
+	if job.UserID != userID && !isAdminSession(s) {
+		return nil, false
+	}
+	return job, true
+}
+
+func registerJobRoutes(r *gin.Engine) {
+	r.GET("/jobs", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		list, err := appStore.ListJobs(c.Request.Context(), userID, 100)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "load jobs failed: %v", err)
+			return
+		}
+		c.HTML(http.StatusOK, "jobs", JobsPageData{
+			Title:     "AutoSail 后台任务",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Jobs:      list,
+		})
+	})
+
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		s := session.Must(c)
+		job, ok := loadVisibleJob(c)
+		if !ok {
+			c.Redirect(http.StatusFound, "/jobs")
+			return
+		}
+		steps, _ := appStore.ListJobSteps(c.Request.Context(), job.ID)
+		c.HTML(http.StatusOK, "job", JobsPageData{
+			Title:     fmt.Sprintf("任务 #%d", job.ID),
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Job:       &JobView{Job: *job, Steps: steps},
+		})
+	})
+
+	r.GET("/jobs/:id/status", func(c *gin.Context) {
+		job, ok := loadVisibleJob(c)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "job not found"})
+			return
+		}
+		steps, _ := appStore.ListJobSteps(c.Request.Context(), job.ID)
+		c.JSON(http.StatusOK, jobStatusJSON(job, steps))
+	})
+}
+
+// JobStatus 是任务状态的 JSON 表示，任务详情页轮询和 /api/v1/jobs 共用。
+type JobStatus struct {
+	OK       bool            `json:"ok"`
+	ID       int64           `json:"id"`
+	Kind     string          `json:"kind"`
+	Region   string          `json:"region"`
+	Target   string          `json:"target"`
+	Params   json.RawMessage `json:"params"`
+	Status   string          `json:"status"`
+	Done     bool            `json:"done"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	Steps    []JobStepStatus `json:"steps"`
+}
+
+type JobStepStatus struct {
+	At      string `json:"at"`
+	Message string `json:"message"`
+}
+
+func jobStatusJSON(job *store.Job, steps []store.JobStep) JobStatus {
+	stepList := make([]JobStepStatus, 0, len(steps))
+	for _, st := range steps {
+		stepList = append(stepList, JobStepStatus{At: st.CreatedAt.Local().Format("2006-01-02 15:04:05"), Message: st.Message})
+	}
+	params := json.RawMessage("null")
+	if strings.TrimSpace(job.Params) != "" && json.Valid([]byte(job.Params)) {
+		params = json.RawMessage(job.Params)
+	}
+	return JobStatus{
+		OK:       true,
+		ID:       job.ID,
+		Kind:     job.Kind,
+		Region:   job.Region,
+		Target:   job.Target,
+		Params:   params,
+		Status:   job.Status,
+		Done:     job.Done(),
+		Error:    job.Error,
+		Attempts: job.Attempts,
+		Steps:    stepList,
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+var (
+	errNotLeftover  = errors.New("不是遗留资源或已被删除")
+	errLeftoverHeld = errors.New("换 IP 时保留的旧静态 IP，到期后自动释放，期间可在「IP 记录」页回滚")
+)
+
+// leftoverClients 返回区域内的 Lightsail 与 EC2 客户端；区域不支持 Lightsail 时第一个返回值为 nil。
+func leftoverClients(ctx context.Context, region string, key *store.Key) (aws.LightsailAPI, aws.EC2LeftoverAPI, error) {
+	ak, sk, proxy := strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy)
+	ec2Cli, err := aws.NewEC2Client(ctx, region, ak, sk, proxy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !leftoverHasLightsail(ctx, region, key) {
+		return nil, ec2Cli, nil
+	}
+	lsCli, err := aws.NewLightsailClient(ctx, region, ak, sk, proxy)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lsCli, ec2Cli, nil
+}
+
+// leftoverHasLightsail 按自动发现的 Lightsail 区域判断，发现失败时退回内置列表。
+func leftoverHasLightsail(ctx context.Context, region string, key *store.Key) bool {
+	list, err := discoverRegions(ctx, "lightsail", key)
+	if err != nil {
+		list = lightsailRegionOptions
+	}
+	for _, r := range list {
+		if r.ID == region {
+			return !r.Disabled
+		}
+	}
+	return false
+}
+
+// leftoverRegions 合并自动发现的 EC2 与 Lightsail 区域，发现失败的一方退回内置列表。
+func leftoverRegions(ctx context.Context, key *store.Key) []RegionOption {
+	all, err := discoverRegions(ctx, "ec2", key)
+	if err != nil {
+		all = ec2RegionOptions
+	}
+	all = append([]RegionOption(nil), all...)
+	ls, err := discoverRegions(ctx, "lightsail", key)
+	if err != nil {
+		ls = lightsailRegionOptions
+	}
+	for _, r := range ls {
+		if !containsRegion(all, r.ID) {
+			all = append(all, r)
+		}
+	}
+	return all
+}
+
+// listLeftovers 汇总 Lightsail 与 EC2 的遗留资源，按估算月费从高到低排序。
+// 仍在保留期内的旧静态 IP 会标出到期时间。
+func listLeftovers(ctx context.Context, key *store.Key, region string, lsCli aws.LightsailAPI, ec2Cli aws.EC2LeftoverAPI) ([]aws.Leftover, error) {
+	var list []aws.Leftover
+	if lsCli != nil {
+		ls, err := aws.ListLightsailLeftovers(ctx, lsCli)
+		if err != nil {
+			return nil, err
+		}
+		if err := markHeldLeftovers(ctx, key, region, ls); err != nil {
+			return nil, err
+		}
+		list = append(list, ls...)
+	}
+	ec, err := aws.ListEC2Leftovers(ctx, ec2Cli)
+	if err != nil {
+		return nil, err
+	}
+	list = append(list, ec...)
+	aws.SortLeftovers(list)
+	return list, nil
+}
+
+// markHeldLeftovers 给保留中的旧静态 IP 填上 HeldUntil。查询失败时返回错误，避免把保留的 IP 当作遗留资源释放。
+func markHeldLeftovers(ctx context.Context, key *store.Key, region string, list []aws.Leftover) error {
+	holds, err := appStore.ListActiveHeldStaticIPs(ctx, key.ID, region)
+	if err != nil {
+		return fmt.Errorf("查询保留中的静态 IP 失败：%w", err)
+	}
+	until := make(map[string]time.Time, len(holds))
+	for _, h := range holds {
+		until[h.Name] = h.ExpiresAt
+	}
+	for i := range list {
+		if t, ok := until[list[i].Name]; ok && list[i].Kind == aws.LeftoverStaticIP {
+			list[i].HeldUntil = &t
+		}
+	}
+	return nil
+}
+
+func leftoversMonthlyUSD(list []aws.Leftover) float64 {
+	total := 0.0
+	for _, l := range list {
+		total += l.MonthlyUSD
+	}
+	return total
+}
+
+type leftoverSweepResult struct {
+	aws.Leftover
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// sweepLeftovers 重新拉取遗留资源，只处理 refs 中仍处于遗留状态的资源；保留中的旧静态 IP 不处理，dryRun 时不做任何修改。
+func sweepLeftovers(ctx context.Context, key *store.Key, region string, lsCli aws.LightsailAPI, ec2Cli aws.EC2LeftoverAPI, refs []string, dryRun bool) ([]leftoverSweepResult, error) {
+	current, err := listLeftovers(ctx, key, region, lsCli, ec2Cli)
+	if err != nil {
+		return nil, err
+	}
+	byRef := make(map[string]aws.Leftover, len(current))
+	for _, l := range current {
+		byRef[l.Ref()] = l
+	}
+	out := make([]leftoverSweepResult, 0, len(refs))
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		l, ok := byRef[ref]
+		if !ok {
+			kind, id, _ := strings.Cut(ref, ":")
+			out = append(out, leftoverSweepResult{Leftover: aws.Leftover{Kind: kind, ID: id}, Error: errNotLeftover.Error()})
+			continue
+		}
+		r := leftoverSweepResult{Leftover: l}
+		if l.HeldUntil != nil {
+			r.Error = errLeftoverHeld.Error()
+		} else if !dryRun {
+			if l.Service == "lightsail" {
+				err = aws.ReleaseLightsailLeftover(ctx, lsCli, l)
+			} else {
+				err = aws.DeleteEC2Leftover(ctx, ec2Cli, l)
+			}
+			if err != nil {
+				r.Error = formatFlashError(err)
+			} else {
+				r.Deleted = true
+			}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+type LeftoversPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	Flash     Flash
+
+	Region     string
+	Regions    []RegionOption
+	KeyName    string
+	Items      []aws.Leftover
+	MonthlyUSD float64
+
+	// 预览（dry-run）选中的资源
+	Selected     map[string]bool
+	Preview      []aws.Leftover
+	PreviewUSD   float64
+	HasLightsail bool
+}
+
+func registerLeftoverRoutes(r *gin.Engine) {
+	r.GET("/leftovers", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		ctx := c.Request.Context()
+		region := normalizeRegion(firstNonEmpty(c.Query("region"), s.GetString("region", "us-east-1")))
+		data := LeftoversPageData{
+			Title:     "AutoSail 遗留资源",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Region:    region,
+			Selected:  map[string]bool{},
+		}
+		switch c.Query("msg") {
+		case "swept":
+			data.Flash.Success = fmt.Sprintf("已处理 %s 项遗留资源", c.Query("ok"))
+			if n := c.Query("failed"); n != "" && n != "0" {
+				data.Flash.Success = ""
+				data.Flash.Error = fmt.Sprintf("成功 %s 项，失败 %s 项：%s", c.Query("ok"), n, strings.TrimSpace(c.Query("err")))
+			}
+		case "noselect":
+			data.Flash.Warn = "请先勾选要处理的资源"
+		case "sweep_failed":
+			data.Flash.Error = "处理遗留资源失败：" + strings.TrimSpace(c.Query("err"))
+		}
+		keys, _ := appStore.ListKeys(ctx, userID)
+		key, _ := resolveActiveKey(s, keys)
+		data.Regions = leftoverRegions(ctx, key)
+		data.HasLightsail = leftoverHasLightsail(ctx, region, key)
+		if !keyUsable(key) {
+			data.Flash.Warn = "请先在首页启用一个可用的密钥"
+			c.HTML(http.StatusOK, "leftovers", data)
+			return
+		}
+		data.KeyName = key.Name
+		lsCli, ec2Cli, err := leftoverClients(ctx, region, key)
+		if err == nil {
+			data.Items, err = listLeftovers(ctx, key, region, lsCli, ec2Cli)
+		}
+		if err != nil {
+			data.Flash.Error = "拉取遗留资源失败：" + formatFlashError(err)
+		}
+		data.MonthlyUSD = leftoversMonthlyUSD(data.Items)
+		for _, ref := range c.QueryArray("preview") {
+			data.Selected[ref] = true
+		}
+		for _, l := range data.Items {
+			if data.Selected[l.Ref()] && l.HeldUntil == nil {
+				data.Preview = append(data.Preview, l)
+			}
+		}
+		data.PreviewUSD = leftoversMonthlyUSD(data.Preview)
+		c.HTML(http.StatusOK, "leftovers", data)
+	})
+
+	r.POST("/aws/leftovers/sweep", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		ctx := c.Request.Context()
+		region := normalizeRegion(firstNonEmpty(c.PostForm("region"), s.GetString("region", "us-east-1")))
+		q := url.Values{"region": {region}}
+		refs := c.PostFormArray("items")
+		if len(refs) == 0 {
+			q.Set("msg", "noselect")
+			c.Redirect(http.StatusFound, "/leftovers?"+q.Encode())
+			return
+		}
+		if c.PostForm("dry_run") == "1" {
+			q["preview"] = refs
+			c.Redirect(http.StatusFound, "/leftovers?"+q.Encode())
+			return
+		}
+		keys, _ := appStore.ListKeys(ctx, userID)
+		key, _ := resolveActiveKey(s, keys)
+		if !keyUsable(key) {
+			c.Redirect(http.StatusFound, "/?tab=manage&msg=needuse")
+			return
+		}
+		lsCli, ec2Cli, err := leftoverClients(ctx, region, key)
+		var results []leftoverSweepResult
+		if err == nil {
+			results, err = sweepLeftovers(ctx, key, region, lsCli, ec2Cli, refs, false)
+		}
+		if err != nil {
+			auditError(c, err)
+			q.Set("msg", "sweep_failed")
+			q.Set("err", formatFlashError(err))
+			c.Redirect(http.StatusFound, "/leftovers?"+q.Encode())
+			return
+		}
+		ok, failed, firstErr := 0, 0, ""
+		for _, r := range results {
+			if r.Deleted {
+				ok++
+				continue
+			}
+			failed++
+			if firstErr == "" {
+				firstErr = r.ID + "：" + r.Error
+			}
+		}
+		if failed > 0 {
+			auditError(c, errors.New(firstErr))
+		}
+		q.Set("msg", "swept")
+		q.Set("ok", strconv.Itoa(ok))
+		q.Set("failed", strconv.Itoa(failed))
+		q.Set("err", firstErr)
+		c.Redirect(http.StatusFound, "/leftovers?"+q.Encode())
+	})
+}
+
+type apiLeftovers struct {
+	Region     string         `json:"region"`
+	Items      []aws.Leftover `json:"items"`
+	MonthlyUSD float64        `json:"monthly_usd"` // 估算，按 us-east-1 价格
+}
+
+type apiLeftoverSweepRequest struct {
+	Items  []string `json:"items" binding:"required"` // 资源标识 kind:id，例如 static_ip:sip-xxx、eip:eipalloc-xxx、volume:vol-xxx、ebs_snapshot:snap-xxx
+	DryRun bool     `json:"dry_run"`                  // 只预览，不做修改
+}
+
+type apiLeftoverSweepResponse struct {
+	DryRun     bool                  `json:"dry_run"`
+	Results    []leftoverSweepResult `json:"results"`
+	MonthlyUSD float64               `json:"monthly_usd"` // 成功处理（dry-run 时为将处理）的资源估算月费
+}
+
+func apiListLeftovers(c *gin.Context) {
+	region := apiRegion(c, "")
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	lsCli, ec2Cli, err := leftoverClients(c.Request.Context(), region, key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	list, err := listLeftovers(c.Request.Context(), key, region, lsCli, ec2Cli)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	if list == nil {
+		list = []aws.Leftover{}
+	}
+	c.JSON(http.StatusOK, apiLeftovers{Region: region, Items: list, MonthlyUSD: leftoversMonthlyUSD(list)})
+}
+
+func apiSweepLeftovers(c *gin.Context) {
+	var in apiLeftoverSweepRequest
+	if !apiBind(c, &in) {
+		return
+	}
+	region := apiRegion(c, "")
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	lsCli, ec2Cli, err := leftoverClients(c.Request.Context(), region, key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	results, err := sweepLeftovers(c.Request.Context(), key, region, lsCli, ec2Cli, in.Items, in.DryRun)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	resp := apiLeftoverSweepResponse{DryRun: in.DryRun, Results: results}
+	for _, r := range results {
+		if r.Error == "" {
+			resp.MonthlyUSD += r.MonthlyUSD
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
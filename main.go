@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"embed"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"math/big"
@@ -56,6 +59,7 @@ type PageData struct {
 
 	Region        string
 	CreateRegions []RegionOption
+	Zones         []ZoneOption
 	ManageRegions []RegionOption
 	QuotaRegions  []RegionOption
 	AZ            string
@@ -66,15 +70,18 @@ type PageData struct {
 	Flash Flash
 
 	// Create form
-	CreateEnableFW   bool
+	CreateFirewall   string
 	CreateIPType     string
 	CreateBlueprint  string
 	CreateBundle     string
 	CreateRootPwd    string
+	CreateSSHKey     string
 	CreateService    string
 	CreateEC2AMI     string
+	AMIPresets       []store.AMIPreset
 	CreateEC2Type    string
 	CreateEC2IPv6    bool
+	CreateEC2AZ      string // 为空时 EC2 由 AWS 选择可用区
 	CreateBundleName string
 
 	Blueprints []Option
@@ -82,6 +89,11 @@ type PageData struct {
 	IPTypes    []Option
 	EC2AMIs    []Option
 	EC2Types   []Option
+	Firewalls  []Option
+	SSHKeys    []Option
+
+	// 刚提交的后台任务
+	JobURL string
 
 	// Proxy check
 	ProxyExitIP  string
@@ -90,6 +102,10 @@ type PageData struct {
 	// Manage
 	Instances     []aws.InstanceView
 	EC2Instances  []aws.EC2InstanceView
+	Snapshots     []aws.SnapshotView
+	Disks         []aws.DiskView
+	Domains       []aws.DomainView
+	Transfer      map[string]aws.TransferUsage
 	ManageService string
 
 	// Quota
@@ -123,13 +139,70 @@ var (
 var templateFS embed.FS
 
 type RegionOption struct {
-	ID   string
-	Name string
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	OptInStatus string `json:"opt_in_status,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
 }
 
 type Option struct {
-	ID   string
-	Name string
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// loadKeyring 读取 master key：优先 APP_MASTER_KEY，其次 APP_MASTER_KEY_FILE（文件不存在则生成）。
+// 两者都未设置时拒绝启动：密钥和数据库放在同一目录，备份数据目录就等于同时泄露了密文和 key。
+// hasSecrets 表示数据库里已有加密数据，此时 key 文件不存在多半是路径写错或卷没挂载，拒绝生成新 key。
+// 轮换时把旧 key 放到 APP_MASTER_KEY_PREVIOUS（逗号分隔），再执行 `app rotate-master-key`。
+func loadKeyring(dbPath string, hasSecrets bool) (*store.Keyring, error) {
+	raw := strings.TrimSpace(os.Getenv("APP_MASTER_KEY"))
+	if raw == "" {
+		keyFile := strings.TrimSpace(os.Getenv("APP_MASTER_KEY_FILE"))
+		if keyFile == "" {
+			legacy := filepath.Join(filepath.Dir(dbPath), "master.key")
+			if _, err := os.Stat(legacy); err == nil {
+				return nil, fmt.Errorf("master key found at %s next to the database; move it outside the data directory and set APP_MASTER_KEY_FILE to its new path", legacy)
+			}
+			return nil, errors.New("master key not configured: set APP_MASTER_KEY, or APP_MASTER_KEY_FILE to a path outside the data directory (generated if missing)")
+		}
+		b, err := os.ReadFile(keyFile)
+		if errors.Is(err, os.ErrNotExist) && hasSecrets {
+			return nil, fmt.Errorf("master key file %s not found, but the database already holds encrypted secrets; restore the key file or fix APP_MASTER_KEY_FILE", keyFile)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			generated, genErr := store.GenerateMasterKey()
+			if genErr != nil {
+				return nil, genErr
+			}
+			if err := os.MkdirAll(filepath.Dir(keyFile), 0o700); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(keyFile, []byte(generated+"\n"), 0o600); err != nil {
+				return nil, err
+			}
+			log.Printf("generated new master key at %s; back it up separately from the data directory", keyFile)
+			b = []byte(generated)
+		} else if err != nil {
+			return nil, err
+		}
+		raw = string(b)
+	}
+	primary, err := store.ParseMasterKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	var previous [][]byte
+	for _, item := range strings.Split(os.Getenv("APP_MASTER_KEY_PREVIOUS"), ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		k, err := store.ParseMasterKey(item)
+		if err != nil {
+			return nil, fmt.Errorf("APP_MASTER_KEY_PREVIOUS: %w", err)
+		}
+		previous = append(previous, k)
+	}
+	return store.NewKeyring(primary, previous...)
 }
 
 func mustEnvInt(key string, def int) int {
@@ -220,22 +293,6 @@ func containsRegion(list []RegionOption, id string) bool {
 	return false
 }
 
-var blueprintOptions = []Option{
-	{ID: "ubuntu_24_04", Name: "Ubuntu 24.04 LTS"},
-	{ID: "ubuntu_22_04", Name: "Ubuntu 22.04 LTS"},
-	{ID: "debian_12", Name: "Debian 12"},
-	{ID: "debian_11", Name: "Debian 11"},
-	{ID: "centos_7", Name: "CentOS 7"},
-}
-
-var bundleOptions = []Option{
-	{ID: "nano_3_0", Name: "nano (2 vCPUs, 内存 0.5 GB, 硬盘 20 GB, 流量 1024 GB / 月)"},
-	{ID: "micro_3_0", Name: "micro (2 vCPUs, 内存 1 GB, 硬盘 40 GB, 流量 2048 GB / 月)"},
-	{ID: "small_3_0", Name: "small (2 vCPUs, 内存 2 GB, 硬盘 60 GB, 流量 3072 GB / 月)"},
-	{ID: "medium_3_0", Name: "medium (2 vCPUs, 内存 4 GB, 硬盘 80 GB, 流量 4096 GB / 月)"},
-	{ID: "large_3_0", Name: "large (2 vCPUs, 内存 8 GB, 硬盘 160 GB, 流量 5120 GB / 月)"},
-}
-
 var ipTypeOptions = []Option{
 	{ID: "dualstack", Name: "双栈（IPv4+IPv6）"},
 	{ID: "ipv6", Name: "仅 IPv6（IPv6-only）"},
@@ -250,43 +307,6 @@ var ec2AMIOptions = []Option{
 	{ID: "custom", Name: "自定义 AMI ID"},
 }
 
-var ec2InstanceTypes = []Option{
-	{ID: "t3.micro", Name: "t3.micro (2 vCPU, 1 GB)"},
-	{ID: "t3.small", Name: "t3.small (2 vCPU, 2 GB)"},
-	{ID: "t3.medium", Name: "t3.medium (2 vCPU, 4 GB)"},
-	{ID: "t3.large", Name: "t3.large (2 vCPU, 8 GB)"},
-	{ID: "t3.xlarge", Name: "t3.xlarge (4 vCPU, 16 GB)"},
-	{ID: "t3a.micro", Name: "t3a.micro (2 vCPU, 1 GB)"},
-	{ID: "t3a.small", Name: "t3a.small (2 vCPU, 2 GB)"},
-	{ID: "t3a.medium", Name: "t3a.medium (2 vCPU, 4 GB)"},
-	{ID: "t3a.large", Name: "t3a.large (2 vCPU, 8 GB)"},
-	{ID: "t4g.micro", Name: "t4g.micro (2 vCPU, 1 GB, ARM)"},
-	{ID: "t4g.small", Name: "t4g.small (2 vCPU, 2 GB, ARM)"},
-	{ID: "t4g.medium", Name: "t4g.medium (2 vCPU, 4 GB, ARM)"},
-	{ID: "t4g.large", Name: "t4g.large (2 vCPU, 8 GB, ARM)"},
-	{ID: "m6i.large", Name: "m6i.large (2 vCPU, 8 GB)"},
-	{ID: "m6i.xlarge", Name: "m6i.xlarge (4 vCPU, 16 GB)"},
-	{ID: "m6g.large", Name: "m6g.large (2 vCPU, 8 GB, ARM)"},
-	{ID: "m6g.xlarge", Name: "m6g.xlarge (4 vCPU, 16 GB, ARM)"},
-	{ID: "c6i.large", Name: "c6i.large (2 vCPU, 4 GB)"},
-	{ID: "c6i.xlarge", Name: "c6i.xlarge (4 vCPU, 8 GB)"},
-	{ID: "c6g.large", Name: "c6g.large (2 vCPU, 4 GB, ARM)"},
-	{ID: "c6g.xlarge", Name: "c6g.xlarge (4 vCPU, 8 GB, ARM)"},
-	{ID: "r6i.large", Name: "r6i.large (2 vCPU, 16 GB)"},
-	{ID: "r6i.xlarge", Name: "r6i.xlarge (4 vCPU, 32 GB)"},
-	{ID: "r6g.large", Name: "r6g.large (2 vCPU, 16 GB, ARM)"},
-	{ID: "r6g.xlarge", Name: "r6g.xlarge (4 vCPU, 32 GB, ARM)"},
-	{ID: "custom", Name: "自定义实例类型"},
-}
-
-var ipv6BundleMap = map[string]string{
-	"nano_3_0":   "nano_ipv6_3_0",
-	"micro_3_0":  "micro_ipv6_3_0",
-	"small_3_0":  "small_ipv6_3_0",
-	"medium_3_0": "medium_ipv6_3_0",
-	"large_3_0":  "large_ipv6_3_0",
-}
-
 func regionLabel(id string) string {
 	for _, r := range allRegionOptions() {
 		if r.ID == id {
@@ -358,6 +378,34 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	hasSecrets, err := appStore.HasEncryptedSecrets(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	keyring, err := loadKeyring(dbPath, hasSecrets)
+	if err != nil {
+		log.Fatalf("load master key: %v", err)
+	}
+	appStore.SetKeyring(keyring)
+
+	if len(os.Args) > 1 && os.Args[1] == "rotate-master-key" {
+		n, err := appStore.RotateMasterKey(context.Background())
+		if err != nil {
+			log.Fatalf("rotate master key failed: %v", err)
+		}
+		log.Printf("rotated %d api keys to master key %s", n, keyring.PrimaryID())
+		return
+	}
+	if n, err := appStore.EncryptPlaintextKeys(context.Background()); err != nil {
+		panic(err)
+	} else if n > 0 {
+		log.Printf("encrypted %d plaintext api keys", n)
+	}
+	if err := startJobRunner(context.Background()); err != nil {
+		panic(err)
+	}
+	startTransferGuard(context.Background())
+	startHeldStaticIPExpiry(context.Background())
 
 	defaultUsername := strings.TrimSpace(os.Getenv("APP_USERNAME"))
 	if defaultUsername == "" {
@@ -376,27 +424,29 @@ func main() {
 
 	// templates
 	tmpl := template.Must(template.New("").Funcs(template.FuncMap{
-		"regionLabel": regionLabel,
+		"regionLabel":  regionLabel,
+		"jobKindLabel": jobKindLabel,
+		"tokenScope":   tokenScopeLabel,
 	}).ParseFS(templateFS, "templates/*.html"))
 	r.SetHTMLTemplate(tmpl)
 
 	// session store
-	store := session.NewStore()
+	appSessions = newSessionStore()
+
+	r.Use(bearerAuthMiddleware())
 
 	// Middleware: get/create session
-	r.Use(func(c *gin.Context) {
-		sid, err := c.Cookie("sid")
-		if err != nil || sid == "" {
-			sid = genSessionID()
-			c.SetCookie("sid", sid, 3600*24*7, "/", "", false, true)
-		}
-		s := store.GetOrCreate(sid)
-		c.Set("sess", s)
-		c.Set("sid", sid)
-		c.Next()
-	})
+	r.Use(sessionMiddleware(appSessions))
+
+	// 审计放在 CSRF 与登录校验之前，被拒绝的变更请求也留记录
+	r.Use(auditMiddleware())
 
 	r.Use(func(c *gin.Context) {
+		// Bearer token 不依赖 cookie，不存在 CSRF 风险
+		if isTokenRequest(c) {
+			c.Next()
+			return
+		}
 		s := session.Must(c)
 		token := strings.TrimSpace(s.GetString("csrf_token", ""))
 		if token == "" {
@@ -404,6 +454,17 @@ func main() {
 			s.SetString("csrf_token", token)
 		}
 		c.Set("csrf_token", token)
+		// API 用 X-CSRF-Token 头传递 token，校验所有非 GET 请求
+		if isAPIRequest(c) {
+			if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+				if strings.TrimSpace(c.GetHeader("X-CSRF-Token")) != token {
+					apiFail(c, http.StatusForbidden, "csrf", "缺少或错误的 X-CSRF-Token")
+					return
+				}
+			}
+			c.Next()
+			return
+		}
 		if c.Request.Method == http.MethodPost {
 			formToken := strings.TrimSpace(c.PostForm("csrf_token"))
 			if formToken == "" || formToken != token {
@@ -556,7 +617,16 @@ func main() {
 			c.Next()
 			return
 		}
+		if c.Request.URL.Path == apiPrefix+"/openapi.json" {
+			c.Next()
+			return
+		}
 		if !isLoggedIn(session.Must(c)) {
+			if isAPIRequest(c) {
+				apiFail(c, http.StatusUnauthorized, "unauthorized", "未登录")
+				return
+			}
+			c.Set("audit_error", "unauthorized")
 			c.Redirect(http.StatusFound, "/login")
 			c.Abort()
 			return
@@ -564,6 +634,24 @@ func main() {
 		c.Next()
 	})
 
+	registerAuditRoutes(r)
+	registerJobRoutes(r)
+	registerTokenRoutes(r)
+	registerSessionRoutes(r)
+	registerAMIPresetRoutes(r)
+	registerSnapshotRoutes(r)
+	registerFirewallRoutes(r)
+	registerSSHKeyRoutes(r)
+	registerTransferGuardRoutes(r)
+	registerLeftoverRoutes(r)
+	registerDiskRoutes(r)
+	registerDNSRoutes(r)
+	registerDNSSyncRoutes(r)
+	registerIPHistoryRoutes(r)
+	registerHeldStaticIPRoutes(r)
+	registerMetricsRoutes(r)
+	registerAPIRoutes(r)
+
 	r.GET("/", func(c *gin.Context) {
 		s := session.Must(c)
 		userID, _ := userIDFromSession(s)
@@ -621,13 +709,16 @@ func main() {
 		createIPType := s.GetString("create_ip_type", "dualstack")
 		createBlueprint := s.GetString("create_blueprint", "ubuntu_24_04")
 		createBundle := s.GetString("create_bundle", "nano_3_0")
-		createFW := s.GetString("create_fw_all", "1") == "1"
+		createFW := s.GetString("create_firewall", firewallDefault)
 		createService := s.GetString("create_service", "lightsail")
 		manageService := s.GetString("manage_service", "lightsail")
 		createEC2AMI := s.GetString("create_ec2_ami", "ubuntu-22.04")
 		createEC2Type := s.GetString("create_ec2_type", "t3.micro")
 		createEC2IPv6 := s.GetString("create_ec2_ipv6", "0") == "1"
-		createBundleName := findOptionName(bundleOptions, createBundle)
+		createEC2AZ := s.GetString("create_ec2_az", "")
+		if createEC2AZ != "" {
+			createEC2AZ = zoneName(region, createEC2AZ)
+		}
 		createRegions := regionOptionsForService(createService)
 		manageRegions := regionOptionsForService(manageService)
 
@@ -654,22 +745,20 @@ func main() {
 			CreateRegions:    createRegions,
 			ManageRegions:    manageRegions,
 			QuotaRegions:     ec2RegionOptions,
-			AZ:               az,
+			AZ:               zoneName(region, az),
 			Tab:              tab,
 			CreateIPType:     createIPType,
 			CreateBlueprint:  createBlueprint,
 			CreateBundle:     createBundle,
-			CreateEnableFW:   createFW,
+			CreateFirewall:   createFW,
+			CreateSSHKey:     s.GetString("create_ssh_key", ""),
 			CreateService:    createService,
 			CreateEC2AMI:     createEC2AMI,
 			CreateEC2Type:    createEC2Type,
 			CreateEC2IPv6:    createEC2IPv6,
-			CreateBundleName: createBundleName,
-			Blueprints:       blueprintOptions,
-			Bundles:          bundleOptions,
+			CreateEC2AZ:      createEC2AZ,
 			IPTypes:          ipTypeOptions,
 			EC2AMIs:          ec2AMIOptions,
-			EC2Types:         ec2InstanceTypes,
 			ManageService:    manageService,
 		}
 		if isAdmin {
@@ -679,6 +768,74 @@ func main() {
 			}
 		}
 
+		// 区域与可用区按当前密钥实时查询，查询失败时退回内置列表
+		if activeHasCreds && (tab == "create" || tab == "manage") {
+			service := createService
+			if tab == "manage" {
+				service = manageService
+			}
+			regions, err := discoverRegions(c.Request.Context(), service, activeKey)
+			if err != nil {
+				data.Flash.Warn = "拉取区域列表失败，使用内置列表：" + formatFlashError(err)
+			} else if tab == "create" {
+				data.CreateRegions = regions
+			} else {
+				data.ManageRegions = regions
+			}
+		}
+		if tab == "create" {
+			zones, err := discoverZones(c.Request.Context(), createService, region, activeKey)
+			if err != nil {
+				data.Flash.Warn = "拉取可用区失败：" + formatFlashError(err)
+			}
+			data.Zones = zones
+		}
+
+		if tab == "create" && createService == "ec2" {
+			presets, err := appStore.ListAMIPresets(c.Request.Context(), userID, region)
+			if err != nil {
+				auditError(c, err)
+			}
+			data.AMIPresets = presets
+			data.EC2AMIs = ec2AMIOptionsFor(presets)
+			if activeHasCreds {
+				types, err := ec2InstanceTypes(c.Request.Context(), region, func() (aws.EC2InstanceTypeAPI, error) {
+					return aws.NewEC2Client(c.Request.Context(), region, activeAK, activeKey.SecretKey, activeProxy)
+				})
+				if err != nil {
+					data.Flash.Error = "拉取实例类型失败：" + err.Error()
+				} else {
+					data.EC2Types = instanceTypeOptionsFor(types)
+				}
+			}
+		}
+		if tab == "create" {
+			sshKeys, err := appStore.ListSSHKeys(c.Request.Context(), userID)
+			if err != nil {
+				auditError(c, err)
+			}
+			data.SSHKeys = sshKeyOptionsFor(sshKeys)
+		}
+		if tab == "create" && createService == "lightsail" {
+			profiles, err := appStore.ListFirewallProfiles(c.Request.Context(), userID)
+			if err != nil {
+				auditError(c, err)
+			}
+			data.Firewalls = firewallOptionsFor(profiles)
+		}
+		if tab == "create" && createService == "lightsail" && activeHasCreds {
+			cat, err := lightsailCatalog(c.Request.Context(), region, func() (aws.LightsailAPI, error) {
+				return aws.NewLightsailClient(c.Request.Context(), region, activeAK, activeKey.SecretKey, activeProxy)
+			})
+			if err != nil {
+				data.Flash.Error = "拉取镜像与套餐失败：" + err.Error()
+			} else {
+				data.Blueprints = blueprintOptionsFor(cat)
+				data.Bundles = bundleOptionsFor(cat)
+				data.CreateBundleName = findOptionName(data.Bundles, createBundle)
+			}
+		}
+
 		data.QuotaRegion = "us-east-1"
 		if activeKey != nil {
 			if strings.TrimSpace(activeKey.QuotaRegion) != "" {
@@ -709,10 +866,44 @@ func main() {
 			data.Flash.Warn = "Access Key / Secret Key 不能为空"
 		case "needids":
 			data.Flash.Warn = "Blueprint / Bundle 不能为空"
+		case "blueprint_unsupported":
+			data.Flash.Warn = "该区域不提供所选系统镜像，请重新选择"
+		case "bundle_unsupported":
+			data.Flash.Warn = "该区域不提供所选套餐，请重新选择"
+		case "ipv6_unsupported":
+			data.Flash.Warn = "所选套餐在该区域没有仅 IPv6 版本"
+		case "needpwd":
+			data.Flash.Warn = "已勾选密码登录，请填写 Root 密码"
+		case "needlogin":
+			data.Flash.Warn = "请选择 SSH 公钥或开启密码登录，否则实例创建后无法登录"
+		case "sshkey_invalid":
+			data.Flash.Error = "SSH 公钥不可用：" + strings.TrimSpace(c.Query("err"))
+		case "firewall_invalid":
+			data.Flash.Warn = "所选防火墙模板不存在或规则无效，请重新选择"
+		case "catalog_failed":
+			data.Flash.Error = "拉取镜像与套餐失败（详情看日志）"
+		case "preset_saved":
+			data.Flash.Success = "已保存 AMI 预设"
+		case "preset_deleted":
+			data.Flash.Success = "已删除 AMI 预设"
+		case "preset_exists":
+			data.Flash.Warn = "该区域已保存过这个 AMI"
+		case "preset_invalid":
+			data.Flash.Error = "AMI 校验失败：" + strings.TrimSpace(c.Query("err"))
+		case "preset_failed":
+			data.Flash.Error = "保存 AMI 预设失败（详情看日志）"
+		case "region_disabled":
+			data.Flash.Warn = "当前账号未启用该区域，请先在 AWS 控制台启用（opt-in）"
+		case "zone_unavailable":
+			data.Flash.Warn = "所选可用区不存在或当前账号不可用，请重新选择"
 		case "err_client":
 			data.Flash.Error = "AWS 客户端初始化失败"
 		case "created":
 			data.Flash.Success = "✅ 创建请求已提交（稍等 1-2 分钟后去『管理』查看）"
+			if jobID, err := strconv.ParseInt(c.Query("job"), 10, 64); err == nil && jobID > 0 {
+				data.Flash.Info = "附加磁盘由后台任务 #" + strconv.FormatInt(jobID, 10) + " 在实例就绪后创建并挂载"
+				data.JobURL = "/jobs/" + strconv.FormatInt(jobID, 10)
+			}
 		case "create_failed":
 			errMsg := strings.TrimSpace(c.Query("err"))
 			if errMsg != "" {
@@ -748,6 +939,44 @@ func main() {
 			data.Flash.Success = "已提交删除（如有静态 IP 已尝试释放）"
 		case "delete_failed":
 			data.Flash.Error = "删除失败（详情看日志）"
+		case "snapshot_ok":
+			data.Flash.Success = "已提交创建快照（生成需要几分钟）"
+		case "snapshot_failed":
+			data.Flash.Error = "创建快照失败（详情看日志）"
+		case "restore_ok":
+			data.Flash.Success = "已提交从快照恢复（稍等 1-2 分钟后刷新）"
+		case "restore_failed":
+			data.Flash.Error = "从快照恢复失败（详情看日志）"
+		case "snapdelete_ok":
+			data.Flash.Success = "已删除快照"
+		case "snapdelete_failed":
+			data.Flash.Error = "删除快照失败（详情看日志）"
+		case "diskcreate_ok":
+			data.Flash.Success = "已提交创建磁盘（变为 available 后可挂载）"
+		case "diskcreate_failed":
+			data.Flash.Error = "创建磁盘失败：容量需在 8-16384 GB 之间，挂载点需为非系统目录的绝对路径（详情看日志）"
+		case "diskattach_ok":
+			data.Flash.Success = "已挂载磁盘（新实例外的磁盘需在实例内执行挂载命令）"
+		case "diskattach_failed":
+			data.Flash.Error = "挂载磁盘失败：磁盘需为 available 且与实例在同一可用区（详情看日志）"
+		case "diskdetach_ok":
+			data.Flash.Success = "已卸载磁盘"
+		case "diskdetach_failed":
+			data.Flash.Error = "卸载磁盘失败：需先停止实例（详情看日志）"
+		case "diskdelete_ok":
+			data.Flash.Success = "已删除磁盘"
+		case "diskdelete_failed":
+			data.Flash.Error = "删除磁盘失败：需先卸载（详情看日志）"
+		case "job_queued":
+			data.Flash.Info = "已提交后台任务"
+			if jobID, err := strconv.ParseInt(c.Query("job"), 10, 64); err == nil && jobID > 0 {
+				data.Flash.Info += " #" + strconv.FormatInt(jobID, 10)
+				data.JobURL = "/jobs/" + strconv.FormatInt(jobID, 10)
+			}
+		case "job_failed":
+			data.Flash.Error = "提交后台任务失败（详情看日志）"
+		case "swapip_invalid":
+			data.Flash.Error = "换IP设置无效：端口需为 1-65535，检测地址需为 http(s) URL，尝试次数 1-10，旧 IP 保留 0-4320 分钟"
 		}
 
 		// manage list
@@ -785,9 +1014,24 @@ func main() {
 						} else {
 							data.Instances = list
 							instCache.Set(key, list, cache.DefaultExpiration)
+							observeInstanceIPs(c.Request.Context(), userID, activeKey, region, list)
 						}
 					}
 				}
+				if len(data.Instances) > 0 {
+					cli, err := aws.NewLightsailClient(c.Request.Context(), region, activeAK, activeKey.SecretKey, activeProxy)
+					if err == nil {
+						data.Transfer, err = transferUsageFor(c.Request.Context(), cli, region, activeKey, data.Instances)
+					}
+					if err != nil {
+						data.Flash.Warn = "拉取流量用量失败：" + formatFlashError(err)
+					}
+				}
+				loadSnapshotsPage(c, &data, region, activeKey)
+				loadDisksPage(c, &data, region, activeKey)
+				if len(data.Instances) > 0 {
+					loadDomainsPage(c, &data, activeKey)
+				}
 			}
 		} else if tab == "manage" && !activeHasCreds {
 			data.Flash.Warn = "请先启用一个有效密钥再查看实例列表"
@@ -803,7 +1047,9 @@ func main() {
 			return
 		}
 		open := strings.TrimSpace(c.PostForm("open")) == "1"
-		_ = appStore.SetRegistrationOpen(c.Request.Context(), open)
+		if err := appStore.SetRegistrationOpen(c.Request.Context(), open); err != nil {
+			auditError(c, err)
+		}
 		c.Redirect(http.StatusFound, "/")
 	})
 
@@ -837,7 +1083,11 @@ func main() {
 				}
 			}
 		}
-		_ = appStore.DeleteUser(c.Request.Context(), userID)
+		if err := appStore.DeleteUser(c.Request.Context(), userID); err != nil {
+			auditError(c, err)
+		} else if _, err := appSessions.RevokeUser(c.Request.Context(), userID); err != nil {
+			auditError(c, err)
+		}
 		c.Redirect(http.StatusFound, "/")
 	})
 
@@ -874,6 +1124,8 @@ func main() {
 						s.SetString("pending_key_id", strconv.FormatInt(keyID, 10))
 						c.Redirect(http.StatusFound, "/?msg=updated")
 						return
+					} else {
+						auditError(c, err)
 					}
 				}
 			}
@@ -890,6 +1142,9 @@ func main() {
 		keyID, err := appStore.CreateKey(c.Request.Context(), userID, keyName, ak, sk, proxy)
 		if err == nil {
 			s.SetString("pending_key_id", strconv.FormatInt(keyID, 10))
+			c.Set("audit_key_id", keyID)
+		} else {
+			auditError(c, err)
 		}
 		c.Redirect(http.StatusFound, "/?msg=saved")
 	})
@@ -944,7 +1199,9 @@ func main() {
 		var deletedKeyID int64
 		if keyIDStr != "" {
 			if keyID, err := strconv.ParseInt(keyIDStr, 10, 64); err == nil && keyID > 0 {
-				_ = appStore.DeleteKey(c.Request.Context(), userID, keyID)
+				if err := appStore.DeleteKey(c.Request.Context(), userID, keyID); err != nil {
+					auditError(c, err)
+				}
 				deletedKeyID = keyID
 			}
 		}
@@ -1010,19 +1267,30 @@ func main() {
 		if region == "" {
 			region = "us-east-1"
 		}
-		if az == "" {
-			az = "a"
-		}
 		s.SetString("region", region)
-		s.SetString("az", az)
+
+		// 默认只用 SSH 密钥登录，root 密码登录需要显式勾选
+		sshKey := strings.TrimSpace(c.PostForm("ssh_key"))
+		s.SetString("create_ssh_key", sshKey)
+		rootPwd := ""
+		if c.PostForm("password_login") == "1" {
+			rootPwd = strings.TrimSpace(c.PostForm("root_pwd"))
+			if rootPwd == "" {
+				c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=needpwd&service="+service)
+				return
+			}
+		}
 
 		if service == "ec2" {
 			amiChoice := strings.TrimSpace(c.PostForm("ec2_ami"))
+			amiCustom := strings.TrimSpace(c.PostForm("ec2_ami_custom"))
 			instanceType := strings.TrimSpace(c.PostForm("ec2_type"))
-			instanceTypeCustom := strings.TrimSpace(c.PostForm("ec2_type_custom"))
 			enableIPv6 := strings.TrimSpace(c.PostForm("ec2_ipv6")) == "1"
 			countStr := strings.TrimSpace(c.PostForm("ec2_count"))
-			rootPwd := strings.TrimSpace(c.PostForm("root_pwd"))
+			if sshKey == "" && rootPwd == "" {
+				c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=needlogin&service=ec2")
+				return
+			}
 			if amiChoice != "" {
 				s.SetString("create_ec2_ami", amiChoice)
 			}
@@ -1034,6 +1302,8 @@ func main() {
 			} else {
 				s.SetString("create_ec2_ipv6", "0")
 			}
+			// 未选择可用区时交给 AWS 放置，避免实例类型在 a 区不提供时创建失败
+			s.SetString("create_ec2_az", az)
 
 			count := int32(1)
 			if countStr != "" {
@@ -1044,16 +1314,41 @@ func main() {
 
 			cli, err := aws.NewEC2Client(c.Request.Context(), region, ak, sk, proxy)
 			if err != nil {
+				auditError(c, err)
 				c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=err_client&service=ec2")
 				return
 			}
 
-			if instanceType == "custom" {
-				instanceType = instanceTypeCustom
+			// 实例类型可以手动输入，调用 RunInstances 前先确认区域内提供该类型
+			types, err := ec2InstanceTypes(c.Request.Context(), region, func() (aws.EC2InstanceTypeAPI, error) { return cli, nil })
+			if err == nil {
+				_, err = aws.FindInstanceType(types, instanceType)
+			}
+			if err != nil {
+				auditError(c, err)
+				c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=create_failed&service=ec2&err="+url.QueryEscape(formatFlashError(err)))
+				return
+			}
+			zone := ""
+			if az != "" {
+				zone = zoneName(region, az)
+				if msg := checkPlacement(c.Request.Context(), "ec2", region, zone, activeKey); msg != "" {
+					c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg="+msg+"&service=ec2")
+					return
+				}
+				if err := aws.CheckInstanceTypeInZone(c.Request.Context(), cli, instanceType, zone); err != nil {
+					auditError(c, err)
+					c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=create_failed&service=ec2&err="+url.QueryEscape(formatFlashError(err)))
+					return
+				}
+			}
+			if amiChoice == "custom" {
+				amiChoice = amiCustom
 			}
 
-			amiID, err := aws.ResolveEC2AMI(c.Request.Context(), cli, amiChoice)
+			amiID, err := aws.ResolveEC2AMI(c.Request.Context(), cli, amiChoice, instanceType)
 			if err != nil {
+				auditError(c, err)
 				errMsg := formatFlashError(err)
 				if errMsg != "" {
 					c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=create_failed&service=ec2&err="+url.QueryEscape(errMsg))
@@ -1063,20 +1358,32 @@ func main() {
 				return
 			}
 
+			keyPair, err := sshKeyPairFor(c.Request.Context(), userID, sshKey, func(name, pub string) error {
+				return aws.EnsureEC2KeyPair(c.Request.Context(), cli, name, pub)
+			})
+			if err != nil {
+				auditError(c, err)
+				c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=sshkey_invalid&service=ec2&err="+url.QueryEscape(formatFlashError(err)))
+				return
+			}
+
 			userData := ""
 			if rootPwd != "" {
-				userData = aws.BuildRootPasswordUserData(rootPwd)
+				userData = aws.BuildRootPasswordUserData(rootPwd, keyPair != "")
 			}
 
 			err = aws.CreateEC2Instance(c.Request.Context(), cli, aws.CreateEC2InstanceInput{
-				Name:         "ec2-" + strconv.FormatInt(time.Now().Unix(), 10),
-				AMI:          amiID,
-				InstanceType: instanceType,
-				Count:        count,
-				UserData:     userData,
-				EnableIPv6:   enableIPv6,
+				Name:             "ec2-" + strconv.FormatInt(time.Now().Unix(), 10),
+				AMI:              amiID,
+				InstanceType:     instanceType,
+				Count:            count,
+				UserData:         userData,
+				KeyName:          keyPair,
+				EnableIPv6:       enableIPv6,
+				AvailabilityZone: zone,
 			})
 			if err != nil {
+				auditError(c, err)
 				errMsg := formatFlashError(err)
 				if errMsg != "" {
 					c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=create_failed&service=ec2&err="+url.QueryEscape(errMsg))
@@ -1093,17 +1400,17 @@ func main() {
 			return
 		}
 
+		s.SetString("az", firstNonEmpty(az, "a"))
 		ipType := strings.TrimSpace(c.PostForm("ip_type"))
 		if ipType == "" {
 			ipType = "dualstack"
 		}
 		s.SetString("create_ip_type", ipType)
-		enableFW := c.PostForm("enable_fw") == "1"
-		if enableFW {
-			s.SetString("create_fw_all", "1")
-		} else {
-			s.SetString("create_fw_all", "0")
+		firewall := strings.TrimSpace(c.PostForm("firewall"))
+		if firewall == "" && c.PostForm("enable_fw") == "1" {
+			firewall = firewallAll
 		}
+		s.SetString("create_firewall", firstNonEmpty(firewall, firewallDefault))
 
 		blueprint := strings.TrimSpace(c.PostForm("blueprint_id"))
 		bundle := strings.TrimSpace(c.PostForm("bundle_id"))
@@ -1113,36 +1420,67 @@ func main() {
 		if bundle != "" {
 			s.SetString("create_bundle", bundle)
 		}
-		rootPwd := strings.TrimSpace(c.PostForm("root_pwd"))
-
-		if rootPwd == "" {
-			c.Redirect(http.StatusFound, "/?tab=create&region="+region)
-			return
-		}
 		if blueprint == "" || bundle == "" {
 			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=needids")
 			return
 		}
+		diskSize, diskMount, err := parseExtraDisk(c.PostForm("disk_size"), c.PostForm("disk_mount"))
+		if err != nil {
+			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=create_failed&err="+url.QueryEscape(err.Error()))
+			return
+		}
 
 		// instanceName: keep it unique like python version
 		instanceName := "vps-" + strconv.FormatInt(time.Now().Unix(), 10)
-		userData := aws.BuildRootPasswordUserData(rootPwd)
-
-		// If ipv6-only, use ipv6 bundle encoding (Lightsail real bundle id)
-		bundleToUse := bundle
-		if ipType == "ipv6" {
-			if v, ok := ipv6BundleMap[bundle]; ok {
-				bundleToUse = v
-			}
-		}
 
 		cli, err := aws.NewLightsailClient(c.Request.Context(), region, ak, sk, proxy)
 		if err != nil {
+			auditError(c, err)
 			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=err_client")
 			return
 		}
 
-		availabilityZone := region + az
+		cat, err := lightsailCatalog(c.Request.Context(), region, func() (aws.LightsailAPI, error) { return cli, nil })
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=catalog_failed")
+			return
+		}
+		// 仅 IPv6 时换成同规格的 IPv6 套餐 ID
+		bundleToUse, msg := lightsailBundleFor(cat, blueprint, bundle, ipType)
+		if msg != "" {
+			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg="+msg)
+			return
+		}
+
+		availabilityZone := zoneName(region, az)
+		if msg := checkPlacement(c.Request.Context(), "lightsail", region, availabilityZone, activeKey); msg != "" {
+			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg="+msg)
+			return
+		}
+
+		fwRules, err := firewallRulesFor(c.Request.Context(), userID, firewall)
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=firewall_invalid")
+			return
+		}
+
+		keyPair, err := sshKeyPairFor(c.Request.Context(), userID, sshKey, func(name, pub string) error {
+			return aws.EnsureLightsailKeyPair(c.Request.Context(), cli, name, pub)
+		})
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=sshkey_invalid&err="+url.QueryEscape(formatFlashError(err)))
+			return
+		}
+		userData := ""
+		if rootPwd != "" {
+			userData = aws.BuildRootPasswordUserData(rootPwd, keyPair != "")
+		}
+		if diskSize > 0 {
+			userData = aws.AppendUserData(userData, aws.DiskMountScript(firstDiskPath, diskMount))
+		}
 
 		err = aws.CreateInstance(c.Request.Context(), cli, aws.CreateInstanceInput{
 			InstanceName:     instanceName,
@@ -1151,9 +1489,11 @@ func main() {
 			BundleID:         bundleToUse,
 			UserData:         userData,
 			IPAddressType:    ipType,
-			EnableFWAll:      enableFW,
+			FirewallRules:    fwRules,
+			KeyPairName:      keyPair,
 		})
 		if err != nil {
+			auditError(c, err)
 			c.Redirect(http.StatusFound, "/?tab=create&region="+region+"&msg=create_failed")
 			return
 		}
@@ -1162,6 +1502,22 @@ func main() {
 		key := strings.Join([]string{"inst", region, ak, proxy}, "|")
 		instCache.Delete(key)
 
+		if diskSize > 0 {
+			jobID, err := enqueueDiskJob(c.Request.Context(), userID, activeKey, region, instanceName, diskJobParams{
+				Disk:       aws.DiskName(instanceName),
+				SizeGB:     diskSize,
+				Zone:       availabilityZone,
+				Path:       firstDiskPath,
+				MountPoint: diskMount,
+			})
+			if err != nil {
+				auditError(c, err)
+				c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg=job_failed")
+				return
+			}
+			c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg=created&job="+strconv.FormatInt(jobID, 10))
+			return
+		}
 		c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg=created")
 	})
 
@@ -1172,6 +1528,19 @@ func main() {
 		})
 	})
 
+	// 启动、停止需要等待实例状态变化，同样交给后台任务
+	r.POST("/aws/start", func(c *gin.Context) {
+		enqueueLightsailJob(c, jobKindStart)
+	})
+
+	r.POST("/aws/stop", func(c *gin.Context) {
+		kind := jobKindStop
+		if c.PostForm("force") == "1" {
+			kind = jobKindForceStop
+		}
+		enqueueLightsailJob(c, kind)
+	})
+
 	r.POST("/aws/openall", func(c *gin.Context) {
 		doManageAction(c, "openall", func(ctx *gin.Context, cli aws.LightsailAPI, name string) error {
 			return aws.OpenAllPorts(ctx.Request.Context(), cli, name)
@@ -1207,16 +1576,25 @@ func main() {
 		c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&service="+service)
 	})
 
+	// 删除与换 IP 可能耗时数分钟，交给后台任务执行
 	r.POST("/aws/delete", func(c *gin.Context) {
-		doManageAction(c, "delete", func(ctx *gin.Context, cli aws.LightsailAPI, name string) error {
-			return aws.DeleteInstanceWithStaticIPCleanup(ctx.Request.Context(), cli, name)
-		})
+		enqueueLightsailJob(c, jobKindDelete)
 	})
 
 	r.POST("/aws/swapip", func(c *gin.Context) {
-		doManageAction(c, "swapip", func(ctx *gin.Context, cli aws.LightsailAPI, name string) error {
-			return aws.SwapStaticIPForInstance(ctx.Request.Context(), cli, name)
-		})
+		p, err := parseSwapJobParams(c.PostForm("probe_ports"), c.PostForm("probe_url"), c.PostForm("max_attempts"), c.PostForm("keep_old_minutes"))
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/?tab=manage&region="+normalizeRegion(c.PostForm("region"))+"&msg=swapip_invalid")
+			return
+		}
+		params, err := p.encode()
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/?tab=manage&region="+normalizeRegion(c.PostForm("region"))+"&msg=job_failed")
+			return
+		}
+		enqueueLightsailJobWithParams(c, jobKindSwapIP, params)
 	})
 
 	r.POST("/aws/ec2/start", func(c *gin.Context) {
@@ -1275,6 +1653,7 @@ func main() {
 
 		sq, err := aws.NewServiceQuotasClient(c.Request.Context(), region, ak, sk, proxy)
 		if err != nil {
+			auditError(c, err)
 			s.SetString("quota_on", "")
 			s.SetString("quota_spot", "")
 			lastTab := s.GetString("last_tab", "create")
@@ -1284,6 +1663,7 @@ func main() {
 
 		onVal, spotVal, onName, spotName, err := aws.TestVCPUQuotas(c.Request.Context(), sq)
 		if err != nil || (strings.TrimSpace(onVal) == "" && strings.TrimSpace(spotVal) == "") {
+			auditError(c, err)
 			s.SetString("quota_on", "")
 			s.SetString("quota_spot", "")
 			s.SetString("quota_on_name", "")
@@ -1298,6 +1678,7 @@ func main() {
 		s.SetString("quota_on_name", onName)
 		s.SetString("quota_sp_name", spotName)
 		if err := appStore.UpdateKeyQuota(c.Request.Context(), userID, activeKey.ID, region, onVal, spotVal, onName, spotName); err != nil {
+			auditError(c, err)
 			lastTab := s.GetString("last_tab", "create")
 			c.Redirect(http.StatusFound, "/?tab="+lastTab+"&msg=quota_err")
 			return
@@ -1315,6 +1696,13 @@ func main() {
 }
 
 func doManageAction(c *gin.Context, action string, fn func(ctx *gin.Context, cli aws.LightsailAPI, name string) error) {
+	doManageActionOn(c, action, "instance", func(ctx *gin.Context, cli aws.LightsailAPI, _ *store.Key, name string) error {
+		return fn(ctx, cli, name)
+	})
+}
+
+// doManageActionOn 与 doManageAction 相同，但操作对象取自表单字段 field（例如快照名）。
+func doManageActionOn(c *gin.Context, action, field string, fn func(ctx *gin.Context, cli aws.LightsailAPI, key *store.Key, target string) error) {
 	s := session.Must(c)
 	userID, _ := userIDFromSession(s)
 	keys, _ := appStore.ListKeys(c.Request.Context(), userID)
@@ -1331,7 +1719,7 @@ func doManageAction(c *gin.Context, action string, fn func(ctx *gin.Context, cli
 	if region == "" {
 		region = normalizeRegion(s.GetString("region", "us-east-1"))
 	}
-	name := strings.TrimSpace(c.PostForm("instance"))
+	name := strings.TrimSpace(c.PostForm(field))
 	if name == "" {
 		c.Redirect(http.StatusFound, "/?tab=manage&region="+region)
 		return
@@ -1343,18 +1731,21 @@ func doManageAction(c *gin.Context, action string, fn func(ctx *gin.Context, cli
 
 	cli, err := aws.NewLightsailClient(c.Request.Context(), region, ak, sk, proxy)
 	if err != nil {
+		auditError(c, err)
 		c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg=err_client")
 		return
 	}
 
-	if err := fn(c, cli, name); err != nil {
+	if err := fn(c, cli, activeKey, name); err != nil {
+		auditError(c, err)
 		c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg="+action+"_failed")
 		return
 	}
 
-	// invalidate cache
-	key := strings.Join([]string{"inst", region, ak, proxy}, "|")
-	instCache.Delete(key)
+	// invalidate cache（实例、快照与磁盘列表）
+	instCache.Delete(instCacheKey("inst", region, activeKey))
+	instCache.Delete(instCacheKey("snap", region, activeKey))
+	instCache.Delete(instCacheKey("disk", region, activeKey))
 
 	c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg="+action+"_ok")
 }
@@ -1388,17 +1779,23 @@ func doManageActionEC2(c *gin.Context, action string, fn func(ctx *gin.Context,
 
 	cli, err := aws.NewEC2Client(c.Request.Context(), region, ak, sk, proxy)
 	if err != nil {
+		auditError(c, err)
 		c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg=err_client&service=ec2")
 		return
 	}
 
 	if err := fn(c, cli, id); err != nil {
+		auditError(c, err)
 		c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg="+action+"_failed&service=ec2")
 		return
 	}
 
 	key := strings.Join([]string{"ec2inst", region, ak, proxy}, "|")
 	instCache.Delete(key)
+	// 没有弹性 IP 的 EC2 实例每次启动都会换公网 IP
+	if action == "start" {
+		enqueueDNSSync(c.Request.Context(), userID, activeKey, jobKindEC2SyncDNS, region, id)
+	}
 
 	c.Redirect(http.StatusFound, "/?tab=manage&region="+region+"&msg="+action+"_ok&service=ec2")
 }
@@ -1,6 +1,29 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	lstypes "github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+	"github.com/aws/smithy-go"
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
 
 func TestNormalizeRegion(t *testing.T) {
 	cases := []struct {
@@ -21,3 +44,335 @@ func TestNormalizeRegion(t *testing.T) {
 		})
 	}
 }
+
+func TestZoneName(t *testing.T) {
+	cases := []struct {
+		region, az, want string
+	}{
+		{region: "us-east-1", az: "b", want: "us-east-1b"},
+		{region: "us-east-1", az: "", want: "us-east-1a"},
+		{region: "us-east-1", az: "us-east-1c", want: "us-east-1c"},
+	}
+
+	for _, tc := range cases {
+		if got := zoneName(tc.region, tc.az); got != tc.want {
+			t.Fatalf("zoneName(%q, %q) = %q, want %q", tc.region, tc.az, got, tc.want)
+		}
+	}
+}
+
+func TestFormatMetricValue(t *testing.T) {
+	cases := []struct {
+		v    float64
+		unit string
+		want string
+	}{
+		{v: 12.345, unit: "Percent", want: "12.3%"},
+		{v: 512, unit: "Bytes", want: "512 B"},
+		{v: 3 * 1024 * 1024, unit: "Bytes", want: "3.0 MB"},
+		{v: 2, unit: "Count", want: "2"},
+	}
+
+	for _, tc := range cases {
+		if got := formatMetricValue(tc.v, tc.unit); got != tc.want {
+			t.Fatalf("formatMetricValue(%v, %q) = %q, want %q", tc.v, tc.unit, got, tc.want)
+		}
+	}
+}
+
+func TestTransferGuardPercent(t *testing.T) {
+	u := aws.TransferUsage{AllowanceGB: 1000, OutGB: 300, ObservedOutGB: 300, ProjectedOutGB: 950}
+	now := time.Date(2026, 4, 10, 0, 0, 0, 0, time.UTC)
+	if got := transferGuardPercent(store.TransferGuardBasisActual, u, now); got != 30 {
+		t.Fatalf("actual = %v, want 30", got)
+	}
+	if got := transferGuardPercent(store.TransferGuardBasisProjected, u, now); got != 95 {
+		t.Fatalf("projected = %v, want 95", got)
+	}
+	// 月初头一天不按预估触发
+	if got := transferGuardPercent(store.TransferGuardBasisProjected, u, time.Date(2026, 4, 1, 6, 0, 0, 0, time.UTC)); got != 0 {
+		t.Fatalf("projected on day one = %v, want 0", got)
+	}
+	if got := transferGuardPercent(store.TransferGuardBasisActual, aws.TransferUsage{OutGB: 5}, now); got != 0 {
+		t.Fatalf("no allowance = %v, want 0", got)
+	}
+	// 月初数据已过保留期：OutGB 是推算值，按已用流量只看实际取到的部分
+	est := aws.TransferUsage{AllowanceGB: 1000, OutGB: 960, ObservedOutGB: 450, ProjectedOutGB: 1100, Estimated: true}
+	late := time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC)
+	if got := transferGuardPercent(store.TransferGuardBasisActual, est, late); got != 45 {
+		t.Fatalf("actual with estimated usage = %v, want 45", got)
+	}
+	if got := transferGuardPercent(store.TransferGuardBasisProjected, est, late); math.Abs(got-110) > 1e-9 {
+		t.Fatalf("projected with estimated usage = %v, want 110", got)
+	}
+}
+
+func TestParseExtraDisk(t *testing.T) {
+	if size, mount, err := parseExtraDisk("", "/srv"); err != nil || size != 0 || mount != "" {
+		t.Fatalf("empty = %d, %q, %v", size, mount, err)
+	}
+	if size, mount, err := parseExtraDisk(" 64 ", ""); err != nil || size != 64 || mount != "/data" {
+		t.Fatalf("64 = %d, %q, %v", size, mount, err)
+	}
+	for _, s := range []string{"4", "-1", "abc", "20000"} {
+		if _, _, err := parseExtraDisk(s, "/data"); !errors.Is(err, aws.ErrInvalidDiskSize) {
+			t.Fatalf("parseExtraDisk(%q) err = %v, want ErrInvalidDiskSize", s, err)
+		}
+	}
+	if _, _, err := parseExtraDisk("32", "/etc"); !errors.Is(err, aws.ErrInvalidMountPoint) {
+		t.Fatalf("mount /etc err = %v, want ErrInvalidMountPoint", err)
+	}
+}
+
+func TestParseSwapJobParams(t *testing.T) {
+	if p, err := parseSwapJobParams("", " ", "5", ""); err != nil || p.probe().Enabled() || p.MaxAttempts != 0 {
+		t.Fatalf("no probe = %+v, %v", p, err)
+	}
+	p, err := parseSwapJobParams("22,443", "https://{ip}.check.example.com/?port={port}", "", "")
+	if err != nil || len(p.Ports) != 2 || p.MaxAttempts != defaultSwapAttempts {
+		t.Fatalf("probe = %+v, %v", p, err)
+	}
+	if params, err := p.encode(); err != nil || params == "" {
+		t.Fatalf("encode = %q, %v", params, err)
+	}
+	if p, err := parseSwapJobParams("", "", "", "60"); err != nil || p.probe().Enabled() || p.KeepOldMinutes != 60 {
+		t.Fatalf("keep old = %+v, %v", p, err)
+	} else if params, _ := p.encode(); params == "" {
+		t.Fatal("keep old params encoded as empty")
+	}
+	for _, in := range [][4]string{{"0", "", "", ""}, {"22", "", "11", ""}, {"", "ftp://x", "", ""}, {"", "check", "", ""}, {"", "http://127.0.0.1:8080/", "", ""}, {"", "", "", "-1"}, {"", "", "", "99999"}} {
+		if _, err := parseSwapJobParams(in[0], in[1], in[2], in[3]); err == nil {
+			t.Fatalf("parseSwapJobParams(%q) = nil error", in)
+		}
+	}
+}
+
+func TestFormatIPDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{0: "-", 30 * time.Second: "不到 1 分钟", 90 * time.Minute: "1 小时", 72 * time.Hour: "3 天"} {
+		if got := formatIPDuration(d); got != want {
+			t.Fatalf("formatIPDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestLoadKeyringRequiresExplicitKey(t *testing.T) {
+	t.Setenv("APP_MASTER_KEY", "")
+	t.Setenv("APP_MASTER_KEY_FILE", "")
+	t.Setenv("APP_MASTER_KEY_PREVIOUS", "")
+	dataDir := t.TempDir()
+	dbPath := filepath.Join(dataDir, "app.db")
+
+	if _, err := loadKeyring(dbPath, false); err == nil {
+		t.Fatalf("expected error without APP_MASTER_KEY / APP_MASTER_KEY_FILE")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "master.key")); !os.IsNotExist(err) {
+		t.Fatalf("master.key must not be generated next to the database, stat err=%v", err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "secrets", "master.key")
+	t.Setenv("APP_MASTER_KEY_FILE", keyFile)
+	first, err := loadKeyring(dbPath, false)
+	if err != nil {
+		t.Fatalf("generate key file: %v", err)
+	}
+	second, err := loadKeyring(dbPath, false)
+	if err != nil {
+		t.Fatalf("reload key file: %v", err)
+	}
+	if first.PrimaryID() != second.PrimaryID() {
+		t.Fatalf("key file should be reused, got %s then %s", first.PrimaryID(), second.PrimaryID())
+	}
+
+	// 数据库里已有密文时，key 文件不存在不能生成新 key
+	missing := filepath.Join(t.TempDir(), "typo", "master.key")
+	t.Setenv("APP_MASTER_KEY_FILE", missing)
+	if _, err := loadKeyring(dbPath, true); err == nil || !strings.Contains(err.Error(), missing) {
+		t.Fatalf("missing key file with encrypted secrets: err = %v", err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("key file must not be generated when secrets exist, stat err=%v", err)
+	}
+
+	t.Setenv("APP_MASTER_KEY_FILE", "")
+	if err := os.WriteFile(filepath.Join(dataDir, "master.key"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadKeyring(dbPath, false); err == nil {
+		t.Fatalf("legacy master.key next to the database should not be loaded silently")
+	}
+}
+
+// fakeLeftoverStaticIPs 模拟区域内未绑定的静态 IP，EC2 侧没有遗留资源。
+type fakeLeftoverStaticIPs struct {
+	aws.LightsailAPI
+	aws.EC2LeftoverAPI
+	names    []string
+	released []string
+}
+
+func (f *fakeLeftoverStaticIPs) GetStaticIps(context.Context, *lightsail.GetStaticIpsInput, ...func(*lightsail.Options)) (*lightsail.GetStaticIpsOutput, error) {
+	out := &lightsail.GetStaticIpsOutput{}
+	for _, name := range f.names {
+		out.StaticIps = append(out.StaticIps, lstypes.StaticIp{Name: &name})
+	}
+	return out, nil
+}
+
+func (f *fakeLeftoverStaticIPs) ReleaseStaticIp(_ context.Context, in *lightsail.ReleaseStaticIpInput, _ ...func(*lightsail.Options)) (*lightsail.ReleaseStaticIpOutput, error) {
+	f.released = append(f.released, *in.StaticIpName)
+	return &lightsail.ReleaseStaticIpOutput{}, nil
+}
+
+func (f *fakeLeftoverStaticIPs) DescribeAddresses(context.Context, *ec2.DescribeAddressesInput, ...func(*ec2.Options)) (*ec2.DescribeAddressesOutput, error) {
+	return &ec2.DescribeAddressesOutput{}, nil
+}
+
+func (f *fakeLeftoverStaticIPs) DescribeVolumes(context.Context, *ec2.DescribeVolumesInput, ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	return &ec2.DescribeVolumesOutput{}, nil
+}
+
+func (f *fakeLeftoverStaticIPs) DescribeSnapshots(context.Context, *ec2.DescribeSnapshotsInput, ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+	return &ec2.DescribeSnapshotsOutput{}, nil
+}
+
+func (f *fakeLeftoverStaticIPs) DescribeImages(context.Context, *ec2.DescribeImagesInput, ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	return &ec2.DescribeImagesOutput{}, nil
+}
+
+func TestSweepLeftoversSkipsHeldStaticIP(t *testing.T) {
+	st, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	prev := appStore
+	appStore = st
+	defer func() { appStore = prev }()
+
+	ctx := context.Background()
+	key := &store.Key{ID: 1, UserID: 1}
+	expires := time.Now().Add(time.Hour)
+	for _, h := range []*store.HeldStaticIP{
+		{UserID: 1, KeyID: 1, Region: "us-east-1", Name: "sip-held", ExpiresAt: expires},
+		{UserID: 1, KeyID: 2, Region: "us-east-1", Name: "sip-other-key", ExpiresAt: expires},
+		{UserID: 1, KeyID: 1, Region: "us-east-1", Name: "sip-failed", ExpiresAt: expires},
+	} {
+		if err := st.CreateHeldStaticIP(ctx, h); err != nil {
+			t.Fatalf("CreateHeldStaticIP: %v", err)
+		}
+		if h.Name == "sip-failed" {
+			if err := st.FinishHeldStaticIP(ctx, h.ID, store.HeldStaticIPFailed, "x"); err != nil {
+				t.Fatalf("FinishHeldStaticIP: %v", err)
+			}
+		}
+	}
+	cli := &fakeLeftoverStaticIPs{names: []string{"sip-held", "sip-other-key", "sip-failed"}}
+
+	list, err := listLeftovers(ctx, key, "us-east-1", cli, cli)
+	if err != nil {
+		t.Fatalf("listLeftovers: %v", err)
+	}
+	held := map[string]bool{}
+	for _, l := range list {
+		held[l.ID] = l.HeldUntil != nil
+	}
+	if len(list) != 3 || !held["sip-held"] || held["sip-other-key"] || held["sip-failed"] {
+		t.Fatalf("leftovers = %+v", list)
+	}
+
+	refs := []string{"static_ip:sip-held", "static_ip:sip-other-key", "static_ip:sip-failed"}
+	results, err := sweepLeftovers(ctx, key, "us-east-1", cli, cli, refs, false)
+	if err != nil {
+		t.Fatalf("sweepLeftovers: %v", err)
+	}
+	if len(results) != 3 || results[0].Deleted || results[0].Error != errLeftoverHeld.Error() || !results[1].Deleted || !results[2].Deleted {
+		t.Fatalf("results = %+v", results)
+	}
+	if len(cli.released) != 2 || cli.released[0] != "sip-other-key" || cli.released[1] != "sip-failed" {
+		t.Fatalf("released = %q", cli.released)
+	}
+}
+
+func TestHeldIPReleaseRetry(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		permanent bool
+	}{
+		{fmt.Errorf("%w：sip-old 已绑定到 vps-2", aws.ErrStaticIPInUse), true},
+		{errJobKeyDeleted, true},
+		{&smithy.GenericAPIError{Code: "UnrecognizedClientException"}, true},
+		{&smithy.GenericAPIError{Code: "ThrottlingException"}, false},
+		{errors.New("proxyconnect tcp: connection refused"), false},
+	} {
+		if got := heldIPReleasePermanent(tc.err); got != tc.permanent {
+			t.Fatalf("heldIPReleasePermanent(%v) = %v", tc.err, got)
+		}
+	}
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 32 * time.Minute, time.Hour, time.Hour, time.Hour}
+	for i, d := range want {
+		if got := heldIPRetryDelay(i); got != d {
+			t.Fatalf("heldIPRetryDelay(%d) = %v, want %v", i, got, d)
+		}
+	}
+}
+
+func TestAuditMiddlewareCoversAuthRoutes(t *testing.T) {
+	st, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	prev := appStore
+	appStore = st
+	defer func() { appStore = prev }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		s := session.New()
+		if c.Request.URL.Path == "/logout" {
+			s.SetString("user_id", "7")
+			s.SetString("username", "alice")
+		}
+		c.Set("sess", s)
+	})
+	r.Use(auditMiddleware())
+	r.POST("/login", func(c *gin.Context) { c.Redirect(http.StatusFound, "/login?msg=bad") })
+	r.POST("/logout", func(c *gin.Context) {
+		s := session.Must(c)
+		s.SetString("user_id", "")
+		s.SetString("username", "")
+		c.Redirect(http.StatusFound, "/login?msg=logout")
+	})
+	r.POST("/register", func(c *gin.Context) { c.Redirect(http.StatusFound, "/login?msg=registered") })
+	r.GET("/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, path := range []string{"/login", "/logout", "/register"} {
+		form := url.Values{"username": {"bob"}, "password": {"hunter2"}, "csrf_token": {"tok"}}
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	events, total, err := st.ListAuditEvents(context.Background(), store.AuditFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("audit events = %d, want 3: %+v", total, events)
+	}
+	got := map[string]store.AuditEvent{}
+	for _, e := range events {
+		got[e.Action] = e
+		if e.Service != "auth" || strings.Contains(e.Params, "hunter2") || strings.Contains(e.Params, "tok") {
+			t.Fatalf("event %s = %+v", e.Action, e)
+		}
+	}
+	if e := got["/login"]; e.Result != "failed" || e.Error != "bad" {
+		t.Fatalf("failed login = %+v", e)
+	}
+	if e := got["/logout"]; e.Result != "ok" || e.UserID != 7 || e.Username != "alice" {
+		t.Fatalf("logout = %+v", e)
+	}
+	if e := got["/register"]; e.Result != "ok" || !strings.Contains(e.Params, `"username":"bob"`) {
+		t.Fatalf("register = %+v", e)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+// 监控数据按时间范围缓存，1 小时视图刷新快一些
+var metricCacheTTL = map[string]time.Duration{
+	"1h":  time.Minute,
+	"24h": 5 * time.Minute,
+	"7d":  15 * time.Minute,
+}
+
+const (
+	chartWidth  = 600
+	chartHeight = 120
+)
+
+// MetricChart 是一个指标在监控页上的展示数据，Polyline 为 SVG polyline 的 points 属性。
+type MetricChart struct {
+	Label    string
+	Name     string
+	Last     string
+	Avg      string
+	Max      string
+	Start    string
+	End      string
+	Polyline string
+	Empty    bool
+}
+
+type MetricsPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	Flash     Flash
+
+	Region   string
+	Instance string
+	Period   string
+	Periods  []aws.MetricPeriod
+	Charts   []MetricChart
+}
+
+func cachedInstanceMetrics(ctx context.Context, cli aws.LightsailAPI, region string, key *store.Key, name string, period aws.MetricPeriod) ([]aws.MetricSeries, error) {
+	cacheKey := instCacheKey("metrics", region, key) + "|" + name + "|" + period.Key
+	if v, ok := instCache.Get(cacheKey); ok {
+		return v.([]aws.MetricSeries), nil
+	}
+	series, err := aws.GetInstanceMetrics(ctx, cli, name, period)
+	if err != nil {
+		return nil, err
+	}
+	instCache.Set(cacheKey, series, metricCacheTTL[period.Key])
+	return series, nil
+}
+
+func formatMetricValue(v float64, unit string) string {
+	switch unit {
+	case "Percent":
+		return strconv.FormatFloat(v, 'f', 1, 64) + "%"
+	case "Bytes":
+		return formatBytes(v)
+	}
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
+
+func formatBytes(v float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatFloat(v, 'f', 0, 64) + " B"
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64) + " " + units[i]
+}
+
+// metricChartFor 把数据点按时间映射到固定大小的画布，纵轴从 0 到最大值（百分比固定到 100）。
+func metricChartFor(s aws.MetricSeries) MetricChart {
+	ch := MetricChart{Label: s.Label, Name: s.Name, Empty: len(s.Points) == 0}
+	if ch.Empty {
+		return ch
+	}
+	first, last := s.Points[0], s.Points[len(s.Points)-1]
+	maxV, sum := 0.0, 0.0
+	for _, p := range s.Points {
+		sum += p.Value
+		if p.Value > maxV {
+			maxV = p.Value
+		}
+	}
+	ch.Last = formatMetricValue(last.Value, s.Unit)
+	ch.Avg = formatMetricValue(sum/float64(len(s.Points)), s.Unit)
+	ch.Max = formatMetricValue(maxV, s.Unit)
+	ch.Start = first.Time.Local().Format("01-02 15:04")
+	ch.End = last.Time.Local().Format("01-02 15:04")
+
+	top := maxV
+	if s.Unit == "Percent" {
+		top = 100
+	}
+	if top <= 0 {
+		top = 1
+	}
+	span := last.Time.Sub(first.Time).Seconds()
+	pts := make([]string, 0, len(s.Points))
+	for _, p := range s.Points {
+		x := 0.0
+		if span > 0 {
+			x = p.Time.Sub(first.Time).Seconds() / span * chartWidth
+		}
+		y := chartHeight - p.Value/top*chartHeight
+		pts = append(pts, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	ch.Polyline = strings.Join(pts, " ")
+	return ch
+}
+
+func registerMetricsRoutes(r *gin.Engine) {
+	r.GET("/metrics", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		region := normalizeRegion(firstNonEmpty(c.Query("region"), s.GetString("region", "us-east-1")))
+		period := aws.FindMetricPeriod(c.Query("period"))
+		data := MetricsPageData{
+			Title:     "AutoSail 实例监控",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Region:    region,
+			Instance:  strings.TrimSpace(c.Query("instance")),
+			Period:    period.Key,
+			Periods:   aws.MetricPeriods,
+		}
+		if data.Instance == "" {
+			c.Redirect(http.StatusFound, "/?tab=manage&region="+region)
+			return
+		}
+		keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+		activeKey, _ := resolveActiveKey(s, keys)
+		if !keyUsable(activeKey) {
+			data.Flash.Warn = "请先启用一个有效密钥"
+		} else if cli, err := aws.NewLightsailClient(c.Request.Context(), region, strings.TrimSpace(activeKey.AccessKey), strings.TrimSpace(activeKey.SecretKey), strings.TrimSpace(activeKey.Proxy)); err != nil {
+			data.Flash.Error = "创建 Lightsail client 失败：" + err.Error()
+		} else if series, err := cachedInstanceMetrics(c.Request.Context(), cli, region, activeKey, data.Instance, period); err != nil {
+			data.Flash.Error = formatFlashError(err)
+		} else {
+			for _, sr := range series {
+				data.Charts = append(data.Charts, metricChartFor(sr))
+			}
+		}
+		c.HTML(http.StatusOK, "metrics", data)
+	})
+}
+
+func apiGetLightsailMetrics(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	series, err := cachedInstanceMetrics(c.Request.Context(), cli, region, key, name, aws.FindMetricPeriod(c.Query("period")))
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
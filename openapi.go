@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiRoute 描述一个 /api/v1 接口；Body / Result 是请求体与成功响应的示例值，只用于生成文档里的 schema。
+type apiRoute struct {
+	Method  string
+	Path    string // gin 风格路径，相对于 apiPrefix
+	ID      string
+	Tag     string
+	Summary string
+	Query   []apiParam
+	Body    any
+	Status  int // 成功时的状态码，默认 200
+	Result  any
+	Handler gin.HandlerFunc
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// openAPISpec 根据路由表生成 OpenAPI 3 文档。
+func openAPISpec(routes []apiRoute) map[string]any {
+	sb := &schemaBuilder{schemas: map[string]any{}, types: map[string]reflect.Type{}}
+	errorRef := sb.schema(reflect.TypeOf(apiErrorResponse{}))
+	paths := map[string]map[string]any{}
+	for _, rt := range routes {
+		path, pathParams := openAPIPath(rt.Path)
+		var params []any
+		for _, name := range pathParams {
+			params = append(params, map[string]any{"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+		for _, q := range rt.Query {
+			params = append(params, map[string]any{"name": q.Name, "in": "query", "required": q.Required, "description": q.Description, "schema": map[string]any{"type": "string"}})
+		}
+		if rt.Method != http.MethodGet {
+			params = append(params, map[string]any{"name": "X-CSRF-Token", "in": "header", "required": false, "description": "使用会话 cookie 认证时必填，值来自 GET /me；Bearer token 认证不需要", "schema": map[string]any{"type": "string"}})
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		op := map[string]any{
+			"operationId": rt.ID,
+			"summary":     rt.Summary,
+			"tags":        []string{rt.Tag},
+			"responses": map[string]any{
+				strconv.Itoa(status): map[string]any{
+					"description": http.StatusText(status),
+					"content":     map[string]any{"application/json": map[string]any{"schema": sb.schema(reflect.TypeOf(rt.Result))}},
+				},
+				"default": map[string]any{
+					"description": "错误",
+					"content":     map[string]any{"application/json": map[string]any{"schema": errorRef}},
+				},
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if rt.Body != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": sb.schema(reflect.TypeOf(rt.Body))}},
+			}
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "AutoSail API",
+			"version": "v1",
+		},
+		"servers": []any{map[string]any{"url": apiPrefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": sb.schemas,
+			"securitySchemes": map[string]any{
+				"cookieAuth": map[string]any{"type": "apiKey", "in": "cookie", "name": "sid"},
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "description": "个人 API token，权限范围 read / operate / admin"},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []string{}}, map[string]any{"cookieAuth": []string{}}},
+	}
+}
+
+// openAPIPath 把 /keys/:id 转成 /keys/{id}，并返回路径参数名。
+func openAPIPath(p string) (string, []string) {
+	parts := strings.Split(p, "/")
+	var params []string
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			name := part[1:]
+			params = append(params, name)
+			parts[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+type schemaBuilder struct {
+	schemas map[string]any
+	types   map[string]reflect.Type
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := b.componentName(t)
+		if _, ok := b.schemas[name]; !ok {
+			// 先占位，避免自引用类型无限递归
+			b.schemas[name] = map[string]any{}
+			b.schemas[name] = b.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// componentName 优先使用类型名（去掉 api 前缀），不同包的同名类型加上包名区分。
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	name := t.Name()
+	if strings.HasPrefix(name, "api") && len(name) > 3 {
+		name = name[3:]
+	}
+	if prev, ok := b.types[name]; ok && prev != t {
+		pkg := t.PkgPath()
+		if i := strings.LastIndex(pkg, "/"); i >= 0 {
+			pkg = pkg[i+1:]
+		}
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	b.types[name] = t
+	return name
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	b.collectFields(t, props, &required)
+	out := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+func (b *schemaBuilder) collectFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.collectFields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+		if f.Tag.Get("binding") == "required" {
+			*required = append(*required, name)
+		}
+	}
+}
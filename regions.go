@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/patrickmn/go-cache"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/store"
+)
+
+type ZoneOption struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// 区域列表接口不区分区域，固定用 us-east-1 的端点查询
+const discoveryRegion = "us-east-1"
+
+func keyUsable(key *store.Key) bool {
+	return key != nil && strings.TrimSpace(key.AccessKey) != "" && strings.TrimSpace(key.SecretKey) != ""
+}
+
+func discoveryCacheKey(prefix string, key *store.Key) string {
+	return instCacheKey(prefix, "", key)
+}
+
+// discoverRegions 返回当前密钥可用的区域。未启用（not-opted-in）的区域保留在列表中但标记为 Disabled，
+// 没有可用密钥时退回内置列表。
+func discoverRegions(ctx context.Context, service string, key *store.Key) ([]RegionOption, error) {
+	if !keyUsable(key) {
+		return regionOptionsForService(service), nil
+	}
+	ec2Regions, ec2Err := cachedEC2Regions(ctx, key)
+	if service == "ec2" {
+		if ec2Err != nil {
+			return nil, ec2Err
+		}
+		return regionOptionsFromInfo(ec2Regions, nil), nil
+	}
+	lsRegions, err := cachedLightsailRegions(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	// Lightsail 不返回启用状态，借用 EC2 的结果；没有 EC2 权限时视为全部可用
+	optIn := map[string]string{}
+	if ec2Err == nil {
+		for _, r := range ec2Regions {
+			optIn[r.ID] = r.OptInStatus
+		}
+	}
+	return regionOptionsFromInfo(lsRegions, optIn), nil
+}
+
+func regionOptionsFromInfo(list []aws.RegionInfo, optIn map[string]string) []RegionOption {
+	out := make([]RegionOption, 0, len(list))
+	for _, r := range list {
+		status := r.OptInStatus
+		if v, ok := optIn[r.ID]; ok {
+			status = v
+		}
+		name := regionLabel(r.ID)
+		if name == r.ID && r.DisplayName != "" {
+			name = r.DisplayName
+		}
+		out = append(out, RegionOption{ID: r.ID, Name: name, OptInStatus: status, Disabled: status == aws.NotOptedIn})
+	}
+	return out
+}
+
+// discoverZones 返回区域内当前账号可用的可用区，没有可用密钥时退回 a / b / c。
+func discoverZones(ctx context.Context, service, region string, key *store.Key) ([]ZoneOption, error) {
+	var zones []aws.ZoneInfo
+	switch {
+	case !keyUsable(key):
+		for _, letter := range []string{"a", "b", "c"} {
+			zones = append(zones, aws.ZoneInfo{Name: region + letter, State: "available"})
+		}
+	case service == "ec2":
+		cacheKey := instCacheKey("ec2zones", region, key)
+		if v, ok := catalogCache.Get(cacheKey); ok {
+			zones = v.([]aws.ZoneInfo)
+			break
+		}
+		cli, err := aws.NewEC2Client(ctx, region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+		if err != nil {
+			return nil, err
+		}
+		if zones, err = aws.ListEC2Zones(ctx, cli); err != nil {
+			return nil, err
+		}
+		catalogCache.Set(cacheKey, zones, cache.DefaultExpiration)
+	default:
+		regions, err := cachedLightsailRegions(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range regions {
+			if r.ID == region {
+				zones = r.Zones
+			}
+		}
+	}
+	out := make([]ZoneOption, 0, len(zones))
+	for _, z := range zones {
+		if z.Usable() {
+			out = append(out, ZoneOption{ID: z.Name, Name: z.Name})
+		}
+	}
+	return out, nil
+}
+
+func cachedLightsailRegions(ctx context.Context, key *store.Key) ([]aws.RegionInfo, error) {
+	cacheKey := discoveryCacheKey("lsregions", key)
+	if v, ok := catalogCache.Get(cacheKey); ok {
+		return v.([]aws.RegionInfo), nil
+	}
+	cli, err := aws.NewLightsailClient(ctx, discoveryRegion, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		return nil, err
+	}
+	list, err := aws.ListLightsailRegions(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	catalogCache.Set(cacheKey, list, cache.DefaultExpiration)
+	return list, nil
+}
+
+func cachedEC2Regions(ctx context.Context, key *store.Key) ([]aws.RegionInfo, error) {
+	cacheKey := discoveryCacheKey("ec2regions", key)
+	if v, ok := catalogCache.Get(cacheKey); ok {
+		return v.([]aws.RegionInfo), nil
+	}
+	cli, err := aws.NewEC2Client(ctx, discoveryRegion, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		return nil, err
+	}
+	list, err := aws.ListEC2Regions(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	catalogCache.Set(cacheKey, list, cache.DefaultExpiration)
+	return list, nil
+}
+
+// zoneName 兼容旧的单字母写法：“a” 会补全为 “us-east-1a”。
+func zoneName(region, az string) string {
+	az = strings.TrimSpace(az)
+	if az == "" {
+		az = "a"
+	}
+	if strings.HasPrefix(az, region) {
+		return az
+	}
+	return region + az
+}
+
+// checkPlacement 确认区域已启用、可用区存在；无法查询时不拦截，交给 AWS 返回错误。
+func checkPlacement(ctx context.Context, service, region, zone string, key *store.Key) string {
+	regions, err := discoverRegions(ctx, service, key)
+	if err == nil {
+		for _, r := range regions {
+			if r.ID == region && r.Disabled {
+				return "region_disabled"
+			}
+		}
+	}
+	zones, err := discoverZones(ctx, service, region, key)
+	if err != nil {
+		return ""
+	}
+	for _, z := range zones {
+		if z.ID == zone {
+			return ""
+		}
+	}
+	return "zone_unavailable"
+}
+
+var placementErrorText = map[string]string{
+	"region_disabled":  "当前账号未启用该区域",
+	"zone_unavailable": "该可用区不存在或当前账号不可用",
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/session"
+)
+
+var appSessions *session.Store
+
+// newSessionStore 根据 SESSION_BACKEND 选择会话后端：sqlite（默认，重启后仍保持登录）或 memory。
+func newSessionStore() *session.Store {
+	ttl := time.Duration(mustEnvInt("SESSION_TTL_MINUTES", 30)) * time.Minute
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SESSION_BACKEND"))) {
+	case "memory":
+		return session.NewStore(session.NewMemoryBackend(), ttl)
+	default:
+		return session.NewStore(appStore.SessionBackend(), ttl)
+	}
+}
+
+// sessionWriter 在响应头写出前保存会话，保证浏览器跟随重定向时能读到刚写入的数据。
+type sessionWriter struct {
+	gin.ResponseWriter
+	save func()
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.save()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) WriteHeaderNow() {
+	w.save()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.save()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) WriteString(s string) (int, error) {
+	w.save()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func sessionMiddleware(sessions *session.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isTokenRequest(c) {
+			c.Next()
+			return
+		}
+		sid, err := c.Cookie("sid")
+		if err != nil || sid == "" {
+			sid = genSessionID()
+			c.SetCookie("sid", sid, 3600*24*7, "/", "", false, true)
+		}
+		s, err := sessions.Load(c.Request.Context(), sid, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			c.String(http.StatusInternalServerError, "load session failed: %v", err)
+			c.Abort()
+			return
+		}
+		var once sync.Once
+		save := func() {
+			once.Do(func() {
+				if err := sessions.Save(c.Request.Context(), s); err != nil {
+					auditError(c, err)
+				}
+			})
+		}
+		c.Writer = &sessionWriter{ResponseWriter: c.Writer, save: save}
+		c.Set("sess", s)
+		c.Set("sid", sid)
+		c.Next()
+		save()
+	}
+}
+
+type SessionsPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+
+	Sessions  []session.Info
+	CurrentID string
+	Flash     Flash
+}
+
+func registerSessionRoutes(r *gin.Engine) {
+	r.GET("/sessions", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		list, err := appSessions.ListUser(c.Request.Context(), userID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "load sessions failed: %v", err)
+			return
+		}
+		data := SessionsPageData{
+			Title:     "AutoSail 登录会话",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Sessions:  list,
+			CurrentID: s.ID(),
+		}
+		switch c.Query("msg") {
+		case "revoked":
+			data.Flash.Success = "已注销该会话"
+		case "others":
+			data.Flash.Success = "已注销其他全部会话"
+		case "session_failed":
+			data.Flash.Error = "操作失败（详情看日志）"
+		}
+		c.HTML(http.StatusOK, "sessions", data)
+	})
+
+	r.POST("/auth/sessions/revoke", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		id := strings.TrimSpace(c.PostForm("session_id"))
+		if id == "" || id == s.ID() {
+			c.Redirect(http.StatusFound, "/sessions")
+			return
+		}
+		if err := appSessions.Revoke(c.Request.Context(), userID, id); err != nil && !errors.Is(err, session.ErrNotFound) {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/sessions?msg=session_failed")
+			return
+		}
+		c.Redirect(http.StatusFound, "/sessions?msg=revoked")
+	})
+
+	r.POST("/auth/sessions/revoke-others", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		list, err := appSessions.ListUser(c.Request.Context(), userID)
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/sessions?msg=session_failed")
+			return
+		}
+		for _, info := range list {
+			if info.ID == s.ID() {
+				continue
+			}
+			if err := appSessions.Revoke(c.Request.Context(), userID, info.ID); err != nil && !errors.Is(err, session.ErrNotFound) {
+				auditError(c, err)
+				c.Redirect(http.StatusFound, "/sessions?msg=session_failed")
+				return
+			}
+		}
+		c.Redirect(http.StatusFound, "/sessions?msg=others")
+	})
+
+	r.POST("/admin/users/logout", func(c *gin.Context) {
+		s := session.Must(c)
+		if !isAdminSession(s) {
+			c.Redirect(http.StatusFound, "/")
+			return
+		}
+		userID, err := strconv.ParseInt(strings.TrimSpace(c.PostForm("user_id")), 10, 64)
+		if err != nil || userID == 0 {
+			c.Redirect(http.StatusFound, "/")
+			return
+		}
+		if _, err := appSessions.RevokeUser(c.Request.Context(), userID); err != nil {
+			auditError(c, err)
+		}
+		c.Redirect(http.StatusFound, "/")
+	})
+}
+
+type apiSessionView struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Current   bool      `json:"current"`
+}
+
+type apiLogoutResult struct {
+	Revoked int `json:"revoked"`
+}
+
+// apiCurrentSessionID 返回本次请求使用的 cookie 会话 ID，token 认证时为空。
+func apiCurrentSessionID(c *gin.Context) string {
+	if isTokenRequest(c) {
+		return ""
+	}
+	return session.Must(c).ID()
+}
+
+func apiListSessions(c *gin.Context) {
+	list, err := appSessions.ListUser(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取会话失败")
+		return
+	}
+	current := apiCurrentSessionID(c)
+	out := make([]apiSessionView, 0, len(list))
+	for _, info := range list {
+		out = append(out, apiSessionView{
+			ID:        info.ID,
+			CreatedAt: info.CreatedAt,
+			LastSeen:  info.LastSeen,
+			IP:        info.IP,
+			UserAgent: info.UserAgent,
+			Current:   info.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiRevokeSession(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+	if id == apiCurrentSessionID(c) {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "不能注销当前会话，请使用退出登录")
+		return
+	}
+	if err := appSessions.Revoke(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, session.ErrNotFound) {
+			apiFail(c, http.StatusNotFound, "session_not_found", "会话不存在")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "注销会话失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
+
+func apiLogoutUser(c *gin.Context) {
+	if !isAdminSession(session.Must(c)) {
+		apiFail(c, http.StatusForbidden, "forbidden", "需要管理员权限")
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "用户 ID 无效")
+		return
+	}
+	n, err := appSessions.RevokeUser(c.Request.Context(), userID)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "强制下线失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiLogoutResult{Revoked: n})
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+var snapshotErrorText = map[string]string{
+	"snapshot_not_found": "快照不存在",
+	"snapshot_pending":   "快照尚未生成完成",
+}
+
+// cachedSnapshots 与实例列表共用 instCache，创建、恢复、删除快照后失效。
+func cachedSnapshots(ctx context.Context, cli aws.LightsailAPI, region string, key *store.Key) ([]aws.SnapshotView, error) {
+	cacheKey := instCacheKey("snap", region, key)
+	if v, ok := instCache.Get(cacheKey); ok {
+		return v.([]aws.SnapshotView), nil
+	}
+	list, err := aws.ListInstanceSnapshots(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	instCache.Set(cacheKey, list, cache.DefaultExpiration)
+	return list, nil
+}
+
+type snapshotRestore struct {
+	Snapshot     string
+	InstanceName string
+	BundleID     string
+	AZ           string
+	IPType       string
+}
+
+// restoreSnapshot 校验快照、可用区与套餐后从快照创建新实例。套餐和可用区留空时沿用快照来源实例的设置。
+// 校验失败时返回错误码（见 snapshotErrorText / placementErrorText / catalogErrorText），AWS 错误通过 err 返回。
+func restoreSnapshot(ctx context.Context, cli aws.LightsailAPI, region string, key *store.Key, in snapshotRestore) (string, string, error) {
+	list, err := cachedSnapshots(ctx, cli, region, key)
+	if err != nil {
+		return "", "", err
+	}
+	snap, ok := aws.FindSnapshot(list, in.Snapshot)
+	if !ok {
+		return "", "snapshot_not_found", nil
+	}
+	if snap.State != "available" {
+		return "", "snapshot_pending", nil
+	}
+	zone := snap.Zone
+	if strings.TrimSpace(in.AZ) != "" {
+		zone = zoneName(region, in.AZ)
+	}
+	if msg := checkPlacement(ctx, "lightsail", region, zone, key); msg != "" {
+		return "", msg, nil
+	}
+	bundle := firstNonEmpty(in.BundleID, snap.FromBundleID)
+	cat, err := lightsailCatalog(ctx, region, func() (aws.LightsailAPI, error) { return cli, nil })
+	if err != nil {
+		return "", "", err
+	}
+	if !cat.HasBundle(bundle) {
+		return "", "bundle_unsupported", nil
+	}
+	name := firstNonEmpty(in.InstanceName, "vps-"+strconv.FormatInt(time.Now().Unix(), 10))
+	err = aws.RestoreInstanceSnapshot(ctx, cli, aws.RestoreSnapshotInput{
+		SnapshotName:     snap.Name,
+		InstanceName:     name,
+		AvailabilityZone: zone,
+		BundleID:         bundle,
+		IPAddressType:    firstNonEmpty(in.IPType, "dualstack"),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return name, "", nil
+}
+
+func invalidateSnapshotCaches(region string, key *store.Key) {
+	instCache.Delete(instCacheKey("snap", region, key))
+	instCache.Delete(instCacheKey("inst", region, key))
+}
+
+func registerSnapshotRoutes(r *gin.Engine) {
+	r.POST("/aws/snapshots", func(c *gin.Context) {
+		doManageAction(c, "snapshot", func(ctx *gin.Context, cli aws.LightsailAPI, name string) error {
+			snapName := firstNonEmpty(ctx.PostForm("snapshot_name"), aws.SnapshotName(name))
+			return aws.CreateInstanceSnapshot(ctx.Request.Context(), cli, name, snapName)
+		})
+	})
+
+	r.POST("/aws/snapshots/restore", func(c *gin.Context) {
+		doManageActionOn(c, "restore", "snapshot", func(ctx *gin.Context, cli aws.LightsailAPI, key *store.Key, snapshot string) error {
+			region := normalizeRegion(firstNonEmpty(ctx.PostForm("region"), session.Must(ctx).GetString("region", "us-east-1")))
+			name, msg, err := restoreSnapshot(ctx.Request.Context(), cli, region, key, snapshotRestore{
+				Snapshot:     snapshot,
+				InstanceName: strings.TrimSpace(ctx.PostForm("instance_name")),
+				BundleID:     strings.TrimSpace(ctx.PostForm("bundle")),
+				AZ:           strings.TrimSpace(ctx.PostForm("az")),
+			})
+			if msg != "" {
+				return errors.New(firstNonEmpty(snapshotErrorText[msg], placementErrorText[msg], catalogErrorText[msg]))
+			}
+			if err != nil {
+				return err
+			}
+			// 用原实例名重建时，沿用原实例绑定的外部 DNS 记录
+			userID, _ := userIDFromSession(session.Must(ctx))
+			enqueueDNSSync(ctx.Request.Context(), userID, key, jobKindSyncDNS, region, name)
+			return nil
+		})
+	})
+
+	r.POST("/aws/snapshots/delete", func(c *gin.Context) {
+		doManageActionOn(c, "snapdelete", "snapshot", func(ctx *gin.Context, cli aws.LightsailAPI, _ *store.Key, snapshot string) error {
+			return aws.DeleteInstanceSnapshot(ctx.Request.Context(), cli, snapshot)
+		})
+	})
+}
+
+func apiListLightsailSnapshots(c *gin.Context) {
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	list, err := cachedSnapshots(c.Request.Context(), cli, region, key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func apiCreateLightsailSnapshot(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	c.Set("audit_instance", name)
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	snapName := firstNonEmpty(c.Query("snapshot_name"), aws.SnapshotName(name))
+	if err := aws.CreateInstanceSnapshot(c.Request.Context(), cli, name, snapName); err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	instCache.Delete(instCacheKey("snap", region, key))
+	c.JSON(http.StatusCreated, apiCreated{Service: "lightsail", Region: region, Name: snapName})
+}
+
+type apiRestoreSnapshotRequest struct {
+	InstanceName string `json:"instance_name,omitempty"` // 默认 vps-<时间戳>
+	BundleID     string `json:"bundle_id,omitempty"`     // 默认沿用快照来源实例的套餐
+	AZ           string `json:"az,omitempty"`            // 默认沿用快照所在可用区
+	IPType       string `json:"ip_type,omitempty"`
+}
+
+func apiRestoreLightsailSnapshot(c *gin.Context) {
+	var in apiRestoreSnapshotRequest
+	if !apiBind(c, &in) {
+		return
+	}
+	snapshot := strings.TrimSpace(c.Param("name"))
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	name, msg, err := restoreSnapshot(c.Request.Context(), cli, region, key, snapshotRestore{
+		Snapshot:     snapshot,
+		InstanceName: strings.TrimSpace(in.InstanceName),
+		BundleID:     strings.TrimSpace(in.BundleID),
+		AZ:           strings.TrimSpace(in.AZ),
+		IPType:       strings.TrimSpace(in.IPType),
+	})
+	switch {
+	case msg == "snapshot_not_found":
+		apiFail(c, http.StatusNotFound, msg, snapshotErrorText[msg])
+		return
+	case msg != "":
+		apiFail(c, http.StatusBadRequest, msg, firstNonEmpty(snapshotErrorText[msg], placementErrorText[msg], catalogErrorText[msg]))
+		return
+	case err != nil:
+		apiAWSFail(c, err)
+		return
+	}
+	c.Set("audit_instance", name)
+	invalidateSnapshotCaches(region, key)
+	enqueueDNSSync(c.Request.Context(), apiUserID(c), key, jobKindSyncDNS, region, name)
+	c.JSON(http.StatusCreated, apiCreated{Service: "lightsail", Region: region, Name: name})
+}
+
+func apiDeleteLightsailSnapshot(c *gin.Context) {
+	snapshot := strings.TrimSpace(c.Param("name"))
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	if err := aws.DeleteInstanceSnapshot(c.Request.Context(), cli, snapshot); err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	instCache.Delete(instCacheKey("snap", region, key))
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
+
+// loadSnapshotsPage 为管理页加载快照列表，以及恢复表单需要的可用区与套餐。
+func loadSnapshotsPage(c *gin.Context, data *PageData, region string, key *store.Key) {
+	ctx := c.Request.Context()
+	cli, err := aws.NewLightsailClient(ctx, region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		return
+	}
+	list, err := cachedSnapshots(ctx, cli, region, key)
+	if err != nil {
+		data.Flash.Warn = "拉取快照失败：" + formatFlashError(err)
+		return
+	}
+	data.Snapshots = list
+	if len(list) == 0 {
+		return
+	}
+	if zones, err := discoverZones(ctx, "lightsail", region, key); err == nil {
+		data.Zones = zones
+	}
+	if cat, err := lightsailCatalog(ctx, region, func() (aws.LightsailAPI, error) { return cli, nil }); err == nil {
+		data.Bundles = bundleOptionsFor(cat)
+	}
+}
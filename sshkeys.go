@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+var errSSHKeyNameEmpty = errors.New("公钥名称不能为空")
+
+type SSHKeysPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	Flash     Flash
+
+	Keys []store.SSHKey
+}
+
+func saveSSHKey(ctx context.Context, userID int64, name, publicKey string) (*store.SSHKey, error) {
+	line, fingerprint, err := aws.ParseSSHPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	// 名称留空时使用公钥注释（通常是 user@host）
+	if strings.TrimSpace(name) == "" {
+		if fields := strings.Fields(line); len(fields) > 2 {
+			name = strings.Join(fields[2:], " ")
+		}
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, errSSHKeyNameEmpty
+	}
+	k := &store.SSHKey{UserID: userID, Name: name, PublicKey: line, Fingerprint: fingerprint}
+	if err := appStore.CreateSSHKey(ctx, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func sshKeyOptionsFor(keys []store.SSHKey) []Option {
+	out := []Option{{ID: "", Name: "不使用"}}
+	for _, k := range keys {
+		out = append(out, Option{ID: strconv.FormatInt(k.ID, 10), Name: k.Name + " (" + k.Fingerprint + ")"})
+	}
+	return out
+}
+
+// sshKeyPairFor 把创建表单的 ssh_key 取值转换成 AWS 密钥对名称，必要时通过 ensure 导入到当前区域。未选择时返回空。
+func sshKeyPairFor(ctx context.Context, userID int64, choice string, ensure func(keyPairName, publicKey string) error) (string, error) {
+	choice = strings.TrimSpace(choice)
+	if choice == "" || choice == "0" {
+		return "", nil
+	}
+	id, err := strconv.ParseInt(choice, 10, 64)
+	if err != nil {
+		return "", store.ErrSSHKeyNotFound
+	}
+	k, err := appStore.GetSSHKey(ctx, userID, id)
+	if err != nil {
+		return "", err
+	}
+	name := aws.KeyPairName(k.Name, k.Fingerprint)
+	if err := ensure(name, k.PublicKey); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func registerSSHKeyRoutes(r *gin.Engine) {
+	r.GET("/ssh-keys", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		data := SSHKeysPageData{
+			Title:     "AutoSail SSH 公钥",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+		}
+		list, err := appStore.ListSSHKeys(c.Request.Context(), userID)
+		if err != nil {
+			data.Flash.Error = "读取 SSH 公钥失败：" + err.Error()
+		}
+		data.Keys = list
+		switch c.Query("msg") {
+		case "sshkey_saved":
+			data.Flash.Success = "已保存 SSH 公钥，创建实例时会自动导入为密钥对"
+		case "sshkey_deleted":
+			data.Flash.Success = "已删除 SSH 公钥（已导入 AWS 的密钥对不会删除）"
+		case "sshkey_exists":
+			data.Flash.Warn = "已存在同名公钥"
+		case "sshkey_failed":
+			data.Flash.Error = "保存公钥失败：" + strings.TrimSpace(c.Query("err"))
+		}
+		c.HTML(http.StatusOK, "sshkeys", data)
+	})
+
+	r.POST("/aws/ssh-keys", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		if _, err := saveSSHKey(c.Request.Context(), userID, c.PostForm("name"), c.PostForm("public_key")); err != nil {
+			if errors.Is(err, store.ErrSSHKeyExists) {
+				c.Redirect(http.StatusFound, "/ssh-keys?msg=sshkey_exists")
+				return
+			}
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/ssh-keys?msg=sshkey_failed&err="+url.QueryEscape(formatFlashError(err)))
+			return
+		}
+		c.Redirect(http.StatusFound, "/ssh-keys?msg=sshkey_saved")
+	})
+
+	r.POST("/aws/ssh-keys/delete", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		id, err := strconv.ParseInt(strings.TrimSpace(c.PostForm("key_id")), 10, 64)
+		if err != nil {
+			c.Redirect(http.StatusFound, "/ssh-keys")
+			return
+		}
+		if err := appStore.DeleteSSHKey(c.Request.Context(), userID, id); err != nil && !errors.Is(err, store.ErrSSHKeyNotFound) {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/ssh-keys?msg=sshkey_failed&err="+url.QueryEscape(formatFlashError(err)))
+			return
+		}
+		c.Redirect(http.StatusFound, "/ssh-keys?msg=sshkey_deleted")
+	})
+}
+
+type apiSSHKey struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	PublicKey   string    `json:"public_key"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type apiSSHKeyInput struct {
+	Name      string `json:"name"` // 默认使用公钥注释
+	PublicKey string `json:"public_key" binding:"required"`
+}
+
+func toAPISSHKey(k *store.SSHKey) apiSSHKey {
+	return apiSSHKey{ID: k.ID, Name: k.Name, PublicKey: k.PublicKey, Fingerprint: k.Fingerprint, CreatedAt: k.CreatedAt}
+}
+
+func apiListSSHKeys(c *gin.Context) {
+	list, err := appStore.ListSSHKeys(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取 SSH 公钥失败")
+		return
+	}
+	out := make([]apiSSHKey, 0, len(list))
+	for i := range list {
+		out = append(out, toAPISSHKey(&list[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateSSHKey(c *gin.Context) {
+	var in apiSSHKeyInput
+	if !apiBind(c, &in) {
+		return
+	}
+	k, err := saveSSHKey(c.Request.Context(), apiUserID(c), in.Name, in.PublicKey)
+	switch {
+	case errors.Is(err, store.ErrSSHKeyExists):
+		apiFail(c, http.StatusConflict, "sshkey_exists", "已存在同名公钥")
+		return
+	case errors.Is(err, aws.ErrInvalidSSHKey), errors.Is(err, errSSHKeyNameEmpty):
+		apiFail(c, http.StatusBadRequest, "invalid_ssh_key", err.Error())
+		return
+	case err != nil:
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "保存公钥失败")
+		return
+	}
+	c.JSON(http.StatusCreated, toAPISSHKey(k))
+}
+
+func apiDeleteSSHKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "公钥 ID 无效")
+		return
+	}
+	if err := appStore.DeleteSSHKey(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, store.ErrSSHKeyNotFound) {
+			apiFail(c, http.StatusNotFound, "sshkey_not_found", "公钥不存在")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "删除公钥失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+// 旧静态 IP 最长保留 3 天；解绑的静态 IP 会产生费用，到期后自动释放
+const (
+	maxKeepOldMinutes    = 3 * 24 * 60
+	heldIPExpiryInterval = time.Minute
+)
+
+// 到期释放失败后按 1、2、4… 分钟退避重试，最长间隔 1 小时；累计失败 maxHeldIPReleaseAttempts 次后记为失败。
+const (
+	maxHeldIPReleaseAttempts = 10
+	maxHeldIPRetryInterval   = time.Hour
+)
+
+var errHoldExpired = errors.New("保留期已过，旧静态IP已经或即将被释放")
+
+// heldIPJobParams 是回滚与释放保留 IP 任务的参数，保存在 Job.Params。
+type heldIPJobParams struct {
+	HoldID int64 `json:"hold_id"`
+}
+
+// holdOldStaticIP 记录换 IP 时保留下来的旧静态 IP。记录失败时旧 IP 不会自动释放，只能在遗留资源页处理。
+func holdOldStaticIP(ctx context.Context, job *store.Job, instance string, res aws.SwapResult, expiresAt time.Time, report func(string)) {
+	h := &store.HeldStaticIP{
+		UserID:    job.UserID,
+		KeyID:     job.KeyID,
+		JobID:     job.ID,
+		Region:    job.Region,
+		Instance:  instance,
+		Name:      res.OldName,
+		IP:        res.OldIP,
+		NewIP:     res.NewIP,
+		ExpiresAt: expiresAt,
+	}
+	if err := appStore.CreateHeldStaticIP(ctx, h); err != nil {
+		log.Printf("record held static ip %s failed: %v", res.OldName, err)
+		report("旧静态IP " + res.OldIP + " 已保留，但记录失败，不会自动释放，请在遗留资源页处理")
+		return
+	}
+	report(fmt.Sprintf("旧静态IP %s 保留至 %s，期间可在「IP 记录」页回滚", res.OldIP, h.ExpiresAt.Local().Format("01-02 15:04")))
+}
+
+func loadJobHold(ctx context.Context, job *store.Job) (*store.HeldStaticIP, error) {
+	var p heldIPJobParams
+	if err := json.Unmarshal([]byte(job.Params), &p); err != nil {
+		return nil, fmt.Errorf("任务参数无效：%w", err)
+	}
+	return appStore.GetHeldStaticIP(ctx, job.UserID, p.HoldID)
+}
+
+// runRollbackIPJob 把实例换回保留的旧静态 IP，释放当前的静态 IP，并同步外部 DNS。
+// 失败时旧 IP 仍在保留期内，可以再次回滚；旧 IP 已不存在时记录为失败。
+// 当前 IP 已解绑却没能绑回去时同样记录保留，到期与旧 IP 一起释放。
+func runRollbackIPJob(ctx context.Context, job *store.Job, report func(string)) error {
+	hold, err := loadJobHold(ctx, job)
+	if err != nil {
+		return err
+	}
+	rolledBack := false
+	err = runLightsailJob(ctx, job, report, func(ctx context.Context, cli aws.LightsailAPI, name string) error {
+		res, err := aws.RollbackStaticIP(ctx, cli, name, hold.Name)
+		if res.Kept {
+			holdOldStaticIP(ctx, job, name, res, hold.ExpiresAt, report)
+			recordSwapHistory(ctx, job, name, res, err, ipReleaseRollbackFail)
+		}
+		if err != nil && !errors.Is(err, aws.ErrStaticIPNotReleased) {
+			return err
+		}
+		rolledBack = true
+		now := time.Now().UTC()
+		base := store.IPHistory{UserID: job.UserID, KeyID: job.KeyID, Region: job.Region, Instance: name, Static: true}
+		if res.OldIP != "" {
+			h := base
+			h.IP, h.ReleasedAt, h.ReleaseReason = res.OldIP, now, "回滚到 "+hold.IP
+			if err := appStore.RecordIPReleased(ctx, &h); err != nil {
+				log.Printf("record ip history failed: %v", err)
+			}
+		}
+		h := base
+		h.IP, h.AssignedAt = firstNonEmpty(res.NewIP, hold.IP), now
+		if err := appStore.RecordIPAssigned(ctx, &h, ipReleaseChanged); err != nil {
+			log.Printf("record ip history failed: %v", err)
+		}
+		if dnsErr := syncJobDNS(ctx, job, report); dnsErr != nil {
+			return errors.Join(err, fmt.Errorf("已换回原静态IP，但外部 DNS 更新失败：%w", dnsErr))
+		}
+		return err
+	})
+	status, errText := store.HeldStaticIPRolledBack, ""
+	switch {
+	case rolledBack:
+		if err != nil {
+			errText = err.Error()
+		}
+	case errors.Is(err, aws.ErrStaticIPGone), errors.Is(err, aws.ErrStaticIPInUse):
+		status, errText = store.HeldStaticIPFailed, err.Error()
+	default:
+		status, errText = store.HeldStaticIPHeld, err.Error()
+	}
+	if e := appStore.FinishHeldStaticIP(context.Background(), hold.ID, status, errText); e != nil {
+		log.Printf("finish held static ip %d failed: %v", hold.ID, e)
+	}
+	return err
+}
+
+// runReleaseHeldIPJob 释放保留期已过的旧静态 IP；旧 IP 已被重新绑定（如在控制台手动绑定）时不释放。
+// 限流、网络等临时失败恢复为 held 并退避重试；密钥已删除或无效、重试次数用完时记为失败，只能在遗留资源页处理。
+func runReleaseHeldIPJob(ctx context.Context, job *store.Job, report func(string)) error {
+	hold, err := loadJobHold(ctx, job)
+	if err != nil {
+		return err
+	}
+	err = runLightsailJob(ctx, job, report, func(ctx context.Context, cli aws.LightsailAPI, _ string) error {
+		return aws.ReleaseStaticIP(ctx, cli, hold.Name)
+	})
+	if err != nil && !heldIPReleasePermanent(err) && hold.Attempts+1 < maxHeldIPReleaseAttempts {
+		retryAt := time.Now().Add(heldIPRetryDelay(hold.Attempts))
+		report("释放失败，" + retryAt.Local().Format("01-02 15:04") + " 自动重试")
+		if e := appStore.DeferHeldStaticIP(context.Background(), hold.ID, err.Error(), retryAt); e != nil {
+			log.Printf("defer held static ip %d failed: %v", hold.ID, e)
+		}
+		return err
+	}
+	status, errText := store.HeldStaticIPReleased, ""
+	if err != nil {
+		status, errText = store.HeldStaticIPFailed, err.Error()
+	}
+	if e := appStore.FinishHeldStaticIP(context.Background(), hold.ID, status, errText); e != nil {
+		log.Printf("finish held static ip %d failed: %v", hold.ID, e)
+	}
+	return err
+}
+
+// heldIPReleasePermanent 表示释放重试也不会成功：旧 IP 被重新绑定、密钥已删除或无效。
+func heldIPReleasePermanent(err error) bool {
+	return errors.Is(err, aws.ErrStaticIPInUse) || errors.Is(err, errJobKeyDeleted) || aws.IsAuthError(err)
+}
+
+// heldIPRetryDelay 返回第 attempts+1 次失败后的等待时间。
+func heldIPRetryDelay(attempts int) time.Duration {
+	if attempts >= 6 {
+		return maxHeldIPRetryInterval
+	}
+	return min(heldIPExpiryInterval<<attempts, maxHeldIPRetryInterval)
+}
+
+// startHeldStaticIPExpiry 每分钟检查到期的保留 IP，提交释放任务。
+func startHeldStaticIPExpiry(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(heldIPExpiryInterval)
+		defer ticker.Stop()
+		for {
+			releaseExpiredHeldStaticIPs(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func releaseExpiredHeldStaticIPs(ctx context.Context, now time.Time) {
+	list, err := appStore.ListExpiredHeldStaticIPs(ctx, now)
+	if err != nil {
+		log.Printf("held static ip: list expired failed: %v", err)
+		return
+	}
+	for _, h := range list {
+		if _, err := enqueueHeldIPJob(ctx, &h, store.HeldStaticIPReleasing, jobKindReleaseHeldIP); err != nil {
+			log.Printf("held static ip %d: enqueue release failed: %v", h.ID, err)
+		}
+	}
+}
+
+// enqueueHeldIPJob 先把保留记录从 held 转为 status，抢到后再提交任务；提交失败时恢复为 held。
+// 返回 0 表示记录已被其他操作处理。
+func enqueueHeldIPJob(ctx context.Context, h *store.HeldStaticIP, status, kind string) (int64, error) {
+	ok, err := appStore.ClaimHeldStaticIP(ctx, h.ID, store.HeldStaticIPHeld, status)
+	if err != nil || !ok {
+		return 0, err
+	}
+	params, _ := json.Marshal(heldIPJobParams{HoldID: h.ID})
+	id, err := jobRunner.Enqueue(ctx, store.Job{
+		UserID: h.UserID,
+		KeyID:  h.KeyID,
+		Kind:   kind,
+		Region: h.Region,
+		Target: h.Instance,
+		Params: string(params),
+	})
+	if err != nil {
+		if e := appStore.FinishHeldStaticIP(ctx, h.ID, store.HeldStaticIPHeld, err.Error()); e != nil {
+			log.Printf("held static ip %d: restore failed: %v", h.ID, e)
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// rollbackHeldStaticIP 提交回滚任务，校验记录属于当前用户且仍在保留期内。
+func rollbackHeldStaticIP(ctx context.Context, userID, holdID int64) (int64, error) {
+	h, err := appStore.GetHeldStaticIP(ctx, userID, holdID)
+	if err != nil {
+		return 0, err
+	}
+	if h.Status != store.HeldStaticIPHeld || !time.Now().Before(h.ExpiresAt) {
+		return 0, errHoldExpired
+	}
+	id, err := enqueueHeldIPJob(ctx, h, store.HeldStaticIPRollingBack, jobKindRollbackIP)
+	if err == nil && id == 0 {
+		return 0, errHoldExpired
+	}
+	return id, err
+}
+
+type HeldStaticIPView struct {
+	store.HeldStaticIP
+	StatusLabel string
+	CanRollback bool
+}
+
+// heldStaticIPViews 只保留属于 keyID 的记录。
+func heldStaticIPViews(list []store.HeldStaticIP, keyID int64, now time.Time) []HeldStaticIPView {
+	var out []HeldStaticIPView
+	for _, h := range list {
+		if h.KeyID != keyID {
+			continue
+		}
+		out = append(out, HeldStaticIPView{
+			HeldStaticIP: h,
+			StatusLabel:  heldStaticIPStatusLabel(h.Status),
+			CanRollback:  h.Status == store.HeldStaticIPHeld && now.Before(h.ExpiresAt),
+		})
+	}
+	return out
+}
+
+func heldStaticIPStatusLabel(status string) string {
+	switch status {
+	case store.HeldStaticIPHeld:
+		return "保留中"
+	case store.HeldStaticIPRollingBack:
+		return "回滚中"
+	case store.HeldStaticIPRolledBack:
+		return "已回滚"
+	case store.HeldStaticIPReleasing:
+		return "释放中"
+	case store.HeldStaticIPReleased:
+		return "已释放"
+	case store.HeldStaticIPFailed:
+		return "失败"
+	}
+	return status
+}
+
+func registerHeldStaticIPRoutes(r *gin.Engine) {
+	r.POST("/aws/ip-holds/rollback", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		id, _ := strconv.ParseInt(strings.TrimSpace(c.PostForm("hold_id")), 10, 64)
+		jobID, err := rollbackHeldStaticIP(c.Request.Context(), userID, id)
+		if err != nil {
+			ipHistoryRedirect(c, "rollback_failed", err)
+			return
+		}
+		c.Redirect(http.StatusFound, "/jobs/"+strconv.FormatInt(jobID, 10))
+	})
+}
+
+type apiHeldStaticIP struct {
+	ID         int64      `json:"id"`
+	KeyID      int64      `json:"key_id"`
+	JobID      int64      `json:"job_id"`
+	Region     string     `json:"region"`
+	Instance   string     `json:"instance"`
+	Name       string     `json:"name"`
+	IP         string     `json:"ip"`
+	NewIP      string     `json:"new_ip,omitempty"`
+	Status     string     `json:"status"` // held、rolling_back、rolled_back、releasing、released 或 failed
+	Error      string     `json:"error,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func apiListHeldStaticIPs(c *gin.Context) {
+	list, err := appStore.ListHeldStaticIPs(c.Request.Context(), apiUserID(c), 0)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取保留的静态 IP 失败")
+		return
+	}
+	out := make([]apiHeldStaticIP, 0, len(list))
+	for i := range list {
+		h := &list[i]
+		v := apiHeldStaticIP{ID: h.ID, KeyID: h.KeyID, JobID: h.JobID, Region: h.Region, Instance: h.Instance, Name: h.Name, IP: h.IP, NewIP: h.NewIP, Status: h.Status, Error: h.Error, ExpiresAt: h.ExpiresAt, CreatedAt: h.CreatedAt}
+		if !h.FinishedAt.IsZero() {
+			v.FinishedAt = &h.FinishedAt
+		}
+		out = append(out, v)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiRollbackHeldStaticIP(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "保留记录 ID 无效")
+		return
+	}
+	jobID, err := rollbackHeldStaticIP(c.Request.Context(), apiUserID(c), id)
+	switch {
+	case errors.Is(err, store.ErrHeldStaticIPNotFound):
+		apiFail(c, http.StatusNotFound, "not_found", "保留记录不存在")
+		return
+	case errors.Is(err, errHoldExpired):
+		apiFail(c, http.StatusConflict, "hold_expired", err.Error())
+		return
+	case err != nil:
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "提交后台任务失败")
+		return
+	}
+	job, err := appStore.GetJob(c.Request.Context(), jobID)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取后台任务失败")
+		return
+	}
+	c.Header("Location", apiPrefix+"/jobs/"+strconv.FormatInt(jobID, 10))
+	c.JSON(http.StatusAccepted, jobStatusJSON(job, nil))
+}
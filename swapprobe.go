@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/store"
+)
+
+// 换 IP 直到可达：默认最多换 3 次、最多 10 次，第一次失败后等 30 秒再换，之后翻倍
+const (
+	defaultSwapAttempts = 3
+	maxSwapAttempts     = 10
+	defaultSwapBackoff  = 30 * time.Second
+)
+
+// swapJobParams 是换 IP 任务的可选参数，保存在 Job.Params。没有端口和检测地址时只换一次、不探测。
+type swapJobParams struct {
+	Ports       []int  `json:"ports,omitempty"`
+	CheckURL    string `json:"check_url,omitempty"`
+	MaxAttempts int    `json:"max_attempts,omitempty"`
+	// KeepOldMinutes 大于 0 时旧静态 IP 只解绑不释放，期间可回滚，到期自动释放
+	KeepOldMinutes int `json:"keep_old_minutes,omitempty"`
+	// 流量保护提交的任务带有策略 ID，用作旧地址的释放原因
+	TransferGuardID int64 `json:"transfer_guard_id,omitempty"`
+}
+
+func (p swapJobParams) probe() aws.ProbeSpec {
+	return aws.ProbeSpec{Ports: p.Ports, CheckURL: p.CheckURL}
+}
+
+// encode 在不需要探测、也不保留旧 IP 时返回空，保持与普通换 IP 任务一致。
+func (p swapJobParams) encode() (string, error) {
+	if !p.probe().Enabled() && p.KeepOldMinutes == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+// parseSwapJobParams 解析网页表单或 API 查询参数中的探测与保留旧 IP 设置。
+func parseSwapJobParams(ports, checkURL, maxAttempts, keepOldMinutes string) (swapJobParams, error) {
+	var p swapJobParams
+	var err error
+	if p.Ports, err = aws.ParsePorts(ports); err != nil {
+		return p, err
+	}
+	p.CheckURL = strings.TrimSpace(checkURL)
+	if p.CheckURL != "" {
+		if err := aws.ValidateCheckURL(p.CheckURL); err != nil {
+			return p, err
+		}
+	}
+	if s := strings.TrimSpace(keepOldMinutes); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > maxKeepOldMinutes {
+			return p, fmt.Errorf("旧 IP 保留时间需在 0-%d 分钟之间", maxKeepOldMinutes)
+		}
+		p.KeepOldMinutes = n
+	}
+	if !p.probe().Enabled() {
+		return swapJobParams{KeepOldMinutes: p.KeepOldMinutes}, nil
+	}
+	p.MaxAttempts = defaultSwapAttempts
+	if s := strings.TrimSpace(maxAttempts); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSwapAttempts {
+			return p, fmt.Errorf("尝试次数需在 1-%d 之间", maxSwapAttempts)
+		}
+		p.MaxAttempts = n
+	}
+	return p, nil
+}
+
+// runSwapJob 更换静态 IP；设置了探测时换到新地址可达为止，每个换到的 IP 写入任务步骤和 swap_attempts。
+// 申请到密钥黑名单中的地址会立即释放重申，换下和拒绝的地址都写入 ip_history。
+// 无论探测结果如何，实例最终使用的 IP 都会同步到外部 DNS。
+func runSwapJob(ctx context.Context, job *store.Job, report func(string)) error {
+	var p swapJobParams
+	if job.Params != "" {
+		if err := json.Unmarshal([]byte(job.Params), &p); err != nil {
+			return fmt.Errorf("任务参数无效：%w", err)
+		}
+	}
+	reason := ipReleaseSwap
+	if p.TransferGuardID > 0 {
+		reason = ipReleaseTransferGuard
+	}
+	blocked, err := blockedIPFunc(ctx, job.KeyID)
+	if err != nil {
+		return err
+	}
+	swapOpt := aws.SwapOptions{Blocked: blocked, KeepOld: p.KeepOldMinutes > 0}
+	return runLightsailJob(ctx, job, report, func(ctx context.Context, cli aws.LightsailAPI, name string) error {
+		// 换 IP 成功但旧静态 IP 没能释放的，任务最后标记为失败，提醒到遗留资源页处理
+		var releaseErrs []error
+		onSwap := func(res aws.SwapResult, err error) {
+			if res.ReleaseErr != nil {
+				report(fmt.Sprintf("旧静态IP %s 未能释放：%v", res.OldName, res.ReleaseErr))
+				releaseErrs = append(releaseErrs, fmt.Errorf("%s：%w", res.OldName, res.ReleaseErr))
+			}
+			// 换 IP 失败但旧 IP 没能绑回去时同样要记录保留，否则旧 IP 不会到期释放
+			if res.Kept {
+				holdOldStaticIP(ctx, job, name, res, time.Now().Add(time.Duration(p.KeepOldMinutes)*time.Minute), report)
+				recordSwapHistory(ctx, job, name, res, err, fmt.Sprintf("%s（保留 %d 分钟可回滚）", reason, p.KeepOldMinutes))
+				return
+			}
+			recordSwapHistory(ctx, job, name, res, err, reason)
+		}
+		var swapErr error
+		if probe := p.probe(); probe.Enabled() {
+			_, swapErr = aws.SwapStaticIPUntilHealthy(ctx, cli, name, aws.SwapUntilHealthyOptions{
+				MaxAttempts: p.MaxAttempts,
+				Backoff:     defaultSwapBackoff,
+				Probe:       probe,
+				Swap:        swapOpt,
+				OnSwap:      onSwap,
+				OnAttempt: func(a aws.SwapAttempt) {
+					state := "不可达"
+					if a.OK {
+						state = "可达"
+					} else {
+						// 下一次换 IP 释放的就是这个不可达的地址
+						reason = ipReleaseUnreachable + "：" + a.Detail
+					}
+					report(fmt.Sprintf("第 %d 次：%s %s（%s）", a.Attempt, a.IP, state, a.Detail))
+					rec := &store.SwapAttempt{
+						JobID:     job.ID,
+						UserID:    job.UserID,
+						KeyID:     job.KeyID,
+						Region:    job.Region,
+						Instance:  name,
+						Attempt:   a.Attempt,
+						IP:        a.IP,
+						OK:        a.OK,
+						Detail:    a.Detail,
+						CreatedAt: a.At,
+					}
+					if err := appStore.RecordSwapAttempt(context.Background(), rec); err != nil {
+						log.Printf("record swap attempt failed: %v", err)
+					}
+				},
+			})
+			// 全部不可达时实例仍保留最后一次换到的 IP，DNS 照常指向它
+			if swapErr != nil && !errors.Is(swapErr, aws.ErrSwapUnhealthy) {
+				return swapErr
+			}
+		} else {
+			res, err := aws.SwapStaticIP(ctx, cli, name, swapOpt)
+			onSwap(res, err)
+			if err != nil {
+				return err
+			}
+		}
+		if err := syncJobDNS(ctx, job, report); err != nil {
+			if swapErr != nil {
+				return fmt.Errorf("%w；外部 DNS 更新失败：%v", swapErr, err)
+			}
+			return fmt.Errorf("静态 IP 已更换，但外部 DNS 更新失败：%w", err)
+		}
+		if len(releaseErrs) > 0 {
+			return errors.Join(swapErr, fmt.Errorf("旧静态 IP 未能释放，仍在计费，请在遗留资源页处理：%w", errors.Join(releaseErrs...)))
+		}
+		return swapErr
+	})
+}
+
+// apiSwapAttempt 是一个换到过的 IP 及其探测结果。
+type apiSwapAttempt struct {
+	ID        int64     `json:"id"`
+	JobID     int64     `json:"job_id"`
+	Attempt   int       `json:"attempt"`
+	IP        string    `json:"ip"`
+	OK        bool      `json:"ok"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func apiSwapLightsailStaticIP(c *gin.Context) {
+	p, err := parseSwapJobParams(c.Query("ports"), c.Query("check_url"), c.Query("max_attempts"), c.Query("keep_old_minutes"))
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	params, err := p.encode()
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "提交后台任务失败")
+		return
+	}
+	apiEnqueueLightsailJobWithParams(c, jobKindSwapIP, params)
+}
+
+func apiListSwapAttempts(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	region := apiRegion(c, "")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	list, err := appStore.ListSwapAttempts(c.Request.Context(), apiUserID(c), region, name, limit)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取换 IP 记录失败")
+		return
+	}
+	out := make([]apiSwapAttempt, 0, len(list))
+	for _, a := range list {
+		out = append(out, apiSwapAttempt{ID: a.ID, JobID: a.JobID, Attempt: a.Attempt, IP: a.IP, OK: a.OK, Detail: a.Detail, CreatedAt: a.CreatedAt})
+	}
+	c.JSON(http.StatusOK, out)
+}
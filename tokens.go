@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+var tokenScopeOptions = []Option{
+	{ID: store.TokenScopeRead, Name: "只读（仅 GET 请求）"},
+	{ID: store.TokenScopeOperate, Name: "操作（创建/管理实例）"},
+	{ID: store.TokenScopeAdmin, Name: "管理（含 token 与管理员接口）"},
+}
+
+// bearerAuthMiddleware 接受 `Authorization: Bearer <token>` 作为会话 cookie 的替代。
+// 验证通过后为本次请求创建一个临时会话，后续的会话、CSRF 中间件会跳过该请求。
+func bearerAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := strings.TrimSpace(c.GetHeader("Authorization"))
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+			c.Next()
+			return
+		}
+		t, err := appStore.LookupAPIToken(c.Request.Context(), auth[7:])
+		if err != nil {
+			if !errors.Is(err, store.ErrTokenNotFound) {
+				auditError(c, err)
+			}
+			apiFail(c, http.StatusUnauthorized, "invalid_token", "API token 无效或已吊销")
+			return
+		}
+		if !tokenAllows(t.Scope, c.Request.Method, c.Request.URL.Path) {
+			apiFail(c, http.StatusForbidden, "insufficient_scope", "API token 权限不足（"+t.Scope+"）")
+			return
+		}
+		if err := appStore.TouchAPIToken(c.Request.Context(), t.ID, c.ClientIP()); err != nil {
+			auditError(c, err)
+		}
+
+		s := session.New()
+		s.SetString("user_id", strconv.FormatInt(t.UserID, 10))
+		s.SetString("username", t.Username)
+		// 管理员权限需要用户本身是管理员，且 token 为 admin 范围
+		if t.IsAdmin && t.Scope == store.TokenScopeAdmin {
+			s.SetString("is_admin", "1")
+		}
+		c.Set("sess", s)
+		c.Set("api_token", t)
+		c.Next()
+	}
+}
+
+func isTokenRequest(c *gin.Context) bool {
+	_, ok := c.Get("api_token")
+	return ok
+}
+
+// tokenAllows：read 只能发 GET；operate 可以操作实例但不能管理 token 和访问管理员接口；admin 不限制。
+func tokenAllows(scope, method, path string) bool {
+	if scope == store.TokenScopeAdmin {
+		return true
+	}
+	if strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/tokens") || strings.HasPrefix(path, "/auth/tokens") || strings.HasPrefix(path, apiPrefix+"/tokens") || strings.HasPrefix(path, apiPrefix+"/admin/") {
+		return false
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return true
+	}
+	return scope == store.TokenScopeOperate
+}
+
+func tokenScopeLabel(scope string) string {
+	for _, o := range tokenScopeOptions {
+		if o.ID == scope {
+			return o.Name
+		}
+	}
+	return scope
+}
+
+type TokensPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+
+	Tokens   []store.APIToken
+	Scopes   []Option
+	NewToken string
+	Flash    Flash
+}
+
+// renderTokensPage 渲染 token 列表；newToken 不为空时一并展示刚创建的明文 token。
+func renderTokensPage(c *gin.Context, newToken string) {
+	s := session.Must(c)
+	userID, _ := userIDFromSession(s)
+	list, err := appStore.ListAPITokens(c.Request.Context(), userID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "load tokens failed: %v", err)
+		return
+	}
+	data := TokensPageData{
+		Title:     "AutoSail API Token",
+		CSRFToken: s.GetString("csrf_token", ""),
+		Username:  s.GetString("username", ""),
+		Tokens:    list,
+		Scopes:    tokenScopeOptions,
+		NewToken:  newToken,
+	}
+	switch c.Query("msg") {
+	case "revoked":
+		data.Flash.Success = "已吊销 token"
+	case "token_failed":
+		data.Flash.Error = "操作失败（详情看日志）"
+	case "needscope":
+		data.Flash.Warn = "请选择有效的权限范围"
+	}
+	c.HTML(http.StatusOK, "tokens", data)
+}
+
+func registerTokenRoutes(r *gin.Engine) {
+	r.GET("/tokens", func(c *gin.Context) {
+		renderTokensPage(c, "")
+	})
+
+	r.POST("/auth/tokens/create", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		name := strings.TrimSpace(c.PostForm("name"))
+		if name == "" {
+			name = "token"
+		}
+		scope := strings.TrimSpace(c.PostForm("scope"))
+		if !store.ValidTokenScope(scope) {
+			c.Redirect(http.StatusFound, "/tokens?msg=needscope")
+			return
+		}
+		raw, _, err := appStore.CreateAPIToken(c.Request.Context(), userID, name, scope)
+		if err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/tokens?msg=token_failed")
+			return
+		}
+		// 新 token 只在本次响应中展示一次，不写入会话（会话可能持久化到数据库）
+		c.Header("Cache-Control", "no-store")
+		renderTokensPage(c, raw)
+	})
+
+	r.POST("/auth/tokens/revoke", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		id, err := strconv.ParseInt(strings.TrimSpace(c.PostForm("token_id")), 10, 64)
+		if err != nil {
+			c.Redirect(http.StatusFound, "/tokens")
+			return
+		}
+		if err := appStore.RevokeAPIToken(c.Request.Context(), userID, id); err != nil {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/tokens?msg=token_failed")
+			return
+		}
+		c.Redirect(http.StatusFound, "/tokens?msg=revoked")
+	})
+}
+
+type apiTokenView struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	Revoked    bool       `json:"revoked"`
+}
+
+type apiTokenInput struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope" binding:"required"`
+}
+
+type apiTokenCreated struct {
+	apiTokenView
+	Token string `json:"token"`
+}
+
+func toAPITokenView(t *store.APIToken) apiTokenView {
+	v := apiTokenView{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scope:      t.Scope,
+		CreatedAt:  t.CreatedAt,
+		LastUsedIP: t.LastUsedIP,
+		Revoked:    t.Revoked(),
+	}
+	if !t.LastUsedAt.IsZero() {
+		used := t.LastUsedAt
+		v.LastUsedAt = &used
+	}
+	return v
+}
+
+func apiListTokens(c *gin.Context) {
+	list, err := appStore.ListAPITokens(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取 token 失败")
+		return
+	}
+	out := make([]apiTokenView, 0, len(list))
+	for i := range list {
+		out = append(out, toAPITokenView(&list[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateToken(c *gin.Context) {
+	var in apiTokenInput
+	if !apiBind(c, &in) {
+		return
+	}
+	if !store.ValidTokenScope(in.Scope) {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "scope 必须是 read / operate / admin")
+		return
+	}
+	raw, t, err := appStore.CreateAPIToken(c.Request.Context(), apiUserID(c), firstNonEmpty(in.Name, "token"), in.Scope)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "创建 token 失败")
+		return
+	}
+	c.JSON(http.StatusCreated, apiTokenCreated{apiTokenView: toAPITokenView(t), Token: raw})
+}
+
+func apiRevokeToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "token ID 无效")
+		return
+	}
+	if err := appStore.RevokeAPIToken(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, store.ErrTokenNotFound) {
+			apiFail(c, http.StatusNotFound, "token_not_found", "token 不存在或已吊销")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "吊销 token 失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/store"
+)
+
+// 流量按小时聚合，半小时刷新一次足够
+const transferCacheTTL = 30 * time.Minute
+
+// 同时查询流量的实例数，实例多时避免 GetInstanceMetricData 被限流
+const transferFetchConcurrency = 4
+
+// cachedInstances 读取 instCache 中的实例列表，未命中时向 AWS 拉取并写回。
+func cachedInstances(ctx context.Context, cli aws.LightsailAPI, region string, key *store.Key) ([]aws.InstanceView, error) {
+	cacheKey := instCacheKey("inst", region, key)
+	if v, ok := instCache.Get(cacheKey); ok {
+		return v.([]aws.InstanceView), nil
+	}
+	list, err := aws.ListInstances(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	instCache.Set(cacheKey, list, cache.DefaultExpiration)
+	return list, nil
+}
+
+// transferUsageFor 计算实例列表中每个实例本月的流量使用情况，按实例名返回。
+// 单个实例查询失败时跳过该实例，只有全部失败才返回错误。
+func transferUsageFor(ctx context.Context, cli aws.LightsailAPI, region string, key *store.Key, instances []aws.InstanceView) (map[string]aws.TransferUsage, error) {
+	cat, err := lightsailCatalog(ctx, region, func() (aws.LightsailAPI, error) { return cli, nil })
+	if err != nil {
+		return nil, err
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		lastErr error
+		out     = make(map[string]aws.TransferUsage, len(instances))
+		sem     = make(chan struct{}, transferFetchConcurrency)
+	)
+	for _, ins := range instances {
+		bundle, ok := cat.Bundle(ins.BundleID)
+		if !ok {
+			continue
+		}
+		cacheKey := instCacheKey("transfer", region, key) + "|" + ins.Name
+		if v, ok := instCache.Get(cacheKey); ok {
+			mu.Lock()
+			out[ins.Name] = v.(aws.TransferUsage)
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(name string, allowance int32) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			u, err := aws.GetMonthTransfer(ctx, cli, name, allowance, time.Now())
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			instCache.Set(cacheKey, u, transferCacheTTL)
+			out[name] = u
+		}(ins.Name, bundle.TransferGB)
+	}
+	wg.Wait()
+	if len(out) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return out, nil
+}
+
+type apiTransferUsage struct {
+	Name string `json:"name"`
+	aws.TransferUsage
+}
+
+func apiListLightsailTransfer(c *gin.Context) {
+	region := apiRegion(c, "")
+	cli, key, ok := apiLightsailClient(c, region)
+	if !ok {
+		return
+	}
+	list, err := cachedInstances(c.Request.Context(), cli, region, key)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	usage, err := transferUsageFor(c.Request.Context(), cli, region, key, list)
+	if err != nil {
+		apiAWSFail(c, err)
+		return
+	}
+	out := make([]apiTransferUsage, 0, len(usage))
+	for _, ins := range list {
+		if u, ok := usage[ins.Name]; ok {
+			out = append(out, apiTransferUsage{Name: ins.Name, TransferUsage: u})
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
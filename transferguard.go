@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aws-lightsail-go/internal/aws"
+	"aws-lightsail-go/internal/jobs"
+	"aws-lightsail-go/internal/session"
+	"aws-lightsail-go/internal/store"
+)
+
+const (
+	// 月初头一天的数据太少，按月底预估判断容易误触发
+	transferGuardMinElapsed = 24 * time.Hour
+	// 认领后超过这个时间仍没有结果的触发记录视为中断，可以重新认领
+	transferGuardStaleClaim = jobs.DefaultTimeout + 10*time.Minute
+)
+
+var transferGuardActionText = map[string]string{
+	store.TransferGuardActionNotify: "通知",
+	store.TransferGuardActionStop:   "停止实例",
+	store.TransferGuardActionSwapIP: "更换静态 IP",
+}
+
+var transferGuardBasisText = map[string]string{
+	store.TransferGuardBasisActual:    "已用出站流量",
+	store.TransferGuardBasisProjected: "月底预估出站流量",
+}
+
+// transferGuardPercent 返回策略关注的出站流量占套餐配额的百分比；没有配额或月初预估数据不足时返回 0。
+// 按已用流量判断时只看实际取到的数据：月初数据超出保留期后 OutGB 是推算值，不能据此停机或换 IP。
+func transferGuardPercent(basis string, u aws.TransferUsage, now time.Time) float64 {
+	if u.AllowanceGB <= 0 {
+		return 0
+	}
+	out := u.ObservedOutGB
+	if basis == store.TransferGuardBasisProjected {
+		now = now.UTC()
+		if now.Sub(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)) < transferGuardMinElapsed {
+			return 0
+		}
+		out = u.ProjectedOutGB
+	}
+	return out / float64(u.AllowanceGB) * 100
+}
+
+// startTransferGuard 按 TRANSFER_GUARD_INTERVAL（分钟，默认 30）定期评估所有流量保护策略，0 表示关闭。
+func startTransferGuard(ctx context.Context) {
+	minutes := mustEnvInt("TRANSFER_GUARD_INTERVAL", 30)
+	if minutes <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+		defer ticker.Stop()
+		for {
+			evaluateTransferGuards(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type transferGuardScope struct {
+	userID int64
+	keyID  int64
+	region string
+}
+
+// evaluateTransferGuards 按（用户, 密钥, 区域）分组拉取流量用量，同一组内的实例只查询一次。
+func evaluateTransferGuards(ctx context.Context, now time.Time) {
+	guards, err := appStore.ListTransferGuards(ctx, 0)
+	if err != nil {
+		log.Printf("transfer guard: list guards failed: %v", err)
+		return
+	}
+	groups := map[transferGuardScope][]store.TransferGuard{}
+	for _, g := range guards {
+		sc := transferGuardScope{userID: g.UserID, keyID: g.KeyID, region: g.Region}
+		groups[sc] = append(groups[sc], g)
+	}
+	for sc, list := range groups {
+		if err := evaluateTransferGuardScope(ctx, sc, list, now); err != nil {
+			log.Printf("transfer guard: user %d key %d %s: %v", sc.userID, sc.keyID, sc.region, err)
+		}
+	}
+}
+
+func evaluateTransferGuardScope(ctx context.Context, sc transferGuardScope, guards []store.TransferGuard, now time.Time) error {
+	keys, err := appStore.ListKeys(ctx, sc.userID)
+	if err != nil {
+		return err
+	}
+	key := findKeyByID(keys, sc.keyID)
+	if key == nil {
+		return errors.New("策略使用的密钥已被删除")
+	}
+	cli, err := aws.NewLightsailClient(ctx, sc.region, strings.TrimSpace(key.AccessKey), strings.TrimSpace(key.SecretKey), strings.TrimSpace(key.Proxy))
+	if err != nil {
+		return err
+	}
+	instances, err := cachedInstances(ctx, cli, sc.region, key)
+	if err != nil {
+		return err
+	}
+	usage, err := transferUsageFor(ctx, cli, sc.region, key, instances)
+	if err != nil {
+		return err
+	}
+	for _, g := range guards {
+		for _, ins := range instances {
+			if g.Instance != "" && g.Instance != ins.Name {
+				continue
+			}
+			// 已停止的实例不再重复停止或换 IP，只保留通知
+			if g.Action != store.TransferGuardActionNotify && ins.State != "running" {
+				continue
+			}
+			u, ok := usage[ins.Name]
+			if !ok {
+				continue
+			}
+			if pct := transferGuardPercent(g.Basis, u, now); pct >= float64(g.Threshold) {
+				fireTransferGuard(ctx, g, ins.Name, pct, now)
+			}
+		}
+	}
+	return nil
+}
+
+// fireTransferGuard 先写入触发记录（本月已成功触发过则跳过），再执行动作并回写结果；
+// 停机、换 IP 的结果在任务结束时由 finishTransferGuardJob 回写。动作失败时记录为 failed，下一次检查仍超过阈值会重试。
+func fireTransferGuard(ctx context.Context, g store.TransferGuard, instance string, pct float64, now time.Time) {
+	ev := &store.TransferGuardEvent{
+		GuardID:  g.ID,
+		UserID:   g.UserID,
+		Region:   g.Region,
+		Instance: instance,
+		Period:   now.UTC().Format("2006-01"),
+		Percent:  pct,
+		Action:   g.Action,
+	}
+	claimed, err := appStore.ClaimTransferGuardEvent(ctx, ev, time.Now().Add(-transferGuardStaleClaim))
+	if err != nil {
+		log.Printf("transfer guard %d: record event failed: %v", g.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	log.Printf("transfer guard %d: %s %s at %.1f%% (threshold %d%%), action %s", g.ID, g.Region, instance, pct, g.Threshold, g.Action)
+
+	var jobID int64
+	switch g.Action {
+	case store.TransferGuardActionStop, store.TransferGuardActionSwapIP:
+		kind := jobKindStop
+		if g.Action == store.TransferGuardActionSwapIP {
+			kind = jobKindSwapIP
+		}
+		jobID, err = jobRunner.Enqueue(ctx, store.Job{
+			UserID: g.UserID,
+			KeyID:  g.KeyID,
+			Kind:   kind,
+			Region: g.Region,
+			Target: instance,
+			Params: fmt.Sprintf(`{"transfer_guard_id":%d}`, g.ID),
+		})
+	default:
+		err = notifyTransferGuard(ctx, g, ev)
+	}
+
+	result, errText := store.TransferGuardResultOK, ""
+	if err != nil {
+		result, errText = store.TransferGuardResultFailed, err.Error()
+	}
+	var e error
+	if err == nil && jobID != 0 {
+		e = appStore.SetTransferGuardEventJob(ctx, ev.ID, jobID)
+	} else {
+		e = appStore.FinishTransferGuardEvent(ctx, ev.ID, result, errText, jobID)
+	}
+	if e != nil {
+		log.Printf("transfer guard %d: finish event failed: %v", g.ID, e)
+	}
+	params, _ := json.Marshal(map[string]any{"guard_id": g.ID, "basis": g.Basis, "threshold": g.Threshold, "percent": pct, "job_id": jobID})
+	if e := appStore.RecordAudit(ctx, store.AuditEvent{
+		UserID:   g.UserID,
+		Username: lookupUsername(ctx, g.UserID),
+		KeyID:    g.KeyID,
+		Service:  "lightsail",
+		Region:   g.Region,
+		Instance: instance,
+		Action:   "transfer-guard:" + g.Action,
+		Params:   string(params),
+		Result:   result,
+		Error:    errText,
+	}); e != nil {
+		log.Printf("record audit event failed: %v", e)
+	}
+}
+
+// finishTransferGuardJob 把流量保护提交的停机、换 IP 任务的结果回写到触发记录，任务失败时下一次检查会重试。
+func finishTransferGuardJob(job *store.Job, err error) {
+	var p struct {
+		TransferGuardID int64 `json:"transfer_guard_id"`
+	}
+	if job.Params == "" || json.Unmarshal([]byte(job.Params), &p) != nil || p.TransferGuardID == 0 {
+		return
+	}
+	result, errText := store.TransferGuardResultOK, ""
+	if err != nil {
+		result, errText = store.TransferGuardResultFailed, err.Error()
+	}
+	if e := appStore.FinishTransferGuardJob(context.Background(), job.ID, result, errText); e != nil {
+		log.Printf("transfer guard %d: finish event for job %d failed: %v", p.TransferGuardID, job.ID, e)
+	}
+}
+
+type transferGuardNotice struct {
+	GuardID   int64   `json:"guard_id"`
+	UserID    int64   `json:"user_id"`
+	Region    string  `json:"region"`
+	Instance  string  `json:"instance"`
+	Basis     string  `json:"basis"`
+	Threshold int     `json:"threshold"`
+	Percent   float64 `json:"percent"`
+	Period    string  `json:"period"`
+}
+
+// notifyTransferGuard 把触发记录 POST 到 TRANSFER_GUARD_WEBHOOK；未配置时只记录在触发历史和审计日志里。
+func notifyTransferGuard(ctx context.Context, g store.TransferGuard, ev *store.TransferGuardEvent) error {
+	hook := strings.TrimSpace(os.Getenv("TRANSFER_GUARD_WEBHOOK"))
+	if hook == "" {
+		return nil
+	}
+	body, _ := json.Marshal(transferGuardNotice{
+		GuardID:   g.ID,
+		UserID:    g.UserID,
+		Region:    ev.Region,
+		Instance:  ev.Instance,
+		Basis:     g.Basis,
+		Threshold: g.Threshold,
+		Percent:   ev.Percent,
+		Period:    ev.Period,
+	})
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook 返回 %s", resp.Status)
+	}
+	return nil
+}
+
+type TransferGuardView struct {
+	store.TransferGuard
+	KeyName    string
+	BasisText  string
+	ActionText string
+}
+
+type TransferGuardsPageData struct {
+	Title     string
+	CSRFToken string
+	Username  string
+	Flash     Flash
+
+	Region  string
+	Regions []RegionOption
+	KeyName string
+	Guards  []TransferGuardView
+	Events  []store.TransferGuardEvent
+}
+
+func transferGuardViews(guards []store.TransferGuard, keys []store.Key) []TransferGuardView {
+	out := make([]TransferGuardView, 0, len(guards))
+	for _, g := range guards {
+		v := TransferGuardView{TransferGuard: g, BasisText: transferGuardBasisText[g.Basis], ActionText: transferGuardActionText[g.Action]}
+		if k := findKeyByID(keys, g.KeyID); k != nil {
+			v.KeyName = k.Name
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func registerTransferGuardRoutes(r *gin.Engine) {
+	r.GET("/transfer-guards", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		ctx := c.Request.Context()
+		keys, _ := appStore.ListKeys(ctx, userID)
+		data := TransferGuardsPageData{
+			Title:     "AutoSail 流量保护",
+			CSRFToken: s.GetString("csrf_token", ""),
+			Username:  s.GetString("username", ""),
+			Region:    normalizeRegion(s.GetString("region", "us-east-1")),
+		}
+		key, _ := resolveActiveKey(s, keys)
+		if key != nil {
+			data.KeyName = key.Name
+		}
+		// 区域按当前密钥实时查询，查询失败时退回内置列表
+		regions, err := discoverRegions(ctx, "lightsail", key)
+		if err != nil {
+			data.Flash.Warn = "拉取区域列表失败，使用内置列表：" + formatFlashError(err)
+			regions = lightsailRegionOptions
+		}
+		data.Regions = regions
+		guards, err := appStore.ListTransferGuards(ctx, userID)
+		if err != nil {
+			data.Flash.Error = "读取流量保护策略失败：" + err.Error()
+		}
+		data.Guards = transferGuardViews(guards, keys)
+		data.Events, _ = appStore.ListTransferGuardEvents(ctx, userID, 50)
+		switch c.Query("msg") {
+		case "guard_saved":
+			data.Flash.Success = "已保存流量保护策略"
+		case "guard_deleted":
+			data.Flash.Success = "已删除流量保护策略"
+		case "guard_invalid":
+			data.Flash.Error = "策略参数无效：阈值需在 1-1000 之间"
+		case "needuse":
+			data.Flash.Warn = "请先在首页启用一个密钥，策略会绑定到当前启用的密钥"
+		case "guard_failed":
+			data.Flash.Error = "保存策略失败：" + strings.TrimSpace(c.Query("err"))
+		}
+		c.HTML(http.StatusOK, "transferguards", data)
+	})
+
+	r.POST("/aws/transfer-guards", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		keys, _ := appStore.ListKeys(c.Request.Context(), userID)
+		activeKey, _ := resolveActiveKey(s, keys)
+		if activeKey == nil {
+			c.Redirect(http.StatusFound, "/transfer-guards?msg=needuse")
+			return
+		}
+		threshold, _ := strconv.Atoi(strings.TrimSpace(c.PostForm("threshold")))
+		g := &store.TransferGuard{
+			UserID:    userID,
+			KeyID:     activeKey.ID,
+			Region:    normalizeRegion(c.PostForm("region")),
+			Instance:  c.PostForm("instance"),
+			Basis:     c.PostForm("basis"),
+			Threshold: threshold,
+			Action:    c.PostForm("action"),
+		}
+		if err := appStore.CreateTransferGuard(c.Request.Context(), g); err != nil {
+			if errors.Is(err, store.ErrInvalidTransferGuard) {
+				c.Redirect(http.StatusFound, "/transfer-guards?msg=guard_invalid")
+				return
+			}
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/transfer-guards?msg=guard_failed&err="+url.QueryEscape(formatFlashError(err)))
+			return
+		}
+		c.Redirect(http.StatusFound, "/transfer-guards?msg=guard_saved")
+	})
+
+	r.POST("/aws/transfer-guards/delete", func(c *gin.Context) {
+		s := session.Must(c)
+		userID, _ := userIDFromSession(s)
+		id, err := strconv.ParseInt(strings.TrimSpace(c.PostForm("guard_id")), 10, 64)
+		if err != nil {
+			c.Redirect(http.StatusFound, "/transfer-guards")
+			return
+		}
+		if err := appStore.DeleteTransferGuard(c.Request.Context(), userID, id); err != nil && !errors.Is(err, store.ErrTransferGuardNotFound) {
+			auditError(c, err)
+			c.Redirect(http.StatusFound, "/transfer-guards?msg=guard_failed&err="+url.QueryEscape(formatFlashError(err)))
+			return
+		}
+		c.Redirect(http.StatusFound, "/transfer-guards?msg=guard_deleted")
+	})
+}
+
+type apiTransferGuard struct {
+	ID        int64     `json:"id"`
+	KeyID     int64     `json:"key_id"`
+	Region    string    `json:"region"`
+	Instance  string    `json:"instance"` // 空表示该区域内所有实例
+	Basis     string    `json:"basis"`
+	Threshold int       `json:"threshold"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type apiTransferGuardInput struct {
+	Region    string `json:"region" binding:"required"`
+	Instance  string `json:"instance,omitempty"`           // 留空对区域内所有实例生效
+	Basis     string `json:"basis" binding:"required"`     // actual 或 projected
+	Threshold int    `json:"threshold" binding:"required"` // 占套餐配额的百分比
+	Action    string `json:"action" binding:"required"`    // notify、stop 或 swapip
+}
+
+type apiTransferGuardEvent struct {
+	ID        int64     `json:"id"`
+	GuardID   int64     `json:"guard_id"`
+	Region    string    `json:"region"`
+	Instance  string    `json:"instance"`
+	Period    string    `json:"period"`
+	Percent   float64   `json:"percent"`
+	Action    string    `json:"action"`
+	Result    string    `json:"result"` // ok 或 failed；停机、换 IP 的任务结束前为空
+	Error     string    `json:"error,omitempty"`
+	JobID     int64     `json:"job_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toAPITransferGuard(g *store.TransferGuard) apiTransferGuard {
+	return apiTransferGuard{ID: g.ID, KeyID: g.KeyID, Region: g.Region, Instance: g.Instance, Basis: g.Basis, Threshold: g.Threshold, Action: g.Action, CreatedAt: g.CreatedAt}
+}
+
+func apiListTransferGuards(c *gin.Context) {
+	list, err := appStore.ListTransferGuards(c.Request.Context(), apiUserID(c))
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取流量保护策略失败")
+		return
+	}
+	out := make([]apiTransferGuard, 0, len(list))
+	for i := range list {
+		out = append(out, toAPITransferGuard(&list[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func apiCreateTransferGuard(c *gin.Context) {
+	var in apiTransferGuardInput
+	if !apiBind(c, &in) {
+		return
+	}
+	key, ok := apiKey(c)
+	if !ok {
+		return
+	}
+	g := &store.TransferGuard{
+		UserID:    apiUserID(c),
+		KeyID:     key.ID,
+		Region:    normalizeRegion(in.Region),
+		Instance:  in.Instance,
+		Basis:     in.Basis,
+		Threshold: in.Threshold,
+		Action:    in.Action,
+	}
+	c.Set("audit_region", g.Region)
+	c.Set("audit_instance", strings.TrimSpace(g.Instance))
+	if err := appStore.CreateTransferGuard(c.Request.Context(), g); err != nil {
+		if errors.Is(err, store.ErrInvalidTransferGuard) {
+			apiFail(c, http.StatusBadRequest, "invalid_request", "basis 需为 actual / projected，action 需为 notify / stop / swapip，threshold 需在 1-1000 之间")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "保存流量保护策略失败")
+		return
+	}
+	c.JSON(http.StatusCreated, toAPITransferGuard(g))
+}
+
+func apiDeleteTransferGuard(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "invalid_request", "策略 ID 无效")
+		return
+	}
+	if err := appStore.DeleteTransferGuard(c.Request.Context(), apiUserID(c), id); err != nil {
+		if errors.Is(err, store.ErrTransferGuardNotFound) {
+			apiFail(c, http.StatusNotFound, "guard_not_found", "策略不存在")
+			return
+		}
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "删除流量保护策略失败")
+		return
+	}
+	c.JSON(http.StatusOK, apiDeleted{Deleted: true})
+}
+
+func apiListTransferGuardEvents(c *gin.Context) {
+	list, err := appStore.ListTransferGuardEvents(c.Request.Context(), apiUserID(c), 100)
+	if err != nil {
+		auditError(c, err)
+		apiFail(c, http.StatusInternalServerError, "internal", "读取触发记录失败")
+		return
+	}
+	out := make([]apiTransferGuardEvent, 0, len(list))
+	for _, e := range list {
+		out = append(out, apiTransferGuardEvent{
+			ID:        e.ID,
+			GuardID:   e.GuardID,
+			Region:    e.Region,
+			Instance:  e.Instance,
+			Period:    e.Period,
+			Percent:   e.Percent,
+			Action:    e.Action,
+			Result:    e.Result,
+			Error:     e.Error,
+			JobID:     e.JobID,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}